@@ -0,0 +1,500 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Gskartwii/roblox-dissector/datamodel"
+	"github.com/Gskartwii/roblox-dissector/filter"
+	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/olebedev/emitter"
+	"github.com/yuin/gopher-lua"
+)
+
+const (
+	COL_HELD_ID = iota
+	COL_HELD_DIRECTION
+	COL_HELD_PACKET
+)
+
+const (
+	COL_FIELD_NAME = iota
+	COL_FIELD_VALUE
+	COL_FIELD_EDITABLE
+)
+
+// maxFieldDepth limits how deep the field editor walks into a packet
+const maxFieldDepth = 12
+
+var instanceType = reflect.TypeOf((*datamodel.Instance)(nil))
+
+// BreakpointViewer holds proxied packets that match a breakpoint filter
+// and allows them to be edited before they are released or dropped.
+type BreakpointViewer struct {
+	mainWidget *gtk.Box
+
+	heldView  *gtk.TreeView
+	heldModel *gtk.ListStore
+	held      map[int]*peer.HeldPacket
+	heldRows  map[int]*gtk.TreeIter
+	heldIndex int
+
+	fieldModel  *gtk.TreeStore
+	fieldValues map[string]reflect.Value
+	selected    int
+
+	filterLock   sync.Mutex
+	enabled      bool
+	FilterScript string
+	filter       *lua.FunctionProto
+	filterState  *lua.LState
+
+	FilterLogWindow *FilterLogWindow
+}
+
+func NewBreakpointViewer() (*BreakpointViewer, error) {
+	viewer := &BreakpointViewer{
+		held:        make(map[int]*peer.HeldPacket),
+		heldRows:    make(map[int]*gtk.TreeIter),
+		fieldValues: make(map[string]reflect.Value),
+		selected:    -1,
+	}
+
+	box, err := boxWithMargin()
+	if err != nil {
+		return nil, err
+	}
+
+	controlRow, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 4)
+	if err != nil {
+		return nil, err
+	}
+	enableButton, err := gtk.CheckButtonNewWithLabel("Hold matching packets")
+	if err != nil {
+		return nil, err
+	}
+	enableButton.Connect("toggled", func() {
+		viewer.filterLock.Lock()
+		viewer.enabled = enableButton.GetActive()
+		viewer.filterLock.Unlock()
+	})
+	controlRow.Add(enableButton)
+	filterButton, err := gtk.ButtonNewWithLabel("Breakpoint filter...")
+	if err != nil {
+		return nil, err
+	}
+	filterButton.Connect("clicked", func() {
+		err := NewEditFilterWindow(viewer.FilterScript, viewer.ApplyFilter)
+		if err != nil {
+			ShowError(viewer.mainWidget, err, "Failed to open filter window")
+		}
+	})
+	controlRow.Add(filterButton)
+	box.Add(controlRow)
+
+	heldModel, err := gtk.ListStoreNew(
+		glib.TYPE_INT,    // id
+		glib.TYPE_STRING, // direction
+		glib.TYPE_STRING, // packet
+	)
+	if err != nil {
+		return nil, err
+	}
+	heldView, err := gtk.TreeViewNewWithModel(heldModel)
+	if err != nil {
+		return nil, err
+	}
+	renderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		return nil, err
+	}
+	for i, title := range []string{"ID", "Direction", "Packet"} {
+		col, err := gtk.TreeViewColumnNewWithAttribute(title, renderer, "text", i)
+		if err != nil {
+			return nil, err
+		}
+		heldView.AppendColumn(col)
+	}
+	sel, err := heldView.GetSelection()
+	if err != nil {
+		return nil, err
+	}
+	sel.SetMode(gtk.SELECTION_SINGLE)
+	sel.Connect("changed", func(selection *gtk.TreeSelection) {
+		viewer.selectionChanged(selection)
+	})
+	heldScrolled, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	heldScrolled.SetVExpand(true)
+	heldScrolled.Add(heldView)
+	box.Add(heldScrolled)
+
+	fieldModel, err := gtk.TreeStoreNew(
+		glib.TYPE_STRING,  // name
+		glib.TYPE_STRING,  // value
+		glib.TYPE_BOOLEAN, // editable
+	)
+	if err != nil {
+		return nil, err
+	}
+	fieldView, err := gtk.TreeViewNewWithModel(fieldModel)
+	if err != nil {
+		return nil, err
+	}
+	nameRenderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		return nil, err
+	}
+	nameCol, err := gtk.TreeViewColumnNewWithAttribute("Field", nameRenderer, "text", COL_FIELD_NAME)
+	if err != nil {
+		return nil, err
+	}
+	fieldView.AppendColumn(nameCol)
+	valueRenderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		return nil, err
+	}
+	valueRenderer.Connect("edited", func(_ *gtk.CellRendererText, path string, text string) {
+		viewer.fieldEdited(path, text)
+	})
+	valueCol, err := gtk.TreeViewColumnNewWithAttribute("Value", valueRenderer, "text", COL_FIELD_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	valueCol.AddAttribute(valueRenderer, "editable", COL_FIELD_EDITABLE)
+	fieldView.AppendColumn(valueCol)
+	fieldScrolled, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	fieldScrolled.SetVExpand(true)
+	fieldScrolled.Add(fieldView)
+	box.Add(fieldScrolled)
+
+	buttonRow, err := gtk.ButtonBoxNew(gtk.ORIENTATION_HORIZONTAL)
+	if err != nil {
+		return nil, err
+	}
+	buttonRow.SetLayout(gtk.BUTTONBOX_END)
+	for _, button := range []struct {
+		label  string
+		action func()
+	}{
+		{"Drop all", func() { viewer.resolveAll(true) }},
+		{"Release all", func() { viewer.resolveAll(false) }},
+		{"Drop", func() { viewer.resolveSelected(true) }},
+		{"Release", func() { viewer.resolveSelected(false) }},
+	} {
+		action := button.action
+		gtkButton, err := gtk.ButtonNewWithLabel(button.label)
+		if err != nil {
+			return nil, err
+		}
+		gtkButton.Connect("clicked", func() {
+			action()
+		})
+		buttonRow.Add(gtkButton)
+	}
+	box.Add(buttonRow)
+
+	logWindow, err := NewFilterLogWindow("Breakpoint filter logs")
+	if err != nil {
+		return nil, err
+	}
+
+	viewer.mainWidget = box
+	viewer.heldView = heldView
+	viewer.heldModel = heldModel
+	viewer.fieldModel = fieldModel
+	viewer.FilterLogWindow = logWindow
+
+	return viewer, nil
+}
+
+// Bind makes the viewer intercept packets forwarded by the given proxy
+func (viewer *BreakpointViewer) Bind(proxy *peer.ProxyWriter) {
+	proxy.Intercept = viewer.Intercept
+	proxy.HoldEmitter.On("held", func(e *emitter.Event) {
+		held := e.Args[0].(*peer.HeldPacket)
+		glib.IdleAdd(func() bool {
+			viewer.addHeld(held)
+			return false
+		})
+	}, emitter.Void)
+}
+
+// Intercept reports whether the packet matches the breakpoint filter.
+// It is called from the proxy goroutine.
+func (viewer *BreakpointViewer) Intercept(layers *peer.PacketLayers) bool {
+	viewer.filterLock.Lock()
+	defer viewer.filterLock.Unlock()
+	if !viewer.enabled {
+		return false
+	}
+	// without a filter, every packet is a breakpoint
+	if viewer.filter == nil {
+		return true
+	}
+	acc, err := filter.FilterAcceptsPacket(viewer.filterState, viewer.filter, layers.Main)
+	if err != nil {
+		viewer.appendLog(fmt.Sprintf("Breakpoint filter error on packet %d: %s\n", layers.UniqueID, err.Error()))
+		return false
+	}
+	return acc
+}
+
+func (viewer *BreakpointViewer) ApplyFilter(script string) {
+	viewer.filterLock.Lock()
+	defer viewer.filterLock.Unlock()
+	viewer.FilterScript = script
+	if script == "" {
+		viewer.filter = nil
+		viewer.filterState = nil
+		return
+	}
+	compiled, err := filter.CompileFilter(script)
+	if err != nil {
+		ShowError(viewer.mainWidget, err, "Failed to compile breakpoint filter")
+		return
+	}
+	viewer.filter = compiled
+	viewer.filterState = filter.NewLuaFilterState(viewer.appendLog)
+}
+
+// appendLog may be called from the proxy goroutine
+func (viewer *BreakpointViewer) appendLog(text string) {
+	glib.IdleAdd(func() bool {
+		viewer.FilterLogWindow.AppendLog(text)
+		return false
+	})
+}
+
+func (viewer *BreakpointViewer) addHeld(held *peer.HeldPacket) {
+	id := viewer.heldIndex
+	viewer.heldIndex++
+	viewer.held[id] = held
+
+	direction := "Server -> Client"
+	if held.FromClient {
+		direction = "Client -> Server"
+	}
+	row := viewer.heldModel.Append()
+	viewer.heldModel.SetValue(row, COL_HELD_ID, id)
+	viewer.heldModel.SetValue(row, COL_HELD_DIRECTION, direction)
+	viewer.heldModel.SetValue(row, COL_HELD_PACKET, held.Layers.Main.String())
+	viewer.heldRows[id] = row
+}
+
+func (viewer *BreakpointViewer) resolve(id int, drop bool) {
+	held, ok := viewer.held[id]
+	if !ok {
+		return
+	}
+	var err error
+	if drop {
+		err = held.Drop()
+	} else {
+		err = held.Release()
+	}
+	if err != nil {
+		ShowError(viewer.mainWidget, err, "Failed to forward held packets")
+	}
+
+	if id == viewer.selected {
+		viewer.selected = -1
+		viewer.fieldModel.Clear()
+		viewer.fieldValues = make(map[string]reflect.Value)
+	}
+	viewer.heldModel.Remove(viewer.heldRows[id])
+	delete(viewer.heldRows, id)
+	delete(viewer.held, id)
+}
+
+func (viewer *BreakpointViewer) resolveSelected(drop bool) {
+	if viewer.selected == -1 {
+		return
+	}
+	viewer.resolve(viewer.selected, drop)
+}
+
+func (viewer *BreakpointViewer) resolveAll(drop bool) {
+	ids := make([]int, 0, len(viewer.held))
+	for id := range viewer.held {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		viewer.resolve(id, drop)
+	}
+}
+
+func (viewer *BreakpointViewer) selectionChanged(selection *gtk.TreeSelection) {
+	_, treeIter, ok := selection.GetSelected()
+	if !ok {
+		return
+	}
+	idValue, err := viewer.heldModel.GetValue(treeIter, COL_HELD_ID)
+	if err != nil {
+		println("failed to get held packet id:", err.Error())
+		return
+	}
+	id, err := idValue.GoValue()
+	if err != nil {
+		println("failed to get held packet id:", err.Error())
+		return
+	}
+	viewer.selected = id.(int)
+
+	viewer.fieldModel.Clear()
+	viewer.fieldValues = make(map[string]reflect.Value)
+	held := viewer.held[viewer.selected]
+	viewer.addFields(nil, held.Layers.Main.TypeString(), reflect.ValueOf(held.Layers.Main), 0, make(map[uintptr]bool))
+}
+
+func isEditableKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func (viewer *BreakpointViewer) addFieldRow(parent *gtk.TreeIter, name string, value string, editable bool) *gtk.TreeIter {
+	row := viewer.fieldModel.Append(parent)
+	viewer.fieldModel.SetValue(row, COL_FIELD_NAME, name)
+	viewer.fieldModel.SetValue(row, COL_FIELD_VALUE, value)
+	viewer.fieldModel.SetValue(row, COL_FIELD_EDITABLE, editable)
+	return row
+}
+
+// addFields walks the packet using reflection. Fields of simple kinds
+// that can be set are made editable.
+func (viewer *BreakpointViewer) addFields(parent *gtk.TreeIter, name string, val reflect.Value, depth int, visited map[uintptr]bool) {
+	if depth > maxFieldDepth {
+		viewer.addFieldRow(parent, name, "...", false)
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Invalid:
+		viewer.addFieldRow(parent, name, "nil", false)
+	case reflect.Ptr:
+		if val.IsNil() {
+			viewer.addFieldRow(parent, name, "nil", false)
+			return
+		}
+		if val.Type() == instanceType {
+			// instances have parent pointers; don't walk into them
+			viewer.addFieldRow(parent, name, val.Interface().(*datamodel.Instance).GetFullName(), false)
+			return
+		}
+		if visited[val.Pointer()] {
+			viewer.addFieldRow(parent, name, fmt.Sprintf("%s (already shown)", val.Type()), false)
+			return
+		}
+		visited[val.Pointer()] = true
+		viewer.addFields(parent, name, val.Elem(), depth+1, visited)
+	case reflect.Interface:
+		if val.IsNil() {
+			viewer.addFieldRow(parent, name, "nil", false)
+			return
+		}
+		viewer.addFields(parent, name, val.Elem(), depth+1, visited)
+	case reflect.Struct:
+		row := viewer.addFieldRow(parent, name, val.Type().String(), false)
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			viewer.addFields(row, field.Name, val.Field(i), depth+1, visited)
+		}
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			viewer.addFieldRow(parent, name, fmt.Sprintf("%X", val.Interface()), false)
+			return
+		}
+		row := viewer.addFieldRow(parent, name, fmt.Sprintf("%s (%d)", val.Type(), val.Len()), false)
+		for i := 0; i < val.Len(); i++ {
+			viewer.addFields(row, "["+strconv.Itoa(i)+"]", val.Index(i), depth+1, visited)
+		}
+	case reflect.Map, reflect.Func, reflect.Chan:
+		viewer.addFieldRow(parent, name, fmt.Sprintf("%s (%d)", val.Type(), val.Len()), false)
+	default:
+		editable := val.CanSet() && isEditableKind(val.Kind())
+		row := viewer.addFieldRow(parent, name, fmt.Sprint(val.Interface()), editable)
+		if editable {
+			path, err := viewer.fieldModel.GetPath(row)
+			if err != nil {
+				println("failed to get field path:", err.Error())
+				return
+			}
+			viewer.fieldValues[path.String()] = val
+		}
+	}
+}
+
+func setValueFromString(val reflect.Value, text string) error {
+	switch val.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		val.SetBool(b)
+	case reflect.String:
+		val.SetString(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 0, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 0, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(text, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetFloat(n)
+	default:
+		return fmt.Errorf("can't edit values of type %s", val.Type())
+	}
+	return nil
+}
+
+func (viewer *BreakpointViewer) fieldEdited(path string, text string) {
+	val, ok := viewer.fieldValues[path]
+	if !ok {
+		return
+	}
+	err := setValueFromString(val, text)
+	if err != nil {
+		ShowError(viewer.mainWidget, err, "Invalid value")
+		return
+	}
+	iter, err := viewer.fieldModel.GetIterFromString(path)
+	if err != nil {
+		println("failed to get edited field:", err.Error())
+		return
+	}
+	viewer.fieldModel.SetValue(iter, COL_FIELD_VALUE, fmt.Sprint(val.Interface()))
+	if row, ok := viewer.heldRows[viewer.selected]; ok {
+		viewer.heldModel.SetValue(row, COL_HELD_PACKET, viewer.held[viewer.selected].Layers.Main.String())
+	}
+}
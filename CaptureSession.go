@@ -5,43 +5,81 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Gskartwii/roblox-dissector/capture"
 	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/Gskartwii/roblox-dissector/project"
+	"github.com/Gskartwii/roblox-dissector/schemacache"
+	"github.com/Gskartwii/roblox-dissector/store"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcapgo"
 	"github.com/gotk3/gotk3/glib"
-	"github.com/olebedev/emitter"
 )
 
-type Conversation struct {
-	Client       *net.UDPAddr
-	Server       *net.UDPAddr
-	ClientReader PacketProvider
-	ServerReader PacketProvider
-	Context      *peer.CommunicationContext
-}
-
 type CaptureSession struct {
 	Name                  string
 	ViewerCounter         uint
 	IsCapturing           bool
-	Conversations         []*Conversation
+	Conversations         []*capture.Conversation
 	CancelFunc            context.CancelFunc
 	InitialViewerOccupied bool
 	ListViewers           []*PacketListViewer
 	ListViewerCallback    func(*CaptureSession, *PacketListViewer, error)
 	ProgressCallback      func(int)
-	progress              int
+	progress              int64
 	ForgetAcks            bool
+	// MidSession enables the detection of conversations
+	// that had started before the capture began
+	MidSession bool
+	// Schema is an external network schema used by conversations
+	// whose ID_NEW_SCHEMA isn't captured. May be nil.
+	Schema *peer.NetworkSchema
+	// Dictionary is an external API dictionary used by conversations
+	// whose dictionary isn't cached. May be nil.
+	Dictionary []byte
+	// Recorder collects the traffic of the session so that it can be
+	// saved as a project. Nil for sessions that can't be saved.
+	Recorder *project.Recorder
+	// LowMemory keeps the packets of conversations on disk instead of
+	// in memory, for captures that are too large to fit in it
+	LowMemory bool
+	// SchemaCache stores the schemas of the conversations and provides
+	// schemas for conversations whose ID_NEW_SCHEMA is missing. May be nil.
+	SchemaCache *schemacache.Cache
+
+	// mutex guards the fields below, which are used by the
+	// workers that decode the packets of different conversations
+	mutex      sync.Mutex
+	diskStores map[*capture.Conversation]*store.Store
 	// PCAP writing fields
 	pcapFile   *os.File
 	pcapWriter *pcapgo.Writer
+	ngWriter   *capture.NgWriter
+	// pcapng packets are held until they have been decoded
+	// so that the decoded packets can be written as comments
+	pending map[pendingKey]*pendingFrame
+	// collectors are the readers whose layers are collected as comments
+	// for the next packet written by WriteCollectedPacket
+	collectors map[pendingKey]bool
+}
+
+// pendingKey identifies the reader of a conversation that decodes a pending packet
+type pendingKey struct {
+	conv   *capture.Conversation
+	reader capture.PacketProvider
 }
 
-func AddressEq(a *net.UDPAddr, b *net.UDPAddr) bool {
-	return a.Port == b.Port && a.IP.Equal(b.IP)
+type pendingFrame struct {
+	source    *net.UDPAddr
+	dest      *net.UDPAddr
+	payload   []byte
+	timestamp time.Time
+	comments  []string
 }
 
 func NewCaptureSession(name string, cancelFunc context.CancelFunc, listViewerCallback func(*CaptureSession, *PacketListViewer, error)) (*CaptureSession, error) {
@@ -58,6 +96,8 @@ func NewCaptureSession(name string, cancelFunc context.CancelFunc, listViewerCal
 		InitialViewerOccupied: false,
 		ListViewers:           []*PacketListViewer{initialViewer},
 		ListViewerCallback:    listViewerCallback,
+		diskStores:            make(map[*capture.Conversation]*store.Store),
+		collectors:            make(map[pendingKey]bool),
 	}
 	listViewerCallback(session, initialViewer, nil)
 
@@ -65,41 +105,23 @@ func NewCaptureSession(name string, cancelFunc context.CancelFunc, listViewerCal
 }
 
 func (session *CaptureSession) SetProgress(prog int) {
-	session.progress = prog
+	atomic.StoreInt64(&session.progress, int64(prog))
 }
 
-func (session *CaptureSession) ConversationFor(source *net.UDPAddr, dest *net.UDPAddr, payload []byte) *Conversation {
-	for _, conv := range session.Conversations {
-		if AddressEq(source, conv.Client) && AddressEq(dest, conv.Server) {
-			return conv
-		}
-		if AddressEq(source, conv.Server) && AddressEq(dest, conv.Client) {
-			return conv
-		}
+func (session *CaptureSession) ConversationFor(source *net.UDPAddr, dest *net.UDPAddr, payload []byte) *capture.Conversation {
+	if conv := capture.FindConversation(session.Conversations, source, dest); conv != nil {
+		return conv
 	}
 
-	if len(payload) < 1 || payload[0] != 0x7B {
-		return nil
+	newConv := capture.DetectConversation(source, dest, payload)
+	if newConv == nil && session.MidSession {
+		newConv = capture.DetectMidSessionConversation(source, dest, payload)
 	}
-	isHandshake := peer.IsOfflineMessage(payload)
-	if !isHandshake {
+	if newConv == nil {
 		return nil
 	}
-
-	newContext := peer.NewCommunicationContext()
-	clientR := peer.NewPacketReader()
-	serverR := peer.NewPacketReader()
-	clientR.SetContext(newContext)
-	serverR.SetContext(newContext)
-	clientR.SetIsClient(true)
-	clientR.BindDataModelHandlers()
-	serverR.BindDataModelHandlers()
-	newConv := &Conversation{
-		Client:       source,
-		Server:       dest,
-		ClientReader: clientR,
-		ServerReader: serverR,
-		Context:      newContext,
+	if newConv.Context.NetworkSchema == nil {
+		newConv.Context.NetworkSchema = session.Schema
 	}
 	session.Conversations = append(session.Conversations, newConv)
 	session.AddConversation(newConv)
@@ -107,28 +129,230 @@ func (session *CaptureSession) ConversationFor(source *net.UDPAddr, dest *net.UD
 	return newConv
 }
 
-func (session *CaptureSession) AddConversation(conv *Conversation) (*PacketListViewer, error) {
+// HandleRawPacket implements capture.RawPacketHandler
+func (session *CaptureSession) HandleRawPacket(packet gopacket.Packet, conv *capture.Conversation, source *net.UDPAddr, dest *net.UDPAddr, payload []byte) {
+	if session.Recorder != nil {
+		session.Recorder.Record(conv, source, payload, packet.Metadata().Timestamp)
+	}
+	session.mutex.Lock()
+	diskStore := session.diskStores[conv]
+	holdFrame := session.ngWriter != nil
+	if holdFrame {
+		session.pending[pendingKey{conv, senderReader(conv, source)}] = &pendingFrame{
+			source:    source,
+			dest:      dest,
+			payload:   payload,
+			timestamp: packet.Metadata().Timestamp,
+		}
+	}
+	session.mutex.Unlock()
+
+	if diskStore != nil {
+		_, err := diskStore.AddDatagram(packet.Metadata().Timestamp, capture.AddressEq(source, conv.Client), payload)
+		if err != nil && err != store.ErrClosed {
+			println("failed to store datagram:", err.Error())
+		}
+	}
+	if !holdFrame {
+		session.WritePacketToPCAP(source, dest, payload, packet.Metadata().Timestamp)
+	}
+}
+
+// HandlePacketDone implements capture.PacketDoneHandler
+func (session *CaptureSession) HandlePacketDone(packet gopacket.Packet, conv *capture.Conversation, source *net.UDPAddr, dest *net.UDPAddr, payload []byte) {
+	key := pendingKey{conv, senderReader(conv, source)}
+	session.mutex.Lock()
+	pending := session.pending[key]
+	delete(session.pending, key)
+	session.mutex.Unlock()
+	if pending == nil {
+		return
+	}
+	err := session.writeFrame(pending.source, pending.dest, pending.payload, pending.timestamp, strings.Join(pending.comments, "\n"))
+	if err != nil {
+		println("PCAP write error:", err.Error())
+	}
+}
+
+// senderReader returns the reader of conv that decodes the packets sent by source
+func senderReader(conv *capture.Conversation, source *net.UDPAddr) capture.PacketProvider {
+	if capture.AddressEq(source, conv.Client) {
+		return conv.ClientReader
+	}
+	return conv.ServerReader
+}
+
+// CollectComments makes the layers emitted by reader, one of the readers of conv,
+// be written as the comments of the next packet written by WriteCollectedPacket.
+// It is used by captures that don't decode packets as they are read from a
+// capture.PacketSource, such as proxies and servers.
+func (session *CaptureSession) CollectComments(conv *capture.Conversation, reader capture.PacketProvider) {
+	session.mutex.Lock()
+	session.collectors[pendingKey{conv, reader}] = true
+	session.mutex.Unlock()
+}
+
+// WriteCollectedPacket writes a packet that reader, one of the readers of conv,
+// has decoded or encoded to the PCAP file. In pcapng files the layers collected
+// from reader since the previous packet are written as its comments.
+func (session *CaptureSession) WriteCollectedPacket(conv *capture.Conversation, reader capture.PacketProvider, srcAddr, dstAddr *net.UDPAddr, payload []byte, timestamp time.Time) {
+	key := pendingKey{conv, reader}
+	session.mutex.Lock()
+	pending := session.pending[key]
+	delete(session.pending, key)
+	session.mutex.Unlock()
+
+	var comments []string
+	if pending != nil {
+		comments = pending.comments
+	}
+	err := session.writeFrame(srcAddr, dstAddr, payload, timestamp, strings.Join(comments, "\n"))
+	if err != nil {
+		println("PCAP write error:", err.Error())
+	}
+}
+
+// annotatePending records a decoded packet as a comment for the pending pcapng packet
+func (session *CaptureSession) annotatePending(e *capture.Event) {
+	key := pendingKey{e.Conversation, e.Provider}
+	session.mutex.Lock()
+	pending := session.pending[key]
+	if pending == nil && session.ngWriter != nil && session.collectors[key] {
+		pending = &pendingFrame{}
+		session.pending[key] = pending
+	}
+	session.mutex.Unlock()
+	if pending == nil {
+		return
+	}
+	// only the goroutine decoding the packets of the reader accesses its pending frame
+	if e.IsError {
+		pending.comments = append(pending.comments, fmt.Sprintf("%s: error: %s", e.Layers.String(), e.Layers.Error.Error()))
+	} else if e.Topic != "reliable" {
+		// "reliable" layers may be incomplete splits, they are
+		// annotated once the full packet has been received
+		pending.comments = append(pending.comments, e.Layers.String())
+	}
+}
+
+// recordFields makes the readers of conv record the byte ranges of decoded fields,
+// so that they can be highlighted in the hex dump
+func recordFields(conv *capture.Conversation) {
+	for _, provider := range []capture.PacketProvider{conv.ClientReader, conv.ServerReader} {
+		if reader, ok := provider.(*peer.DefaultPacketReader); ok {
+			reader.RecordFields = true
+		}
+	}
+}
+
+// newDiskStore creates the disk store of a conversation in low-memory mode
+func (session *CaptureSession) newDiskStore(conv *capture.Conversation) (*store.Store, func() *capture.Conversation) {
+	diskStore, err := store.New("")
+	if err != nil {
+		println("failed to create packet store, keeping packets in memory:", err.Error())
+		return nil, nil
+	}
+	session.mutex.Lock()
+	session.diskStores[conv] = diskStore
+	session.mutex.Unlock()
+	return diskStore, func() *capture.Conversation {
+		// the schema and the dictionary may have been attached after the store was created
+		fresh := capture.NewConversation(conv.Client, conv.Server)
+		fresh.Context.Degraded = conv.Context.Degraded
+		fresh.Context.NetworkSchema = conv.Context.NetworkSchema
+		fresh.Context.APIDictionary = conv.Context.APIDictionary
+		fresh.Context.ProtocolVersion = conv.Context.ProtocolVersion
+		recordFields(fresh)
+		return fresh
+	}
+}
+
+// storePacket adds the summary of a finished packet to a disk store
+func (session *CaptureSession) storePacket(diskStore *store.Store, e *capture.Event) {
+	switch e.Topic {
+	case "offline", "full-reliable":
+	case "ack":
+		if session.ForgetAcks {
+			return
+		}
+	default:
+		return
+	}
+	count := diskStore.DatagramCount()
+	if count == 0 {
+		return
+	}
+	summary := store.Summarize(e.Layers, count-1)
+	if !e.IsError && hasSubpackets(e.Layers) {
+		summary.Flags |= store.FlagHasChildren
+	}
+	err := diskStore.AddPacket(summary)
+	if err != nil && err != store.ErrClosed {
+		println("failed to store packet:", err.Error())
+	}
+}
+
+func (session *CaptureSession) AddConversation(conv *capture.Conversation) (*PacketListViewer, error) {
 	var err error
 	var viewer *PacketListViewer
+	var diskStore *store.Store
+	var freshConversation func() *capture.Conversation
+	recordFields(conv)
+	if session.LowMemory {
+		diskStore, freshConversation = session.newDiskStore(conv)
+	}
 	if !session.InitialViewerOccupied {
 		session.InitialViewerOccupied = true
 		viewer = session.ListViewers[0]
 		viewer.Conversation = conv
+		if diskStore != nil {
+			glib.IdleAdd(func() bool {
+				viewer.UseDiskStore(diskStore, freshConversation)
+				return false
+			})
+		}
 	} else {
 		title := fmt.Sprintf("%s#%d", session.Name, session.ViewerCounter)
 		session.ViewerCounter++
 
 		glib.IdleAdd(func() bool {
 			viewer, err = NewPacketListViewer(title, conv)
+			if err == nil {
+				session.ListViewers = append(session.ListViewers, viewer)
+				if diskStore != nil {
+					viewer.UseDiskStore(diskStore, freshConversation)
+				}
+			}
 			session.ListViewerCallback(session, viewer, err)
 			return false
 		})
 	}
-	handler := func(e *emitter.Event) {
-		topic := e.OriginalTopic
-		layers := e.Args[0].(*peer.PacketLayers)
+	if conv.Context.APIDictionary == nil {
+		conv.Context.APIDictionary = session.Dictionary
+	}
+	if session.SchemaCache != nil {
+		session.SchemaCache.WatchNearest(conv, func(requested, matched schemacache.Key) {
+			warning := fmt.Sprintf("No schema is cached for client version %s, using the schema of %s instead. Packets may be decoded wrongly.", requested, matched)
+			// the viewer is created in an earlier idle callback
+			glib.IdleAdd(func() bool {
+				if viewer != nil {
+					viewer.ShowWarning(warning)
+				}
+				return false
+			})
+		}, func(err error) {
+			println("schema cache error:", err.Error())
+		})
+	}
+	conv.Bind(func(e *capture.Event) {
+		session.annotatePending(e)
+		if diskStore != nil {
+			session.storePacket(diskStore, e)
+		}
+		topic := e.Topic
+		layers := e.Layers
 
-		associatedProgress := session.progress
+		associatedProgress := int(atomic.LoadInt64(&session.progress))
 		_, err := glib.IdleAdd(func() bool {
 			viewer.NotifyPacket(topic, layers, session.ForgetAcks)
 			if session.ProgressCallback != nil {
@@ -139,11 +363,7 @@ func (session *CaptureSession) AddConversation(conv *Conversation) (*PacketListV
 		if err != nil {
 			println("idleadd failed:", err.Error())
 		}
-	}
-	conv.ClientReader.Layers().On("*", handler, emitter.Void)
-	conv.ClientReader.Errors().On("*", handler, emitter.Void)
-	conv.ServerReader.Layers().On("*", handler, emitter.Void)
-	conv.ServerReader.Errors().On("*", handler, emitter.Void)
+	})
 
 	return viewer, err
 }
@@ -169,18 +389,34 @@ func (session *CaptureSession) ReportDone() {
 	})
 }
 
-// InitPCAPWriter initializes PCAP file writing for the capture session
+// InitPCAPWriter initializes PCAP file writing for the capture session.
+// Files whose name ends with .pcapng are written in the pcapng format,
+// with the decoded packets and errors as packet comments.
 func (session *CaptureSession) InitPCAPWriter(filename string) error {
 	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("failed to create PCAP file: %v", err)
 	}
 
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
 	session.pcapFile = file
+	if strings.HasSuffix(strings.ToLower(filename), ".pcapng") {
+		session.pending = make(map[pendingKey]*pendingFrame)
+		session.ngWriter, err = capture.NewNgWriter(file, layers.LinkTypeEthernet, 65536)
+		if err != nil {
+			session.pcapFile.Close()
+			session.pcapFile = nil
+			return fmt.Errorf("failed to write pcapng header: %v", err)
+		}
+		return nil
+	}
 	session.pcapWriter = pcapgo.NewWriter(file)
 	err = session.pcapWriter.WriteFileHeader(65536, layers.LinkTypeEthernet)
 	if err != nil {
 		session.pcapFile.Close()
+		session.pcapFile = nil
+		session.pcapWriter = nil
 		return fmt.Errorf("failed to write PCAP header: %v", err)
 	}
 
@@ -189,24 +425,35 @@ func (session *CaptureSession) InitPCAPWriter(filename string) error {
 
 // ClosePCAPWriter closes the PCAP file writer
 func (session *CaptureSession) ClosePCAPWriter() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
 	if session.pcapFile != nil {
 		session.pcapFile.Close()
 		session.pcapFile = nil
 		session.pcapWriter = nil
+		session.ngWriter = nil
+		session.pending = nil
 	}
 }
 
-// WritePacketToPCAP writes a raw UDP packet payload to the PCAP file
-func (session *CaptureSession) WritePacketToPCAP(srcAddr, dstAddr *net.UDPAddr, payload []byte) {
-	if session.pcapWriter != nil {
-		err := session.WriteToPCAP(srcAddr, dstAddr, payload)
-		if err != nil {
-			println("PCAP write error:", err.Error())
-		}
+// WritePacketToPCAP writes a raw UDP packet payload to the PCAP file,
+// stamped with the time it was captured
+func (session *CaptureSession) WritePacketToPCAP(srcAddr, dstAddr *net.UDPAddr, payload []byte, timestamp time.Time) {
+	err := session.WriteToPCAP(srcAddr, dstAddr, payload, timestamp)
+	if err != nil {
+		println("PCAP write error:", err.Error())
 	}
 }
-func (session *CaptureSession) WriteToPCAP(srcAddr, dstAddr *net.UDPAddr, payload []byte) error {
-	if session.pcapWriter == nil {
+
+func (session *CaptureSession) WriteToPCAP(srcAddr, dstAddr *net.UDPAddr, payload []byte, timestamp time.Time) error {
+	return session.writeFrame(srcAddr, dstAddr, payload, timestamp, "")
+}
+
+// writeFrame writes a packet to the PCAP file. The comment is only written in pcapng files.
+func (session *CaptureSession) writeFrame(srcAddr, dstAddr *net.UDPAddr, payload []byte, timestamp time.Time, comment string) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.pcapWriter == nil && session.ngWriter == nil {
 		return nil // PCAP writer not initialized
 	}
 
@@ -261,9 +508,13 @@ func (session *CaptureSession) WriteToPCAP(srcAddr, dstAddr *net.UDPAddr, payloa
 	}
 
 	// Write to PCAP
-	return session.pcapWriter.WritePacket(gopacket.CaptureInfo{
-		Timestamp:     time.Now(),
+	ci := gopacket.CaptureInfo{
+		Timestamp:     timestamp,
 		CaptureLength: len(buffer.Bytes()),
 		Length:        len(buffer.Bytes()),
-	}, buffer.Bytes())
+	}
+	if session.ngWriter != nil {
+		return session.ngWriter.WritePacket(ci, buffer.Bytes(), comment)
+	}
+	return session.pcapWriter.WritePacket(ci, buffer.Bytes())
 }
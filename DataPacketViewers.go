@@ -28,6 +28,9 @@ func blanketViewer(content string) (gtk.IWidget, error) {
 }
 
 func viewerForDataPacket(packet peer.Packet83Subpacket) (gtk.IWidget, error) {
+	if custom, ok := packet.(*peer.CustomPacket); ok {
+		return blanketViewer(custom.String())
+	}
 	switch packet.Type() {
 	case 0x01, 0x04, 0x09, 0x0B, 0x0C, 0x0D, 0x0F, 0x10, 0x13, 0x14:
 		return blanketViewer(packet.String())
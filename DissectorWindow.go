@@ -4,16 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/Gskartwii/roblox-dissector/capture"
 	"github.com/Gskartwii/roblox-dissector/datamodel"
 	"github.com/Gskartwii/roblox-dissector/peer"
-	"github.com/dreadl0ck/gopcap"
+	"github.com/Gskartwii/roblox-dissector/project"
+	"github.com/Gskartwii/roblox-dissector/schemacache"
 	"github.com/google/gopacket/pcap"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
@@ -46,6 +51,12 @@ type DissectorWindow struct {
 
 	tabs                 *gtk.Notebook
 	forgetAcksItem       *gtk.CheckMenuItem
+	pcapngItem           *gtk.CheckMenuItem
+	midSessionItem       *gtk.CheckMenuItem
+	lowMemoryItem        *gtk.CheckMenuItem
+	saveSessionItem      *gtk.MenuItem
+	sessionNotesItem     *gtk.MenuItem
+	redecodeItem         *gtk.MenuItem
 	tabIndexToSession    []*CaptureSession
 	tabIndexToListViewer []*PacketListViewer
 	sessionRefCount      map[*CaptureSession]uint
@@ -56,6 +67,15 @@ type DissectorWindow struct {
 	resetFilterItem       *gtk.MenuItem
 	applyFilterItem       *gtk.MenuItem
 	viewFilterLogItem     *gtk.MenuItem
+
+	// externalSchema is used by new captures whose ID_NEW_SCHEMA
+	// isn't captured. May be nil.
+	externalSchema *peer.NetworkSchema
+	// externalDictionary is used by new captures whose API
+	// dictionary isn't cached. May be nil.
+	externalDictionary []byte
+	// schemaCache stores the schemas seen in all captures. May be nil.
+	schemaCache *schemacache.Cache
 }
 
 func ShowError(wdg gtk.IWidget, err error, extrainfo string) {
@@ -127,6 +147,7 @@ func (win *DissectorWindow) AppendClosablePage(title string, session *CaptureSes
 		win.tabIndexToSession = append(win.tabIndexToSession[:pageNum], win.tabIndexToSession[pageNum+1:]...)
 		win.sessionRefCount[oldSession] -= 1
 
+		listViewer.CloseDiskStore()
 		if win.sessionRefCount[oldSession] == 0 {
 			delete(win.sessionRefCount, oldSession)
 			oldSession.StopCapture()
@@ -154,6 +175,9 @@ func (win *DissectorWindow) UpdateActionsForPage(curPage int) {
 		win.resetFilterItem.SetSensitive(false)
 		win.applyFilterItem.SetSensitive(false)
 		win.viewFilterLogItem.SetSensitive(false)
+		win.saveSessionItem.SetSensitive(false)
+		win.sessionNotesItem.SetSensitive(false)
+		win.redecodeItem.SetSensitive(false)
 		return
 	}
 
@@ -165,6 +189,9 @@ func (win *DissectorWindow) UpdateActionsForPage(curPage int) {
 	win.resetFilterItem.SetSensitive(true)
 	win.applyFilterItem.SetSensitive(true)
 	win.viewFilterLogItem.SetSensitive(true)
+	win.saveSessionItem.SetSensitive(curSession.Recorder != nil && !curSession.IsCapturing)
+	win.sessionNotesItem.SetSensitive(curSession.Recorder != nil)
+	win.redecodeItem.SetSensitive(curSession.Recorder != nil && !curSession.IsCapturing)
 
 	pauseButtonIcon, err := win.pauseButton.GetIconWidget()
 	if err != nil {
@@ -202,6 +229,14 @@ func (win *DissectorWindow) BrowseDataModelClicked() {
 	BrowseDataModel(currViewer.Conversation.Context)
 }
 
+// captureExtension returns the extension of the files captures are saved to
+func (win *DissectorWindow) captureExtension() string {
+	if win.pcapngItem.GetActive() {
+		return "pcapng"
+	}
+	return "pcap"
+}
+
 func (win *DissectorWindow) CaptureFromPcapDevice(name string) {
 	handle, err := pcap.OpenLive(name, 2000, false, 1*time.Second)
 	if err != nil {
@@ -228,9 +263,18 @@ func (win *DissectorWindow) CaptureFromPcapDevice(name string) {
 		return
 	}
 	session.ForgetAcks = win.forgetAcksItem.GetActive()
+	session.MidSession = win.midSessionItem.GetActive()
+	session.Schema = win.externalSchema
+	session.Dictionary = win.externalDictionary
+	session.SchemaCache = win.schemaCache
+	session.LowMemory = win.lowMemoryItem.GetActive()
+	if !session.LowMemory {
+		// saving would need all of the traffic in memory
+		session.Recorder = project.NewRecorder(project.New(name))
+	}
 
 	// Initialize PCAP writing for live captured packets
-	pcapFilename := fmt.Sprintf("capture_%s_%d.pcap", name, time.Now().Unix())
+	pcapFilename := fmt.Sprintf("capture_%s_%d.%s", name, time.Now().Unix(), win.captureExtension())
 	err = session.InitPCAPWriter(pcapFilename)
 	if err != nil {
 		println("Warning: Failed to initialize PCAP writer:", err.Error())
@@ -268,7 +312,7 @@ func (win *DissectorWindow) CaptureFromServer(port uint16, schema *peer.NetworkS
 	session.ForgetAcks = win.forgetAcksItem.GetActive()
 
 	// Initialize PCAP writing for server captured packets
-	pcapFilename := fmt.Sprintf("server_capture_port_%d_%d.pcap", port, time.Now().Unix())
+	pcapFilename := fmt.Sprintf("server_capture_port_%d_%d.%s", port, time.Now().Unix(), win.captureExtension())
 	err = session.InitPCAPWriter(pcapFilename)
 	if err != nil {
 		println("Warning: Failed to initialize PCAP writer:", err.Error())
@@ -288,7 +332,7 @@ func (win *DissectorWindow) CaptureFromServer(port uint16, schema *peer.NetworkS
 }
 
 func (win *DissectorWindow) CaptureFromFile(filename string) {
-	handle, err := pcap.OpenOffline(filename)
+	file, err := capture.OpenFile(filename)
 	if err != nil {
 		win.ShowCaptureError(err, "Starting capture")
 		return
@@ -338,9 +382,18 @@ func (win *DissectorWindow) CaptureFromFile(filename string) {
 		return
 	}
 	session.ForgetAcks = win.forgetAcksItem.GetActive()
+	session.MidSession = win.midSessionItem.GetActive()
+	session.Schema = win.externalSchema
+	session.Dictionary = win.externalDictionary
+	session.SchemaCache = win.schemaCache
+	session.LowMemory = win.lowMemoryItem.GetActive()
+	if !session.LowMemory {
+		// saving would need all of the traffic in memory
+		session.Recorder = project.NewRecorder(project.New(filepath.Base(filename)))
+	}
 
 	// Initialize PCAP writing for captured packets
-	pcapFilename := filename + "_captured.pcap"
+	pcapFilename := filename + "_captured." + win.captureExtension()
 	err = session.InitPCAPWriter(pcapFilename)
 	if err != nil {
 		println("Warning: Failed to initialize PCAP writer:", err.Error())
@@ -375,7 +428,7 @@ func (win *DissectorWindow) CaptureFromFile(filename string) {
 	}
 
 	go func() {
-		count, err := gopcap.Count(filename)
+		count, err := capture.CountPackets(filename)
 		if err != nil {
 			glib.IdleAdd(func() bool {
 				progressDialog.Close()
@@ -385,7 +438,10 @@ func (win *DissectorWindow) CaptureFromFile(filename string) {
 			countPackets = float64(count)
 		}
 
-		err = CaptureFromHandle(context, session, handle)
+		// conversations are decoded in parallel, so the packets of different
+		// conversations may be written to the capture file out of order
+		err = capture.CapturePacketsParallel(context, session, file.Packets(context), runtime.NumCPU())
+		file.Close()
 		session.ReportDone()
 		if err != nil {
 			win.ShowCaptureError(err, "Starting capture")
@@ -406,7 +462,8 @@ func (win *DissectorWindow) PromptCaptureFromFile() {
 		return
 	}
 	filter.AddPattern("*.pcap")
-	filter.SetName("PCAP network capture files (*.pcap)")
+	filter.AddPattern("*.pcapng")
+	filter.SetName("PCAP network capture files (*.pcap, *.pcapng)")
 	chooser.AddFilter(filter)
 	resp := chooser.NativeDialog.Run()
 	if gtk.ResponseType(resp) == gtk.RESPONSE_ACCEPT {
@@ -422,6 +479,270 @@ func (win *DissectorWindow) PromptCaptureLive() {
 	}
 }
 
+// SaveSession saves the traffic and analysis state of a session to a .sala project file
+func (win *DissectorWindow) SaveSession(session *CaptureSession, filename string) error {
+	if session.Recorder == nil {
+		return errors.New("this session can't be saved")
+	}
+	if session.IsCapturing {
+		return errors.New("stop the capture before saving the session")
+	}
+	for _, viewer := range session.ListViewers {
+		if viewer.Conversation == nil {
+			continue
+		}
+		saved := session.Recorder.Conversation(viewer.Conversation)
+		saved.Filter = viewer.FilterScript
+		saved.Bookmarks = viewer.SortedBookmarks()
+	}
+	session.Recorder.UpdateProtocolVersions()
+	saved := session.Recorder.Project()
+	err := saved.SetNetworkSchema(session.Schema)
+	if err != nil {
+		return err
+	}
+	saved.Dictionary = session.Dictionary
+	return saved.SaveFile(filename)
+}
+
+func (win *DissectorWindow) PromptSaveSession() {
+	curPage := win.tabs.GetCurrentPage()
+	if curPage == -1 {
+		return
+	}
+	session := win.tabIndexToSession[curPage]
+	chooser, err := gtk.FileChooserNativeDialogNew("Save session", win, gtk.FILE_CHOOSER_ACTION_SAVE, "Save", "Cancel")
+	if err != nil {
+		win.ShowCaptureError(err, "Making chooser")
+		return
+	}
+	chooser.SetDoOverwriteConfirmation(true)
+	chooser.SetCurrentName(session.Recorder.Project().Name + ".sala")
+	resp := chooser.NativeDialog.Run()
+	if gtk.ResponseType(resp) != gtk.RESPONSE_ACCEPT {
+		return
+	}
+	filename := chooser.GetFilename()
+	if !strings.HasSuffix(filename, ".sala") {
+		filename += ".sala"
+	}
+	err = win.SaveSession(session, filename)
+	if err != nil {
+		win.ShowCaptureError(err, "Saving session")
+	}
+}
+
+// OpenSession reopens a session saved with SaveSession. The saved datagrams
+// are decoded again, so the packets get the same IDs as in the original session.
+func (win *DissectorWindow) OpenSession(filename string) {
+	saved, err := project.LoadFile(filename)
+	if err != nil {
+		win.ShowCaptureError(err, "Opening session")
+		return
+	}
+	win.openProject(filepath.Base(filename), saved)
+}
+
+// openProject decodes the datagrams of a project in a new session
+func (win *DissectorWindow) openProject(name string, saved *project.Project) {
+	schema, err := saved.NetworkSchema()
+	if err != nil {
+		win.ShowCaptureError(err, "Parsing session schema")
+		return
+	}
+	if len(saved.Conversations) == 0 {
+		win.ShowCaptureError(errors.New("no conversations"), "Opening session")
+		return
+	}
+
+	context, cancelFunc := context.WithCancel(context.Background())
+	session, err := NewCaptureSession(name, cancelFunc, func(session *CaptureSession, listViewer *PacketListViewer, err error) {
+		if err != nil {
+			win.ShowCaptureError(err, "Accepting new listviewer")
+			return
+		}
+		listViewer.mainWidget.ShowAll()
+		win.AppendClosablePage(listViewer.title, session, listViewer)
+
+		windowHeight := win.GetAllocatedHeight()
+		paneHeight := int(0.6 * float64(windowHeight))
+		listViewer.mainWidget.SetPosition(paneHeight)
+		listViewer.mainWidget.SetWideHandle(true)
+	})
+	if err != nil {
+		win.ShowCaptureError(err, "Opening session")
+		return
+	}
+	session.ForgetAcks = win.forgetAcksItem.GetActive()
+	session.Schema = schema
+	session.Dictionary = saved.Dictionary
+	if session.Dictionary == nil {
+		session.Dictionary = win.externalDictionary
+	}
+	session.SchemaCache = win.schemaCache
+	session.Recorder = project.NewRecorder(saved)
+	session.ProgressCallback = func(progress int) {
+		if progress == -1 {
+			win.UpdateActionsEnabled()
+		}
+	}
+
+	go func() {
+		for _, savedConv := range saved.Conversations {
+			conv, err := savedConv.NewCaptureConversation(schema, session.Dictionary)
+			if err != nil {
+				win.ShowCaptureError(err, "Opening session")
+				break
+			}
+			session.Conversations = append(session.Conversations, conv)
+			session.Recorder.Restore(conv, savedConv)
+			session.AddConversation(conv)
+			err = savedConv.Replay(context, conv)
+			if err != nil {
+				break
+			}
+		}
+		session.ReportDone()
+		// Viewers are created on the main loop, so the analysis state
+		// must be restored after all of them have been created
+		glib.IdleAdd(func() bool {
+			for _, viewer := range session.ListViewers {
+				if viewer.Conversation == nil {
+					continue
+				}
+				savedConv := session.Recorder.Conversation(viewer.Conversation)
+				for _, bookmark := range savedConv.Bookmarks {
+					viewer.Bookmarks[bookmark.PacketID] = bookmark.Note
+				}
+				viewer.refreshBookmarks()
+				if savedConv.Filter != "" {
+					viewer.ApplyFilter(savedConv.Filter)
+				}
+			}
+			return false
+		})
+	}()
+}
+
+func (win *DissectorWindow) PromptOpenSession() {
+	chooser, err := gtk.FileChooserNativeDialogNew("Choose session file", win, gtk.FILE_CHOOSER_ACTION_OPEN, "Choose", "Cancel")
+	if err != nil {
+		win.ShowCaptureError(err, "Making chooser")
+		return
+	}
+	filter, err := gtk.FileFilterNew()
+	if err != nil {
+		win.ShowCaptureError(err, "Creating filter")
+		return
+	}
+	filter.AddPattern("*.sala")
+	filter.SetName("Sala session files (*.sala)")
+	chooser.AddFilter(filter)
+	resp := chooser.NativeDialog.Run()
+	if gtk.ResponseType(resp) == gtk.RESPONSE_ACCEPT {
+		filename := chooser.GetFilename()
+		win.OpenSession(filename)
+	}
+}
+
+func (win *DissectorWindow) EditSessionNotes() {
+	curPage := win.tabs.GetCurrentPage()
+	if curPage == -1 {
+		return
+	}
+	saved := win.tabIndexToSession[curPage].Recorder.Project()
+	err := NewEditTextWindow("Session notes", saved.Notes, func(notes string) {
+		saved.Notes = notes
+	})
+	if err != nil {
+		win.ShowCaptureError(err, "Editing session notes")
+	}
+}
+
+// promptSchema asks for a network schema file, starting in the schema cache.
+// It returns nil if no schema was chosen.
+func (win *DissectorWindow) promptSchema() *peer.NetworkSchema {
+	chooser, err := gtk.FileChooserNativeDialogNew("Choose schema file", win, gtk.FILE_CHOOSER_ACTION_OPEN, "Choose", "Cancel")
+	if err != nil {
+		win.ShowCaptureError(err, "Making chooser")
+		return nil
+	}
+	if win.schemaCache != nil {
+		if _, err := os.Stat(win.schemaCache.Dir); err == nil {
+			chooser.SetCurrentFolder(win.schemaCache.Dir)
+		}
+	}
+	resp := chooser.NativeDialog.Run()
+	if gtk.ResponseType(resp) != gtk.RESPONSE_ACCEPT {
+		return nil
+	}
+	file, err := os.Open(chooser.GetFilename())
+	if err != nil {
+		win.ShowCaptureError(err, "Parsing schema")
+		return nil
+	}
+	defer file.Close()
+	schema, err := peer.ReadSchema(file)
+	if err != nil {
+		win.ShowCaptureError(err, "Parsing schema")
+		return nil
+	}
+	return schema
+}
+
+// PromptExternalSchema asks for a network schema to use in new captures
+// whose ID_NEW_SCHEMA isn't captured
+func (win *DissectorWindow) PromptExternalSchema() {
+	if schema := win.promptSchema(); schema != nil {
+		win.externalSchema = schema
+	}
+}
+
+// PromptExternalDictionary asks for a zstd dictionary to use in new
+// captures whose server enables API dictionary compression. The schema
+// cache keeps it for later captures with the same schema version.
+func (win *DissectorWindow) PromptExternalDictionary() {
+	chooser, err := gtk.FileChooserNativeDialogNew("Choose API dictionary file", win, gtk.FILE_CHOOSER_ACTION_OPEN, "Choose", "Cancel")
+	if err != nil {
+		win.ShowCaptureError(err, "Making chooser")
+		return
+	}
+	resp := chooser.NativeDialog.Run()
+	if gtk.ResponseType(resp) != gtk.RESPONSE_ACCEPT {
+		return
+	}
+	dictionary, err := ioutil.ReadFile(chooser.GetFilename())
+	if err != nil {
+		win.ShowCaptureError(err, "Reading API dictionary")
+		return
+	}
+	win.externalDictionary = dictionary
+}
+
+// PromptRedecode asks for a network schema and decodes the conversations
+// of the current session again in a new session, using the schema for
+// conversations whose ID_NEW_SCHEMA wasn't captured
+func (win *DissectorWindow) PromptRedecode() {
+	curPage := win.tabs.GetCurrentPage()
+	if curPage == -1 {
+		return
+	}
+	session := win.tabIndexToSession[curPage]
+	schema := win.promptSchema()
+	if schema == nil {
+		return
+	}
+	session.Recorder.UpdateProtocolVersions()
+	saved := session.Recorder.Project().Clone()
+	err := saved.SetNetworkSchema(schema)
+	if err != nil {
+		win.ShowCaptureError(err, "Re-decoding session")
+		return
+	}
+	saved.Dictionary = session.Dictionary
+	win.openProject(session.Name+" (re-decoded)", saved)
+}
+
 func openBrowser(url string) {
 	var err error
 
@@ -461,6 +782,10 @@ func NewDissectorWindow() (*gtk.Window, error) {
 		Window:          wind,
 		sessionRefCount: make(map[*CaptureSession]uint),
 	}
+	dwin.schemaCache, err = schemacache.Default()
+	if err != nil {
+		println("Warning: schemas won't be cached:", err.Error())
+	}
 
 	tabs, err := winBuilder.GetObject("conversationtabs")
 	if err != nil {
@@ -555,6 +880,36 @@ func NewDissectorWindow() (*gtk.Window, error) {
 	}
 	dwin.forgetAcksItem = forgetAcksItem
 
+	pcapngItem_, err := winBuilder.GetObject("pcapngitem")
+	if err != nil {
+		return nil, err
+	}
+	pcapngItem, ok := pcapngItem_.(*gtk.CheckMenuItem)
+	if !ok {
+		return nil, invalidUi("pcapngitem")
+	}
+	dwin.pcapngItem = pcapngItem
+
+	midSessionItem_, err := winBuilder.GetObject("midsessionitem")
+	if err != nil {
+		return nil, err
+	}
+	midSessionItem, ok := midSessionItem_.(*gtk.CheckMenuItem)
+	if !ok {
+		return nil, invalidUi("midsessionitem")
+	}
+	dwin.midSessionItem = midSessionItem
+
+	lowMemoryItem_, err := winBuilder.GetObject("lowmemoryitem")
+	if err != nil {
+		return nil, err
+	}
+	lowMemoryItem, ok := lowMemoryItem_.(*gtk.CheckMenuItem)
+	if !ok {
+		return nil, invalidUi("lowmemoryitem")
+	}
+	dwin.lowMemoryItem = lowMemoryItem
+
 	divertItem, err := winBuilder.GetObject("fromdivertitem")
 	if err != nil {
 		return nil, err
@@ -585,7 +940,7 @@ func NewDissectorWindow() (*gtk.Window, error) {
 		session.ForgetAcks = dwin.forgetAcksItem.GetActive()
 
 		// Initialize PCAP writing for WinDivert captured packets
-		pcapFilename := fmt.Sprintf("divert_capture_%d.pcap", time.Now().Unix())
+		pcapFilename := fmt.Sprintf("divert_capture_%d.%s", time.Now().Unix(), dwin.captureExtension())
 		err = session.InitPCAPWriter(pcapFilename)
 		if err != nil {
 			println("Warning: Failed to initialize PCAP writer:", err.Error())
@@ -599,6 +954,64 @@ func NewDissectorWindow() (*gtk.Window, error) {
 		}
 	})
 
+	openSessionItem_, err := winBuilder.GetObject("opensessionitem")
+	if err != nil {
+		return nil, err
+	}
+	openSessionItem, ok := openSessionItem_.(*gtk.MenuItem)
+	if !ok {
+		return nil, invalidUi("opensessionitem")
+	}
+	openSessionItem.Connect("activate", dwin.PromptOpenSession)
+	saveSessionItem_, err := winBuilder.GetObject("savesessionitem")
+	if err != nil {
+		return nil, err
+	}
+	saveSessionItem, ok := saveSessionItem_.(*gtk.MenuItem)
+	if !ok {
+		return nil, invalidUi("savesessionitem")
+	}
+	saveSessionItem.Connect("activate", dwin.PromptSaveSession)
+	dwin.saveSessionItem = saveSessionItem
+	sessionNotesItem_, err := winBuilder.GetObject("sessionnotesitem")
+	if err != nil {
+		return nil, err
+	}
+	sessionNotesItem, ok := sessionNotesItem_.(*gtk.MenuItem)
+	if !ok {
+		return nil, invalidUi("sessionnotesitem")
+	}
+	sessionNotesItem.Connect("activate", dwin.EditSessionNotes)
+	dwin.sessionNotesItem = sessionNotesItem
+	externalSchemaItem_, err := winBuilder.GetObject("externalschemaitem")
+	if err != nil {
+		return nil, err
+	}
+	externalSchemaItem, ok := externalSchemaItem_.(*gtk.MenuItem)
+	if !ok {
+		return nil, invalidUi("externalschemaitem")
+	}
+	externalSchemaItem.Connect("activate", dwin.PromptExternalSchema)
+	externalDictionaryItem_, err := winBuilder.GetObject("externaldictionaryitem")
+	if err != nil {
+		return nil, err
+	}
+	externalDictionaryItem, ok := externalDictionaryItem_.(*gtk.MenuItem)
+	if !ok {
+		return nil, invalidUi("externaldictionaryitem")
+	}
+	externalDictionaryItem.Connect("activate", dwin.PromptExternalDictionary)
+	redecodeItem_, err := winBuilder.GetObject("redecodeitem")
+	if err != nil {
+		return nil, err
+	}
+	redecodeItem, ok := redecodeItem_.(*gtk.MenuItem)
+	if !ok {
+		return nil, invalidUi("redecodeitem")
+	}
+	redecodeItem.Connect("activate", dwin.PromptRedecode)
+	dwin.redecodeItem = redecodeItem
+
 	aboutDialogItem, err := winBuilder.GetObject("aboutitem")
 	if err != nil {
 		return nil, err
@@ -703,7 +1116,7 @@ Sala is tool for dissecting Roblox network packets.`)
 				ShowError(dwin, err, "Parsing schema")
 				return
 			}
-			schema, err := peer.ParseSchema(file)
+			schema, err := peer.ReadSchema(file)
 			if err != nil {
 				ShowError(dwin, err, "Parsing schema")
 				return
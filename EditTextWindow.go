@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// NewEditTextWindow shows a window for editing free-form text,
+// such as session notes or the note of a bookmark
+func NewEditTextWindow(title string, oldText string, callback func(string)) error {
+	box, err := boxWithMargin()
+	if err != nil {
+		return err
+	}
+
+	textBuffer, err := gtk.TextBufferNew(nil)
+	if err != nil {
+		return err
+	}
+	textBuffer.SetText(oldText)
+	textInput, err := gtk.TextViewNewWithBuffer(textBuffer)
+	if err != nil {
+		return err
+	}
+	textInput.SetWrapMode(gtk.WRAP_WORD)
+	textInput.SetVExpand(true)
+	scrolled, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return err
+	}
+	scrolled.Add(textInput)
+	box.Add(scrolled)
+
+	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	if err != nil {
+		return err
+	}
+
+	buttonRow, err := gtk.ButtonBoxNew(gtk.ORIENTATION_HORIZONTAL)
+	if err != nil {
+		return err
+	}
+	buttonRow.SetLayout(gtk.BUTTONBOX_END)
+	buttonRow.SetSpacing(8)
+	okButton, err := gtk.ButtonNewWithLabel("OK")
+	if err != nil {
+		return err
+	}
+	okButton.Connect("clicked", func() {
+		text, err := textBuffer.GetProperty("text")
+		if err != nil {
+			ShowError(win, err, "Getting text")
+			return
+		}
+		win.Destroy()
+		callback(text.(string))
+	})
+	buttonRow.Add(okButton)
+
+	box.Add(buttonRow)
+
+	win.Add(box)
+	win.SetTitle(title)
+	win.SetSizeRequest(480, 320)
+	win.ShowAll()
+
+	return nil
+}
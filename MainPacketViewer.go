@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/http"
@@ -137,7 +138,52 @@ func newLabelF(fmtS string, rest ...interface{}) (*gtk.Label, error) {
 	return label, nil
 }
 
-func newIpAddressScrolledList(addrs []*net.UDPAddr) (*gtk.ScrolledWindow, error) {
+// fieldHighlighter highlights the bytes of the named field in the hex dump
+type fieldHighlighter func(name string)
+
+// linkField wraps widget so that clicking it highlights the named field
+func linkField(widget gtk.IWidget, highlight fieldHighlighter, name string) (*gtk.EventBox, error) {
+	eventBox, err := gtk.EventBoxNew()
+	if err != nil {
+		return nil, err
+	}
+	eventBox.Add(widget)
+	eventBox.Connect("button-press-event", func() {
+		highlight(name)
+	})
+	return eventBox, nil
+}
+
+// newFieldLabelF creates a label that highlights the named field when clicked
+func newFieldLabelF(highlight fieldHighlighter, name string, fmtS string, rest ...interface{}) (*gtk.EventBox, error) {
+	label, err := newLabelF(fmtS, rest...)
+	if err != nil {
+		return nil, err
+	}
+	return linkField(label, highlight, name)
+}
+
+// linkRows highlights the field of the selected row of a list view
+func linkRows(view *gtk.TreeView, highlight fieldHighlighter, field func(index int) string) error {
+	selection, err := view.GetSelection()
+	if err != nil {
+		return err
+	}
+	selection.Connect("changed", func(selection *gtk.TreeSelection) {
+		model, iter, ok := selection.GetSelected()
+		if !ok {
+			return
+		}
+		path, err := model.ToTreeModel().GetPath(iter)
+		if err != nil {
+			return
+		}
+		highlight(field(path.GetIndices()[0]))
+	})
+	return nil
+}
+
+func newIpAddressScrolledList(addrs []*net.UDPAddr, highlight fieldHighlighter) (*gtk.ScrolledWindow, error) {
 	ipAddrStore, err := gtk.ListStoreNew(glib.TYPE_STRING)
 	if err != nil {
 		return nil, err
@@ -155,6 +201,12 @@ func newIpAddressScrolledList(addrs []*net.UDPAddr) (*gtk.ScrolledWindow, error)
 		return nil, err
 	}
 	ipAddrView.AppendColumn(column)
+	err = linkRows(ipAddrView, highlight, func(index int) string {
+		return fmt.Sprintf("Addresses[%d]", index)
+	})
+	if err != nil {
+		return nil, err
+	}
 	for _, addr := range addrs {
 		row := ipAddrStore.Append()
 		err = ipAddrStore.SetValue(row, 0, addr.String())
@@ -171,17 +223,17 @@ func newIpAddressScrolledList(addrs []*net.UDPAddr) (*gtk.ScrolledWindow, error)
 	return ipAddrScrolledView, nil
 }
 
-func openConnectionReq1Viewer(packet *peer.Packet05Layer) (gtk.IWidget, error) {
+func openConnectionReq1Viewer(packet *peer.Packet05Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	versionLabel, err := newLabelF("Version: %d", packet.ProtocolVersion)
+	versionLabel, err := newFieldLabelF(highlight, "ProtocolVersion", "Version: %d", packet.ProtocolVersion)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(versionLabel)
-	paddingLenLabel, err := newLabelF("Padding length: %d", packet.MTUPaddingLength)
+	paddingLenLabel, err := newFieldLabelF(highlight, "MTUPadding", "Padding length: %d", packet.MTUPaddingLength)
 	if err != nil {
 		return nil, err
 	}
@@ -189,22 +241,22 @@ func openConnectionReq1Viewer(packet *peer.Packet05Layer) (gtk.IWidget, error) {
 	box.ShowAll()
 	return box, nil
 }
-func openConnectionResp1Viewer(packet *peer.Packet06Layer) (gtk.IWidget, error) {
+func openConnectionResp1Viewer(packet *peer.Packet06Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	guidLabel, err := newLabelF("GUID: %08X", packet.GUID)
+	guidLabel, err := newFieldLabelF(highlight, "GUID", "GUID: %08X", packet.GUID)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(guidLabel)
-	securityLabel, err := newLabelF("Use security: %v", packet.UseSecurity)
+	securityLabel, err := newFieldLabelF(highlight, "UseSecurity", "Use security: %v", packet.UseSecurity)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(securityLabel)
-	mtuSizeLabel, err := newLabelF("MTU: %d", packet.MTU)
+	mtuSizeLabel, err := newFieldLabelF(highlight, "MTU", "MTU: %d", packet.MTU)
 	if err != nil {
 		return nil, err
 	}
@@ -212,32 +264,32 @@ func openConnectionResp1Viewer(packet *peer.Packet06Layer) (gtk.IWidget, error)
 	box.ShowAll()
 	return box, nil
 }
-func openConnectionReq2Viewer(packet *peer.Packet07Layer) (gtk.IWidget, error) {
+func openConnectionReq2Viewer(packet *peer.Packet07Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	ipAddrLabel, err := newLabelF("IP address: %s", packet.IPAddress)
+	ipAddrLabel, err := newFieldLabelF(highlight, "IPAddress", "IP address: %s", packet.IPAddress)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(ipAddrLabel)
-	mtuSizeLabel, err := newLabelF("MTU: %d", packet.MTU)
+	mtuSizeLabel, err := newFieldLabelF(highlight, "MTU", "MTU: %d", packet.MTU)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(mtuSizeLabel)
-	guidLabel, err := newLabelF("GUID: %08X", packet.GUID)
+	guidLabel, err := newFieldLabelF(highlight, "GUID", "GUID: %08X", packet.GUID)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(guidLabel)
-	supportedVersionLabel, err := newLabelF("Supported version: %d", packet.SupportedVersion)
+	supportedVersionLabel, err := newFieldLabelF(highlight, "SupportedVersion", "Supported version: %d", packet.SupportedVersion)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(supportedVersionLabel)
-	capabilitiesLabel, err := newLabelF("Capabilities: %s", capabilitiesToString(packet.Capabilities))
+	capabilitiesLabel, err := newFieldLabelF(highlight, "Capabilities", "Capabilities: %s", capabilitiesToString(packet.Capabilities))
 	if err != nil {
 		return nil, err
 	}
@@ -245,32 +297,32 @@ func openConnectionReq2Viewer(packet *peer.Packet07Layer) (gtk.IWidget, error) {
 	box.ShowAll()
 	return box, nil
 }
-func openConnectionResp2Viewer(packet *peer.Packet08Layer) (gtk.IWidget, error) {
+func openConnectionResp2Viewer(packet *peer.Packet08Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	guidLabel, err := newLabelF("GUID: %08X", packet.GUID)
+	guidLabel, err := newFieldLabelF(highlight, "GUID", "GUID: %08X", packet.GUID)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(guidLabel)
-	ipAddrLabel, err := newLabelF("IP address: %s", packet.IPAddress)
+	ipAddrLabel, err := newFieldLabelF(highlight, "IPAddress", "IP address: %s", packet.IPAddress)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(ipAddrLabel)
-	mtuSizeLabel, err := newLabelF("MTU: %d", packet.MTU)
+	mtuSizeLabel, err := newFieldLabelF(highlight, "MTU", "MTU: %d", packet.MTU)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(mtuSizeLabel)
-	supportedVersionLabel, err := newLabelF("Supported version: %d", packet.SupportedVersion)
+	supportedVersionLabel, err := newFieldLabelF(highlight, "SupportedVersion", "Supported version: %d", packet.SupportedVersion)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(supportedVersionLabel)
-	capabilitiesLabel, err := newLabelF("Capabilities: %s", capabilitiesToString(packet.Capabilities))
+	capabilitiesLabel, err := newFieldLabelF(highlight, "Capabilities", "Capabilities: %s", capabilitiesToString(packet.Capabilities))
 	if err != nil {
 		return nil, err
 	}
@@ -278,27 +330,27 @@ func openConnectionResp2Viewer(packet *peer.Packet08Layer) (gtk.IWidget, error)
 	box.ShowAll()
 	return box, nil
 }
-func connectionRequestViewer(packet *peer.Packet09Layer) (gtk.IWidget, error) {
+func connectionRequestViewer(packet *peer.Packet09Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	guidLabel, err := newLabelF("GUID: %08X", packet.GUID)
+	guidLabel, err := newFieldLabelF(highlight, "GUID", "GUID: %08X", packet.GUID)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(guidLabel)
-	timeLabel, err := newLabelF("Timestamp: %d", packet.Timestamp)
+	timeLabel, err := newFieldLabelF(highlight, "Timestamp", "Timestamp: %d", packet.Timestamp)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(timeLabel)
-	securityLabel, err := newLabelF("Use security: %v", packet.UseSecurity)
+	securityLabel, err := newFieldLabelF(highlight, "UseSecurity", "Use security: %v", packet.UseSecurity)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(securityLabel)
-	passwordLabel, err := newLabelF("Password: %X", packet.Password)
+	passwordLabel, err := newFieldLabelF(highlight, "Password", "Password: %X", packet.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -307,17 +359,17 @@ func connectionRequestViewer(packet *peer.Packet09Layer) (gtk.IWidget, error) {
 	box.ShowAll()
 	return box, nil
 }
-func connectionAcceptedViewer(packet *peer.Packet10Layer) (gtk.IWidget, error) {
+func connectionAcceptedViewer(packet *peer.Packet10Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	ipAddrLabel, err := newLabelF("IP address: %s", packet.IPAddress)
+	ipAddrLabel, err := newFieldLabelF(highlight, "IPAddress", "IP address: %s", packet.IPAddress)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(ipAddrLabel)
-	indexLabel, err := newLabelF("System index: %d", packet.SystemIndex)
+	indexLabel, err := newFieldLabelF(highlight, "SystemIndex", "System index: %d", packet.SystemIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -328,18 +380,18 @@ func connectionAcceptedViewer(packet *peer.Packet10Layer) (gtk.IWidget, error) {
 	}
 	box.Add(remotesLabel)
 
-	ipAddrScrolledView, err := newIpAddressScrolledList(packet.Addresses[:])
+	ipAddrScrolledView, err := newIpAddressScrolledList(packet.Addresses[:], highlight)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(ipAddrScrolledView)
 
-	sendPingTime, err := newLabelF("Send ping time: %d", packet.SendPingTime)
+	sendPingTime, err := newFieldLabelF(highlight, "SendPingTime", "Send ping time: %d", packet.SendPingTime)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(sendPingTime)
-	sendPongTime, err := newLabelF("Send pong time: %d", packet.SendPongTime)
+	sendPongTime, err := newFieldLabelF(highlight, "SendPongTime", "Send pong time: %d", packet.SendPongTime)
 	if err != nil {
 		return nil, err
 	}
@@ -348,12 +400,12 @@ func connectionAcceptedViewer(packet *peer.Packet10Layer) (gtk.IWidget, error) {
 	box.ShowAll()
 	return box, nil
 }
-func newIncomingConnectionViewer(packet *peer.Packet13Layer) (gtk.IWidget, error) {
+func newIncomingConnectionViewer(packet *peer.Packet13Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	ipAddrLabel, err := newLabelF("IP address: %s", packet.IPAddress)
+	ipAddrLabel, err := newFieldLabelF(highlight, "IPAddress", "IP address: %s", packet.IPAddress)
 	if err != nil {
 		return nil, err
 	}
@@ -364,18 +416,18 @@ func newIncomingConnectionViewer(packet *peer.Packet13Layer) (gtk.IWidget, error
 	}
 	box.Add(remotesLabel)
 
-	ipAddrScrolledView, err := newIpAddressScrolledList(packet.Addresses[:])
+	ipAddrScrolledView, err := newIpAddressScrolledList(packet.Addresses[:], highlight)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(ipAddrScrolledView)
 
-	sendPingTime, err := newLabelF("Send ping time: %d", packet.SendPingTime)
+	sendPingTime, err := newFieldLabelF(highlight, "SendPingTime", "Send ping time: %d", packet.SendPingTime)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(sendPingTime)
-	sendPongTime, err := newLabelF("Send pong time: %d", packet.SendPongTime)
+	sendPongTime, err := newFieldLabelF(highlight, "SendPongTime", "Send pong time: %d", packet.SendPongTime)
 	if err != nil {
 		return nil, err
 	}
@@ -384,7 +436,7 @@ func newIncomingConnectionViewer(packet *peer.Packet13Layer) (gtk.IWidget, error
 	box.ShowAll()
 	return box, nil
 }
-func disconnectionNotificationViewer(packet *peer.Packet15Layer) (gtk.IWidget, error) {
+func disconnectionNotificationViewer(packet *peer.Packet15Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	reasonLabel, err := gtk.LabelNew(fmt.Sprintf("Resolving disconnection reason (%d)...", packet.Reason))
 	if err != nil {
 		return nil, err
@@ -436,46 +488,50 @@ func disconnectionNotificationViewer(packet *peer.Packet15Layer) (gtk.IWidget, e
 			}()
 		}
 	}
-	reasonLabel.ShowAll()
+	linked, err := linkField(reasonLabel, highlight, "Reason")
+	if err != nil {
+		return nil, err
+	}
+	linked.ShowAll()
 
-	return reasonLabel, nil
+	return linked, nil
 }
-func topReplicViewer(packet *peer.Packet81Layer) (gtk.IWidget, error) {
+func topReplicViewer(packet *peer.Packet81Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	streamJob, err := newLabelF("StreamingEnabled: %v", packet.StreamJob)
+	streamJob, err := newFieldLabelF(highlight, "StreamJob", "StreamingEnabled: %v", packet.StreamJob)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(streamJob)
-	filteringEnabled, err := newLabelF("FilteringEnabled: %v", packet.FilteringEnabled)
+	filteringEnabled, err := newFieldLabelF(highlight, "FilteringEnabled", "FilteringEnabled: %v", packet.FilteringEnabled)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(filteringEnabled)
-	bool1, err := newLabelF("Bool1: %v", packet.Bool1)
+	bool1, err := newFieldLabelF(highlight, "Bool1", "Bool1: %v", packet.Bool1)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(bool1)
-	bool2, err := newLabelF("Bool2: %v", packet.Bool2)
+	bool2, err := newFieldLabelF(highlight, "Bool2", "Bool2: %v", packet.Bool2)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(bool2)
-	bool3, err := newLabelF("Bool3: %v", packet.Bool3)
+	bool3, err := newFieldLabelF(highlight, "Bool3", "Bool3: %v", packet.Bool3)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(bool3)
-	characterAutoSpawn, err := newLabelF("CharacterAutoSpawn (?): %v", packet.CharacterAutoSpawn)
+	characterAutoSpawn, err := newFieldLabelF(highlight, "CharacterAutoSpawn", "CharacterAutoSpawn (?): %v", packet.CharacterAutoSpawn)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(characterAutoSpawn)
-	peerId, err := newLabelF("Client peerid: %d", packet.PeerID)
+	peerId, err := newFieldLabelF(highlight, "PeerID", "Client peerid: %d", packet.PeerID)
 	if err != nil {
 		return nil, err
 	}
@@ -511,6 +567,12 @@ func topReplicViewer(packet *peer.Packet81Layer) (gtk.IWidget, error) {
 		}
 		view.AppendColumn(col)
 	}
+	err = linkRows(view, highlight, func(index int) string {
+		return fmt.Sprintf("Items[%d]", index)
+	})
+	if err != nil {
+		return nil, err
+	}
 	for i, item := range packet.Items {
 		row := model.Append()
 		model.SetValue(row, 0, i)
@@ -542,7 +604,7 @@ func topReplicViewer(packet *peer.Packet81Layer) (gtk.IWidget, error) {
 
 	return box, nil
 }
-func submitTicketViewer(packet *peer.Packet8ALayer) (gtk.IWidget, error) {
+func submitTicketViewer(packet *peer.Packet8ALayer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	scrollWindow, err := gtk.ScrolledWindowNew(nil, nil)
 	if err != nil {
 		return nil, err
@@ -618,7 +680,12 @@ func submitTicketViewer(packet *peer.Packet8ALayer) (gtk.IWidget, error) {
 	}
 	box.Add(goldenHash)
 
-	scrollWindow.Add(box)
+	// the fields can't be told apart in the encrypted payload
+	linked, err := linkField(box, highlight, "Encrypted")
+	if err != nil {
+		return nil, err
+	}
+	scrollWindow.Add(linked)
 	scrollWindow.ShowAll()
 	return scrollWindow, nil
 }
@@ -682,7 +749,7 @@ func clusterViewer(packet *peer.Packet8DLayer) (gtk.IWidget, error) {
 	box.ShowAll()
 	return box, nil
 }
-func protocolSyncViewer(packet *peer.Packet90Layer) (gtk.IWidget, error) {
+func protocolSyncViewer(packet *peer.Packet90Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	scrollWindow, err := gtk.ScrolledWindowNew(nil, nil)
 	if err != nil {
 		return nil, err
@@ -767,21 +834,26 @@ func protocolSyncViewer(packet *peer.Packet90Layer) (gtk.IWidget, error) {
 		box.Add(label)
 	}
 
-	scrollWindow.Add(box)
+	// the fields can't be told apart in the encrypted payload
+	linked, err := linkField(box, highlight, "Encrypted")
+	if err != nil {
+		return nil, err
+	}
+	scrollWindow.Add(linked)
 	scrollWindow.ShowAll()
 	return scrollWindow, nil
 }
-func dictionaryFormatViewer(packet *peer.Packet93Layer) (gtk.IWidget, error) {
+func dictionaryFormatViewer(packet *peer.Packet93Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
-	protocolSchemaSync, err := newLabelF("Protocol schema sync: %v", packet.ProtocolSchemaSync)
+	protocolSchemaSync, err := newFieldLabelF(highlight, "Flags", "Protocol schema sync: %v", packet.ProtocolSchemaSync)
 	if err != nil {
 		return nil, err
 	}
 	box.Add(protocolSchemaSync)
-	apiDictionaryCompression, err := newLabelF("API dictionary compression: %v", packet.APIDictionaryCompression)
+	apiDictionaryCompression, err := newFieldLabelF(highlight, "Flags", "API dictionary compression: %v", packet.APIDictionaryCompression)
 	if err != nil {
 		return nil, err
 	}
@@ -823,9 +895,17 @@ func dictionaryFormatViewer(packet *peer.Packet93Layer) (gtk.IWidget, error) {
 		}
 		view.AppendColumn(col)
 	}
+	names := make([]string, 0, len(packet.Params))
 	for name, value := range packet.Params {
+		names = append(names, name)
 		model.InsertWithValues(nil, -1, []int{0, 1}, []interface{}{name, value})
 	}
+	err = linkRows(view, highlight, func(index int) string {
+		return fmt.Sprintf("Params[%q]", names[index])
+	})
+	if err != nil {
+		return nil, err
+	}
 	scrolled.Add(view)
 	scrolled.SetVExpand(true)
 	box.Add(scrolled)
@@ -833,13 +913,13 @@ func dictionaryFormatViewer(packet *peer.Packet93Layer) (gtk.IWidget, error) {
 	box.ShowAll()
 	return box, nil
 }
-func schemaViewer(packet *peer.Packet97Layer) (gtk.IWidget, error) {
+func schemaViewer(packet *peer.Packet97Layer, highlight fieldHighlighter) (gtk.IWidget, error) {
 	box, err := boxWithMargin()
 	if err != nil {
 		return nil, err
 	}
 
-	enumLabel, err := newLabelF("Enum schema (%d entries):", len(packet.Schema.Enums))
+	enumLabel, err := newFieldLabelF(highlight, "Schema", "Enum schema (%d entries):", len(packet.Schema.Enums))
 	if err != nil {
 		return nil, err
 	}
@@ -888,7 +968,7 @@ func schemaViewer(packet *peer.Packet97Layer) (gtk.IWidget, error) {
 	}
 	box.Add(sep)
 
-	classLabel, err := newLabelF("Class schema (%d classes, %d properties, %d events):", len(packet.Schema.Instances), len(packet.Schema.Properties), len(packet.Schema.Events))
+	classLabel, err := newFieldLabelF(highlight, "Schema", "Class schema (%d classes, %d properties, %d events):", len(packet.Schema.Instances), len(packet.Schema.Properties), len(packet.Schema.Events))
 	if err != nil {
 		return nil, err
 	}
@@ -942,7 +1022,7 @@ func schemaViewer(packet *peer.Packet97Layer) (gtk.IWidget, error) {
 	classesScrolled.SetVExpand(true)
 	box.Add(classesScrolled)
 
-	prefixLabel, err := newLabelF("Preshared Content prefixes (%d entries):", len(packet.Schema.ContentPrefixes))
+	prefixLabel, err := newFieldLabelF(highlight, "Schema", "Preshared Content prefixes (%d entries):", len(packet.Schema.ContentPrefixes))
 	if err != nil {
 		return nil, err
 	}
@@ -1014,6 +1094,14 @@ func schemaViewer(packet *peer.Packet97Layer) (gtk.IWidget, error) {
 		filter.AddPattern("*.txt")
 		filter.SetName("TXT files (*.txt)")
 		dialog.AddFilter(filter)
+		jsonFilter, err := gtk.FileFilterNew()
+		if err != nil {
+			println("Failed to make filter:", err.Error())
+			return
+		}
+		jsonFilter.AddPattern("*.json")
+		jsonFilter.SetName("JSON files (*.json)")
+		dialog.AddFilter(jsonFilter)
 		resp := dialog.Run()
 		if gtk.ResponseType(resp) == gtk.RESPONSE_ACCEPT {
 			filename := dialog.GetFilename()
@@ -1022,7 +1110,12 @@ func schemaViewer(packet *peer.Packet97Layer) (gtk.IWidget, error) {
 				ShowError(box, err, "Saving schema to file")
 				return
 			}
-			err = packet.Schema.Dump(schemaFile)
+			defer schemaFile.Close()
+			if strings.HasSuffix(filename, ".json") {
+				err = packet.Schema.DumpJSON(schemaFile)
+			} else {
+				err = packet.Schema.Dump(schemaFile)
+			}
 			if err != nil {
 				ShowError(box, err, "Saving schema to file")
 			}
@@ -1071,38 +1164,80 @@ func luauChallengeViewer(packet *peer.Packet9BLayer) (gtk.IWidget, error) {
 	return box, nil
 }
 
-func viewerForMainPacket(packet peer.RakNetPacket) (gtk.IWidget, error) {
+func rawPacketViewer(packet *peer.RawPacket) (gtk.IWidget, error) {
+	box, err := boxWithMargin()
+	if err != nil {
+		return nil, err
+	}
+	label, err := newLabelF("%s (0x%02X), %d bytes", packet.TypeString(), packet.PacketType, len(packet.Payload))
+	if err != nil {
+		return nil, err
+	}
+	box.Add(label)
+
+	textBuffer, err := gtk.TextBufferNew(nil)
+	if err != nil {
+		return nil, err
+	}
+	textBuffer.SetText(hex.Dump(packet.Payload))
+	hexView, err := gtk.TextViewNewWithBuffer(textBuffer)
+	if err != nil {
+		return nil, err
+	}
+	hexView.SetProperty("monospace", true)
+	hexView.SetEditable(false)
+	scrolled, err := gtk.ScrolledWindowNew(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	scrolled.SetVExpand(true)
+	scrolled.Add(hexView)
+	box.Add(scrolled)
+
+	box.ShowAll()
+	return box, nil
+}
+
+// viewerForMainPacket creates a viewer for the main layer of a packet.
+// Clicking the fields in the viewer highlights them with highlight.
+func viewerForMainPacket(packet peer.RakNetPacket, highlight fieldHighlighter) (gtk.IWidget, error) {
+	switch packet := packet.(type) {
+	case *peer.RawPacket:
+		return rawPacketViewer(packet)
+	case *peer.CustomPacket:
+		return blanketViewer(packet.String())
+	}
 	switch packet.Type() {
-	case 0x00, 0x03, 0x83, 0x84, 0x85, 0x86, 0x87, 0x8F, 0x92, 0x96, 0x98:
+	case 0x00, 0x03, 0x04, 0x83, 0x84, 0x85, 0x86, 0x87, 0x8E, 0x8F, 0x92, 0x94, 0x95, 0x96, 0x98:
 		return blanketViewer(packet.String())
 	case 0x05:
-		return openConnectionReq1Viewer(packet.(*peer.Packet05Layer))
+		return openConnectionReq1Viewer(packet.(*peer.Packet05Layer), highlight)
 	case 0x06:
-		return openConnectionResp1Viewer(packet.(*peer.Packet06Layer))
+		return openConnectionResp1Viewer(packet.(*peer.Packet06Layer), highlight)
 	case 0x07:
-		return openConnectionReq2Viewer(packet.(*peer.Packet07Layer))
+		return openConnectionReq2Viewer(packet.(*peer.Packet07Layer), highlight)
 	case 0x08:
-		return openConnectionResp2Viewer(packet.(*peer.Packet08Layer))
+		return openConnectionResp2Viewer(packet.(*peer.Packet08Layer), highlight)
 	case 0x09:
-		return connectionRequestViewer(packet.(*peer.Packet09Layer))
+		return connectionRequestViewer(packet.(*peer.Packet09Layer), highlight)
 	case 0x10:
-		return connectionAcceptedViewer(packet.(*peer.Packet10Layer))
+		return connectionAcceptedViewer(packet.(*peer.Packet10Layer), highlight)
 	case 0x13:
-		return newIncomingConnectionViewer(packet.(*peer.Packet13Layer))
+		return newIncomingConnectionViewer(packet.(*peer.Packet13Layer), highlight)
 	case 0x15:
-		return disconnectionNotificationViewer(packet.(*peer.Packet15Layer))
+		return disconnectionNotificationViewer(packet.(*peer.Packet15Layer), highlight)
 	case 0x81:
-		return topReplicViewer(packet.(*peer.Packet81Layer))
+		return topReplicViewer(packet.(*peer.Packet81Layer), highlight)
 	case 0x8A:
-		return submitTicketViewer(packet.(*peer.Packet8ALayer))
+		return submitTicketViewer(packet.(*peer.Packet8ALayer), highlight)
 	case 0x8D:
 		return clusterViewer(packet.(*peer.Packet8DLayer))
 	case 0x90:
-		return protocolSyncViewer(packet.(*peer.Packet90Layer))
+		return protocolSyncViewer(packet.(*peer.Packet90Layer), highlight)
 	case 0x93:
-		return dictionaryFormatViewer(packet.(*peer.Packet93Layer))
+		return dictionaryFormatViewer(packet.(*peer.Packet93Layer), highlight)
 	case 0x97:
-		return schemaViewer(packet.(*peer.Packet97Layer))
+		return schemaViewer(packet.(*peer.Packet97Layer), highlight)
 	case 0x9B:
 		return luauChallengeViewer(packet.(*peer.Packet9BLayer))
 	default:
@@ -12,6 +12,15 @@ import (
 	"github.com/gotk3/gotk3/gtk"
 )
 
+const (
+	COL_RANGE_NAME = iota
+	COL_RANGE_BYTES
+	COL_RANGE_INDEX
+)
+
+// fieldHighlightTag is the name of the tag that marks the selected field in the hex dump
+const fieldHighlightTag = "fieldhighlight"
+
 type splitPacketRange struct {
 	start uint32
 	end   uint32 // inclusive
@@ -24,6 +33,12 @@ type PacketDetailsViewer struct {
 	hexBox      *gtk.TextView
 	hexDumpData []byte
 
+	// layers is the packet shown in the hex dump
+	layers      *peer.PacketLayers
+	fieldsModel *gtk.ListStore
+	fieldsView  *gtk.TreeView
+	fieldRows   []*gtk.TreeIter
+
 	reliablity        *gtk.Label
 	rmNumber          *gtk.Label
 	channel           *gtk.Label
@@ -78,6 +93,31 @@ func NewPacketDetailsViewer() (*PacketDetailsViewer, error) {
 	if !ok {
 		return nil, invalidUi("hexbox")
 	}
+	hexBox.Connect("button-release-event", func() bool {
+		viewer.hexDumpClicked()
+		return false
+	})
+	fieldsModel_, err := builder.GetObject("fieldsliststore")
+	if err != nil {
+		return nil, err
+	}
+	fieldsModel, ok := fieldsModel_.(*gtk.ListStore)
+	if !ok {
+		return nil, invalidUi("fieldsliststore")
+	}
+	fieldsView_, err := builder.GetObject("fieldsview")
+	if err != nil {
+		return nil, err
+	}
+	fieldsView, ok := fieldsView_.(*gtk.TreeView)
+	if !ok {
+		return nil, invalidUi("fieldsview")
+	}
+	fieldsSelection, err := fieldsView.GetSelection()
+	if err != nil {
+		return nil, err
+	}
+	fieldsSelection.Connect("changed", viewer.fieldSelected)
 	copyHex_, err := builder.GetObject("copyashexstreambutton")
 	if err != nil {
 		return nil, err
@@ -216,6 +256,8 @@ func NewPacketDetailsViewer() (*PacketDetailsViewer, error) {
 	viewer.mainWidget = notebook
 	viewer.logBox = logBox
 	viewer.hexBox = hexBox
+	viewer.fieldsModel = fieldsModel
+	viewer.fieldsView = fieldsView
 	viewer.reliablity = reliability
 	viewer.rmNumber = rmNumber
 	viewer.channel = channel
@@ -237,10 +279,148 @@ func (viewer *PacketDetailsViewer) updateHexTab(layers *peer.PacketLayers) error
 		return err
 	}
 	textBuffer.SetText(hex.Dump(viewer.hexDumpData))
+	textBuffer.CreateTag(fieldHighlightTag, map[string]interface{}{"background": "#FFE082"})
 	viewer.hexBox.SetBuffer(textBuffer)
+
+	viewer.layers = layers
+	viewer.fieldsModel.Clear()
+	viewer.fieldRows = viewer.fieldRows[:0]
+	for i, field := range layers.Fields {
+		start, end := field.Bytes()
+		row := viewer.fieldsModel.Append()
+		viewer.fieldsModel.SetValue(row, COL_RANGE_NAME, field.Name)
+		viewer.fieldsModel.SetValue(row, COL_RANGE_BYTES, fmt.Sprintf("%d-%d", start, end-1))
+		viewer.fieldsModel.SetValue(row, COL_RANGE_INDEX, i)
+		viewer.fieldRows = append(viewer.fieldRows, row)
+	}
 	return nil
 }
 
+// hexDumpColumns returns the line of a byte in the output of hex.Dump
+// and the columns of its hex digits and its character
+func hexDumpColumns(offset int) (int, int, int) {
+	column := offset % 16
+	hexColumn := 10 + 3*column
+	if column >= 8 {
+		hexColumn++
+	}
+	return offset / 16, hexColumn, 61 + column
+}
+
+// hexDumpOffset returns the byte shown at a position in the output
+// of hex.Dump, or -1 if there is no byte at that position
+func hexDumpOffset(line int, column int) int {
+	switch {
+	case column >= 10 && column < 34:
+		return line*16 + (column-10)/3
+	case column >= 35 && column < 59:
+		return line*16 + 8 + (column-35)/3
+	case column >= 61 && column < 77:
+		return line*16 + column - 61
+	}
+	return -1
+}
+
+// highlightBytes marks bytes from start to end (exclusive) in the hex dump
+func (viewer *PacketDetailsViewer) highlightBytes(start int, end int) {
+	buffer, err := viewer.hexBox.GetBuffer()
+	if err != nil {
+		println("failed to get hex buffer:", err.Error())
+		return
+	}
+	buffer.RemoveTagByName(fieldHighlightTag, buffer.GetStartIter(), buffer.GetEndIter())
+	if end > len(viewer.hexDumpData) {
+		end = len(viewer.hexDumpData)
+	}
+	for offset := start; offset < end; {
+		line, hexColumn, charColumn := hexDumpColumns(offset)
+		lineEnd := (line + 1) * 16
+		if lineEnd > end {
+			lineEnd = end
+		}
+		_, lastHexColumn, lastCharColumn := hexDumpColumns(lineEnd - 1)
+		buffer.ApplyTagByName(fieldHighlightTag, buffer.GetIterAtLineOffset(line, hexColumn), buffer.GetIterAtLineOffset(line, lastHexColumn+2))
+		buffer.ApplyTagByName(fieldHighlightTag, buffer.GetIterAtLineOffset(line, charColumn), buffer.GetIterAtLineOffset(line, lastCharColumn+1))
+		offset = lineEnd
+	}
+	if start < end {
+		viewer.hexBox.ScrollToIter(buffer.GetIterAtLineOffset(start/16, 0), 0.1, false, 0, 0)
+	}
+}
+
+func (viewer *PacketDetailsViewer) fieldSelected(selection *gtk.TreeSelection) {
+	_, treeIter, ok := selection.GetSelected()
+	if !ok {
+		viewer.highlightBytes(0, 0)
+		return
+	}
+	indexValue, err := viewer.fieldsModel.GetValue(treeIter, COL_RANGE_INDEX)
+	if err != nil {
+		println("failed to get field index:", err.Error())
+		return
+	}
+	index, err := indexValue.GoValue()
+	if err != nil {
+		println("failed to get field index:", err.Error())
+		return
+	}
+	viewer.highlightBytes(viewer.layers.Fields[index.(int)].Bytes())
+}
+
+func (viewer *PacketDetailsViewer) selectField(index int) {
+	selection, err := viewer.fieldsView.GetSelection()
+	if err != nil {
+		println("failed to get field selection:", err.Error())
+		return
+	}
+	selection.SelectIter(viewer.fieldRows[index])
+	path, err := viewer.fieldsModel.GetPath(viewer.fieldRows[index])
+	if err == nil {
+		viewer.fieldsView.ScrollToCell(path, nil, false, 0, 0)
+	}
+}
+
+// hexDumpClicked selects the innermost field that contains the clicked byte
+func (viewer *PacketDetailsViewer) hexDumpClicked() {
+	if viewer.layers == nil {
+		return
+	}
+	buffer, err := viewer.hexBox.GetBuffer()
+	if err != nil {
+		println("failed to get hex buffer:", err.Error())
+		return
+	}
+	iter := buffer.GetIterAtMark(buffer.GetInsert())
+	offset := hexDumpOffset(iter.GetLine(), iter.GetLineOffset())
+	if offset < 0 || offset >= len(viewer.hexDumpData) {
+		return
+	}
+	fields := viewer.layers.FieldsAt(offset)
+	if len(fields) == 0 {
+		return
+	}
+	for i, field := range viewer.layers.Fields {
+		if field == fields[0] {
+			viewer.selectField(i)
+			return
+		}
+	}
+}
+
+// HighlightField selects the field with the given name and highlights
+// its bytes in the hex dump
+func (viewer *PacketDetailsViewer) HighlightField(name string) {
+	if viewer.layers == nil {
+		return
+	}
+	for i, field := range viewer.layers.Fields {
+		if field.Name == name {
+			viewer.selectField(i)
+			return
+		}
+	}
+}
+
 var reliabilityNames = []string{
 	"Unreliable",
 	"Unreliable, sequenced",
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"time"
 
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/filter"
 	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/Gskartwii/roblox-dissector/project"
+	"github.com/Gskartwii/roblox-dissector/store"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
@@ -15,11 +22,13 @@ const (
 	COL_PACKET
 	COL_DIRECTION
 	COL_LEN_BYTES
+	COL_TIME
 	COL_COLOR
 	COL_HAS_LENGTH
 	COL_MAIN_PACKET_ID
 	COL_SUBPACKET_ID
 	COL_PACKET_KIND
+	COL_BOOKMARK
 )
 
 const (
@@ -32,8 +41,12 @@ const (
 	KIND_TOUCH
 )
 
+// defaultRowHeight is used to estimate the number of visible rows
+// in low-memory mode until the height of a row can be measured
+const defaultRowHeight = 24
+
 type PacketListViewer struct {
-	Conversation *Conversation
+	Conversation *capture.Conversation
 
 	updatePassthrough bool
 	queuedChannels    []string
@@ -48,6 +61,8 @@ type PacketListViewer struct {
 	sortModel   *gtk.TreeModelSort
 
 	packetDetailsViewer *PacketDetailsViewer
+	detailsPane         *gtk.Paned
+	breakpointViewer    *BreakpointViewer
 
 	packetRows        map[uint64]*gtk.TreePath
 	packetStore       map[uint64]*peer.PacketLayers
@@ -56,9 +71,30 @@ type PacketListViewer struct {
 
 	FilterScript    string
 	FilterLogWindow *FilterLogWindow
+	// Bookmarks maps the UniqueIDs of bookmarked packets to their notes
+	Bookmarks map[uint64]string
 
 	filter      *lua.FunctionProto
 	filterState *lua.LState
+
+	// diskStore keeps the packets on disk in low-memory mode.
+	// Only the packets that fit in the visible area have rows, and
+	// windowScrollbar scrolls through the store instead of the rows.
+	diskStore         *store.Store
+	freshConversation func() *capture.Conversation
+	decoding          map[uint64]bool
+	windowIDs         map[uint64]bool
+	windowStart       int
+	windowRows        int
+	windowSize        int
+	followTail        bool
+	slidePending      bool
+	movingWindow      bool
+	scrolledList      *gtk.ScrolledWindow
+	windowAdjustment  *gtk.Adjustment
+	windowScrollbar   *gtk.Scrollbar
+	windowLabel       *gtk.Label
+	warningLabel      *gtk.Label
 }
 
 func ShowPacketListViewerWindow(title string, forPacket *peer.PacketLayers) error {
@@ -89,13 +125,14 @@ func ShowPacketListViewerWindow(title string, forPacket *peer.PacketLayers) erro
 	return nil
 }
 
-func NewPacketListViewer(title string, conversation *Conversation) (*PacketListViewer, error) {
+func NewPacketListViewer(title string, conversation *capture.Conversation) (*PacketListViewer, error) {
 	viewer := &PacketListViewer{
 		Conversation:      conversation,
 		packetRows:        make(map[uint64]*gtk.TreePath),
 		packetStore:       make(map[uint64]*peer.PacketLayers),
 		packetTypeApplied: make(map[uint64]bool),
 		lazyLoadFakeRows:  make(map[uint64]*gtk.TreePath),
+		Bookmarks:         make(map[uint64]string),
 		updatePassthrough: true,
 	}
 
@@ -110,11 +147,13 @@ func NewPacketListViewer(title string, conversation *Conversation) (*PacketListV
 		glib.TYPE_STRING,  // COL_PACKET
 		glib.TYPE_STRING,  // COL_DIRECTION
 		glib.TYPE_INT64,   // COL_LEN_BYTES
+		glib.TYPE_STRING,  // COL_TIME
 		glib.TYPE_STRING,  // COL_COLOR
 		glib.TYPE_BOOLEAN, // COL_HAS_LENGTH
 		glib.TYPE_INT64,   // COL_MAIN_PACKET_ID
 		glib.TYPE_INT64,   // COL_SUBPACKET_ID
 		glib.TYPE_INT64,   // COL_PACKET_KIND
+		glib.TYPE_STRING,  // COL_BOOKMARK
 	)
 	if err != nil {
 		return nil, err
@@ -135,7 +174,7 @@ func NewPacketListViewer(title string, conversation *Conversation) (*PacketListV
 		return nil, err
 	}
 
-	for i, colName := range []string{"ID", "Packet", "Direction", "Length in bytes"} {
+	for i, colName := range []string{"ID", "Packet", "Direction", "Length in bytes", "Time"} {
 		colRenderer, err := gtk.CellRendererTextNew()
 		if err != nil {
 			return nil, err
@@ -156,6 +195,17 @@ func NewPacketListViewer(title string, conversation *Conversation) (*PacketListV
 		col.SetSortColumnID(i)
 		treeView.AppendColumn(col)
 	}
+	bookmarkRenderer, err := gtk.CellRendererTextNew()
+	if err != nil {
+		return nil, err
+	}
+	bookmarkCol, err := gtk.TreeViewColumnNewWithAttribute("Bookmark", bookmarkRenderer, "text", COL_BOOKMARK)
+	if err != nil {
+		return nil, err
+	}
+	bookmarkCol.AddAttribute(bookmarkRenderer, "background", COL_COLOR)
+	bookmarkCol.SetSortColumnID(COL_BOOKMARK)
+	treeView.AppendColumn(bookmarkCol)
 
 	scrolledList, err := gtk.ScrolledWindowNew(nil, nil)
 	if err != nil {
@@ -168,12 +218,99 @@ func NewPacketListViewer(title string, conversation *Conversation) (*PacketListV
 		return nil, err
 	}
 
+	detailsPane, err := gtk.PanedNew(gtk.ORIENTATION_HORIZONTAL)
+	if err != nil {
+		return nil, err
+	}
+	detailsPane.Pack1(packetDetailsViewer.mainWidget, true, false)
+
 	mainWidget, err := gtk.PanedNew(gtk.ORIENTATION_VERTICAL)
 	if err != nil {
 		return nil, err
 	}
-	mainWidget.Add(scrolledList)
-	mainWidget.Add(packetDetailsViewer.mainWidget)
+	windowLabel, err := gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	warningLabel, err := gtk.LabelNew("")
+	if err != nil {
+		return nil, err
+	}
+	warningLabel.SetLineWrap(true)
+	warningLabel.SetNoShowAll(true)
+	windowAdjustment, err := gtk.AdjustmentNew(0, 0, 0, 1, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	windowAdjustment.Connect("value-changed", func() {
+		if !viewer.movingWindow && viewer.diskStore != nil {
+			viewer.showWindow(int(windowAdjustment.GetValue()))
+		}
+	})
+	windowScrollbar, err := gtk.ScrollbarNew(gtk.ORIENTATION_VERTICAL, windowAdjustment)
+	if err != nil {
+		return nil, err
+	}
+	// the label and the scrollbar are only shown in low-memory mode
+	windowLabel.SetNoShowAll(true)
+	windowScrollbar.SetNoShowAll(true)
+	scrolledList.Connect("size-allocate", func() {
+		if viewer.diskStore == nil {
+			return
+		}
+		size := viewer.visibleRows()
+		if size == viewer.windowSize {
+			return
+		}
+		viewer.windowSize = size
+		// the rows can't be changed during the allocation
+		glib.IdleAdd(func() bool {
+			if viewer.followTail {
+				viewer.showWindow(viewer.tailStart())
+			} else {
+				viewer.showWindow(viewer.windowStart)
+			}
+			return false
+		})
+	})
+	treeView.Connect("scroll-event", func(_ *gtk.TreeView, evt *gdk.Event) bool {
+		if viewer.diskStore == nil {
+			return false
+		}
+		scroll := gdk.EventScrollNewFromEvent(evt)
+		switch scroll.Direction() {
+		case gdk.SCROLL_UP:
+			viewer.scrollWindow(-3)
+		case gdk.SCROLL_DOWN:
+			viewer.scrollWindow(3)
+		case gdk.SCROLL_SMOOTH:
+			viewer.scrollWindow(int(scroll.DeltaY() * 3))
+		}
+		return true
+	})
+	treeView.Connect("key-press-event", func(_ *gtk.TreeView, evt *gdk.Event) bool {
+		if viewer.diskStore == nil {
+			return false
+		}
+		return viewer.windowKeyPressed(gdk.EventKeyNewFromEvent(evt).KeyVal())
+	})
+
+	listBox, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	if err != nil {
+		return nil, err
+	}
+	scrolledBox, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
+	if err != nil {
+		return nil, err
+	}
+	scrolledBox.PackStart(scrolledList, true, true, 0)
+	scrolledBox.PackStart(windowScrollbar, false, false, 0)
+	listBox.PackStart(warningLabel, false, false, 2)
+	listBox.PackStart(windowLabel, false, false, 2)
+	listBox.PackStart(scrolledBox, true, true, 0)
+
+	mainWidget.Add(listBox)
+	mainWidget.Add(detailsPane)
 
 	sel, err := treeView.GetSelection()
 	if err != nil {
@@ -224,7 +361,21 @@ func NewPacketListViewer(title string, conversation *Conversation) (*PacketListV
 				return
 			}
 
-			viewer.addSubpackets(iter, viewer.packetStore[baseId])
+			layers, ok := viewer.layersFor(baseId)
+			if !ok {
+				// the packet has been evicted from memory, expand the row
+				// again once it has been decoded
+				pathString := sortFilterPath.String()
+				viewer.treeView.CollapseRow(sortFilterPath)
+				viewer.decodeLater(baseId, func() {
+					path, err := gtk.TreePathNewFromString(pathString)
+					if err == nil {
+						viewer.treeView.ExpandRow(path, false)
+					}
+				})
+				return
+			}
+			viewer.addSubpackets(iter, layers)
 			delete(viewer.lazyLoadFakeRows, baseId)
 			viewer.treeView.ExpandRow(sortFilterPath, false)
 		}
@@ -269,24 +420,62 @@ func NewPacketListViewer(title string, conversation *Conversation) (*PacketListV
 				println("failed to get packet kind from selection")
 				return
 			}
-			if kind == KIND_MAIN {
-				mainPacket := viewer.packetStore[baseId]
-				err = ShowPacketListViewerWindow(fmt.Sprintf("View packet %d: %s", baseId, mainPacket.String()), mainPacket)
-			} else {
-				mainPacketId, err := viewer.uint64FromIter(iter, COL_MAIN_PACKET_ID, viewer.sortModel)
+			mainPacketId := baseId
+			if kind != KIND_MAIN {
+				mainPacketId, err = viewer.uint64FromIter(iter, COL_MAIN_PACKET_ID, viewer.sortModel)
 				if err != nil {
 					println("failed to parent id from selection:", err.Error())
 					return
 				}
-				mainPacket := viewer.packetStore[mainPacketId]
-				err = ShowPacketListViewerWindow(fmt.Sprintf("View packet %d: %s", baseId, mainPacket.String()), mainPacket)
 			}
-			if err != nil {
-				println("failed to make packet viewer")
+			showPacket := func() {
+				mainPacket, _ := viewer.layersFor(mainPacketId)
+				err := ShowPacketListViewerWindow(fmt.Sprintf("View packet %d: %s", baseId, mainPacket.String()), mainPacket)
+				if err != nil {
+					println("failed to make packet viewer")
+				}
+			}
+			if _, ok := viewer.layersFor(mainPacketId); !ok {
+				viewer.decodeLater(mainPacketId, showPacket)
 				return
 			}
+			showPacket()
 		})
 		popupMenu.Append(showAction)
+
+		kind, err := viewer.uint64FromIter(iter, COL_PACKET_KIND, viewer.sortModel)
+		if err == nil && kind == KIND_MAIN {
+			baseId, err := viewer.uint64FromIter(iter, COL_ID, viewer.sortModel)
+			if err != nil {
+				println("failed to base id from selection")
+				return
+			}
+			bookmarkAction, err := gtk.MenuItemNewWithLabel("Bookmark packet...")
+			if err != nil {
+				println("Failed to make menu:", err.Error())
+				return
+			}
+			bookmarkAction.Connect("activate", func() {
+				err := NewEditTextWindow(fmt.Sprintf("Bookmark note for packet %d", baseId), viewer.Bookmarks[baseId], func(note string) {
+					viewer.SetBookmark(baseId, note)
+				})
+				if err != nil {
+					ShowError(viewer.mainWidget, err, "Editing bookmark")
+				}
+			})
+			popupMenu.Append(bookmarkAction)
+			if _, ok := viewer.Bookmarks[baseId]; ok {
+				removeAction, err := gtk.MenuItemNewWithLabel("Remove bookmark")
+				if err != nil {
+					println("Failed to make menu:", err.Error())
+					return
+				}
+				removeAction.Connect("activate", func() {
+					viewer.RemoveBookmark(baseId)
+				})
+				popupMenu.Append(removeAction)
+			}
+		}
 		popupMenu.ShowAll()
 		popupMenu.PopupAtPointer(evt)
 	})
@@ -296,14 +485,34 @@ func NewPacketListViewer(title string, conversation *Conversation) (*PacketListV
 
 	viewer.title = title
 	viewer.packetDetailsViewer = packetDetailsViewer
+	viewer.detailsPane = detailsPane
 	viewer.mainWidget = mainWidget
 	viewer.treeView = treeView
 	viewer.model = model
 	viewer.filterModel = filterModel
 	viewer.sortModel = sortModel
+	viewer.scrolledList = scrolledList
+	viewer.windowAdjustment = windowAdjustment
+	viewer.windowScrollbar = windowScrollbar
+	viewer.windowLabel = windowLabel
+	viewer.warningLabel = warningLabel
 	return viewer, nil
 }
 
+// ShowWarning shows a warning about the decoding of the conversation above the packets
+func (viewer *PacketListViewer) ShowWarning(text string) {
+	viewer.warningLabel.SetText(text)
+	viewer.warningLabel.SetNoShowAll(false)
+	viewer.warningLabel.Show()
+}
+
+// AttachBreakpointViewer shows the breakpoint viewer next to the packet details
+func (viewer *PacketListViewer) AttachBreakpointViewer(breakpointViewer *BreakpointViewer) {
+	viewer.breakpointViewer = breakpointViewer
+	viewer.detailsPane.Pack2(breakpointViewer.mainWidget, false, true)
+	breakpointViewer.mainWidget.ShowAll()
+}
+
 func (viewer *PacketListViewer) FilterAcceptsPacket(model *gtk.TreeModelFilter, iter *gtk.TreeIter, userData interface{}) bool {
 	if viewer.filter == nil {
 		return true
@@ -332,7 +541,7 @@ func (viewer *PacketListViewer) FilterAcceptsPacket(model *gtk.TreeModelFilter,
 	case KIND_UNINITIALIZED:
 		return true
 	case KIND_MAIN:
-		if packet, ok := viewer.packetStore[baseId]; ok {
+		if packet, ok := viewer.layersFor(baseId); ok {
 			// when filtering, drop error packets by default
 			if packet.Main == nil {
 				return false
@@ -341,7 +550,7 @@ func (viewer *PacketListViewer) FilterAcceptsPacket(model *gtk.TreeModelFilter,
 				return false
 			}
 
-			acc, err := FilterAcceptsPacket(viewer.filterState, viewer.filter, packet.Main)
+			acc, err := filter.FilterAcceptsPacket(viewer.filterState, viewer.filter, packet.Main)
 			if err != nil {
 				reportError(baseId, err)
 				return true
@@ -354,8 +563,13 @@ func (viewer *PacketListViewer) FilterAcceptsPacket(model *gtk.TreeModelFilter,
 			println("failed to base id for filtering")
 			return true
 		}
-		replicPacket := viewer.packetStore[mainPacketId].Main.(*peer.Packet83Layer).SubPackets[baseId]
-		acc, err := FilterAcceptsReplicPacket(viewer.filterState, viewer.filter, replicPacket)
+		mainPacket, ok := viewer.layersFor(mainPacketId)
+		if !ok {
+			// evicted packets are only filtered once they have been decoded again
+			return true
+		}
+		replicPacket := mainPacket.Main.(*peer.Packet83Layer).SubPackets[baseId]
+		acc, err := filter.FilterAcceptsReplicPacket(viewer.filterState, viewer.filter, replicPacket)
 		if err != nil {
 			reportError(mainPacketId, err)
 			return true
@@ -375,21 +589,406 @@ func (viewer *PacketListViewer) ApplyFilter(script string) {
 		viewer.filterModel.Refilter()
 		return
 	}
-	compiled, err := CompileFilter(script)
+	compiled, err := filter.CompileFilter(script)
 	if err != nil {
 		ShowError(viewer.mainWidget, err, "Failed to compile filter")
 		return
 	}
 	viewer.filter = compiled
-	viewer.filterState = NewLuaFilterState(viewer.FilterLogWindow.AppendLog)
+	viewer.filterState = filter.NewLuaFilterState(viewer.FilterLogWindow.AppendLog)
 	viewer.filterModel.Refilter()
 }
 
+// SetBookmark bookmarks a packet with a note
+func (viewer *PacketListViewer) SetBookmark(id uint64, note string) {
+	viewer.Bookmarks[id] = note
+	viewer.refreshBookmarks()
+}
+
+// RemoveBookmark removes the bookmark of a packet
+func (viewer *PacketListViewer) RemoveBookmark(id uint64) {
+	delete(viewer.Bookmarks, id)
+	viewer.refreshBookmarks()
+}
+
+// SortedBookmarks returns the bookmarks ordered by packet ID
+func (viewer *PacketListViewer) SortedBookmarks() []project.Bookmark {
+	bookmarks := make([]project.Bookmark, 0, len(viewer.Bookmarks))
+	for id, note := range viewer.Bookmarks {
+		bookmarks = append(bookmarks, project.Bookmark{PacketID: id, Note: note})
+	}
+	sort.Slice(bookmarks, func(i, j int) bool {
+		return bookmarks[i].PacketID < bookmarks[j].PacketID
+	})
+	return bookmarks
+}
+
+// refreshBookmarks updates the bookmark column of the main packet rows
+func (viewer *PacketListViewer) refreshBookmarks() {
+	iter, ok := viewer.model.GetIterFirst()
+	for ok {
+		id, err := viewer.uint64FromIter(iter, COL_ID, viewer.model)
+		if err != nil {
+			println("failed to get id for bookmark:", err.Error())
+			return
+		}
+		viewer.model.SetValue(iter, COL_BOOKMARK, viewer.bookmarkLabel(id))
+		ok = viewer.model.IterNext(iter)
+	}
+}
+
+// bookmarkLabel returns the contents of the bookmark column for a packet
+func (viewer *PacketListViewer) bookmarkLabel(id uint64) string {
+	if note, bookmarked := viewer.Bookmarks[id]; bookmarked {
+		return "\u2605 " + note
+	}
+	return ""
+}
+
+// UseDiskStore makes the viewer keep its packets in diskStore instead of
+// memory. freshConversation creates conversations with the same settings
+// as the viewer's conversation, for decoding evicted packets again.
+func (viewer *PacketListViewer) UseDiskStore(diskStore *store.Store, freshConversation func() *capture.Conversation) {
+	viewer.diskStore = diskStore
+	viewer.freshConversation = freshConversation
+	viewer.decoding = make(map[uint64]bool)
+	viewer.windowIDs = make(map[uint64]bool)
+	viewer.windowSize = viewer.visibleRows()
+	viewer.followTail = true
+	// the rows are scrolled by windowScrollbar instead
+	viewer.scrolledList.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_EXTERNAL)
+	viewer.windowLabel.SetNoShowAll(false)
+	viewer.windowLabel.Show()
+	viewer.windowScrollbar.SetNoShowAll(false)
+	viewer.windowScrollbar.Show()
+	viewer.updateWindow()
+}
+
+// CloseDiskStore removes the files of the viewer's disk store, if it has one
+func (viewer *PacketListViewer) CloseDiskStore() {
+	if viewer.diskStore != nil {
+		err := viewer.diskStore.Close()
+		if err != nil {
+			println("failed to close packet store:", err.Error())
+		}
+	}
+}
+
+// layersFor returns the decoded layers of a main packet. In low-memory mode
+// it returns false if the packet has been evicted from memory.
+func (viewer *PacketListViewer) layersFor(id uint64) (*peer.PacketLayers, bool) {
+	if layers, ok := viewer.packetStore[id]; ok {
+		return layers, true
+	}
+	if viewer.diskStore != nil {
+		return viewer.diskStore.Cached(id)
+	}
+	return nil, false
+}
+
+// keepLayers keeps the decoded layers of a finished packet
+func (viewer *PacketListViewer) keepLayers(layers *peer.PacketLayers) {
+	if viewer.diskStore == nil {
+		viewer.packetStore[layers.UniqueID] = layers
+		return
+	}
+	delete(viewer.packetStore, layers.UniqueID)
+	viewer.diskStore.Remember(layers)
+}
+
+// decodeLater decodes an evicted packet again in the background
+// and calls done on the main loop once it is in memory
+func (viewer *PacketListViewer) decodeLater(id uint64, done func()) {
+	if viewer.diskStore == nil || viewer.decoding[id] {
+		return
+	}
+	viewer.decoding[id] = true
+	diskStore := viewer.diskStore
+	freshConversation := viewer.freshConversation
+	go func() {
+		_, err := diskStore.Redecode(context.Background(), freshConversation, id)
+		glib.IdleAdd(func() bool {
+			delete(viewer.decoding, id)
+			if err != nil {
+				ShowError(viewer.mainWidget, err, "Decoding packet")
+				return false
+			}
+			done()
+			return false
+		})
+	}()
+}
+
+// admitRow reports whether a row should be added for a new main packet.
+// In low-memory mode, new rows are only added while the window shows the
+// last packets, and the window slides forward when it is full.
+func (viewer *PacketListViewer) admitRow(id uint64) bool {
+	if viewer.diskStore == nil {
+		return true
+	}
+	defer viewer.updateWindow()
+	if !viewer.followTail || viewer.windowIDs[id] {
+		return false
+	}
+	if viewer.windowRows >= viewer.windowSize {
+		// the rows of a burst of packets are added by a single slide
+		if !viewer.slidePending {
+			viewer.slidePending = true
+			glib.IdleAdd(func() bool {
+				viewer.slidePending = false
+				if viewer.followTail {
+					viewer.showWindow(viewer.tailStart())
+				}
+				return false
+			})
+		}
+		return false
+	}
+	viewer.windowIDs[id] = true
+	viewer.windowRows++
+	return true
+}
+
+// tailStart returns the index of the first packet of the last full window
+func (viewer *PacketListViewer) tailStart() int {
+	start := viewer.diskStore.Len() - viewer.windowSize
+	if start < 0 {
+		return 0
+	}
+	return start
+}
+
+// visibleRows returns the number of rows that fit in the visible area of the list
+func (viewer *PacketListViewer) visibleRows() int {
+	var headerHeight int
+	viewer.treeView.ConvertBinWindowToWidgetCoords(0, 0, nil, &headerHeight)
+	rowHeight := defaultRowHeight
+	if viewer.windowRows > 1 {
+		first, err1 := gtk.TreePathNewFromString("0")
+		second, err2 := gtk.TreePathNewFromString("1")
+		if err1 == nil && err2 == nil {
+			// the distance between the rows includes the spacing between them
+			height := viewer.treeView.GetCellArea(second, nil).GetY() - viewer.treeView.GetCellArea(first, nil).GetY()
+			if height > 0 {
+				rowHeight = height
+			}
+		}
+	}
+	rows := (viewer.scrolledList.GetAllocatedHeight() - headerHeight) / rowHeight
+	if rows < 1 {
+		return 1
+	}
+	return rows
+}
+
+// scrollWindow moves the window of rows by delta packets
+func (viewer *PacketListViewer) scrollWindow(delta int) {
+	if delta != 0 {
+		// the adjustment clamps the value and shows the new window
+		viewer.windowAdjustment.SetValue(float64(viewer.windowStart + delta))
+	}
+}
+
+// windowKeyPressed moves the window when the cursor is moved past its
+// first or last row, and reports whether the key was handled
+func (viewer *PacketListViewer) windowKeyPressed(key uint) bool {
+	path, _ := viewer.treeView.GetCursor()
+	if path == nil || path.GetDepth() != 1 {
+		return false
+	}
+	row := path.GetIndices()[0]
+	var delta int
+	switch key {
+	case gdk.KEY_Up:
+		if row != 0 {
+			return false
+		}
+		delta = -1
+	case gdk.KEY_Down:
+		if row != viewer.windowRows-1 {
+			return false
+		}
+		delta = 1
+	case gdk.KEY_Page_Up:
+		delta = -viewer.windowSize
+	case gdk.KEY_Page_Down:
+		delta = viewer.windowSize
+	default:
+		return false
+	}
+	start := viewer.windowStart
+	viewer.scrollWindow(delta)
+	if viewer.windowStart == start {
+		return false
+	}
+	if row >= viewer.windowRows {
+		row = viewer.windowRows - 1
+	}
+	cursor, err := gtk.TreePathNewFromString(fmt.Sprint(row))
+	if err == nil {
+		viewer.treeView.SetCursor(cursor, nil, false)
+	}
+	return true
+}
+
+// selectedMainPacket returns the ID of the selected row if it is a main packet
+func (viewer *PacketListViewer) selectedMainPacket() (uint64, bool) {
+	selection, err := viewer.treeView.GetSelection()
+	if err != nil {
+		return 0, false
+	}
+	_, iter, ok := selection.GetSelected()
+	if !ok {
+		return 0, false
+	}
+	kind, err := viewer.uint64FromIter(iter, COL_PACKET_KIND)
+	if err != nil || kind != KIND_MAIN {
+		return 0, false
+	}
+	id, err := viewer.uint64FromIter(iter, COL_ID)
+	return id, err == nil
+}
+
+// selectMainPacket selects the row of a main packet if it is in the window
+func (viewer *PacketListViewer) selectMainPacket(id uint64) {
+	selection, err := viewer.treeView.GetSelection()
+	if err != nil {
+		return
+	}
+	iter, ok := viewer.sortModel.GetIterFirst()
+	for ok {
+		rowID, err := viewer.uint64FromIter(iter, COL_ID)
+		if err == nil && rowID == id {
+			selection.SelectIter(iter)
+			return
+		}
+		ok = viewer.sortModel.IterNext(iter)
+	}
+}
+
+// showWindow replaces the rows of the viewer with the packets
+// that fit in the visible area, starting at index start of the disk store
+func (viewer *PacketListViewer) showWindow(start int) {
+	summaries, err := viewer.diskStore.Packets(start, viewer.windowSize)
+	if err != nil {
+		ShowError(viewer.mainWidget, err, "Reading packets")
+		return
+	}
+	selected, hasSelection := viewer.selectedMainPacket()
+	viewer.model.Clear()
+	viewer.packetRows = make(map[uint64]*gtk.TreePath)
+	viewer.packetTypeApplied = make(map[uint64]bool)
+	viewer.lazyLoadFakeRows = make(map[uint64]*gtk.TreePath)
+	viewer.windowIDs = make(map[uint64]bool)
+	viewer.windowStart = start
+	viewer.windowRows = 0
+	for _, summary := range summaries {
+		viewer.appendSummaryRow(summary)
+	}
+
+	viewer.followTail = start+viewer.windowSize >= viewer.diskStore.Len()
+	if viewer.followTail {
+		// in low-memory mode, packetStore only contains
+		// packets that haven't been received completely
+		pending := make([]uint64, 0, len(viewer.packetStore))
+		for id := range viewer.packetStore {
+			if !viewer.windowIDs[id] {
+				pending = append(pending, id)
+			}
+		}
+		sort.Slice(pending, func(i, j int) bool {
+			return pending[i] < pending[j]
+		})
+		for _, id := range pending {
+			layers := viewer.packetStore[id]
+			viewer.appendPartialPacketRow(layers)
+			iter, err := viewer.model.GetIter(viewer.packetRows[id])
+			if err == nil {
+				viewer.updatePacketInfo(iter, layers)
+			}
+			viewer.windowIDs[id] = true
+			viewer.windowRows++
+		}
+	}
+	if hasSelection && viewer.windowIDs[selected] {
+		viewer.selectMainPacket(selected)
+	}
+	viewer.updateWindow()
+}
+
+// appendSummaryRow adds a row for a packet from the disk store
+func (viewer *PacketListViewer) appendSummaryRow(summary *store.Summary) {
+	direction := "???"
+	if summary.Has(store.FlagFromClient) {
+		direction = "C->S"
+	} else if summary.Has(store.FlagFromServer) {
+		direction = "S->C"
+	}
+	color := "rgba(0,0,0,0)"
+	if summary.Has(store.FlagError) {
+		color = "rgba(255,0,0,.5)"
+	} else if summary.Has(store.FlagDegraded) {
+		color = "rgba(255,165,0,.5)"
+	}
+
+	var newRow gtk.TreeIter
+	err := viewer.model.InsertWithValues(&newRow, nil, -1, []int{COL_ID, COL_PACKET, COL_DIRECTION, COL_LEN_BYTES, COL_TIME, COL_COLOR, COL_HAS_LENGTH, COL_PACKET_KIND, COL_BOOKMARK}, []interface{}{
+		int64(summary.ID),
+		summary.Text,
+		direction,
+		int64(summary.Length),
+		formatPacketTime(summary.Time),
+		color,
+		summary.Has(store.FlagHasLength),
+		int64(KIND_MAIN),
+		viewer.bookmarkLabel(summary.ID),
+	})
+	if err != nil {
+		println("failed to insert rows:", err.Error())
+		return
+	}
+	if summary.Has(store.FlagHasChildren) {
+		viewer.addLazyRow(&newRow, summary.ID)
+	}
+	viewer.windowIDs[summary.ID] = true
+	viewer.windowRows++
+}
+
+// updateWindow updates the scrollbar and the label of the window of rows
+func (viewer *PacketListViewer) updateWindow() {
+	count := viewer.diskStore.Len()
+	viewer.movingWindow = true
+	viewer.windowAdjustment.Configure(float64(viewer.windowStart), 0, float64(count), 1, float64(viewer.windowSize), float64(viewer.windowSize))
+	viewer.movingWindow = false
+
+	end := viewer.windowStart + viewer.windowRows
+	if end > count {
+		end = count
+	}
+	if viewer.windowStart >= end {
+		viewer.windowLabel.SetText(fmt.Sprintf("Waiting for packets (%d stored)", count))
+		return
+	}
+	viewer.windowLabel.SetText(fmt.Sprintf("Packets %d to %d of %d", viewer.windowStart+1, end, count))
+}
+
+// formatPacketTime formats a capture timestamp for the time column
+func formatPacketTime(timestamp time.Time) string {
+	if timestamp.IsZero() {
+		return ""
+	}
+	return timestamp.Format("15:04:05.000000")
+}
+
 func (viewer *PacketListViewer) NotifyOfflinePacket(layers *peer.PacketLayers) {
 	id := layers.UniqueID
+	if !viewer.admitRow(id) {
+		viewer.keepLayers(layers)
+		return
+	}
 	model := viewer.model
 	newRow := model.Append(nil)
-	viewer.packetStore[id] = layers
+	viewer.keepLayers(layers)
 	model.SetValue(newRow, COL_ID, int64(id))
 	model.SetValue(newRow, COL_PACKET, layers.String())
 	var direction string
@@ -403,11 +1002,15 @@ func (viewer *PacketListViewer) NotifyOfflinePacket(layers *peer.PacketLayers) {
 	}
 	model.SetValue(newRow, COL_DIRECTION, direction)
 	model.SetValue(newRow, COL_LEN_BYTES, int64(len(layers.OfflinePayload)))
+	model.SetValue(newRow, COL_TIME, formatPacketTime(layers.Root.Timestamp))
 	model.SetValue(newRow, COL_HAS_LENGTH, true)
 	model.SetValue(newRow, COL_PACKET_KIND, int64(KIND_MAIN))
 	if layers.Error != nil {
 		model.SetValue(newRow, COL_COLOR, "rgba(255,0,0,.5)")
 	}
+	if viewer.diskStore != nil {
+		return
+	}
 
 	var err error
 	viewer.packetRows[id], err = model.GetPath(newRow)
@@ -419,7 +1022,10 @@ func (viewer *PacketListViewer) NotifyOfflinePacket(layers *peer.PacketLayers) {
 func (viewer *PacketListViewer) NotifyACK(layers *peer.PacketLayers) {
 	id := layers.UniqueID
 	model := viewer.model
-	viewer.packetStore[id] = layers
+	viewer.keepLayers(layers)
+	if !viewer.admitRow(id) {
+		return
+	}
 	var direction string
 
 	if layers.Root.FromClient {
@@ -430,13 +1036,17 @@ func (viewer *PacketListViewer) NotifyACK(layers *peer.PacketLayers) {
 		direction = "???"
 	}
 	var newRow gtk.TreeIter
-	model.InsertWithValues(&newRow, nil, -1, []int{COL_ID, COL_PACKET, COL_DIRECTION, COL_HAS_LENGTH, COL_PACKET_KIND}, []interface{}{
+	model.InsertWithValues(&newRow, nil, -1, []int{COL_ID, COL_PACKET, COL_DIRECTION, COL_HAS_LENGTH, COL_PACKET_KIND, COL_TIME}, []interface{}{
 		int64(id),
 		layers.String(),
 		direction,
 		false,
 		int64(KIND_MAIN),
+		formatPacketTime(layers.Root.Timestamp),
 	})
+	if viewer.diskStore != nil {
+		return
+	}
 
 	var err error
 	viewer.packetRows[id], err = model.GetPath(&newRow)
@@ -467,12 +1077,13 @@ func (viewer *PacketListViewer) appendPartialPacketRow(layers *peer.PacketLayers
 		direction = "???"
 	}
 	var newRow gtk.TreeIter
-	model.InsertWithValues(&newRow, nil, -1, []int{COL_ID, COL_COLOR, COL_HAS_LENGTH, COL_PACKET_KIND, COL_DIRECTION}, []interface{}{
+	model.InsertWithValues(&newRow, nil, -1, []int{COL_ID, COL_COLOR, COL_HAS_LENGTH, COL_PACKET_KIND, COL_DIRECTION, COL_TIME}, []interface{}{
 		int64(id),
 		"rgba(255,255,0,.5)",
 		true,
 		int64(KIND_MAIN),
 		direction,
+		formatPacketTime(layers.Root.Timestamp),
 	},
 	)
 
@@ -569,39 +1180,44 @@ func (viewer *PacketListViewer) addSubpackets(iter *gtk.TreeIter, layers *peer.P
 	}
 }
 
-func (viewer *PacketListViewer) addLazySubpackets(iter *gtk.TreeIter, layers *peer.PacketLayers) {
-	model := viewer.model
+// hasSubpackets reports whether a packet is shown with subpacket rows
+func hasSubpackets(layers *peer.PacketLayers) bool {
+	switch mainLayer := layers.Main.(type) {
+	case *peer.Packet83Layer:
+		return len(mainLayer.SubPackets) > 0
+	case *peer.Packet85Layer:
+		return len(mainLayer.SubPackets) > 0
+	case *peer.Packet86Layer:
+		return len(mainLayer.SubPackets) > 0
+	}
+	return false
+}
 
-	var lazyIter *gtk.TreeIter
-	switch layers.PacketType {
-	case 0x83:
-		mainLayer := layers.Main.(*peer.Packet83Layer)
-		if len(mainLayer.SubPackets) > 0 {
-			lazyIter = model.Append(iter)
-		}
-	case 0x85:
-		mainLayer := layers.Main.(*peer.Packet85Layer)
-		if len(mainLayer.SubPackets) > 0 {
-			lazyIter = model.Append(iter)
-		}
-	case 0x86:
-		mainLayer := layers.Main.(*peer.Packet86Layer)
-		if len(mainLayer.SubPackets) > 0 {
-			lazyIter = model.Append(iter)
-		}
+func (viewer *PacketListViewer) addLazySubpackets(iter *gtk.TreeIter, layers *peer.PacketLayers) {
+	if hasSubpackets(layers) {
+		viewer.addLazyRow(iter, layers.UniqueID)
 	}
-	if lazyIter != nil {
-		var err error
-		viewer.lazyLoadFakeRows[layers.UniqueID], err = model.GetPath(lazyIter)
-		if err != nil {
-			println("failed to get lazy iter path:", err.Error())
-		}
+}
+
+// addLazyRow adds a placeholder row that is replaced by the subpackets
+// of a packet when its row is expanded
+func (viewer *PacketListViewer) addLazyRow(iter *gtk.TreeIter, id uint64) {
+	lazyIter := viewer.model.Append(iter)
+	var err error
+	viewer.lazyLoadFakeRows[id], err = viewer.model.GetPath(lazyIter)
+	if err != nil {
+		println("failed to get lazy iter path:", err.Error())
 	}
 }
 func (viewer *PacketListViewer) NotifyPartialPacket(layers *peer.PacketLayers) {
 	existingRow, ok := viewer.packetRows[layers.UniqueID]
 
 	if !ok {
+		if !viewer.admitRow(layers.UniqueID) {
+			// the row is added when the window is shown
+			viewer.packetStore[layers.UniqueID] = layers
+			return
+		}
 		viewer.appendPartialPacketRow(layers)
 	} else {
 		iter, err := viewer.model.GetIter(existingRow)
@@ -615,7 +1231,11 @@ func (viewer *PacketListViewer) NotifyPartialPacket(layers *peer.PacketLayers) {
 
 func (viewer *PacketListViewer) NotifyFullPacket(layers *peer.PacketLayers) {
 	existingRow, ok := viewer.packetRows[layers.UniqueID]
-	if !ok {
+	if !ok && viewer.diskStore != nil {
+		// the packet has no row in the window
+		viewer.keepLayers(layers)
+		return
+	} else if !ok {
 		println("haven't seen this full packet yet:", layers.UniqueID)
 		return
 	} else {
@@ -630,12 +1250,21 @@ func (viewer *PacketListViewer) NotifyFullPacket(layers *peer.PacketLayers) {
 		if layers.Error != nil {
 			viewer.model.SetValue(iter, COL_COLOR, "rgba(255,0,0,.5)")
 		} else {
-			// Why doesn't GTK have `transparent` for colors, like CSS?
-			viewer.model.SetValue(iter, COL_COLOR, "rgba(0,0,0,0)") // finished with this packet
+			if len(layers.Degradations) != 0 {
+				// decoded from a conversation that was picked up mid-session
+				viewer.model.SetValue(iter, COL_COLOR, "rgba(255,165,0,.5)")
+			} else {
+				// Why doesn't GTK have `transparent` for colors, like CSS?
+				viewer.model.SetValue(iter, COL_COLOR, "rgba(0,0,0,0)") // finished with this packet
+			}
 			viewer.addLazySubpackets(iter, layers)
 		}
 		viewer.model.SetValue(iter, COL_LEN_BYTES, int64(layers.SplitPacket.RealLength))
+		viewer.model.SetValue(iter, COL_TIME, formatPacketTime(layers.SplitPacket.FirstTimestamp))
 		viewer.model.SetValue(iter, COL_PACKET, layers.String())
+		if viewer.diskStore != nil {
+			viewer.keepLayers(layers)
+		}
 	}
 }
 
@@ -716,11 +1345,33 @@ func (viewer *PacketListViewer) selectionChanged(selection *gtk.TreeSelection) {
 		return
 	}
 
+	mainPacketId := baseId
+	if kind != KIND_MAIN {
+		mainPacketId, err = viewer.uint64FromIter(treeIter, COL_MAIN_PACKET_ID)
+		if err != nil {
+			println("failed to parent id from selection:", err.Error())
+			return
+		}
+	}
+	mainPacket, ok := viewer.layersFor(mainPacketId)
+	if !ok {
+		packetViewer, err := blanketViewer("Decoding packet...")
+		if err != nil {
+			println("failed to get packet viewer:", err.Error())
+			return
+		}
+		viewer.packetDetailsViewer.ShowMainLayer(packetViewer)
+		viewer.decodeLater(mainPacketId, func() {
+			viewer.selectionChanged(selection)
+		})
+		return
+	}
+
 	if kind == KIND_MAIN {
-		layers := viewer.packetStore[baseId]
+		layers := mainPacket
 		viewer.packetDetailsViewer.ShowPacket(layers)
 		if layers.Main != nil {
-			packetViewer, err := viewerForMainPacket(layers.Main)
+			packetViewer, err := viewerForMainPacket(layers.Main, viewer.packetDetailsViewer.HighlightField)
 			if err != nil {
 				println("failed to get packet viewer:", err.Error())
 				return
@@ -749,21 +1400,17 @@ func (viewer *PacketListViewer) selectionChanged(selection *gtk.TreeSelection) {
 			viewer.packetDetailsViewer.ShowMainLayer(packetViewer)
 		}
 	} else {
-		mainPacketId, err := viewer.uint64FromIter(treeIter, COL_MAIN_PACKET_ID)
-		if err != nil {
-			println("failed to parent id from selection:", err.Error())
-			return
-		}
-		viewer.packetDetailsViewer.ShowPacket(viewer.packetStore[mainPacketId])
+		viewer.packetDetailsViewer.ShowPacket(mainPacket)
 
 		switch kind {
 		case KIND_DATA_REPLIC:
-			packetViewer, err := viewerForDataPacket(viewer.packetStore[mainPacketId].Main.(*peer.Packet83Layer).SubPackets[baseId])
+			packetViewer, err := viewerForDataPacket(mainPacket.Main.(*peer.Packet83Layer).SubPackets[baseId])
 			if err != nil {
 				println("failed to get subpacket viewer:", err.Error())
 				return
 			}
 			viewer.packetDetailsViewer.ShowMainLayer(packetViewer)
+			viewer.packetDetailsViewer.HighlightField(fmt.Sprintf("SubPackets[%d]", baseId))
 		case KIND_DATA_JOIN_DATA_INSTANCE, KIND_DATA_STREAM_DATA_INSTANCE:
 			joinDataSubpacket, err := viewer.uint64FromIter(treeIter, COL_SUBPACKET_ID)
 			if err != nil {
@@ -776,7 +1423,7 @@ func (viewer *PacketListViewer) selectionChanged(selection *gtk.TreeSelection) {
 				println("failed to make make subpacket window:", err.Error())
 				return
 			}
-			subpacket := viewer.packetStore[mainPacketId].Main.(*peer.Packet83Layer).SubPackets[joinDataSubpacket]
+			subpacket := mainPacket.Main.(*peer.Packet83Layer).SubPackets[joinDataSubpacket]
 			var joinDataInstances []*peer.ReplicationInstance
 			if kind == KIND_DATA_JOIN_DATA_INSTANCE {
 				joinDataInstances = subpacket.(*peer.Packet83_0B).Instances
@@ -788,18 +1435,21 @@ func (viewer *PacketListViewer) selectionChanged(selection *gtk.TreeSelection) {
 			instViewer.mainWidget.ShowAll()
 
 			viewer.packetDetailsViewer.ShowMainLayer(instViewer.mainWidget)
+			// the instances can only be located as a whole in the compressed region
+			viewer.packetDetailsViewer.HighlightField(fmt.Sprintf("SubPackets[%d].Instances", joinDataSubpacket))
 		case KIND_PHYSICS:
 			physicsPacketViewer, err := NewPhysicsPacketViewer()
 			if err != nil {
 				println("failed to create physics packet viewer:", err.Error())
 				return
 			}
-			physicsPacketViewer.ViewPacket(viewer.packetStore[mainPacketId].Main.(*peer.Packet85Layer).SubPackets[baseId])
+			physicsPacketViewer.ViewPacket(mainPacket.Main.(*peer.Packet85Layer).SubPackets[baseId])
 			physicsPacketViewer.mainWidget.ShowAll()
 
 			viewer.packetDetailsViewer.ShowMainLayer(physicsPacketViewer.mainWidget)
+			viewer.packetDetailsViewer.HighlightField(fmt.Sprintf("SubPackets[%d]", baseId))
 		case KIND_TOUCH:
-			packet := viewer.packetStore[mainPacketId].Main.(*peer.Packet86Layer).SubPackets[baseId]
+			packet := mainPacket.Main.(*peer.Packet86Layer).SubPackets[baseId]
 			packetViewer, err := blanketViewer(packet.String())
 			if err != nil {
 				println("failed to get subpacket viewer:", err.Error())
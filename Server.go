@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
+	"time"
 
+	"github.com/Gskartwii/roblox-dissector/capture"
 	"github.com/Gskartwii/roblox-dissector/datamodel"
 	"github.com/Gskartwii/roblox-dissector/peer"
 	"github.com/gotk3/gotk3/gtk"
@@ -296,23 +299,43 @@ func NewServerStartWidget(callback func(string, string, uint16)) error {
 }
 
 func CaptureFromServer(ctx context.Context, session *CaptureSession, server *peer.CustomServer) {
+	var conversationsMutex sync.Mutex
+	conversations := make(map[string]*capture.Conversation)
 	server.ClientEmitter.On("client", func(e *emitter.Event) {
 		client := e.Args[0].(*peer.ServerClient)
 
-		session.AddConversation(&Conversation{
+		conv := &capture.Conversation{
 			Client:       client.Address,
 			Server:       client.Server.Address,
 			ClientReader: client.DefaultPacketReader,
 			ServerReader: client.DefaultPacketWriter,
 			Context:      client.Context,
-		})
+		}
+		session.CollectComments(conv, conv.ClientReader)
+		session.CollectComments(conv, conv.ServerReader)
+		conversationsMutex.Lock()
+		conversations[client.Address.String()] = conv
+		conversationsMutex.Unlock()
+		session.AddConversation(conv)
 	}, emitter.Void)
 
-	// Listen for all packets (both client-to-server and server-to-client) for PCAP capture
+	// Listen for all packets (both client-to-server and server-to-client) for PCAP capture.
+	// They are emitted once they have been decoded or encoded.
 	server.PacketEmitter.On("packet", func(e *emitter.Event) {
 		srcAddr := e.Args[0].(*net.UDPAddr)
 		dstAddr := e.Args[1].(*net.UDPAddr)
 		payload := e.Args[2].([]byte)
-		session.WritePacketToPCAP(srcAddr, dstAddr, payload)
+
+		conversationsMutex.Lock()
+		conv := conversations[srcAddr.String()]
+		if conv == nil {
+			conv = conversations[dstAddr.String()]
+		}
+		conversationsMutex.Unlock()
+		if conv == nil {
+			session.WritePacketToPCAP(srcAddr, dstAddr, payload, time.Now())
+			return
+		}
+		session.WriteCollectedPacket(conv, senderReader(conv, srcAddr), srcAddr, dstAddr, payload, time.Now())
 	}, emitter.Void)
 }
@@ -10,8 +10,11 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
+	"github.com/Gskartwii/roblox-dissector/capture"
 	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/gotk3/gotk3/glib"
 
 	windivert "github.com/Gskartwii/windivert-go"
 	"github.com/olebedev/emitter"
@@ -24,7 +27,7 @@ type ProxiedPacket struct {
 	Layers  *peer.PacketLayers
 }
 
-func CaptureWithDivertedPacket(ctx context.Context, session *CaptureSession, clientAddr *net.UDPAddr, serverAddr *net.UDPAddr, payload []byte, ifIdx uint32, subIfIdx uint32) error {
+func CaptureWithDivertedPacket(ctx context.Context, session *CaptureSession, clientAddr *net.UDPAddr, serverAddr *net.UDPAddr, payload []byte, timestamp time.Time, ifIdx uint32, subIfIdx uint32) error {
 	filter := fmt.Sprintf("(ip.SrcAddr == %s and udp.SrcPort == %d) or (ip.DstAddr == %s and udp.DstPort == %d)",
 		clientAddr.IP.String(), clientAddr.Port,
 		clientAddr.IP.String(), clientAddr.Port)
@@ -60,19 +63,39 @@ func CaptureWithDivertedPacket(ctx context.Context, session *CaptureSession, cli
 		}
 	}, emitter.Void)
 
-	clientConversation := &Conversation{
+	clientConversation := &capture.Conversation{
 		ClientReader: proxyWriter.ClientHalf.DefaultPacketWriter,
 		ServerReader: proxyWriter.ClientHalf.DefaultPacketReader,
 	}
-	serverConversation := &Conversation{
+	serverConversation := &capture.Conversation{
 		ClientReader: proxyWriter.ServerHalf.DefaultPacketReader,
 		ServerReader: proxyWriter.ServerHalf.DefaultPacketWriter,
 	}
 	clientConversation.Client = clientAddr
 	serverConversation.Client = clientAddr
-	session.AddConversation(clientConversation)
+	// packets from the client are decoded by the client half and packets
+	// from the server by the server half, their layers are written as
+	// the comments of the packets in pcapng files
+	clientReader := proxyWriter.ClientHalf.DefaultPacketReader
+	serverReader := proxyWriter.ServerHalf.DefaultPacketReader
+	session.CollectComments(clientConversation, clientReader)
+	session.CollectComments(serverConversation, serverReader)
+	clientViewer, _ := session.AddConversation(clientConversation)
 	session.AddConversation(serverConversation)
 
+	if clientViewer != nil {
+		glib.IdleAdd(func() bool {
+			breakpointViewer, err := NewBreakpointViewer()
+			if err != nil {
+				ShowError(clientViewer.mainWidget, err, "Failed to create breakpoint viewer")
+				return false
+			}
+			breakpointViewer.Bind(proxyWriter)
+			clientViewer.AttachBreakpointViewer(breakpointViewer)
+			return false
+		})
+	}
+
 	packetChan := make(chan ProxiedPacket, 100)
 
 	divertedLayers := &peer.PacketLayers{
@@ -81,9 +104,11 @@ func CaptureWithDivertedPacket(ctx context.Context, session *CaptureSession, cli
 			Destination: serverAddr,
 			FromClient:  true,
 			FromServer:  false,
+			Timestamp:   timestamp,
 		},
 	}
 	proxyWriter.ProxyClient(payload, divertedLayers)
+	session.WriteCollectedPacket(clientConversation, clientReader, clientAddr, serverAddr, payload, divertedLayers.Root.Timestamp)
 	go func() {
 		var pktSrcAddr, pktDstAddr *net.UDPAddr
 		var winDivertAddr *windivert.Address
@@ -112,12 +137,10 @@ func CaptureWithDivertedPacket(ctx context.Context, session *CaptureSession, cli
 					// TODO: Can this be improved?
 					FromClient: proxyWriter.ClientAddr.String() == pktSrcAddr.String(),
 					FromServer: proxyWriter.ServerAddr.String() == pktSrcAddr.String(),
+					Timestamp:  time.Now(),
 				},
 			}
 
-			// Write captured packet to PCAP
-			session.WritePacketToPCAP(pktSrcAddr, pktDstAddr, udpPayload)
-
 			select {
 			case packetChan <- ProxiedPacket{Layers: layers, Payload: udpPayload}:
 			case <-ctx.Done():
@@ -128,10 +151,14 @@ func CaptureWithDivertedPacket(ctx context.Context, session *CaptureSession, cli
 	for {
 		select {
 		case newPacket := <-packetChan:
-			if newPacket.Layers.Root.FromClient { // from client? handled by client side
+			root := newPacket.Layers.Root
+			// Write captured packet to PCAP once it has been decoded
+			if root.FromClient { // from client? handled by client side
 				proxyWriter.ProxyClient(newPacket.Payload, newPacket.Layers)
+				session.WriteCollectedPacket(clientConversation, clientReader, root.Source, root.Destination, newPacket.Payload, root.Timestamp)
 			} else {
 				proxyWriter.ProxyServer(newPacket.Payload, newPacket.Layers)
+				session.WriteCollectedPacket(serverConversation, serverReader, root.Source, root.Destination, newPacket.Payload, root.Timestamp)
 			}
 		case <-ctx.Done():
 			return nil
@@ -180,10 +207,7 @@ func CaptureFromDivert(ctx context.Context, session *CaptureSession) error {
 				return
 			}
 
-			// Write captured packet to PCAP
-			session.WritePacketToPCAP(pktSrcAddr, pktDstAddr, udpPayload)
-
-			err = CaptureWithDivertedPacket(ctx, session, pktSrcAddr, pktDstAddr, udpPayload, ifIdx, subIfIdx)
+			err = CaptureWithDivertedPacket(ctx, session, pktSrcAddr, pktDstAddr, udpPayload, time.Now(), ifIdx, subIfIdx)
 			if err != nil {
 				fmt.Printf("open divert connection fail: %s\n", err.Error())
 				return
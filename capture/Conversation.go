@@ -0,0 +1,164 @@
+// Package capture implements the detection and decoding of RakNet conversations
+// from captured UDP traffic.
+package capture
+
+import (
+	"net"
+
+	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/olebedev/emitter"
+)
+
+// PacketProvider is implemented by anything that emits decoded packet layers,
+// such as peer.DefaultPacketReader and peer.DefaultPacketWriter
+type PacketProvider interface {
+	Layers() *emitter.Emitter
+	Errors() *emitter.Emitter
+}
+
+// Conversation represents the traffic between a single client and server
+type Conversation struct {
+	Client       *net.UDPAddr
+	Server       *net.UDPAddr
+	ClientReader PacketProvider
+	ServerReader PacketProvider
+	Context      *peer.CommunicationContext
+}
+
+// Event is a decoded packet layer emitted by one of the readers of a Conversation
+type Event struct {
+	Conversation *Conversation
+	// Topic is the topic the layers were emitted on, such as "offline" or "full-reliable"
+	Topic  string
+	Layers *peer.PacketLayers
+	// Provider is the reader of the conversation that emitted the layers
+	Provider PacketProvider
+	// IsError is set if the layers were emitted on the error emitter
+	IsError bool
+}
+
+// AddressEq reports whether two UDP addresses are equal
+func AddressEq(a *net.UDPAddr, b *net.UDPAddr) bool {
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+// NewConversation creates a conversation between client and server
+// with fresh packet readers that share a CommunicationContext
+func NewConversation(client *net.UDPAddr, server *net.UDPAddr) *Conversation {
+	context := peer.NewCommunicationContext()
+	clientR := peer.NewPacketReader()
+	serverR := peer.NewPacketReader()
+	clientR.SetContext(context)
+	serverR.SetContext(context)
+	clientR.SetIsClient(true)
+	clientR.BindDataModelHandlers()
+	serverR.BindDataModelHandlers()
+
+	return &Conversation{
+		Client:       client,
+		Server:       server,
+		ClientReader: clientR,
+		ServerReader: serverR,
+		Context:      context,
+	}
+}
+
+// DetectConversation creates a new conversation if payload is the
+// first packet of a RakNet handshake. Otherwise it returns nil.
+func DetectConversation(source *net.UDPAddr, dest *net.UDPAddr, payload []byte) *Conversation {
+	if len(payload) < 1 || payload[0] != 0x7B {
+		return nil
+	}
+	if !peer.IsOfflineMessage(payload) {
+		return nil
+	}
+	return NewConversation(source, dest)
+}
+
+// DetectMidSessionConversation creates a degraded conversation if payload is
+// a connected RakNet datagram, so that conversations whose handshake wasn't
+// captured can be decoded. Otherwise it returns nil.
+// The side with a private address is assumed to be the client. If both or
+// neither are private, the sender of payload is assumed to be the client.
+func DetectMidSessionConversation(source *net.UDPAddr, dest *net.UDPAddr, payload []byte) *Conversation {
+	if !peer.IsConnectedDatagram(payload) {
+		return nil
+	}
+	client, server := source, dest
+	if isPrivateIP(dest.IP) && !isPrivateIP(source.IP) {
+		client, server = dest, source
+	}
+	conv := NewConversation(client, server)
+	conv.Context.Degraded = true
+	return conv
+}
+
+var privateNetworks = []*net.IPNet{
+	{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+	{IP: net.IP{172, 16, 0, 0}, Mask: net.CIDRMask(12, 32)},
+	{IP: net.IP{192, 168, 0, 0}, Mask: net.CIDRMask(16, 32)},
+	{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)},
+	{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(7, 128)},
+}
+
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return true
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMidSession reports whether the conversation was picked up after it had
+// started, in which case its packets are decoded in degraded mode
+func (conv *Conversation) IsMidSession() bool {
+	return conv.Context.Degraded
+}
+
+// Has reports whether a packet from source to dest belongs to the conversation
+func (conv *Conversation) Has(source *net.UDPAddr, dest *net.UDPAddr) bool {
+	if AddressEq(source, conv.Client) && AddressEq(dest, conv.Server) {
+		return true
+	}
+	return AddressEq(source, conv.Server) && AddressEq(dest, conv.Client)
+}
+
+// Bind calls handler for every layer emitted by the conversation's readers
+func (conv *Conversation) Bind(handler func(*Event)) {
+	bind := func(provider PacketProvider) {
+		provider.Layers().On("*", func(e *emitter.Event) {
+			handler(&Event{
+				Conversation: conv,
+				Topic:        e.OriginalTopic,
+				Layers:       e.Args[0].(*peer.PacketLayers),
+				Provider:     provider,
+			})
+		}, emitter.Void)
+		provider.Errors().On("*", func(e *emitter.Event) {
+			handler(&Event{
+				Conversation: conv,
+				Topic:        e.OriginalTopic,
+				Layers:       e.Args[0].(*peer.PacketLayers),
+				Provider:     provider,
+				IsError:      true,
+			})
+		}, emitter.Void)
+	}
+	bind(conv.ClientReader)
+	bind(conv.ServerReader)
+}
+
+// FindConversation returns the conversation in convs that a packet
+// from source to dest belongs to, or nil
+func FindConversation(convs []*Conversation, source *net.UDPAddr, dest *net.UDPAddr) *Conversation {
+	for _, conv := range convs {
+		if conv.Has(source, dest) {
+			return conv
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package capture
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/ip4defrag"
+	"github.com/google/gopacket/layers"
+)
+
+// FragmentTimeout is how long the fragments of an incomplete datagram
+// are kept after the last one was seen
+const FragmentTimeout = 30 * time.Second
+
+// maxIPv6Fragments is the maximum number of fragments an IPv6 datagram may consist of
+const maxIPv6Fragments = 64
+
+// ipv6FragmentKey identifies the fragments of a single IPv6 datagram
+type ipv6FragmentKey struct {
+	flow gopacket.Flow
+	id   uint32
+}
+
+type ipv6Fragment struct {
+	offset int
+	data   []byte
+}
+
+// ipv6Fragments collects the fragments of an IPv6 datagram
+type ipv6Fragments struct {
+	fragments []ipv6Fragment
+	// length is the length of the reassembled payload, or -1 if
+	// the last fragment hasn't been seen yet
+	length   int
+	lastSeen time.Time
+}
+
+// Defragmenter reassembles IPv4 and IPv6 fragments of UDP datagrams, so
+// that RakNet datagrams larger than the path MTU can be decoded.
+// Fragments of other protocols are passed through unchanged.
+// A Defragmenter is not safe for concurrent use.
+type Defragmenter struct {
+	ipv4        *ip4defrag.IPv4Defragmenter
+	ipv6        map[ipv6FragmentKey]*ipv6Fragments
+	lastDiscard time.Time
+}
+
+// NewDefragmenter creates an empty Defragmenter
+func NewDefragmenter() *Defragmenter {
+	return &Defragmenter{
+		ipv4: ip4defrag.NewIPv4Defragmenter(),
+		ipv6: make(map[ipv6FragmentKey]*ipv6Fragments),
+	}
+}
+
+// Defrag returns packet itself if it isn't a fragment and the reassembled
+// packet if packet completes a datagram. If packet is a fragment of a datagram
+// that is still incomplete, Defrag returns nil. The link layer of the
+// reassembled packet is copied from the last fragment.
+func (d *Defragmenter) Defrag(packet gopacket.Packet) (gopacket.Packet, error) {
+	timestamp := packet.Metadata().Timestamp
+	if timestamp.Sub(d.lastDiscard) >= FragmentTimeout {
+		d.discardOlderThan(timestamp.Add(-FragmentTimeout))
+		d.lastDiscard = timestamp
+	}
+
+	if ipv4, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok {
+		if ipv4.Protocol != layers.IPProtocolUDP {
+			return packet, nil
+		}
+		result, err := d.ipv4.DefragIPv4WithTimestamp(ipv4, timestamp)
+		if result == ipv4 {
+			return packet, nil
+		} else if result == nil {
+			return nil, err
+		}
+		return rebuildPacket(packet, ipv4, result, result.Payload)
+	}
+
+	ipv6, ok := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	if !ok {
+		return packet, nil
+	}
+	fragment, ok := packet.Layer(layers.LayerTypeIPv6Fragment).(*layers.IPv6Fragment)
+	if !ok || fragment.NextHeader != layers.IPProtocolUDP {
+		return packet, nil
+	}
+	payload, err := d.defragIPv6(ipv6, fragment, timestamp)
+	if payload == nil {
+		return nil, err
+	}
+	result := &layers.IPv6{
+		Version:      ipv6.Version,
+		TrafficClass: ipv6.TrafficClass,
+		FlowLabel:    ipv6.FlowLabel,
+		NextHeader:   fragment.NextHeader,
+		HopLimit:     ipv6.HopLimit,
+		SrcIP:        ipv6.SrcIP,
+		DstIP:        ipv6.DstIP,
+	}
+	return rebuildPacket(packet, ipv6, result, payload)
+}
+
+// defragIPv6 adds a fragment to its datagram and returns the reassembled
+// payload if the datagram is complete
+func (d *Defragmenter) defragIPv6(ipv6 *layers.IPv6, fragment *layers.IPv6Fragment, timestamp time.Time) ([]byte, error) {
+	key := ipv6FragmentKey{flow: ipv6.NetworkFlow(), id: fragment.Identification}
+	datagram, ok := d.ipv6[key]
+	if !ok {
+		datagram = &ipv6Fragments{length: -1}
+		d.ipv6[key] = datagram
+	}
+	datagram.lastSeen = timestamp
+
+	offset := int(fragment.FragmentOffset) * 8
+	data := fragment.LayerPayload()
+	if offset+len(data) > 0xFFFF || len(datagram.fragments) >= maxIPv6Fragments {
+		delete(d.ipv6, key)
+		return nil, errors.New("invalid IPv6 fragment")
+	}
+	if !fragment.MoreFragments {
+		datagram.length = offset + len(data)
+	}
+	datagram.fragments = append(datagram.fragments, ipv6Fragment{offset: offset, data: data})
+	if datagram.length < 0 {
+		return nil, nil
+	}
+
+	sort.Slice(datagram.fragments, func(i, j int) bool {
+		return datagram.fragments[i].offset < datagram.fragments[j].offset
+	})
+	payload := make([]byte, 0, datagram.length)
+	for _, fragment := range datagram.fragments {
+		if fragment.offset > len(payload) {
+			return nil, nil // there's a hole, so more fragments are needed
+		}
+		// RFC 8200 requires datagrams with overlapping fragments to be discarded
+		if fragment.offset < len(payload) || fragment.offset+len(fragment.data) > datagram.length {
+			delete(d.ipv6, key)
+			return nil, errors.New("overlapping IPv6 fragments")
+		}
+		payload = append(payload, fragment.data...)
+	}
+	if len(payload) < datagram.length {
+		return nil, nil
+	}
+	delete(d.ipv6, key)
+	return payload, nil
+}
+
+// discardOlderThan forgets the fragments of datagrams that haven't been
+// completed since t
+func (d *Defragmenter) discardOlderThan(t time.Time) {
+	d.ipv4.DiscardOlderThan(t)
+	for key, datagram := range d.ipv6 {
+		if datagram.lastSeen.Before(t) {
+			delete(d.ipv6, key)
+		}
+	}
+}
+
+// rebuildPacket creates a packet that has the link layer of packet and the
+// given network layer and payload in place of the original network layer
+func rebuildPacket(packet gopacket.Packet, original gopacket.Layer, network gopacket.SerializableLayer, payload []byte) (gopacket.Packet, error) {
+	var data []byte
+	for _, layer := range packet.Layers() {
+		if layer == original {
+			break
+		}
+		data = append(data, layer.LayerContents()...)
+	}
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		network, gopacket.Payload(payload))
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, buffer.Bytes()...)
+
+	result := gopacket.NewPacket(data, packet.Layers()[0].LayerType(), gopacket.Default)
+	ci := packet.Metadata().CaptureInfo
+	ci.CaptureLength = len(data)
+	ci.Length = len(data)
+	result.Metadata().CaptureInfo = ci
+	return result, nil
+}
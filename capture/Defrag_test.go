@@ -0,0 +1,161 @@
+package capture
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var fragmentEthernet = &layers.Ethernet{
+	SrcMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 1},
+	DstMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 2},
+	EthernetType: layers.EthernetTypeIPv4,
+}
+
+// serializeFrame serializes the layers of a frame and decodes it again
+func serializeFrame(t *testing.T, timestamp time.Time, serializable ...gopacket.SerializableLayer) gopacket.Packet {
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, serializable...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	packet.Metadata().Timestamp = timestamp
+	packet.Metadata().CaptureLength = len(buffer.Bytes())
+	packet.Metadata().Length = len(buffer.Bytes())
+	return packet
+}
+
+// udpDatagram returns a UDP header followed by payload
+func udpDatagram(t *testing.T, network gopacket.NetworkLayer, src, dst *net.UDPAddr, payload []byte) []byte {
+	udp := &layers.UDP{
+		SrcPort: layers.UDPPort(src.Port),
+		DstPort: layers.UDPPort(dst.Port),
+	}
+	udp.SetNetworkLayerForChecksum(network)
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		udp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// checkReassembled checks that fragments are reassembled into a UDP packet carrying payload
+func checkReassembled(t *testing.T, fragments []gopacket.Packet, payload []byte) {
+	defragmenter := NewDefragmenter()
+	var result gopacket.Packet
+	for i, fragment := range fragments {
+		var err error
+		result, err = defragmenter.Defrag(fragment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < len(fragments)-1 && result != nil {
+			t.Fatalf("fragment %d completed the datagram", i)
+		}
+	}
+	if result == nil {
+		t.Fatal("datagram wasn't reassembled")
+	}
+	if _, ok := result.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); !ok {
+		t.Error("reassembled packet has no link layer")
+	}
+	if udp, ok := result.Layer(layers.LayerTypeUDP).(*layers.UDP); !ok || !bytes.Equal(udp.Payload, payload) {
+		t.Error("reassembled payload differs")
+	}
+	if result.Metadata().CaptureLength != len(result.Data()) {
+		t.Errorf("capture length is %d, expected %d", result.Metadata().CaptureLength, len(result.Data()))
+	}
+}
+
+func TestDefragIPv4(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+	dst := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	payload := make([]byte, 1492)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	header := func() *layers.IPv4 {
+		return &layers.IPv4{Version: 4, TTL: 64, Id: 1234, Protocol: layers.IPProtocolUDP, SrcIP: src.IP, DstIP: dst.IP}
+	}
+	datagram := udpDatagram(t, header(), src, dst, payload)
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var fragments []gopacket.Packet
+	for offset := 0; offset < len(datagram); offset += 512 {
+		end := offset + 512
+		ip := header()
+		if end < len(datagram) {
+			ip.Flags = layers.IPv4MoreFragments
+		} else {
+			end = len(datagram)
+		}
+		ip.FragOffset = uint16(offset / 8)
+		fragments = append(fragments, serializeFrame(t, start, fragmentEthernet, ip, gopacket.Payload(datagram[offset:end])))
+	}
+	// the last fragment may arrive before the others
+	fragments[1], fragments[2] = fragments[2], fragments[1]
+	checkReassembled(t, fragments, payload)
+
+	unfragmented := serializeFrame(t, start, fragmentEthernet, header(), gopacket.Payload(datagram))
+	if result, err := NewDefragmenter().Defrag(unfragmented); err != nil || result != unfragmented {
+		t.Error("unfragmented packet was changed")
+	}
+}
+
+func TestDefragIPv6(t *testing.T) {
+	src := &net.UDPAddr{IP: net.ParseIP("fd00::1"), Port: 50000}
+	dst := &net.UDPAddr{IP: net.ParseIP("fd00::2"), Port: 53640}
+	payload := make([]byte, 1492)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	ethernet := *fragmentEthernet
+	ethernet.EthernetType = layers.EthernetTypeIPv6
+	header := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolIPv6Fragment, SrcIP: src.IP, DstIP: dst.IP}
+	datagram := udpDatagram(t, &layers.IPv6{Version: 6, NextHeader: layers.IPProtocolUDP, SrcIP: src.IP, DstIP: dst.IP}, src, dst, payload)
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var fragments []gopacket.Packet
+	for offset := 0; offset < len(datagram); offset += 800 {
+		end := offset + 800
+		more := byte(1)
+		if end >= len(datagram) {
+			end = len(datagram)
+			more = 0
+		}
+		// gopacket can't serialize fragment headers, so they are written by hand
+		fragmentHeader := []byte{byte(layers.IPProtocolUDP), 0, byte(offset >> 8), byte(offset) | more, 0, 0, 0x12, 0x34}
+		data := append(fragmentHeader, datagram[offset:end]...)
+		fragments = append(fragments, serializeFrame(t, start.Add(time.Duration(offset)), &ethernet, header, gopacket.Payload(data)))
+	}
+	checkReassembled(t, fragments, payload)
+}
+
+func TestDefragDiscardsStaleFragments(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+	dst := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Id: 1, Protocol: layers.IPProtocolUDP, SrcIP: src.IP, DstIP: dst.IP}
+	datagram := udpDatagram(t, ip, src, dst, make([]byte, 64))
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := *ip
+	first.Flags = layers.IPv4MoreFragments
+	last := *ip
+	last.FragOffset = 4
+
+	defragmenter := NewDefragmenter()
+	if result, _ := defragmenter.Defrag(serializeFrame(t, start, fragmentEthernet, &first, gopacket.Payload(datagram[:32]))); result != nil {
+		t.Fatal("incomplete datagram was reassembled")
+	}
+	late := start.Add(2 * FragmentTimeout)
+	if result, _ := defragmenter.Defrag(serializeFrame(t, late, fragmentEthernet, &last, gopacket.Payload(datagram[32:]))); result != nil {
+		t.Error("datagram was reassembled from a stale fragment")
+	}
+}
@@ -0,0 +1,270 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+const (
+	ngBlockTypeSectionHeader  = 0x0A0D0D0A
+	ngBlockTypeNameResolution = 0x00000004
+	ngByteOrderMagic          = 0x1A2B3C4D
+
+	ngNameRecordEnd  = 0
+	ngNameRecordIPv4 = 1
+	ngNameRecordIPv6 = 2
+)
+
+// File is a pcap or pcapng capture file opened for reading
+type File struct {
+	file     *os.File
+	reader   *pcapgo.Reader
+	ngReader *pcapgo.NgReader
+
+	// Names maps IP addresses to the host names recorded in the
+	// name resolution blocks of a pcapng file
+	Names map[string][]string
+}
+
+// OpenFile opens a pcap or pcapng file. The format is detected from its contents.
+func OpenFile(filename string) (*File, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	var magic [4]byte
+	_, err = io.ReadFull(file, magic[:])
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	result := &File{file: file}
+	if binary.LittleEndian.Uint32(magic[:]) != ngBlockTypeSectionHeader {
+		result.reader, err = pcapgo.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return result, nil
+	}
+
+	result.Names, err = readNameResolution(bufio.NewReader(file))
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	result.ngReader, err = pcapgo.NewNgReader(file, pcapgo.NgReaderOptions{
+		WantMixedLinkType:  true,
+		SkipUnknownVersion: true,
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+// IsNg reports whether the file is in the pcapng format
+func (file *File) IsNg() bool {
+	return file.ngReader != nil
+}
+
+// Close closes the underlying file
+func (file *File) Close() error {
+	return file.file.Close()
+}
+
+// NameOf returns the first host name recorded for an address, or an empty string
+func (file *File) NameOf(addr *net.UDPAddr) string {
+	names := file.Names[addr.IP.String()]
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// Packets decodes the packets in the file and sends them to the returned channel.
+// The channel is closed when the file is exhausted, a read error occurs or ctx is cancelled.
+// Packets from every interface of a pcapng file are decoded using the link type of their interface.
+func (file *File) Packets(ctx context.Context) <-chan gopacket.Packet {
+	packets := make(chan gopacket.Packet, 1000)
+	go func() {
+		defer close(packets)
+		for {
+			packet, err := file.next()
+			if err != nil {
+				return
+			}
+			select {
+			case packets <- packet:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return packets
+}
+
+func (file *File) next() (gopacket.Packet, error) {
+	var data []byte
+	var ci gopacket.CaptureInfo
+	var err error
+	var linkType layers.LinkType
+	if file.ngReader != nil {
+		data, ci, err = file.ngReader.ReadPacketData()
+		if err == nil {
+			linkType = ci.AncillaryData[0].(layers.LinkType)
+		}
+	} else {
+		data, ci, err = file.reader.ReadPacketData()
+		linkType = file.reader.LinkType()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	packet := gopacket.NewPacket(data, linkType, gopacket.Default)
+	*packet.Metadata() = gopacket.PacketMetadata{CaptureInfo: ci}
+	return packet, nil
+}
+
+// CountPackets returns the number of packets in a pcap or pcapng file
+func CountPackets(filename string) (int, error) {
+	file, err := OpenFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	count := 0
+	for {
+		if file.ngReader != nil {
+			_, _, err = file.ngReader.ZeroCopyReadPacketData()
+		} else {
+			_, _, err = file.reader.ZeroCopyReadPacketData()
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// readNameResolution collects the records of all name resolution blocks in a pcapng stream
+func readNameResolution(r io.Reader) (map[string][]string, error) {
+	names := make(map[string][]string)
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	var header [8]byte
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF {
+			return names, nil
+		} else if err != nil {
+			return names, err
+		}
+
+		blockType := byteOrder.Uint32(header[0:4])
+		if blockType == ngBlockTypeSectionHeader {
+			// every section may have a different byte order
+			var magic [4]byte
+			_, err = io.ReadFull(r, magic[:])
+			if err != nil {
+				return names, err
+			}
+			if binary.BigEndian.Uint32(magic[:]) == ngByteOrderMagic {
+				byteOrder = binary.BigEndian
+			} else {
+				byteOrder = binary.LittleEndian
+			}
+			length := byteOrder.Uint32(header[4:8])
+			if length < 28 || length%4 != 0 {
+				return names, errors.New("invalid section header length")
+			}
+			_, err = io.CopyN(ioutil.Discard, r, int64(length-12))
+			if err != nil {
+				return names, err
+			}
+			continue
+		}
+
+		length := byteOrder.Uint32(header[4:8])
+		if length < 12 || length%4 != 0 {
+			return names, errors.New("invalid pcapng block length")
+		}
+		body := make([]byte, length-8)
+		_, err = io.ReadFull(r, body)
+		if err != nil {
+			return names, err
+		}
+		if blockType == ngBlockTypeNameResolution {
+			parseNameRecords(body[:len(body)-4], byteOrder, names)
+		}
+	}
+}
+
+func parseNameRecords(body []byte, byteOrder binary.ByteOrder, names map[string][]string) {
+	for len(body) >= 4 {
+		recordType := byteOrder.Uint16(body[0:2])
+		recordLength := int(byteOrder.Uint16(body[2:4]))
+		body = body[4:]
+		if recordType == ngNameRecordEnd || recordLength > len(body) {
+			return
+		}
+		value := body[:recordLength]
+		padded := (recordLength + 3) &^ 3
+		if padded > len(body) {
+			padded = len(body)
+		}
+		body = body[padded:]
+
+		var ipLength int
+		switch recordType {
+		case ngNameRecordIPv4:
+			ipLength = net.IPv4len
+		case ngNameRecordIPv6:
+			ipLength = net.IPv6len
+		default:
+			continue
+		}
+		if len(value) < ipLength {
+			continue
+		}
+		ip := net.IP(value[:ipLength]).String()
+		// the address is followed by one or more zero-terminated names
+		for _, name := range splitZeroTerminated(value[ipLength:]) {
+			names[ip] = append(names[ip], name)
+		}
+	}
+}
+
+func splitZeroTerminated(data []byte) []string {
+	var result []string
+	start := 0
+	for i, b := range data {
+		if b == 0 {
+			if i > start {
+				result = append(result, string(data[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return result
+}
@@ -0,0 +1,92 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestPcapngRoundTrip(t *testing.T) {
+	client := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	data := udpPacket(t, client, server, []byte{0x84, 1, 2, 3})
+
+	var buffer bytes.Buffer
+	writer, err := NewNgWriter(&buffer, layers.LinkTypeRaw, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	ci := gopacket.CaptureInfo{Timestamp: timestamp, CaptureLength: len(data), Length: len(data)}
+	err = writer.WritePacket(ci, data, "ID_DATA: decoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// name resolution block: one IPv4 record followed by the end of records
+	var records bytes.Buffer
+	record := append([]byte(server.IP), []byte("rcc.example\x00")...)
+	binary.Write(&records, binary.LittleEndian, [2]uint16{ngNameRecordIPv4, uint16(len(record))})
+	records.Write(record)
+	records.Write(make([]byte, ngPadding(len(record))))
+	records.Write(make([]byte, 4))
+	err = writer.writeBlock(ngBlockTypeNameResolution, records.Bytes(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WritePacket(ci, data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.pcapng")
+	err = ioutil.WriteFile(filename, buffer.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := OpenFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if !file.IsNg() {
+		t.Error("file was not detected as pcapng")
+	}
+	if file.NameOf(server) != "rcc.example" {
+		t.Errorf("server name is %q", file.NameOf(server))
+	}
+
+	var count int
+	for packet := range file.Packets(context.Background()) {
+		count++
+		if !packet.Metadata().Timestamp.Equal(timestamp) {
+			t.Errorf("timestamp is %s, expected %s", packet.Metadata().Timestamp, timestamp)
+		}
+		src, dst := SrcAndDestFromGoPacket(packet)
+		if !AddressEq(src, client) || !AddressEq(dst, server) {
+			t.Errorf("packet is %s -> %s", src, dst)
+		}
+	}
+	if count != 2 {
+		t.Errorf("read %d packets, expected 2", count)
+	}
+	total, err := CountPackets(filename)
+	if err != nil || total != 2 {
+		t.Errorf("counted %d packets: %v", total, err)
+	}
+}
@@ -0,0 +1,124 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	ngBlockTypeInterfaceDescriptor = 0x00000001
+	ngBlockTypeEnhancedPacket      = 0x00000006
+
+	ngOptionEndOfOptions = 0
+	ngOptionComment      = 1
+	ngOptionUserAppl     = 4
+	ngOptionTSResol      = 9
+)
+
+// NgWriter writes single-interface pcapng files in which every packet
+// may carry a comment. The timestamps are written in nanosecond resolution.
+type NgWriter struct {
+	w *bufio.Writer
+}
+
+type ngOption struct {
+	code  uint16
+	value []byte
+}
+
+func ngPadding(length int) int {
+	return (4 - length&3) & 3
+}
+
+func ngOptionsLength(options []ngOption) int {
+	if len(options) == 0 {
+		return 0
+	}
+	length := 4 // end of options
+	for _, option := range options {
+		length += 4 + len(option.value) + ngPadding(len(option.value))
+	}
+	return length
+}
+
+// NewNgWriter writes the section header and the interface description to w
+func NewNgWriter(w io.Writer, linkType layers.LinkType, snapLength uint32) (*NgWriter, error) {
+	writer := &NgWriter{w: bufio.NewWriter(w)}
+
+	var header [16]byte
+	binary.LittleEndian.PutUint32(header[0:4], ngByteOrderMagic)
+	binary.LittleEndian.PutUint16(header[4:6], 1) // major version
+	binary.LittleEndian.PutUint16(header[6:8], 0) // minor version
+	binary.LittleEndian.PutUint64(header[8:16], 0xFFFFFFFFFFFFFFFF)
+	err := writer.writeBlock(ngBlockTypeSectionHeader, header[:], nil, []ngOption{
+		{code: ngOptionUserAppl, value: []byte("Sala")},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var iface [8]byte
+	binary.LittleEndian.PutUint16(iface[0:2], uint16(linkType))
+	binary.LittleEndian.PutUint32(iface[4:8], snapLength)
+	err = writer.writeBlock(ngBlockTypeInterfaceDescriptor, iface[:], nil, []ngOption{
+		{code: ngOptionTSResol, value: []byte{9}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return writer, writer.w.Flush()
+}
+
+func (writer *NgWriter) writeBlock(blockType uint32, fixed []byte, data []byte, options []ngOption) error {
+	length := 12 + len(fixed) + len(data) + ngPadding(len(data)) + ngOptionsLength(options)
+	var scratch [8]byte
+	binary.LittleEndian.PutUint32(scratch[0:4], blockType)
+	binary.LittleEndian.PutUint32(scratch[4:8], uint32(length))
+	writer.w.Write(scratch[:8])
+	writer.w.Write(fixed)
+	writer.w.Write(data)
+	writer.w.Write(make([]byte, ngPadding(len(data))))
+	if len(options) > 0 {
+		for _, option := range options {
+			binary.LittleEndian.PutUint16(scratch[0:2], option.code)
+			binary.LittleEndian.PutUint16(scratch[2:4], uint16(len(option.value)))
+			writer.w.Write(scratch[:4])
+			writer.w.Write(option.value)
+			writer.w.Write(make([]byte, ngPadding(len(option.value))))
+		}
+		binary.LittleEndian.PutUint32(scratch[0:4], ngOptionEndOfOptions)
+		writer.w.Write(scratch[:4])
+	}
+	binary.LittleEndian.PutUint32(scratch[0:4], uint32(length))
+	_, err := writer.w.Write(scratch[:4])
+	return err
+}
+
+// WritePacket writes a packet with an optional comment
+func (writer *NgWriter) WritePacket(ci gopacket.CaptureInfo, data []byte, comment string) error {
+	var header [20]byte
+	timestamp := uint64(ci.Timestamp.UnixNano())
+	binary.LittleEndian.PutUint32(header[0:4], 0) // interface ID
+	binary.LittleEndian.PutUint32(header[4:8], uint32(timestamp>>32))
+	binary.LittleEndian.PutUint32(header[8:12], uint32(timestamp))
+	binary.LittleEndian.PutUint32(header[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[16:20], uint32(ci.Length))
+
+	var options []ngOption
+	if comment != "" {
+		// option values are limited to 65535 bytes
+		if len(comment) > 0xFFFF {
+			comment = comment[:0xFFFF]
+		}
+		options = []ngOption{{code: ngOptionComment, value: []byte(comment)}}
+	}
+	err := writer.writeBlock(ngBlockTypeEnhancedPacket, header[:], data, options)
+	if err != nil {
+		return err
+	}
+	return writer.w.Flush()
+}
@@ -0,0 +1,329 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// RollingOptions configures a RollingWriter. Zero values disable the
+// corresponding limits.
+type RollingOptions struct {
+	// Dir is the directory the capture files are written to
+	Dir string
+	// Prefix starts the name of every capture file. Files in Dir that start
+	// with Prefix are subject to the retention limits.
+	Prefix string
+	// Ng writes pcapng files instead of pcap files
+	Ng bool
+	// PerConversation writes the packets of each conversation to their own files
+	PerConversation bool
+
+	// MaxSize starts a new file once a file has grown to this many bytes
+	MaxSize int64
+	// MaxDuration starts a new file once a file spans this long
+	MaxDuration time.Duration
+
+	// MaxFiles removes the oldest files once there are more than this many
+	MaxFiles int
+	// MaxTotalSize removes the oldest files once they take more than this many bytes in total
+	MaxTotalSize int64
+	// Retention removes files that were last written to longer ago than this
+	Retention time.Duration
+	// CheckInterval is how often the retention limits are checked, in addition
+	// to whenever a file is started. DefaultCheckInterval is used if it is zero.
+	CheckInterval time.Duration
+}
+
+// DefaultCheckInterval is the default interval of retention checks
+const DefaultCheckInterval = time.Minute
+
+// countingWriter counts the bytes written to a file
+type countingWriter struct {
+	w    io.Writer
+	size int64
+}
+
+func (writer *countingWriter) Write(data []byte) (int, error) {
+	n, err := writer.w.Write(data)
+	writer.size += int64(n)
+	return n, err
+}
+
+// rollingFile is a capture file that is currently being written to
+type rollingFile struct {
+	file    *os.File
+	counter *countingWriter
+	pcap    *pcapgo.Writer
+	ng      *NgWriter
+	// start is the timestamp of the first packet in the file
+	start time.Time
+}
+
+// RollingWriter writes captured packets to a series of capture files,
+// starting new files by size or time and removing old files according
+// to retention limits. It is safe for concurrent use.
+type RollingWriter struct {
+	options    RollingOptions
+	linkType   layers.LinkType
+	snapLength uint32
+
+	mutex    sync.Mutex
+	files    map[*Conversation]*rollingFile
+	sequence int
+	// stop ends the periodic retention checks
+	stop chan struct{}
+	// retentionErr is the first error of a periodic retention check.
+	// It is returned by the next call to WritePacket.
+	retentionErr error
+}
+
+// NewRollingWriter creates a RollingWriter for frames of the given link type
+func NewRollingWriter(options RollingOptions, linkType layers.LinkType, snapLength uint32) (*RollingWriter, error) {
+	if options.Prefix == "" {
+		options.Prefix = "capture"
+	}
+	if options.Dir == "" {
+		options.Dir = "."
+	}
+	err := os.MkdirAll(options.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	writer := &RollingWriter{
+		options:    options,
+		linkType:   linkType,
+		snapLength: snapLength,
+		files:      make(map[*Conversation]*rollingFile),
+	}
+	if options.MaxFiles > 0 || options.MaxTotalSize > 0 || options.Retention > 0 {
+		interval := options.CheckInterval
+		if interval <= 0 {
+			interval = DefaultCheckInterval
+		}
+		// files also expire and the current files grow while no file is started
+		writer.stop = make(chan struct{})
+		go writer.checkRetention(interval, writer.stop)
+	}
+	return writer, nil
+}
+
+// checkRetention enforces the retention limits every interval until stop is closed
+func (writer *RollingWriter) checkRetention(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			writer.mutex.Lock()
+			err := writer.enforceRetention()
+			if err != nil && writer.retentionErr == nil {
+				writer.retentionErr = err
+			}
+			writer.mutex.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (writer *RollingWriter) extension() string {
+	if writer.options.Ng {
+		return ".pcapng"
+	}
+	return ".pcap"
+}
+
+// addressLabel formats an address so that it can be used in a file name
+func addressLabel(addr fmt.Stringer) string {
+	return strings.NewReplacer(":", "-", "[", "", "]", "", "%", "-").Replace(addr.String())
+}
+
+// create opens a new capture file for conv, which may be nil
+func (writer *RollingWriter) create(conv *Conversation, start time.Time) (*rollingFile, error) {
+	label := ""
+	if writer.options.PerConversation && conv != nil {
+		label = "_" + addressLabel(conv.Client) + "_" + addressLabel(conv.Server)
+	}
+
+	var file *os.File
+	var err error
+	for {
+		writer.sequence++
+		name := fmt.Sprintf("%s%s_%s_%04d%s", writer.options.Prefix, label, start.Format("20060102-150405"), writer.sequence, writer.extension())
+		file, err = os.OpenFile(filepath.Join(writer.options.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &rollingFile{
+		file:    file,
+		counter: &countingWriter{w: file},
+		start:   start,
+	}
+	if writer.options.Ng {
+		result.ng, err = NewNgWriter(result.counter, writer.linkType, writer.snapLength)
+	} else {
+		result.pcap = pcapgo.NewWriter(result.counter)
+		err = result.pcap.WriteFileHeader(writer.snapLength, writer.linkType)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return result, nil
+}
+
+// full reports whether a file must be replaced before a packet with the
+// given timestamp is written to it
+func (writer *RollingWriter) full(file *rollingFile, timestamp time.Time) bool {
+	if writer.options.MaxSize > 0 && file.counter.size >= writer.options.MaxSize {
+		return true
+	}
+	return writer.options.MaxDuration > 0 && timestamp.Sub(file.start) >= writer.options.MaxDuration
+}
+
+// WritePacket writes a link-layer frame to the current file of conv. conv may
+// be nil, and it is ignored unless the writer splits files per conversation.
+// The comment is only written to pcapng files.
+func (writer *RollingWriter) WritePacket(conv *Conversation, ci gopacket.CaptureInfo, data []byte, comment string) error {
+	if !writer.options.PerConversation {
+		conv = nil
+	}
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	file := writer.files[conv]
+	if file != nil && writer.full(file, ci.Timestamp) {
+		delete(writer.files, conv)
+		err := file.file.Close()
+		if err != nil {
+			return err
+		}
+		file = nil
+	}
+	if file == nil {
+		var err error
+		file, err = writer.create(conv, ci.Timestamp)
+		if err != nil {
+			return err
+		}
+		writer.files[conv] = file
+		err = writer.enforceRetention()
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if file.ng != nil {
+		err = file.ng.WritePacket(ci, data, comment)
+	} else {
+		err = file.pcap.WritePacket(ci, data)
+	}
+	if err == nil {
+		err = writer.retentionErr
+	}
+	writer.retentionErr = nil
+	return err
+}
+
+// CloseConversation closes the file of a conversation that has ended
+func (writer *RollingWriter) CloseConversation(conv *Conversation) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	file, ok := writer.files[conv]
+	if !ok {
+		return nil
+	}
+	delete(writer.files, conv)
+	return file.file.Close()
+}
+
+// Close closes all files of the writer
+func (writer *RollingWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.stop != nil {
+		close(writer.stop)
+		writer.stop = nil
+	}
+	var err error
+	for conv, file := range writer.files {
+		if closeErr := file.file.Close(); err == nil {
+			err = closeErr
+		}
+		delete(writer.files, conv)
+	}
+	return err
+}
+
+// enforceRetention removes the oldest capture files that exceed the
+// retention limits. Files that are being written to are never removed.
+func (writer *RollingWriter) enforceRetention() error {
+	options := writer.options
+	if options.MaxFiles <= 0 && options.MaxTotalSize <= 0 && options.Retention <= 0 {
+		return nil
+	}
+
+	open := make(map[string]bool)
+	for _, file := range writer.files {
+		open[filepath.Base(file.file.Name())] = true
+	}
+	entries, err := ioutil.ReadDir(options.Dir)
+	if err != nil {
+		return err
+	}
+	var closed []os.FileInfo
+	count := 0
+	var totalSize int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, options.Prefix+"_") ||
+			(filepath.Ext(name) != ".pcap" && filepath.Ext(name) != ".pcapng") {
+			continue
+		}
+		count++
+		totalSize += entry.Size()
+		if !open[name] {
+			closed = append(closed, entry)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		if closed[i].ModTime().Equal(closed[j].ModTime()) {
+			return closed[i].Name() < closed[j].Name()
+		}
+		return closed[i].ModTime().Before(closed[j].ModTime())
+	})
+
+	for _, entry := range closed {
+		expired := options.Retention > 0 && time.Since(entry.ModTime()) > options.Retention
+		tooMany := options.MaxFiles > 0 && count > options.MaxFiles
+		tooLarge := options.MaxTotalSize > 0 && totalSize > options.MaxTotalSize
+		if !expired && !tooMany && !tooLarge {
+			continue
+		}
+		err = os.Remove(filepath.Join(options.Dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		count--
+		totalSize -= entry.Size()
+	}
+	return nil
+}
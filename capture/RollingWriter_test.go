@@ -0,0 +1,201 @@
+package capture
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestRollingWriterSplitsConversations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	first := NewConversation(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}, server)
+	second := NewConversation(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 3).To4(), Port: 50001}, server)
+
+	writer, err := NewRollingWriter(RollingOptions{
+		Dir:             dir,
+		Prefix:          "test",
+		PerConversation: true,
+		MaxDuration:     time.Minute,
+	}, layers.LinkTypeRaw, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	write := func(conv *Conversation, offset time.Duration) {
+		data := udpPacket(t, conv.Client, conv.Server, []byte{0x84, 1, 2, 3})
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(offset), CaptureLength: len(data), Length: len(data)}
+		err := writer.WritePacket(conv, ci, data, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(first, 0)
+	write(second, 0)
+	write(first, 30*time.Second)
+	// the first conversation's file spans a minute, so a new one is started
+	write(first, 90*time.Second)
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packetCounts := make(map[string]int)
+	matches, err := filepath.Glob(filepath.Join(dir, "test_*.pcap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range matches {
+		count, err := CountPackets(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packetCounts[filepath.Base(name)] = count
+	}
+	if len(packetCounts) != 3 {
+		t.Fatalf("wrote files %v, expected 3", packetCounts)
+	}
+	expected := map[string]int{
+		"test_10.0.0.1-50000_10.0.0.2-53640_20200102-030405_0001.pcap": 2,
+		"test_10.0.0.3-50001_10.0.0.2-53640_20200102-030405_0002.pcap": 1,
+		"test_10.0.0.1-50000_10.0.0.2-53640_20200102-030535_0003.pcap": 1,
+	}
+	for name, count := range expected {
+		if packetCounts[name] != count {
+			t.Errorf("%s has %d packets, expected %d", name, packetCounts[name], count)
+		}
+	}
+
+	file, err := OpenFile(filepath.Join(dir, "test_10.0.0.1-50000_10.0.0.2-53640_20200102-030405_0001.pcap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for packet := range file.Packets(context.Background()) {
+		src, dst := SrcAndDestFromGoPacket(packet)
+		if !AddressEq(src, first.Client) || !AddressEq(dst, server) {
+			t.Errorf("packet is %s -> %s", src, dst)
+		}
+	}
+}
+
+func TestRollingWriterRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// files from an earlier run are subject to retention, other files are not
+	old := filepath.Join(dir, "test_20190101-000000_0001.pcapng")
+	unrelated := filepath.Join(dir, "notes.txt")
+	for _, name := range []string{old, unrelated} {
+		err = ioutil.WriteFile(name, []byte("old"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		past := time.Now().Add(-time.Hour)
+		os.Chtimes(name, past, past)
+	}
+
+	writer, err := NewRollingWriter(RollingOptions{
+		Dir:      dir,
+		Prefix:   "test",
+		Ng:       true,
+		MaxSize:  1,
+		MaxFiles: 2,
+	}, layers.LinkTypeRaw, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	client := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	data := udpPacket(t, client, server, []byte{0x84, 1, 2, 3})
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * time.Second), CaptureLength: len(data), Length: len(data)}
+		err = writer.WritePacket(nil, ci, data, "comment")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var captures []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".pcapng") {
+			captures = append(captures, entry.Name())
+		}
+	}
+	// every packet fills a file, so only the last two files are kept
+	if len(captures) != 2 || captures[0] != "test_20200102-030407_0003.pcapng" || captures[1] != "test_20200102-030408_0004.pcapng" {
+		t.Errorf("kept files %v", captures)
+	}
+	if _, err = os.Stat(unrelated); err != nil {
+		t.Error("removed a file that wasn't a capture")
+	}
+}
+
+func TestRollingWriterRetentionTimer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writer, err := NewRollingWriter(RollingOptions{
+		Dir:           dir,
+		Prefix:        "test",
+		MaxSize:       1,
+		Retention:     50 * time.Millisecond,
+		CheckInterval: 10 * time.Millisecond,
+	}, layers.LinkTypeRaw, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	client := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	data := udpPacket(t, client, server, []byte{0x84, 1, 2, 3})
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * time.Second), CaptureLength: len(data), Length: len(data)}
+		err = writer.WritePacket(nil, ci, data, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the closed file expires while no file is started
+	closed := filepath.Join(dir, "test_20200102-030405_0001.pcap")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err = os.Stat(closed); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired file wasn't removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "test_20200102-030406_0002.pcap")); err != nil {
+		t.Error("removed the file that is being written to")
+	}
+}
@@ -0,0 +1,75 @@
+package capture
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+)
+
+// Session is a Conversations implementation that detects new conversations
+// from their handshakes and passes their decoded layers to a handler
+type Session struct {
+	Conversations []*Conversation
+	// MidSession enables the detection of conversations that had started
+	// before the capture began. See DetectMidSessionConversation.
+	// It is disabled by default, because other UDP traffic can be
+	// mistaken for RakNet datagrams.
+	MidSession bool
+	// Handler is called for every layer decoded in any conversation.
+	// When used with CapturePacketsParallel, it is called concurrently
+	// for different conversations.
+	Handler func(*Event)
+	// NewConversation is called when a conversation is detected,
+	// before any of its packets are decoded. May be nil.
+	NewConversation func(*Conversation)
+	// RawPacket is called with every packet that belongs to a conversation,
+	// before it is decoded. May be nil.
+	RawPacket func(packet gopacket.Packet, conv *Conversation)
+
+	progress int64
+}
+
+// NewSession creates a Session that calls handler for each decoded layer
+func NewSession(handler func(*Event)) *Session {
+	return &Session{Handler: handler}
+}
+
+// ConversationFor implements Conversations
+func (session *Session) ConversationFor(source *net.UDPAddr, dest *net.UDPAddr, payload []byte) *Conversation {
+	if conv := FindConversation(session.Conversations, source, dest); conv != nil {
+		return conv
+	}
+	conv := DetectConversation(source, dest, payload)
+	if conv == nil && session.MidSession {
+		conv = DetectMidSessionConversation(source, dest, payload)
+	}
+	if conv == nil {
+		return nil
+	}
+	session.Conversations = append(session.Conversations, conv)
+	if session.NewConversation != nil {
+		session.NewConversation(conv)
+	}
+	if session.Handler != nil {
+		conv.Bind(session.Handler)
+	}
+	return conv
+}
+
+// HandleRawPacket implements RawPacketHandler
+func (session *Session) HandleRawPacket(packet gopacket.Packet, conv *Conversation, _ *net.UDPAddr, _ *net.UDPAddr, _ []byte) {
+	if session.RawPacket != nil {
+		session.RawPacket(packet, conv)
+	}
+}
+
+// SetProgress implements Conversations
+func (session *Session) SetProgress(progress int) {
+	atomic.StoreInt64(&session.progress, int64(progress))
+}
+
+// Progress returns the number of packets read from the source so far
+func (session *Session) Progress() int {
+	return int(atomic.LoadInt64(&session.progress))
+}
@@ -0,0 +1,199 @@
+package capture
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type sliceSource [][]byte
+
+func (source *sliceSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if len(*source) == 0 {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+	data := (*source)[0]
+	*source = (*source)[1:]
+	return data, gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(data), Length: len(data)}, nil
+}
+
+func udpPacket(t *testing.T, src, dst *net.UDPAddr, payload []byte) []byte {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    src.IP,
+		DstIP:    dst.IP,
+	}
+	udp := &layers.UDP{
+		SrcPort: layers.UDPPort(src.Port),
+		DstPort: layers.UDPPort(dst.Port),
+	}
+	udp.SetNetworkLayerForChecksum(ip)
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ip, udp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestSessionDetectsConversations(t *testing.T) {
+	client := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	other := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3).To4(), Port: 1234}
+
+	handshake := append([]byte{0x7B}, peer.OfflineMessageID...)
+	handshake = append(handshake, 5)
+	source := sliceSource{
+		udpPacket(t, other, server, []byte{0x84, 0, 0, 0}),
+		udpPacket(t, client, server, handshake),
+		udpPacket(t, server, client, []byte{0xC0, 0, 1, 1, 0, 0, 0}),
+	}
+
+	var events []*Event
+	var raw int
+	session := NewSession(func(e *Event) {
+		events = append(events, e)
+	})
+	session.RawPacket = func(_ gopacket.Packet, conv *Conversation) {
+		if conv == nil {
+			t.Error("raw packet without conversation")
+		}
+		raw++
+	}
+
+	err := CaptureFromSource(context.Background(), session, gopacket.NewPacketSource(&source, layers.LayerTypeIPv4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Conversations) != 1 {
+		t.Fatalf("detected %d conversations, expected 1", len(session.Conversations))
+	}
+	conv := session.Conversations[0]
+	if !AddressEq(conv.Client, client) || !AddressEq(conv.Server, server) {
+		t.Errorf("conversation is %s -> %s", conv.Client, conv.Server)
+	}
+	if raw != 2 {
+		t.Errorf("got %d raw packets, expected 2", raw)
+	}
+	if session.Progress() != 3 {
+		t.Errorf("progress is %d, expected 3", session.Progress())
+	}
+	if len(events) == 0 || events[0].Topic != "offline" || events[0].Conversation != conv {
+		t.Fatal("first event is not the offline handshake")
+	}
+	for _, e := range events[1:] {
+		if !e.Layers.Root.FromServer {
+			t.Errorf("event %s was not from server", e.Topic)
+		}
+	}
+}
+
+func TestSessionDetectsMidSession(t *testing.T) {
+	client := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2).To4(), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(128, 116, 1, 2).To4(), Port: 53640}
+
+	// a RELIABLE datagram carrying ID_CONNECTED_PING
+	datagram := []byte{0x84, 1, 0, 0, peer.Reliable << 5, 0, 72, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	source := sliceSource{
+		udpPacket(t, server, client, []byte{0x84, 0, 0, 0}),
+		udpPacket(t, server, client, datagram),
+	}
+
+	var events []*Event
+	session := NewSession(func(e *Event) {
+		events = append(events, e)
+	})
+	session.MidSession = true
+	err := CaptureFromSource(context.Background(), session, gopacket.NewPacketSource(&source, layers.LayerTypeIPv4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Conversations) != 1 {
+		t.Fatalf("detected %d conversations, expected 1", len(session.Conversations))
+	}
+	conv := session.Conversations[0]
+	if !conv.IsMidSession() {
+		t.Error("conversation is not marked as mid-session")
+	}
+	if !AddressEq(conv.Client, client) || !AddressEq(conv.Server, server) {
+		t.Errorf("conversation is %s -> %s", conv.Client, conv.Server)
+	}
+	var decoded bool
+	for _, e := range events {
+		if e.Topic == "full-reliable" && !e.IsError && e.Layers.Main != nil {
+			decoded = true
+		}
+	}
+	if !decoded {
+		t.Error("ping was not decoded")
+	}
+
+	// mid-session detection is opt-in
+	session = NewSession(nil)
+	source = sliceSource{udpPacket(t, server, client, datagram)}
+	CaptureFromSource(context.Background(), session, gopacket.NewPacketSource(&source, layers.LayerTypeIPv4))
+	if len(session.Conversations) != 0 {
+		t.Error("mid-session conversation was detected while disabled")
+	}
+}
+
+func TestCapturePacketsParallel(t *testing.T) {
+	server := &net.UDPAddr{IP: net.IPv4(128, 116, 1, 2).To4(), Port: 53640}
+	var packets [][]byte
+	for i := byte(1); i <= 20; i++ {
+		for port := 50000; port < 50008; port++ {
+			client := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2).To4(), Port: port}
+			datagram := []byte{0x84, i, 0, 0, peer.Reliable << 5, 0, 72, i, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, i}
+			packets = append(packets, udpPacket(t, server, client, datagram))
+		}
+	}
+
+	// decodes the packets and returns the pings of each client in the order they were decoded
+	decode := func(capturePackets func(context.Context, Conversations, <-chan gopacket.Packet) error) map[int][]byte {
+		var mutex sync.Mutex
+		pings := make(map[int][]byte)
+		session := NewSession(func(e *Event) {
+			if e.Topic != "full-reliable" || e.IsError {
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			port := e.Conversation.Client.Port
+			pings[port] = append(pings[port], byte(e.Layers.Reliability.ReliableMessageNumber))
+		})
+		// the clients are picked up mid-session
+		session.MidSession = true
+		source := sliceSource(append([][]byte(nil), packets...))
+		err := capturePackets(context.Background(), session, gopacket.NewPacketSource(&source, layers.LayerTypeIPv4).Packets())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(session.Conversations) != 8 {
+			t.Fatalf("detected %d conversations, expected 8", len(session.Conversations))
+		}
+		if session.Progress() != len(packets) {
+			t.Errorf("progress is %d, expected %d", session.Progress(), len(packets))
+		}
+		return pings
+	}
+
+	serial := decode(CapturePackets)
+	parallel := decode(func(ctx context.Context, convs Conversations, packetChan <-chan gopacket.Packet) error {
+		return CapturePacketsParallel(ctx, convs, packetChan, 3)
+	})
+	for port, pings := range serial {
+		if len(pings) != 20 || string(parallel[port]) != string(pings) {
+			t.Errorf("client %d decoded %v in parallel, %v serially", port, parallel[port], pings)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package capture
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Conversations keeps track of the conversations seen by CaptureFromSource
+type Conversations interface {
+	// ConversationFor returns the conversation a packet belongs to.
+	// A nil return value means that the packet is not part of a RakNet conversation.
+	ConversationFor(source *net.UDPAddr, dest *net.UDPAddr, payload []byte) *Conversation
+	SetProgress(int)
+}
+
+// RawPacketHandler can be implemented by a Conversations to receive
+// the raw payloads of RakNet packets before they are decoded
+type RawPacketHandler interface {
+	HandleRawPacket(packet gopacket.Packet, conv *Conversation, source *net.UDPAddr, dest *net.UDPAddr, payload []byte)
+}
+
+// PacketDoneHandler can be implemented by a Conversations to be notified
+// after a RakNet packet has been decoded and all of its layers have been emitted
+type PacketDoneHandler interface {
+	HandlePacketDone(packet gopacket.Packet, conv *Conversation, source *net.UDPAddr, dest *net.UDPAddr, payload []byte)
+}
+
+// workerQueueLength is the number of packets that may wait for each worker
+// of CapturePacketsParallel
+const workerQueueLength = 256
+
+// SrcAndDestFromGoPacket returns the UDP source and destination addresses of a packet
+func SrcAndDestFromGoPacket(packet gopacket.Packet) (*net.UDPAddr, *net.UDPAddr) {
+	var srcIP, dstIP net.IP
+	if ipv4, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4); ok {
+		srcIP = ipv4.SrcIP
+		dstIP = ipv4.DstIP
+	} else if ipv6, ok := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6); ok {
+		srcIP = ipv6.SrcIP
+		dstIP = ipv6.DstIP
+	}
+	return &net.UDPAddr{
+		IP:   srcIP,
+		Port: int(packet.Layer(layers.LayerTypeUDP).(*layers.UDP).SrcPort),
+		Zone: "udp",
+	}, &net.UDPAddr{
+		IP:   dstIP,
+		Port: int(packet.Layer(layers.LayerTypeUDP).(*layers.UDP).DstPort),
+		Zone: "udp",
+	}
+}
+
+// NewLayers creates the PacketLayers for a packet that is about to be decoded
+func NewLayers(source *net.UDPAddr, dest *net.UDPAddr, fromClient bool) *peer.PacketLayers {
+	return &peer.PacketLayers{
+		Root: peer.RootLayer{
+			Source:      source,
+			Destination: dest,
+			FromClient:  fromClient,
+			FromServer:  !fromClient,
+		},
+	}
+}
+
+// CaptureFromSource decodes every RakNet packet in packetSource using the
+// readers of the conversations returned by convs. It returns when the source
+// is exhausted or ctx is cancelled.
+func CaptureFromSource(ctx context.Context, convs Conversations, packetSource *gopacket.PacketSource) error {
+	return CapturePackets(ctx, convs, packetSource.Packets())
+}
+
+// job is a RakNet packet together with the conversation it belongs to
+type job struct {
+	packet  gopacket.Packet
+	conv    *Conversation
+	source  *net.UDPAddr
+	dest    *net.UDPAddr
+	payload []byte
+}
+
+// dispatch reassembles fragmented packets and finds the conversation
+// a packet belongs to. It returns false if the packet isn't part of a
+// RakNet conversation or if it is a fragment of an incomplete datagram.
+func dispatch(convs Conversations, defragmenter *Defragmenter, packet gopacket.Packet) (job, bool) {
+	packet, _ = defragmenter.Defrag(packet)
+	if packet == nil || packet.ApplicationLayer() == nil ||
+		(packet.Layer(layers.LayerTypeIPv4) == nil && packet.Layer(layers.LayerTypeIPv6) == nil) ||
+		packet.Layer(layers.LayerTypeUDP) == nil {
+		return job{}, false
+	}
+	payload := packet.ApplicationLayer().Payload()
+	if len(payload) == 0 {
+		return job{}, false
+	}
+
+	src, dest := SrcAndDestFromGoPacket(packet)
+	conv := convs.ConversationFor(src, dest, payload)
+	if conv == nil {
+		return job{}, false // Not a RakNet packet
+	}
+	return job{packet: packet, conv: conv, source: src, dest: dest, payload: payload}, true
+}
+
+// decode decodes the packet using the readers of its conversation
+func (j job) decode(rawHandler RawPacketHandler, doneHandler PacketDoneHandler) {
+	fromClient := AddressEq(j.source, j.conv.Client)
+
+	if rawHandler != nil {
+		rawHandler.HandleRawPacket(j.packet, j.conv, j.source, j.dest, j.payload)
+	}
+
+	layers := NewLayers(j.source, j.dest, fromClient)
+	layers.Root.Timestamp = j.packet.Metadata().Timestamp
+	var reader PacketProvider
+	if fromClient {
+		reader = j.conv.ClientReader
+	} else {
+		reader = j.conv.ServerReader
+	}
+	reader.(peer.PacketReader).ReadPacket(j.payload, layers)
+	if doneHandler != nil {
+		doneHandler.HandlePacketDone(j.packet, j.conv, j.source, j.dest, j.payload)
+	}
+}
+
+// CapturePackets is like CaptureFromSource, but reads the packets from a channel
+func CapturePackets(ctx context.Context, convs Conversations, packetChan <-chan gopacket.Packet) error {
+	var progress int
+	defragmenter := NewDefragmenter()
+	rawHandler, _ := convs.(RawPacketHandler)
+	doneHandler, _ := convs.(PacketDoneHandler)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case packet, ok := <-packetChan:
+			if !ok {
+				return nil
+			}
+			progress++
+
+			j, ok := dispatch(convs, defragmenter, packet)
+			if !ok {
+				continue
+			}
+			j.decode(rawHandler, doneHandler)
+			convs.SetProgress(progress)
+		}
+	}
+}
+
+// CapturePacketsParallel is like CapturePackets, but decodes the packets of
+// different conversations on up to workers goroutines. The packets of each
+// conversation are still decoded in the order they were read in.
+//
+// ConversationFor is only called from the calling goroutine, but the other
+// methods of convs and the handlers bound to the conversations are called
+// concurrently for different conversations. SetProgress is called with the
+// number of packets that have been processed in total.
+func CapturePacketsParallel(ctx context.Context, convs Conversations, packetChan <-chan gopacket.Packet, workers int) error {
+	if workers < 2 {
+		return CapturePackets(ctx, convs, packetChan)
+	}
+	rawHandler, _ := convs.(RawPacketHandler)
+	doneHandler, _ := convs.(PacketDoneHandler)
+
+	var processed int64
+	var wg sync.WaitGroup
+	queues := make([]chan job, workers)
+	for i := range queues {
+		queues[i] = make(chan job, workerQueueLength)
+		wg.Add(1)
+		go func(queue <-chan job) {
+			defer wg.Done()
+			for j := range queue {
+				// keep draining the queue after cancellation so that
+				// the dispatcher is never blocked
+				if ctx.Err() != nil {
+					continue
+				}
+				j.decode(rawHandler, doneHandler)
+				convs.SetProgress(int(atomic.AddInt64(&processed, 1)))
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+		// the workers may report their progress out of order
+		convs.SetProgress(int(atomic.LoadInt64(&processed)))
+	}()
+
+	defragmenter := NewDefragmenter()
+	// conversations are assigned to workers in the order they are detected
+	assigned := make(map[*Conversation]chan<- job)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case packet, ok := <-packetChan:
+			if !ok {
+				return nil
+			}
+
+			j, ok := dispatch(convs, defragmenter, packet)
+			if !ok {
+				atomic.AddInt64(&processed, 1)
+				continue
+			}
+			queue, ok := assigned[j.conv]
+			if !ok {
+				queue = queues[len(assigned)%workers]
+				assigned[j.conv] = queue
+			}
+			select {
+			case queue <- j:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Package capturetest provides conversations and datagrams for the tests of
+// packages that store and decode captures.
+package capturetest
+
+import (
+	"net"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/peer"
+)
+
+var (
+	// Client is the address of the client in test conversations
+	Client = &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2).To4(), Port: 50000}
+	// Server is the address of the server in test conversations
+	Server = &net.UDPAddr{IP: net.IPv4(128, 116, 1, 2).To4(), Port: 53640}
+)
+
+// ReliablePing returns a datagram containing a single RELIABLE ID_CONNECTED_PING.
+// number is used as the datagram number, the message number and the ping time.
+func ReliablePing(number byte) []byte {
+	return []byte{0x84, number, 0, 0, peer.Reliable << 5, 0, 72, number, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, number}
+}
+
+// NewMidSessionConversation returns a degraded conversation between Client and Server
+func NewMidSessionConversation() *capture.Conversation {
+	conv := capture.NewConversation(Client, Server)
+	conv.Context.Degraded = true
+	return conv
+}
+
+// Read decodes a datagram in conv as if it had been captured at timestamp
+func Read(conv *capture.Conversation, payload []byte, fromClient bool, timestamp time.Time) {
+	source, dest, reader := conv.Server, conv.Client, conv.ServerReader
+	if fromClient {
+		source, dest, reader = conv.Client, conv.Server, conv.ClientReader
+	}
+	layers := capture.NewLayers(source, dest, fromClient)
+	layers.Root.Timestamp = timestamp
+	reader.(peer.PacketReader).ReadPacket(payload, layers)
+}
@@ -0,0 +1,222 @@
+// Package export implements a structured JSON encoding of decoded packets.
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/peer"
+)
+
+// RakNetRecord describes the outermost layer of a datagram
+type RakNetRecord struct {
+	IsValid          bool            `json:"isValid"`
+	IsACK            bool            `json:"isAck,omitempty"`
+	IsNAK            bool            `json:"isNak,omitempty"`
+	IsPacketPair     bool            `json:"isPacketPair,omitempty"`
+	IsContinuousSend bool            `json:"isContinuousSend,omitempty"`
+	NeedsBAndAS      bool            `json:"needsBAndAs,omitempty"`
+	HasBAndAS        bool            `json:"hasBAndAs,omitempty"`
+	DatagramNumber   uint32          `json:"datagramNumber"`
+	ACKs             []peer.ACKRange `json:"acks,omitempty"`
+}
+
+// ReliabilityRecord describes the reliability layer of a packet
+// or of its last split
+type ReliabilityRecord struct {
+	Reliability           uint8  `json:"reliability"`
+	ReliabilityName       string `json:"reliabilityName"`
+	ReliableMessageNumber uint32 `json:"reliableMessageNumber"`
+	SequencingIndex       uint32 `json:"sequencingIndex"`
+	OrderingIndex         uint32 `json:"orderingIndex"`
+	OrderingChannel       uint8  `json:"orderingChannel"`
+	LengthInBits          uint16 `json:"lengthInBits"`
+	HasSplitPacket        bool   `json:"hasSplitPacket"`
+}
+
+// SplitRecord describes how a packet was split
+type SplitRecord struct {
+	SplitPacketID uint16 `json:"splitPacketId"`
+	NumSplits     uint32 `json:"numSplits"`
+	NumReceived   uint32 `json:"numReceived"`
+	// DatagramNumbers of the splits in split order
+	DatagramNumbers []uint32 `json:"datagramNumbers"`
+	RealLength      uint32   `json:"realLength"`
+	IsFinal         bool     `json:"isFinal"`
+	// Capture times of the first and last splits
+	FirstTime *time.Time `json:"firstTime,omitempty"`
+	LastTime  *time.Time `json:"lastTime,omitempty"`
+}
+
+// SubpacketRecord describes one Packet83 subpacket
+type SubpacketRecord struct {
+	Type       uint8       `json:"type"`
+	TypeString string      `json:"typeString"`
+	Fields     interface{} `json:"fields"`
+}
+
+// PacketRecord is the JSON representation of a PacketLayers
+type PacketRecord struct {
+	// Conversation is an optional index set by the caller
+	Conversation int    `json:"conversation,omitempty"`
+	ID           uint64 `json:"id"`
+	Source       string `json:"source,omitempty"`
+	Destination  string `json:"destination,omitempty"`
+	// Time is the capture time of the datagram that completed the packet
+	Time       *time.Time `json:"time,omitempty"`
+	FromClient bool       `json:"fromClient"`
+	PacketType uint8      `json:"packetType"`
+	PacketName string     `json:"packetName"`
+	Error      string     `json:"error,omitempty"`
+	// Degradations lists what couldn't be decoded in a conversation
+	// that was picked up mid-session
+	Degradations []string `json:"degradations,omitempty"`
+
+	RakNet      *RakNetRecord      `json:"raknet,omitempty"`
+	Reliability *ReliabilityRecord `json:"reliability,omitempty"`
+	Split       *SplitRecord       `json:"split,omitempty"`
+	Timestamp   interface{}        `json:"timestamp,omitempty"`
+	// Main is the main layer, except for ID_DATA, which has Subpackets instead
+	Main       interface{}       `json:"main,omitempty"`
+	Subpackets []SubpacketRecord `json:"subpackets,omitempty"`
+}
+
+// reliabilityNames are the names of the RakNet reliabilities
+var reliabilityNames = [...]string{
+	"UNRELIABLE",
+	"UNRELIABLE_SEQUENCED",
+	"RELIABLE",
+	"RELIABLE_ORDERED",
+	"RELIABLE_SEQUENCED",
+	"UNRELIABLE_WITH_ACK_RECEIPT",
+	"RELIABLE_WITH_ACK_RECEIPT",
+	"RELIABLE_ORDERED_WITH_ACK_RECEIPT",
+}
+
+func optionalTime(timestamp time.Time) *time.Time {
+	if timestamp.IsZero() {
+		return nil
+	}
+	return &timestamp
+}
+
+func newRakNetRecord(layer *peer.RakNetLayer) *RakNetRecord {
+	return &RakNetRecord{
+		IsValid:          layer.Flags.IsValid,
+		IsACK:            layer.Flags.IsACK,
+		IsNAK:            layer.Flags.IsNAK,
+		IsPacketPair:     layer.Flags.IsPacketPair,
+		IsContinuousSend: layer.Flags.IsContinuousSend,
+		NeedsBAndAS:      layer.Flags.NeedsBAndAS,
+		HasBAndAS:        layer.Flags.HasBAndAS,
+		DatagramNumber:   layer.DatagramNumber,
+		ACKs:             layer.ACKs,
+	}
+}
+
+func newReliabilityRecord(layer *peer.ReliablePacket) *ReliabilityRecord {
+	record := &ReliabilityRecord{
+		Reliability:           layer.Reliability,
+		ReliableMessageNumber: layer.ReliableMessageNumber,
+		SequencingIndex:       layer.SequencingIndex,
+		OrderingIndex:         layer.OrderingIndex,
+		OrderingChannel:       layer.OrderingChannel,
+		LengthInBits:          layer.LengthInBits,
+		HasSplitPacket:        layer.HasSplitPacket,
+	}
+	if int(layer.Reliability) < len(reliabilityNames) {
+		record.ReliabilityName = reliabilityNames[layer.Reliability]
+	}
+	return record
+}
+
+func newSplitRecord(layers *peer.PacketLayers) *SplitRecord {
+	buffer := layers.SplitPacket
+	record := &SplitRecord{
+		NumReceived: buffer.NumReceivedSplits,
+		RealLength:  buffer.RealLength,
+		IsFinal:     buffer.IsFinal,
+		FirstTime:   optionalTime(buffer.FirstTimestamp),
+		LastTime:    optionalTime(buffer.LastTimestamp),
+	}
+	if layers.Reliability != nil {
+		record.SplitPacketID = layers.Reliability.SplitPacketID
+		record.NumSplits = layers.Reliability.SplitPacketCount
+	}
+	record.DatagramNumbers = make([]uint32, 0, len(buffer.ReliablePackets))
+	for _, split := range buffer.ReliablePackets {
+		if split != nil && split.RakNetLayer != nil {
+			record.DatagramNumbers = append(record.DatagramNumbers, split.RakNetLayer.DatagramNumber)
+		}
+	}
+	return record
+}
+
+// NewPacketRecord creates the JSON representation of layers
+func NewPacketRecord(layers *peer.PacketLayers) *PacketRecord {
+	record := &PacketRecord{
+		ID:         layers.UniqueID,
+		FromClient: layers.Root.FromClient,
+		PacketType: layers.PacketType,
+		PacketName: peer.PacketNames[layers.PacketType],
+		Time:       optionalTime(layers.Root.Timestamp),
+	}
+	if layers.Root.Source != nil {
+		record.Source = layers.Root.Source.String()
+	}
+	if layers.Root.Destination != nil {
+		record.Destination = layers.Root.Destination.String()
+	}
+	if layers.Error != nil {
+		record.Error = layers.Error.Error()
+	}
+	record.Degradations = layers.Degradations
+	if layers.RakNet != nil {
+		record.RakNet = newRakNetRecord(layers.RakNet)
+	}
+	if layers.Reliability != nil {
+		record.Reliability = newReliabilityRecord(layers.Reliability)
+	}
+	if layers.SplitPacket != nil && layers.Reliability != nil && layers.Reliability.HasSplitPacket {
+		record.Split = newSplitRecord(layers)
+	}
+	if layers.Timestamp != nil {
+		record.Timestamp = Encode(layers.Timestamp)
+	}
+
+	if data, ok := layers.Main.(*peer.Packet83Layer); ok {
+		record.Subpackets = make([]SubpacketRecord, 0, len(data.SubPackets))
+		for _, sub := range data.SubPackets {
+			record.Subpackets = append(record.Subpackets, SubpacketRecord{
+				Type:       sub.Type(),
+				TypeString: sub.TypeString(),
+				Fields:     Encode(sub),
+			})
+		}
+	} else if layers.Main != nil {
+		record.Main = Encode(layers.Main)
+	}
+
+	return record
+}
+
+// Exporter writes PacketRecords as newline-delimited JSON
+type Exporter struct {
+	encoder *json.Encoder
+}
+
+// NewExporter creates an Exporter that writes to output
+func NewExporter(output io.Writer) *Exporter {
+	return &Exporter{encoder: json.NewEncoder(output)}
+}
+
+// WriteRecord writes a single record
+func (exporter *Exporter) WriteRecord(record *PacketRecord) error {
+	return exporter.encoder.Encode(record)
+}
+
+// Export writes the JSON representation of layers
+func (exporter *Exporter) Export(layers *peer.PacketLayers) error {
+	return exporter.WriteRecord(NewPacketRecord(layers))
+}
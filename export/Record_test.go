@@ -0,0 +1,153 @@
+package export
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/datamodel"
+	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/robloxapi/rbxfile"
+)
+
+func TestPacketRecordEncoding(t *testing.T) {
+	workspace, _ := datamodel.NewInstance("Workspace", nil)
+	part, _ := datamodel.NewInstance("Part", workspace)
+	part.Set("Name", rbxfile.ValueString("Baseplate"))
+	part.Ref = datamodel.Reference{Scope: "RBXSERVER", Id: 5, PeerId: 1}
+
+	class := &peer.NetworkInstanceSchema{Name: "Part", NetworkID: 3}
+	property := &peer.NetworkPropertySchema{Name: "Transparency", InstanceSchema: class, NetworkID: 7}
+	class.Properties = []*peer.NetworkPropertySchema{property}
+
+	layers := &peer.PacketLayers{
+		PacketType:  0x83,
+		Reliability: &peer.ReliablePacket{Reliability: peer.ReliableOrdered},
+		Main: &peer.Packet83Layer{SubPackets: []peer.Packet83Subpacket{
+			&peer.Packet83_03{
+				Instance: part,
+				Schema:   property,
+				Value: datamodel.ValueTuple{
+					rbxfile.ValueFloat(math.NaN()),
+					datamodel.ValueReference{Reference: part.Ref, Instance: part},
+					datamodel.ValueDictionary{"token": datamodel.ValueToken{ID: 2, Value: 1}},
+					rbxfile.ValueBinaryString{0xFF, 0x00},
+				},
+			},
+		}},
+	}
+
+	encoded, err := json.Marshal(NewPacketRecord(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record struct {
+		Reliability struct {
+			ReliabilityName string
+		}
+		Subpackets []struct {
+			Fields struct {
+				Instance InstanceRecord
+				Schema   SchemaReference
+				Value    struct {
+					Type  string
+					Value []json.RawMessage
+				}
+			}
+		}
+	}
+	err = json.Unmarshal(encoded, &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Reliability.ReliabilityName != "RELIABLE_ORDERED" {
+		t.Errorf("reliability name is %q", record.Reliability.ReliabilityName)
+	}
+	if len(record.Subpackets) != 1 {
+		t.Fatalf("got %d subpackets", len(record.Subpackets))
+	}
+	fields := record.Subpackets[0].Fields
+	if fields.Instance.FullName != part.GetFullName() || fields.Instance.Reference != "RBXSERVER_5" {
+		t.Errorf("wrong instance record %+v", fields.Instance)
+	}
+	if fields.Schema.Name != "Transparency" || fields.Schema.ClassName != "Part" {
+		t.Errorf("wrong schema reference %+v", fields.Schema)
+	}
+	if fields.Value.Type != "Tuple" || len(fields.Value.Value) != 4 {
+		t.Fatalf("wrong tuple encoding %s", encoded)
+	}
+	expected := []string{
+		`{"type":"Float","value":"NaN"}`,
+		`"fullName":"` + part.GetFullName() + `"`,
+		`{"type":"Dictionary","value":{"token":{"type":"Token","value":{"ID":2,"Value":1}}}}`,
+		`{"type":"BinaryString","value":{"base64":"/wA="}}`,
+	}
+	for i, fragment := range expected {
+		if !strings.Contains(string(fields.Value.Value[i]), fragment) {
+			t.Errorf("tuple item %d is %s, expected it to contain %s", i, fields.Value.Value[i], fragment)
+		}
+	}
+}
+
+func TestSchemaEncoding(t *testing.T) {
+	class := &peer.NetworkInstanceSchema{Name: "Part", NetworkID: 3}
+	class.Properties = []*peer.NetworkPropertySchema{{Name: "Anchored", InstanceSchema: class}}
+	class.Events = []*peer.NetworkEventSchema{{Name: "Touched", InstanceSchema: class}}
+	schema := &peer.NetworkSchema{Instances: []*peer.NetworkInstanceSchema{class}}
+
+	encoded, err := json.Marshal(Encode(&peer.Packet97Layer{Schema: schema}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"Properties":[{"EnumID":0,"InstanceSchema":{"name":"Part","networkId":3}`) {
+		t.Errorf("schema items were not expanded: %s", encoded)
+	}
+}
+
+func TestSplitRecordTimes(t *testing.T) {
+	first := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	last := first.Add(30 * time.Millisecond)
+	layers := &peer.PacketLayers{
+		PacketType:  0xFE,
+		Root:        peer.RootLayer{Timestamp: last},
+		Reliability: &peer.ReliablePacket{Reliability: peer.ReliableOrdered, HasSplitPacket: true, SplitPacketCount: 3},
+		SplitPacket: &peer.SplitPacketBuffer{
+			NumReceivedSplits: 3,
+			IsFinal:           true,
+			FirstTimestamp:    first,
+			LastTimestamp:     last,
+		},
+	}
+
+	encoded, err := json.Marshal(NewPacketRecord(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record PacketRecord
+	err = json.Unmarshal(encoded, &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Split == nil {
+		t.Fatalf("split record is missing: %s", encoded)
+	}
+	if record.Split.FirstTime == nil || !record.Split.FirstTime.Equal(first) {
+		t.Errorf("first time is %v", record.Split.FirstTime)
+	}
+	if record.Split.LastTime == nil || !record.Split.LastTime.Equal(last) {
+		t.Errorf("last time is %v", record.Split.LastTime)
+	}
+
+	// splits without capture times have none in the record
+	layers.SplitPacket.FirstTimestamp = time.Time{}
+	layers.SplitPacket.LastTimestamp = time.Time{}
+	encoded, err = json.Marshal(NewPacketRecord(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "firstTime") || strings.Contains(string(encoded), "lastTime") {
+		t.Errorf("zero split times were exported: %s", encoded)
+	}
+}
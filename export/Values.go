@@ -0,0 +1,276 @@
+package export
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Gskartwii/roblox-dissector/datamodel"
+	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/olebedev/emitter"
+	"github.com/robloxapi/rbxfile"
+)
+
+var (
+	valueType          = reflect.TypeOf((*rbxfile.Value)(nil)).Elem()
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+	instanceType       = reflect.TypeOf((*datamodel.Instance)(nil))
+	instanceSchemaType = reflect.TypeOf((*peer.NetworkInstanceSchema)(nil))
+	propertySchemaType = reflect.TypeOf((*peer.NetworkPropertySchema)(nil))
+	eventSchemaType    = reflect.TypeOf((*peer.NetworkEventSchema)(nil))
+	networkSchemaType  = reflect.TypeOf(peer.NetworkSchema{})
+	udpAddrType        = reflect.TypeOf((*net.UDPAddr)(nil))
+	timeType           = reflect.TypeOf(time.Time{})
+	skippedTypes       = map[reflect.Type]bool{
+		reflect.TypeOf((*log.Logger)(nil)):      true,
+		reflect.TypeOf((*emitter.Emitter)(nil)): true,
+		reflect.TypeOf((*sync.RWMutex)(nil)):    true,
+		reflect.TypeOf((*sync.Mutex)(nil)):      true,
+	}
+)
+
+// InstanceRecord describes an instance that is referenced by a packet
+type InstanceRecord struct {
+	Reference string `json:"reference"`
+	PeerID    uint32 `json:"peerId"`
+	ClassName string `json:"className,omitempty"`
+	Name      string `json:"name,omitempty"`
+	FullName  string `json:"fullName,omitempty"`
+}
+
+// NewInstanceRecord creates an InstanceRecord for instance. The instance may be nil.
+func NewInstanceRecord(instance *datamodel.Instance) *InstanceRecord {
+	if instance == nil {
+		return nil
+	}
+	return &InstanceRecord{
+		Reference: instance.Ref.String(),
+		PeerID:    instance.Ref.PeerId,
+		ClassName: instance.ClassName,
+		Name:      instance.Name(),
+		FullName:  instance.GetFullName(),
+	}
+}
+
+// SchemaReference identifies a schema item without repeating its contents
+type SchemaReference struct {
+	Name      string `json:"name"`
+	ClassName string `json:"className,omitempty"`
+	NetworkID uint16 `json:"networkId"`
+}
+
+// TypedValue is the encoding of an rbxfile.Value
+type TypedValue struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// EncodeValue returns the typed encoding of an rbxfile.Value,
+// including the custom value types of the datamodel package
+func EncodeValue(value rbxfile.Value) *TypedValue {
+	if value == nil {
+		return nil
+	}
+	return &TypedValue{
+		Type:  datamodel.TypeString(value),
+		Value: new(walker).walk(reflect.ValueOf(value), false),
+	}
+}
+
+// Encode converts an arbitrary decoded packet structure into
+// a tree that can be marshalled by encoding/json
+func Encode(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return new(walker).walk(reflect.ValueOf(value), false)
+}
+
+// walker converts values by reflection. Pointers currently being walked are
+// tracked so that back-references don't recurse forever.
+type walker struct {
+	visiting map[uintptr]bool
+}
+
+func encodeFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f)
+	}
+	return f
+}
+
+func encodeBytes(data []byte, isValue bool) interface{} {
+	if isValue && utf8.Valid(data) {
+		return string(data)
+	}
+	return map[string]string{"base64": base64.StdEncoding.EncodeToString(data)}
+}
+
+func schemaReference(val reflect.Value) *SchemaReference {
+	switch schema := val.Interface().(type) {
+	case *peer.NetworkInstanceSchema:
+		return &SchemaReference{Name: schema.Name, NetworkID: schema.NetworkID}
+	case *peer.NetworkPropertySchema:
+		ref := &SchemaReference{Name: schema.Name, NetworkID: schema.NetworkID}
+		if schema.InstanceSchema != nil {
+			ref.ClassName = schema.InstanceSchema.Name
+		}
+		return ref
+	case *peer.NetworkEventSchema:
+		ref := &SchemaReference{Name: schema.Name, NetworkID: schema.NetworkID}
+		if schema.InstanceSchema != nil {
+			ref.ClassName = schema.InstanceSchema.Name
+		}
+		return ref
+	}
+	return nil
+}
+
+// walk encodes val. Inside a NetworkSchema, schema items are expanded;
+// elsewhere they are encoded as SchemaReferences.
+func (w *walker) walk(val reflect.Value, inSchema bool) interface{} {
+	if !val.IsValid() || !val.CanInterface() {
+		return nil
+	}
+	typ := val.Type()
+	if skippedTypes[typ] {
+		return nil
+	}
+
+	switch {
+	case typ == instanceType:
+		return NewInstanceRecord(val.Interface().(*datamodel.Instance))
+	case typ == udpAddrType:
+		if val.IsNil() {
+			return nil
+		}
+		return val.Interface().(*net.UDPAddr).String()
+	case typ == timeType:
+		return val.Interface().(time.Time).Format(time.RFC3339Nano)
+	case typ == instanceSchemaType || typ == propertySchemaType || typ == eventSchemaType:
+		if val.IsNil() {
+			return nil
+		}
+		if !inSchema {
+			return schemaReference(val)
+		}
+	case typ == networkSchemaType:
+		inSchema = true
+	}
+
+	switch val.Kind() {
+	case reflect.Interface:
+		if val.IsNil() {
+			return nil
+		}
+		if typ == valueType {
+			return EncodeValue(val.Interface().(rbxfile.Value))
+		}
+		if typ.Implements(errorType) {
+			return val.Interface().(error).Error()
+		}
+		return w.walkInterface(val.Elem(), inSchema)
+	case reflect.Ptr:
+		if val.IsNil() {
+			return nil
+		}
+		ptr := val.Pointer()
+		if w.visiting[ptr] {
+			return nil
+		}
+		if w.visiting == nil {
+			w.visiting = make(map[uintptr]bool)
+		}
+		w.visiting[ptr] = true
+		defer delete(w.visiting, ptr)
+		return w.walk(val.Elem(), inSchema)
+	case reflect.Struct:
+		return w.walkStruct(val, inSchema)
+	case reflect.Slice:
+		if val.IsNil() {
+			return nil
+		}
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return encodeBytes(val.Bytes(), typ.Implements(valueType))
+		}
+		fallthrough
+	case reflect.Array:
+		result := make([]interface{}, val.Len())
+		for i := range result {
+			result[i] = w.walk(val.Index(i), inSchema)
+		}
+		return result
+	case reflect.Map:
+		if val.IsNil() {
+			return nil
+		}
+		result := make(map[string]interface{}, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			result[fmt.Sprint(iter.Key().Interface())] = w.walk(iter.Value(), inSchema)
+		}
+		return result
+	case reflect.String:
+		return val.String()
+	case reflect.Bool:
+		return val.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return val.Uint()
+	case reflect.Float32, reflect.Float64:
+		return encodeFloat(val.Float())
+	}
+	// funcs, channels and the like carry no packet data
+	return nil
+}
+
+// walkInterface encodes the dynamic value of an interface. Structs are
+// annotated with their type name because it can't be inferred from the field.
+func (w *walker) walkInterface(val reflect.Value, inSchema bool) interface{} {
+	result := w.walk(val, inSchema)
+	if fields, ok := result.(map[string]interface{}); ok {
+		typ := val.Type()
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		fields["@type"] = typ.Name()
+	}
+	return result
+}
+
+func (w *walker) walkStruct(val reflect.Value, inSchema bool) interface{} {
+	typ := val.Type()
+	result := make(map[string]interface{}, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+		fieldVal := val.Field(i)
+		if field.Anonymous {
+			// promote the fields of embedded structs, like encoding/json does
+			if embedded, ok := w.walk(fieldVal, inSchema).(map[string]interface{}); ok {
+				for name, value := range embedded {
+					if _, exists := result[name]; !exists {
+						result[name] = value
+					}
+				}
+			}
+			continue
+		}
+		// InstanceSchema points back at the class that contains the item
+		if field.Name == "InstanceSchema" {
+			result[field.Name] = w.walk(fieldVal, false)
+			continue
+		}
+		result[field.Name] = w.walk(fieldVal, inSchema)
+	}
+	return result
+}
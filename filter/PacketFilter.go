@@ -1,4 +1,5 @@
-package main
+// Package filter implements Lua filters that can be used to select decoded packets.
+package filter
 
 import (
 	"errors"
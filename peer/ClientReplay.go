@@ -0,0 +1,651 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/datamodel"
+	"github.com/olebedev/emitter"
+)
+
+// CapturedConversation contains the packets of a recorded conversation
+// in the order they were captured. Only offline and full-reliable packets
+// should be included; Root.FromClient tells the direction of each packet.
+type CapturedConversation struct {
+	// Context is the context that the packets were decoded with
+	Context *CommunicationContext
+	Packets []*PacketLayers
+}
+
+// firstPacket returns the index of the first captured packet of the given type
+// sent in the given direction, or -1 if there is no such packet
+func (capture *CapturedConversation) firstPacket(fromClient bool, packetType byte) int {
+	for i, layers := range capture.Packets {
+		if layers.Root.FromClient == fromClient && layers.PacketType == packetType && layers.Main != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// timeOf returns the capture time of the packet at the given index
+func (capture *CapturedConversation) timeOf(index int) time.Time {
+	return capture.Packets[index].Root.Timestamp
+}
+
+// ReplayDivergence describes a difference between the responses a server gave
+// to a client packet in a capture and the responses a live server gave to the
+// replayed packet
+type ReplayDivergence struct {
+	// PacketIndex is the index of the replayed packet in CapturedConversation.Packets
+	PacketIndex int
+	Packet      *PacketLayers
+	// Missing contains responses that were captured but not received
+	Missing []string
+	// Unexpected contains responses that were received but not captured
+	Unexpected []string
+	// Unmapped contains the names of captured instances that the packet referenced
+	// but which don't exist on the live server
+	Unmapped []string
+}
+
+func (divergence *ReplayDivergence) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "packet %d (%s) diverged:", divergence.PacketIndex, divergence.Packet.String())
+	if len(divergence.Missing) != 0 {
+		fmt.Fprintf(&builder, " missing %s;", strings.Join(divergence.Missing, ", "))
+	}
+	if len(divergence.Unexpected) != 0 {
+		fmt.Fprintf(&builder, " unexpected %s;", strings.Join(divergence.Unexpected, ", "))
+	}
+	if len(divergence.Unmapped) != 0 {
+		fmt.Fprintf(&builder, " unmapped references %s;", strings.Join(divergence.Unmapped, ", "))
+	}
+	return builder.String()
+}
+
+// DefaultIgnoredResponses lists responses that are not considered when
+// looking for divergences, because they depend on timing rather than on
+// the replayed packets
+var DefaultIgnoredResponses = map[string]bool{
+	"ID_CONNECTED_PING":   true,
+	"ID_CONNECTED_PONG":   true,
+	"ID_REPLIC_PING":      true,
+	"ID_REPLIC_PING_BACK": true,
+}
+
+// handshakePackets are regenerated by ClientReplay instead of being replayed
+var handshakePackets = map[byte]bool{
+	0x00: true, // ping
+	0x03: true, // pong
+	0x05: true,
+	0x07: true,
+	0x09: true,
+	0x13: true,
+	0x90: true,
+	0x8A: true,
+}
+
+// ClientReplay plays back the client half of a captured conversation
+// against a live server, such as a CustomServer. The handshake is regenerated,
+// and references to the captured server's instances are remapped to the
+// live server's instances by their full names.
+type ClientReplay struct {
+	PacketLogicHandler
+	Capture    *CapturedConversation
+	ServerAddr *net.UDPAddr
+	GUID       uint64
+
+	// ResponseWindow is how long responses are collected after
+	// each replayed packet
+	ResponseWindow time.Duration
+	// JoinTimeout is how long the replay waits for ID_SET_GLOBALS
+	JoinTimeout time.Duration
+	// JoinSettle is how long the replay waits for join data
+	// before it starts replaying packets
+	JoinSettle       time.Duration
+	IgnoredResponses map[string]bool
+
+	// DivergenceEmitter emits "divergence" with a *ReplayDivergence
+	// whenever the live server's responses differ from the captured ones
+	DivergenceEmitter *emitter.Emitter
+
+	responseLock sync.Mutex
+	responses    []string
+	joined       chan struct{}
+	joinOnce     sync.Once
+}
+
+// NewClientReplay creates a ClientReplay that will connect to the given server
+func NewClientReplay(ctx context.Context, capture *CapturedConversation, serverAddr *net.UDPAddr) *ClientReplay {
+	commContext := NewCommunicationContext()
+	commContext.PlaceID = capture.Context.PlaceID
+	commContext.VersionID = capture.Context.VersionID
+	commContext.ProtocolVersion = capture.Context.ProtocolVersion
+	commContext.APIDictionary = capture.Context.APIDictionary
+
+	replay := &ClientReplay{
+		PacketLogicHandler: newPacketLogicHandler(ctx, commContext, false),
+		Capture:            capture,
+		ServerAddr:         serverAddr,
+		GUID:               rand.Uint64(),
+
+		ResponseWindow:   200 * time.Millisecond,
+		JoinTimeout:      10 * time.Second,
+		JoinSettle:       2 * time.Second,
+		IgnoredResponses: DefaultIgnoredResponses,
+
+		DivergenceEmitter: emitter.New(0),
+		joined:            make(chan struct{}),
+	}
+	return replay
+}
+
+func responseNames(layers *PacketLayers) []string {
+	if layers.Main == nil {
+		return []string{layers.String() + " (undecoded)"}
+	}
+	if data, ok := layers.Main.(*Packet83Layer); ok {
+		names := make([]string, len(data.SubPackets))
+		for i, sub := range data.SubPackets {
+			names[i] = sub.TypeString()
+		}
+		return names
+	}
+	return []string{layers.Main.TypeString()}
+}
+
+func (replay *ClientReplay) recordResponse(e *emitter.Event) {
+	layers := e.Args[0].(*PacketLayers)
+	replay.responseLock.Lock()
+	replay.responses = append(replay.responses, responseNames(layers)...)
+	replay.responseLock.Unlock()
+}
+
+func (replay *ClientReplay) takeResponses() []string {
+	replay.responseLock.Lock()
+	defer replay.responseLock.Unlock()
+	responses := replay.responses
+	replay.responses = nil
+	return responses
+}
+
+// capturedPacket returns the first captured packet of the given type
+// sent by the client
+func (replay *ClientReplay) capturedPacket(packetType byte) RakNetPacket {
+	index := replay.Capture.firstPacket(true, packetType)
+	if index == -1 {
+		return nil
+	}
+	return replay.Capture.Packets[index].Main
+}
+
+func (replay *ClientReplay) offline6Handler(e *emitter.Event) {
+	reply := e.Args[0].(*Packet06Layer)
+	request := &Packet07Layer{
+		IPAddress: replay.ServerAddr,
+		MTU:       reply.MTU,
+		GUID:      replay.GUID,
+	}
+	if captured, ok := replay.capturedPacket(0x07).(*Packet07Layer); ok {
+		request.SupportedVersion = captured.SupportedVersion
+		request.Capabilities = captured.Capabilities
+	}
+	err := replay.WriteOffline(request)
+	if err != nil {
+		println("replay: failed to write request 2:", err.Error())
+	}
+}
+
+func (replay *ClientReplay) offline8Handler(e *emitter.Event) {
+	request := &Packet09Layer{
+		GUID:      replay.GUID,
+		Timestamp: uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+		Password:  DefaultPasswordBytes,
+	}
+	if captured, ok := replay.capturedPacket(0x09).(*Packet09Layer); ok {
+		request.Password = captured.Password
+	}
+	err := replay.WritePacket(request)
+	if err != nil {
+		println("replay: failed to write connection request:", err.Error())
+	}
+}
+
+func (replay *ClientReplay) connectionAcceptedHandler(e *emitter.Event) {
+	accepted := e.Args[0].(*Packet10Layer)
+	nullIP, _ := net.ResolveUDPAddr("udp", "0.0.0.0:0")
+	incoming := &Packet13Layer{
+		IPAddress:    replay.ServerAddr,
+		SendPingTime: accepted.SendPongTime,
+		SendPongTime: uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	for i := range incoming.Addresses {
+		incoming.Addresses[i] = nullIP
+	}
+	err := replay.WritePacket(incoming)
+	if err != nil {
+		println("replay: failed to write new incoming connection:", err.Error())
+		return
+	}
+
+	err = replay.WritePacket(replay.protocolSync())
+	if err != nil {
+		println("replay: failed to write protocol sync:", err.Error())
+	}
+}
+
+var joinDataPlaceID = regexp.MustCompile(`placeId=\d+`)
+
+// protocolSync creates the ID_PROTOCOL_SYNC of the replay. The version
+// fields come from the context of the connection, the requested flags
+// and join data from the captured packet.
+func (replay *ClientReplay) protocolSync() *Packet90Layer {
+	commContext := replay.Context
+	placeID := fmt.Sprintf("placeId=%d", commContext.PlaceID)
+	sync := &Packet90Layer{
+		SchemaVersion: uint32(commContext.ProtocolVersion),
+		VersionID:     commContext.VersionID,
+		JoinData:      placeID,
+	}
+	captured, ok := replay.capturedPacket(0x90).(*Packet90Layer)
+	if !ok {
+		return sync
+	}
+	if !commContext.ProtocolVersion.Known() {
+		sync.SchemaVersion = captured.SchemaVersion
+	}
+	sync.Int1 = captured.Int1
+	sync.Int2 = captured.Int2
+	sync.RequestedFlags = captured.RequestedFlags
+	sync.JoinData = joinDataPlaceID.ReplaceAllLiteralString(captured.JoinData, placeID)
+	return sync
+}
+
+// submitTicket creates the ID_SUBMIT_TICKET of the replay. The protocol
+// version comes from the context of the connection, which also provides the
+// encryption key, and the identity of the client from the captured packet.
+// It returns nil if the capture has no ticket.
+func (replay *ClientReplay) submitTicket() *Packet8ALayer {
+	captured, ok := replay.capturedPacket(0x8A).(*Packet8ALayer)
+	if !ok {
+		return nil
+	}
+	ticket := &Packet8ALayer{
+		ProtocolVersion: uint32(replay.Context.ProtocolVersion),
+
+		PlayerID:          captured.PlayerID,
+		ClientTicket:      captured.ClientTicket,
+		TicketHash:        captured.TicketHash,
+		LuauResponse:      captured.LuauResponse,
+		DataModelHash:     captured.DataModelHash,
+		SecurityKey:       captured.SecurityKey,
+		Platform:          captured.Platform,
+		RobloxProductName: captured.RobloxProductName,
+		CryptoHash:        captured.CryptoHash,
+		SessionID:         captured.SessionID,
+		GoldenHash:        captured.GoldenHash,
+	}
+	if !replay.Context.ProtocolVersion.Known() {
+		ticket.ProtocolVersion = captured.ProtocolVersion
+	}
+	return ticket
+}
+
+func (replay *ClientReplay) dictionaryFormatHandler(e *emitter.Event) {
+	ticket := replay.submitTicket()
+	if ticket == nil {
+		println("replay: capture has no submit ticket packet")
+		return
+	}
+	err := replay.WritePacket(ticket)
+	if err != nil {
+		println("replay: failed to write submit ticket:", err.Error())
+	}
+}
+
+func (replay *ClientReplay) bindReplayHandlers() {
+	replay.bindDefaultHandlers()
+	replay.BindDataModelHandlers()
+
+	replay.DefaultPacketReader.LayerEmitter.On("full-reliable", replay.recordResponse, emitter.Void)
+	replay.DefaultPacketReader.ErrorEmitter.On("full-reliable", replay.recordResponse, emitter.Void)
+
+	basicHandlers := replay.PacketEmitter
+	basicHandlers.On("ID_OPEN_CONNECTION_REPLY_1", replay.offline6Handler, emitter.Void)
+	basicHandlers.On("ID_OPEN_CONNECTION_REPLY_2", replay.offline8Handler, emitter.Void)
+	basicHandlers.On("ID_CONNECTION_REQUEST_ACCEPTED", replay.connectionAcceptedHandler, emitter.Void)
+	basicHandlers.On("ID_DICTIONARY_FORMAT", replay.dictionaryFormatHandler, emitter.Void)
+	basicHandlers.On("ID_CONNECTED_PING", func(e *emitter.Event) {
+		replay.sendPong(e.Args[0].(*Packet00Layer).SendPingTime)
+	}, emitter.Void)
+	basicHandlers.On("ID_SET_GLOBALS", func(e *emitter.Event) {
+		replay.joinOnce.Do(func() {
+			close(replay.joined)
+		})
+	}, emitter.Void)
+
+	replay.Output.On("udp", func(e *emitter.Event) {
+		_, err := replay.Connection.Write(e.Args[0].([]byte))
+		if err != nil {
+			println("replay: write error:", err.Error())
+		}
+	}, emitter.Void)
+}
+
+func (replay *ClientReplay) readLoop() {
+	buf := make([]byte, 1492)
+	for {
+		n, err := replay.Connection.Read(buf)
+		if err != nil {
+			return
+		}
+		payload := make([]byte, n)
+		copy(payload, buf[:n])
+		replay.ReadPacket(payload, &PacketLayers{
+			Root: RootLayer{
+				Source:      replay.ServerAddr,
+				Destination: replay.Connection.LocalAddr().(*net.UDPAddr),
+				FromServer:  true,
+			},
+		})
+	}
+}
+
+func (replay *ClientReplay) wait(duration time.Duration) error {
+	select {
+	case <-time.After(duration):
+		return nil
+	case <-replay.RunningContext.Done():
+		return replay.RunningContext.Err()
+	}
+}
+
+// expectedResponses returns the server packets that were captured
+// after the client packet at the given index
+func (replay *ClientReplay) expectedResponses(index int) []string {
+	var responses []string
+	for _, layers := range replay.Capture.Packets[index+1:] {
+		if layers.Root.FromClient {
+			break
+		}
+		responses = append(responses, responseNames(layers)...)
+	}
+	return responses
+}
+
+// diffResponses returns the elements missing from and unexpected in
+// actual, compared to expected, ignoring order
+func (replay *ClientReplay) diffResponses(expected []string, actual []string) (missing []string, unexpected []string) {
+	counts := make(map[string]int)
+	for _, name := range expected {
+		if !replay.IgnoredResponses[name] {
+			counts[name]++
+		}
+	}
+	for _, name := range actual {
+		if !replay.IgnoredResponses[name] {
+			counts[name]--
+		}
+	}
+	for name, count := range counts {
+		for ; count > 0; count-- {
+			missing = append(missing, name)
+		}
+		for ; count < 0; count++ {
+			unexpected = append(unexpected, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+	return
+}
+
+func (replay *ClientReplay) replayPacket(layers *PacketLayers) ([]string, error) {
+	if forwardsRaw(layers) {
+		return nil, replay.ForwardRaw(layers)
+	}
+	remapper := newReferenceRemapper(replay.Capture.Context.ServerPeerID, replay.Capture.Context.DataModel, replay.Context.DataModel)
+	main := remapper.remap(reflect.ValueOf(layers.Main)).Interface().(RakNetPacket)
+	if layers.PacketType == 0x85 {
+		return remapper.unmapped, replay.WriteTimestamped(layers.Timestamp, main)
+	}
+	return remapper.unmapped, replay.WritePacket(main)
+}
+
+// Replay connects to the server, performs the handshake and replays
+// every packet the client sent after it. It returns once all packets
+// have been replayed or the running context is cancelled.
+func (replay *ClientReplay) Replay() error {
+	conn, err := net.DialUDP("udp", nil, replay.ServerAddr)
+	if err != nil {
+		return err
+	}
+	replay.Connection = conn
+	replay.DestinationAddress = replay.ServerAddr
+	replay.bindReplayHandlers()
+	go replay.readLoop()
+	replay.startAcker()
+	replay.Connected = true
+	defer replay.Disconnect()
+
+	request, ok := replay.capturedPacket(0x05).(*Packet05Layer)
+	if !ok {
+		request = &Packet05Layer{ProtocolVersion: 5, MTUPaddingLength: 1492 - 0x1C - 1 - len(OfflineMessageID) - 1}
+	}
+	err = replay.WriteOffline(request)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-replay.joined:
+	case <-time.After(replay.JoinTimeout):
+		return errors.New("timed out waiting for the server to accept the join")
+	case <-replay.RunningContext.Done():
+		return replay.RunningContext.Err()
+	}
+	err = replay.wait(replay.JoinSettle)
+	if err != nil {
+		return err
+	}
+	replay.takeResponses()
+
+	// Packets sent before the ticket are part of the handshake
+	start := replay.Capture.firstPacket(true, 0x8A) + 1
+	for i := start; i < len(replay.Capture.Packets); i++ {
+		layers := replay.Capture.Packets[i]
+		if !layers.Root.FromClient || layers.OfflinePayload != nil || handshakePackets[layers.PacketType] {
+			continue
+		}
+		unmapped, err := replay.replayPacket(layers)
+		if err != nil {
+			return fmt.Errorf("failed to replay packet %d: %s", i, err.Error())
+		}
+		err = replay.wait(replay.ResponseWindow)
+		if err != nil {
+			return err
+		}
+
+		missing, unexpected := replay.diffResponses(replay.expectedResponses(i), replay.takeResponses())
+		if len(missing) != 0 || len(unexpected) != 0 || len(unmapped) != 0 {
+			<-replay.DivergenceEmitter.Emit("divergence", &ReplayDivergence{
+				PacketIndex: i,
+				Packet:      layers,
+				Missing:     missing,
+				Unexpected:  unexpected,
+				Unmapped:    unmapped,
+			})
+		}
+	}
+	return nil
+}
+
+var instanceType = reflect.TypeOf((*datamodel.Instance)(nil))
+var valueReferenceType = reflect.TypeOf(datamodel.ValueReference{})
+
+// referenceRemapper copies packets decoded from a capture, replacing references
+// to instances owned by the captured server with the instances that have the same
+// full name in another DataModel. The captured packets are left unchanged, so that
+// a capture can be replayed more than once.
+type referenceRemapper struct {
+	from uint32
+	// source is the DataModel of the capture
+	source *datamodel.DataModel
+	target *datamodel.DataModel
+	// copies maps pointers that have been copied to their copies,
+	// so that shared and cyclic pointers are copied once
+	copies   map[copiedPointer]reflect.Value
+	unmapped []string
+}
+
+type copiedPointer struct {
+	address uintptr
+	typ     reflect.Type
+}
+
+func newReferenceRemapper(from uint32, source *datamodel.DataModel, target *datamodel.DataModel) *referenceRemapper {
+	return &referenceRemapper{
+		from:   from,
+		source: source,
+		target: target,
+		copies: make(map[copiedPointer]reflect.Value),
+	}
+}
+
+// lookup returns the instance in the target DataModel that has the same full
+// name as instance, or nil if there is none or instance isn't under a service
+func (remapper *referenceRemapper) lookup(instance *datamodel.Instance) *datamodel.Instance {
+	var path []*datamodel.Instance
+	for inst := instance; inst != nil; inst = inst.Parent() {
+		path = append(path, inst)
+	}
+	root := path[len(path)-1]
+	if remapper.source.FindService(root.ClassName) != root {
+		return nil
+	}
+	current := remapper.target.FindService(root.ClassName)
+	for i := len(path) - 2; i >= 0 && current != nil; i-- {
+		current = current.FindFirstChild(path[i].Name())
+	}
+	return current
+}
+
+func (remapper *referenceRemapper) remapInstance(instance *datamodel.Instance) *datamodel.Instance {
+	if remapper.target == nil || instance == nil || instance.Ref.IsNull || instance.Ref.PeerId != remapper.from {
+		return instance
+	}
+	mapped := remapper.lookup(instance)
+	if mapped == nil {
+		remapper.unmapped = append(remapper.unmapped, instance.GetFullName())
+		return instance
+	}
+	return mapped
+}
+
+func (remapper *referenceRemapper) remapReference(val reflect.Value) reflect.Value {
+	ref := val.Interface().(datamodel.ValueReference)
+	mapped := remapper.remapInstance(ref.Instance)
+	if mapped == ref.Instance {
+		return val
+	}
+	return reflect.ValueOf(datamodel.ValueReference{Reference: mapped.Ref, Instance: mapped})
+}
+
+// copyPacket returns a deep copy of a captured packet that shares its instances
+func copyPacket(packet RakNetPacket) RakNetPacket {
+	return newReferenceRemapper(0, nil, nil).remap(reflect.ValueOf(packet)).Interface().(RakNetPacket)
+}
+
+// isPlain reports whether values of kind can be copied without remapping
+func isPlain(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// remap returns a deep copy of val with the references remapped.
+// Instances aren't copied; they are either remapped or shared with val.
+// Unexported fields are copied shallowly.
+func (remapper *referenceRemapper) remap(val reflect.Value) reflect.Value {
+	switch val.Kind() {
+	case reflect.Ptr:
+		if val.IsNil() {
+			return val
+		}
+		if val.Type() == instanceType {
+			return reflect.ValueOf(remapper.remapInstance(val.Interface().(*datamodel.Instance)))
+		}
+		key := copiedPointer{val.Pointer(), val.Type()}
+		if copied, ok := remapper.copies[key]; ok {
+			return copied
+		}
+		copied := reflect.New(val.Type().Elem())
+		remapper.copies[key] = copied
+		copied.Elem().Set(remapper.remap(val.Elem()))
+		return copied
+	case reflect.Interface:
+		if val.IsNil() {
+			return val
+		}
+		result := reflect.New(val.Type()).Elem()
+		result.Set(remapper.remap(val.Elem()))
+		return result
+	case reflect.Struct:
+		if val.Type() == valueReferenceType {
+			return remapper.remapReference(val)
+		}
+		result := reflect.New(val.Type()).Elem()
+		result.Set(val)
+		for i := 0; i < val.NumField(); i++ {
+			if val.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			result.Field(i).Set(remapper.remap(val.Field(i)))
+		}
+		return result
+	case reflect.Slice:
+		if val.IsNil() {
+			return val
+		}
+		result := reflect.MakeSlice(val.Type(), val.Len(), val.Len())
+		if isPlain(val.Type().Elem().Kind()) {
+			reflect.Copy(result, val)
+			return result
+		}
+		for i := 0; i < val.Len(); i++ {
+			result.Index(i).Set(remapper.remap(val.Index(i)))
+		}
+		return result
+	case reflect.Array:
+		result := reflect.New(val.Type()).Elem()
+		for i := 0; i < val.Len(); i++ {
+			result.Index(i).Set(remapper.remap(val.Index(i)))
+		}
+		return result
+	case reflect.Map:
+		if val.IsNil() {
+			return val
+		}
+		result := reflect.MakeMapWithSize(val.Type(), val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			result.SetMapIndex(iter.Key(), remapper.remap(iter.Value()))
+		}
+		return result
+	}
+	return val
+}
@@ -0,0 +1,142 @@
+package peer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Gskartwii/roblox-dissector/datamodel"
+	"github.com/robloxapi/rbxfile"
+)
+
+func newTestTree(peerID uint32, id uint32) (*datamodel.DataModel, *datamodel.Instance) {
+	model := datamodel.New()
+	workspace, _ := datamodel.NewInstance("Workspace", nil)
+	workspace.Ref = datamodel.Reference{Scope: "RBXServer", Id: id, PeerId: peerID}
+	model.AddService(workspace)
+	part, _ := datamodel.NewInstance("Part", nil)
+	part.Set("Name", rbxfile.ValueString("Baseplate"))
+	part.Ref = datamodel.Reference{Scope: "RBXServer", Id: id + 1, PeerId: peerID}
+	workspace.AddChild(part)
+	return model, part
+}
+
+func TestReferenceRemapper(t *testing.T) {
+	capturedModel, capturedPart := newTestTree(1, 10)
+	liveModel, livePart := newTestTree(2, 500)
+
+	packet := &Packet83_07{
+		Instance: capturedPart,
+		Event: &ReplicationEvent{
+			Arguments: []rbxfile.Value{
+				datamodel.ValueReference{Reference: capturedPart.Ref, Instance: capturedPart},
+				datamodel.ValueArray{datamodel.ValueReference{Reference: capturedPart.Ref, Instance: capturedPart}},
+			},
+		},
+	}
+	remapper := newReferenceRemapper(1, capturedModel, liveModel)
+	remapped := remapper.remap(reflect.ValueOf(packet)).Interface().(*Packet83_07)
+
+	if remapped.Instance != livePart {
+		t.Errorf("instance was not remapped: %s", remapped.Instance.Ref.String())
+	}
+	if ref := remapped.Event.Arguments[0].(datamodel.ValueReference); ref.Instance != livePart || ref.Reference != livePart.Ref {
+		t.Errorf("reference argument was not remapped: %s", ref.Reference.String())
+	}
+	if ref := remapped.Event.Arguments[1].(datamodel.ValueArray)[0].(datamodel.ValueReference); ref.Instance != livePart {
+		t.Errorf("reference in array was not remapped: %s", ref.Reference.String())
+	}
+	if len(remapper.unmapped) != 0 {
+		t.Errorf("unexpected unmapped references: %v", remapper.unmapped)
+	}
+
+	// the captured packet can be replayed again
+	if packet.Instance != capturedPart {
+		t.Error("captured instance was modified")
+	}
+	if ref := packet.Event.Arguments[0].(datamodel.ValueReference); ref.Instance != capturedPart {
+		t.Error("captured reference argument was modified")
+	}
+	if ref := packet.Event.Arguments[1].(datamodel.ValueArray)[0].(datamodel.ValueReference); ref.Instance != capturedPart {
+		t.Error("captured reference in array was modified")
+	}
+}
+
+func TestReferenceRemapperNeedsService(t *testing.T) {
+	capturedModel, _ := newTestTree(1, 10)
+	liveModel, _ := newTestTree(2, 500)
+
+	// a Workspace that isn't a service of the captured DataModel
+	orphan, _ := datamodel.NewInstance("Workspace", nil)
+	orphan.Ref = datamodel.Reference{Scope: "RBXServer", Id: 20, PeerId: 1}
+	remapper := newReferenceRemapper(1, capturedModel, liveModel)
+	if mapped := remapper.remapInstance(orphan); mapped != orphan {
+		t.Errorf("orphan was remapped to %s", mapped.GetFullName())
+	}
+	if len(remapper.unmapped) != 1 {
+		t.Errorf("unmapped references: %v", remapper.unmapped)
+	}
+}
+
+func TestCopyPacket(t *testing.T) {
+	_, part := newTestTree(1, 10)
+	packet := &Packet83Layer{SubPackets: []Packet83Subpacket{&Packet83_07{
+		Instance: part,
+		Event:    &ReplicationEvent{Arguments: []rbxfile.Value{rbxfile.ValueString("hello")}},
+	}}}
+	copied := copyPacket(packet).(*Packet83Layer)
+	event := copied.SubPackets[0].(*Packet83_07)
+	if copied == packet || event == packet.SubPackets[0] || event.Event == packet.SubPackets[0].(*Packet83_07).Event {
+		t.Error("packet was not copied")
+	}
+	if event.Instance != part || string(event.Event.Arguments[0].(rbxfile.ValueString)) != "hello" {
+		t.Errorf("copied %+v", event)
+	}
+}
+
+func TestReplayHandshakeFromContext(t *testing.T) {
+	commContext := NewCommunicationContext()
+	commContext.PlaceID = 1818
+	commContext.VersionID = Packet90VersionID{1, 2, 3, 4, 5}
+	commContext.ProtocolVersion = HashTokensVersion
+	captured := &CapturedConversation{
+		Context: commContext,
+		Packets: []*PacketLayers{{
+			Root:       RootLayer{FromClient: true},
+			PacketType: 0x90,
+			Main: &Packet90Layer{
+				SchemaVersion:  35,
+				Int1:           1,
+				RequestedFlags: []string{"Flag"},
+				JoinData:       "placeId=1&browserTrackerId=7",
+				VersionID:      Packet90VersionID{5, 4, 3, 2, 1},
+			},
+		}, {
+			Root:       RootLayer{FromClient: true},
+			PacketType: 0x8A,
+			Main: &Packet8ALayer{
+				PlayerID:        42,
+				ClientTicket:    "ticket",
+				ProtocolVersion: 35,
+				Platform:        "Win32",
+			},
+		}},
+	}
+	replay := NewClientReplay(context.Background(), captured, nil)
+
+	sync := replay.protocolSync()
+	if sync.SchemaVersion != uint32(HashTokensVersion) || sync.VersionID != commContext.VersionID {
+		t.Errorf("version fields weren't taken from the context: %+v", sync)
+	}
+	if sync.JoinData != "placeId=1818&browserTrackerId=7" || sync.Int1 != 1 || !reflect.DeepEqual(sync.RequestedFlags, []string{"Flag"}) {
+		t.Errorf("request fields weren't copied: %+v", sync)
+	}
+
+	ticket := replay.submitTicket()
+	if ticket.ProtocolVersion != uint32(HashTokensVersion) {
+		t.Errorf("protocol version is %d", ticket.ProtocolVersion)
+	}
+	if ticket.PlayerID != 42 || ticket.ClientTicket != "ticket" || ticket.Platform != "Win32" {
+		t.Errorf("client fields weren't copied: %+v", ticket)
+	}
+}
@@ -1,6 +1,7 @@
 package peer
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/Gskartwii/roblox-dissector/datamodel"
@@ -88,10 +89,33 @@ type CommunicationContext struct {
 
 	PlaceID   int64
 	VersionID Packet90VersionID
+	// ProtocolVersion is the SchemaVersion from ID_PROTOCOL_SYNC.
+	// Decoders and serializers use it to choose between packet formats.
+	ProtocolVersion ProtocolVersion
+	// APIDictionaryCompression is set if the server enabled it in ID_DICTIONARY_FORMAT.
+	// Compressed regions are then zstd frames that use APIDictionary.
+	APIDictionaryCompression bool
+	// APIDictionary is the zstd dictionary for the protocol version
+	// of this communication. It is nil if unknown.
+	APIDictionary []byte
+
+	// Degraded is set for conversations that were picked up after they
+	// had started. Decoders then tolerate unknown instance references and
+	// ordering indices, and record what they couldn't decode in
+	// PacketLayers.Degradations.
+	Degraded bool
 
 	uniqueID uint64
 }
 
+// ErrNoSchema is returned by decoders that need the network schema
+// when ID_NEW_SCHEMA hasn't been received
+var ErrNoSchema = errors.New("network schema unknown: ID_NEW_SCHEMA was not captured")
+
+// ErrNoAPIDictionary is returned by decoders and serializers of compressed
+// regions when API dictionary compression is enabled but APIDictionary is nil
+var ErrNoAPIDictionary = errors.New("API dictionary unknown: the server enabled API dictionary compression")
+
 // NewCommunicationContext returns a new CommunicationContext
 func NewCommunicationContext() *CommunicationContext {
 	return &CommunicationContext{
@@ -100,6 +124,18 @@ func NewCommunicationContext() *CommunicationContext {
 	}
 }
 
+// compressionDictionary returns the zstd dictionary used by compressed
+// regions, or nil if they are plain zstd frames
+func (context *CommunicationContext) compressionDictionary() ([]byte, error) {
+	if !context.APIDictionaryCompression {
+		return nil, nil
+	}
+	if context.APIDictionary == nil {
+		return nil, ErrNoAPIDictionary
+	}
+	return context.APIDictionary, nil
+}
+
 // GenerateSubmitTicketKey generates a key to be used by ID_SUBMIT_TICKET packets
 func (context *CommunicationContext) GenerateSubmitTicketKey() [0x10]byte {
 	var result [0x10]byte
@@ -114,6 +150,18 @@ func (context *CommunicationContext) GenerateSubmitTicketKey() [0x10]byte {
 	return result
 }
 
+// lookupInstance resolves the reference to an instance that should already exist.
+// In degraded mode, unknown references resolve to placeholder instances.
+func lookupInstance(reader PacketReader, layers *PacketLayers, reference datamodel.Reference) (*datamodel.Instance, error) {
+	context := reader.Context()
+	instance, err := context.InstancesByReference.TryGetInstance(reference)
+	if err != datamodel.ErrInstanceDoesntExist || !context.Degraded {
+		return instance, err
+	}
+	layers.degrade("unknown instance %s", reference.String())
+	return context.InstancesByReference.CreateInstance(reference)
+}
+
 func (context *CommunicationContext) removeInstance(instance *datamodel.Instance) {
 	context.InstancesByReference.RemoveTree(instance)
 }
@@ -0,0 +1,127 @@
+package peer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Gskartwii/roblox-dissector/datamodel"
+	"github.com/robloxapi/rbxfile"
+	"github.com/robloxapi/rbxfile/xml"
+)
+
+type instanceProperty struct {
+	Instance *rbxfile.Instance
+	Name     string
+}
+
+func findScripts(instances []*rbxfile.Instance, propertyList []instanceProperty) []instanceProperty {
+	for _, instance := range instances {
+		for name, property := range instance.Properties {
+			thisType := property.Type()
+			if thisType == datamodel.TypeSignedProtectedString {
+				propertyList = append(propertyList, instanceProperty{
+					Instance: instance,
+					Name:     name,
+				})
+			}
+		}
+		propertyList = findScripts(instance.Children, propertyList)
+	}
+	return propertyList
+}
+
+func instName(instance *rbxfile.Instance) string {
+	name := instance.Get("Name")
+	if name == nil {
+		return instance.ClassName
+	}
+	var nameStr rbxfile.ValueString
+	var ok bool
+	if nameStr, ok = name.(rbxfile.ValueString); !ok {
+		return instance.ClassName
+	}
+	return string(nameStr)
+}
+
+func getFullName(instance *rbxfile.Instance) string {
+	if instance == nil {
+		return "nil"
+	}
+	parts := make([]string, 0, 8)
+	for instance != nil {
+		parts = append([]string{instName(instance)}, parts...)
+		instance = instance.Parent()
+	}
+	var builder strings.Builder
+	for _, part := range parts {
+		builder.WriteByte('.')
+		builder.WriteString(part)
+	}
+	return builder.String()[1:]
+}
+
+func dumpScripts(location string, instances []*rbxfile.Instance, encountered map[string]int) error {
+	instList := findScripts(instances, nil)
+
+	for _, instProp := range instList {
+		instFullName := getFullName(instProp.Instance)
+		name := fmt.Sprintf("%s/%s.rbxc", location, instFullName)
+		if count, ok := encountered[name]; ok {
+			oldName := name
+			name = fmt.Sprintf("%s/%s.%d.rbxc", location, instFullName, count)
+			encountered[oldName] = count + 1
+		} else {
+			encountered[name] = 1
+		}
+
+		file, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write([]byte(instProp.Instance.Properties[instProp.Name].(datamodel.ValueSignedProtectedString).Value.Value))
+		if err != nil {
+			return err
+		}
+		err = file.Close()
+		if err != nil {
+			return err
+		}
+
+		// HACK: We clear the script source here to prevent issues with the XML parser
+		// This may be unexpected in the case of Studio, where the source code is not protected
+		delete(instProp.Instance.Properties, instProp.Name)
+	}
+	return nil
+}
+
+// DumpDataModel writes the DataModel as datamodel.rbxlx into the given directory.
+// Script sources are written into separate .rbxc files, and the script keys
+// into scriptKeys.
+func (context *CommunicationContext) DumpDataModel(location string) error {
+	writableClone := context.DataModel.ToRbxfile()
+
+	writer, err := os.OpenFile(location+"/datamodel.rbxlx", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	scriptData, err := os.OpenFile(location+"/scriptKeys", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer scriptData.Close()
+
+	_, err = fmt.Fprintf(scriptData, "Script key: %d\nCore script key: %d", context.ScriptKey, context.CoreScriptKey)
+	if err != nil {
+		return err
+	}
+
+	err = dumpScripts(location, writableClone.Instances, make(map[string]int))
+	if err != nil {
+		return err
+	}
+
+	return xml.Serialize(writer, nil, writableClone)
+}
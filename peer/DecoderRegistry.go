@@ -0,0 +1,159 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+type subpacketDecoderFunc func(*extendedReader, PacketReader, *PacketLayers) (Packet83Subpacket, error)
+
+// PacketCodec describes how a packet or ID_DATA subpacket type is
+// decoded and serialized. It can be registered to a DecoderRegistry
+// to add support for new types or to override the built-in ones.
+type PacketCodec struct {
+	// TypeString is the name of the type, such as "ID_CHAT_TEAM"
+	TypeString string
+	// Decode reads the payload that follows the type byte.
+	// Subpacket decoders must only read their own subpacket, because
+	// the stream also contains the rest of the ID_DATA packet.
+	Decode func(stream io.Reader, reader PacketReader, layers *PacketLayers) (fmt.Stringer, error)
+	// Serialize writes a value returned by Decode, excluding the type byte.
+	// If Serialize is nil, the packet can't be serialized.
+	Serialize func(value fmt.Stringer, writer PacketWriter, stream io.Writer) error
+}
+
+// CustomPacket is a packet or ID_DATA subpacket decoded by a registered PacketCodec.
+// It implements both RakNetPacket and Packet83Subpacket.
+type CustomPacket struct {
+	PacketType byte
+	Codec      *PacketCodec
+	// Value is the value returned by Codec.Decode
+	Value fmt.Stringer
+}
+
+// Serialize implements RakNetPacket.Serialize() and Packet83Subpacket.Serialize()
+func (layer *CustomPacket) Serialize(writer PacketWriter, stream *extendedWriter) error {
+	if layer.Codec.Serialize == nil {
+		return fmt.Errorf("%s can't be serialized", layer.Codec.TypeString)
+	}
+	return layer.Codec.Serialize(layer.Value, writer, stream)
+}
+
+func (layer *CustomPacket) String() string {
+	if layer.Value == nil {
+		return layer.Codec.TypeString
+	}
+	return layer.Value.String()
+}
+
+// TypeString implements RakNetPacket.TypeString() and Packet83Subpacket.TypeString()
+func (layer *CustomPacket) TypeString() string {
+	return layer.Codec.TypeString
+}
+
+// Type implements RakNetPacket.Type() and Packet83Subpacket.Type()
+func (layer *CustomPacket) Type() byte {
+	return layer.PacketType
+}
+
+// DecoderRegistry holds the decoders used by a PacketReader for
+// top-level packets and ID_DATA subpackets.
+// It must not be modified while packets are being read.
+type DecoderRegistry struct {
+	packets    map[byte]decoderFunc
+	subpackets map[uint8]subpacketDecoderFunc
+}
+
+// DefaultDecoders is the registry copied by NewPacketReader().
+// Codecs registered to it in init() are used by every new reader.
+var DefaultDecoders = NewDecoderRegistry()
+
+// NewDecoderRegistry returns a registry that contains the built-in decoders
+func NewDecoderRegistry() *DecoderRegistry {
+	registry := &DecoderRegistry{
+		packets:    make(map[byte]decoderFunc, len(packetDecoders)),
+		subpackets: make(map[uint8]subpacketDecoderFunc, len(packet83Decoders)),
+	}
+	for packetType, decoder := range packetDecoders {
+		registry.packets[packetType] = decoder
+	}
+	for subpacketType, decoder := range packet83Decoders {
+		registry.subpackets[subpacketType] = decoder
+	}
+	return registry
+}
+
+// Clone returns a copy of the registry that can be modified independently
+func (registry *DecoderRegistry) Clone() *DecoderRegistry {
+	clone := &DecoderRegistry{
+		packets:    make(map[byte]decoderFunc, len(registry.packets)),
+		subpackets: make(map[uint8]subpacketDecoderFunc, len(registry.subpackets)),
+	}
+	for packetType, decoder := range registry.packets {
+		clone.packets[packetType] = decoder
+	}
+	for subpacketType, decoder := range registry.subpackets {
+		clone.subpackets[subpacketType] = decoder
+	}
+	return clone
+}
+
+func checkCodec(codec *PacketCodec) error {
+	if codec == nil || codec.Decode == nil {
+		return errors.New("codec has no decoder")
+	}
+	if codec.TypeString == "" {
+		return errors.New("codec has no type string")
+	}
+	return nil
+}
+
+// RegisterPacket makes the registry decode packets of the given type with codec.
+// Decoded packets are *CustomPacket layers.
+//
+// ID_TIMESTAMP (0x1B) is reserved. It isn't a packet of its own but a prefix
+// of the packet that follows it, so the reader decodes it itself into
+// PacketLayers.Timestamp and then looks up the decoder of the wrapped packet
+// in the registry. A codec for it couldn't return the wrapped packet.
+func (registry *DecoderRegistry) RegisterPacket(packetType byte, codec *PacketCodec) error {
+	if err := checkCodec(codec); err != nil {
+		return err
+	}
+	if packetType == 0x1B {
+		return errors.New("can't override ID_TIMESTAMP")
+	}
+	registry.packets[packetType] = func(stream *extendedReader, reader PacketReader, layers *PacketLayers) (RakNetPacket, error) {
+		value, err := codec.Decode(stream, reader, layers)
+		return &CustomPacket{PacketType: packetType, Codec: codec, Value: value}, err
+	}
+	return nil
+}
+
+// RegisterDataSubpacket makes the registry decode ID_DATA subpackets of the given type
+// with codec. Decoded subpackets are *CustomPacket values.
+func (registry *DecoderRegistry) RegisterDataSubpacket(subpacketType uint8, codec *PacketCodec) error {
+	if err := checkCodec(codec); err != nil {
+		return err
+	}
+	// ID_REPLIC_END terminates the subpacket list
+	if subpacketType == 0 {
+		return errors.New("can't override ID_REPLIC_END")
+	}
+	registry.subpackets[subpacketType] = func(stream *extendedReader, reader PacketReader, layers *PacketLayers) (Packet83Subpacket, error) {
+		value, err := codec.Decode(stream, reader, layers)
+		return &CustomPacket{PacketType: subpacketType, Codec: codec, Value: value}, err
+	}
+	return nil
+}
+
+// Unregister removes the decoder of a packet type, so that
+// packets of that type are read as *RawPacket layers
+func (registry *DecoderRegistry) Unregister(packetType byte) {
+	delete(registry.packets, packetType)
+}
+
+// UnregisterDataSubpacket removes the decoder of an ID_DATA subpacket type
+func (registry *DecoderRegistry) UnregisterDataSubpacket(subpacketType uint8) {
+	delete(registry.subpackets, subpacketType)
+}
@@ -0,0 +1,117 @@
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/olebedev/emitter"
+)
+
+type testValue []byte
+
+func (value testValue) String() string {
+	return fmt.Sprintf("test value %X", []byte(value))
+}
+
+// testCodec reads a length-prefixed byte string
+var testCodec = &PacketCodec{
+	TypeString: "ID_TEST",
+	Decode: func(stream io.Reader, reader PacketReader, layers *PacketLayers) (fmt.Stringer, error) {
+		var length [1]byte
+		if _, err := io.ReadFull(stream, length[:]); err != nil {
+			return nil, err
+		}
+		value := make(testValue, length[0])
+		_, err := io.ReadFull(stream, value)
+		return value, err
+	},
+	Serialize: func(value fmt.Stringer, writer PacketWriter, stream io.Writer) error {
+		_, err := stream.Write(append([]byte{byte(len(value.(testValue)))}, value.(testValue)...))
+		return err
+	},
+}
+
+func TestDecoderRegistry(t *testing.T) {
+	reader := NewPacketReader()
+	reader.SetContext(NewCommunicationContext())
+	if err := reader.Decoders().RegisterPacket(0x88, testCodec); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Decoders().RegisterDataSubpacket(0x0D, testCodec); err != nil {
+		t.Fatal(err)
+	}
+	if reader.Decoders().RegisterPacket(0x1B, testCodec) == nil {
+		t.Error("ID_TIMESTAMP was overridden")
+	}
+	if reader.Decoders().RegisterDataSubpacket(0x0E, &PacketCodec{TypeString: "ID_TEST"}) == nil {
+		t.Error("codec without a decoder was registered")
+	}
+	if _, ok := DefaultDecoders.packets[0x88]; ok {
+		t.Error("registering to a reader modified DefaultDecoders")
+	}
+
+	var read []*PacketLayers
+	reader.LayerEmitter.On("full-reliable", func(e *emitter.Event) {
+		read = append(read, e.Args[0].(*PacketLayers))
+	}, emitter.Void)
+	var subpackets []Packet83Subpacket
+	reader.DataEmitter.On("ID_TEST", func(e *emitter.Event) {
+		subpackets = append(subpackets, e.Args[0].(Packet83Subpacket))
+	}, emitter.Void)
+	reader.ErrorEmitter.On("*", func(e *emitter.Event) {
+		t.Errorf("decode error: %s", e.Args[0].(*PacketLayers).Error)
+	}, emitter.Void)
+
+	reader.ReadPacket(orderedDatagram(0, 0, 0, []byte{0x88, 2, 0xAB, 0xCD}), &PacketLayers{})
+	// two ID_REPLIC_STREAM_DATA subpackets overridden by the codec
+	data := []byte{0x83, 0x0D, 1, 0x01, 0x0D, 0, 0x00}
+	reader.ReadPacket(orderedDatagram(1, 1, 1, data), &PacketLayers{})
+	if len(read) != 2 {
+		t.Fatalf("read %d packets", len(read))
+	}
+
+	custom, ok := read[0].Main.(*CustomPacket)
+	if !ok {
+		t.Fatalf("main layer is %T", read[0].Main)
+	}
+	if custom.TypeString() != "ID_TEST" || custom.String() != "test value ABCD" {
+		t.Errorf("decoded %s: %s", custom.TypeString(), custom.String())
+	}
+	var buffer bytes.Buffer
+	if err := custom.Serialize(nil, &extendedWriter{&buffer}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buffer.Bytes(), []byte{2, 0xAB, 0xCD}) {
+		t.Errorf("serialized %X", buffer.Bytes())
+	}
+
+	if len(subpackets) != 2 || subpackets[0].Type() != 0x0D || subpackets[0].String() != "test value 01" {
+		t.Fatalf("decoded subpackets %v", subpackets)
+	}
+	buffer.Reset()
+	if err := read[1].Main.Serialize(nil, &extendedWriter{&buffer}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buffer.Bytes(), data[1:]) {
+		t.Errorf("serialized %X", buffer.Bytes())
+	}
+
+	reader.Decoders().Unregister(0x88)
+	reader.ReadPacket(orderedDatagram(2, 2, 2, []byte{0x88, 0}), &PacketLayers{})
+	if _, ok := read[2].Main.(*RawPacket); !ok {
+		t.Errorf("unregistered packet decoded as %T", read[2].Main)
+	}
+
+	// the packet wrapped in ID_TIMESTAMP is decoded from the registry
+	reader.Decoders().RegisterPacket(0x88, testCodec)
+	timestamped := []byte{0x1B, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 6, 0x88, 1, 0xEF}
+	reader.ReadPacket(orderedDatagram(3, 3, 3, timestamped), &PacketLayers{})
+	if read[3].Timestamp == nil || read[3].Timestamp.Timestamp != 5 || read[3].PacketType != 0x88 {
+		t.Errorf("timestamp decoded as %v", read[3].Timestamp)
+	}
+	if custom, ok := read[3].Main.(*CustomPacket); !ok || custom.String() != "test value EF" {
+		t.Errorf("timestamped packet decoded as %v", read[3].Main)
+	}
+}
@@ -145,7 +145,11 @@ func (b *extendedReader) readFloat64BE() (float64, error) {
 	return math.Float64frombits(intf), err
 }
 
-func (b *extendedReader) RegionToZStdStream() (*extendedReader, error) {
+func (b *extendedReader) RegionToZStdStream(context *CommunicationContext) (*extendedReader, error) {
+	dictionary, err := context.compressionDictionary()
+	if err != nil {
+		return nil, err
+	}
 	compressedLen, err := b.readUint32BE()
 	if err != nil {
 		return nil, err
@@ -169,6 +173,9 @@ func (b *extendedReader) RegionToZStdStream() (*extendedReader, error) {
 		fmt.Printf("first bytes %#X\n", decompressed)
 	}*/
 
+	if dictionary != nil {
+		return &extendedReader{zstd.NewReaderDict(bytes.NewReader(compressed), dictionary)}, nil
+	}
 	zstdStream := zstd.NewReader(bytes.NewReader(compressed))
 	return &extendedReader{zstdStream}, nil
 }
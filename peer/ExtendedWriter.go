@@ -326,9 +326,24 @@ func (b *zstdExtendedWriter) Close() error {
 	return b.targetStream.allBytes(b.compressedBuffer.Bytes())
 }
 
-func (b *extendedWriter) wrapZstd() *zstdExtendedWriter {
+// newZstdWriter creates a compressor that uses the compression dictionary of context
+func newZstdWriter(output io.Writer, context *CommunicationContext) (*zstd.Writer, error) {
+	dictionary, err := context.compressionDictionary()
+	if err != nil {
+		return nil, err
+	}
+	if dictionary != nil {
+		return zstd.NewWriterLevelDict(output, zstd.DefaultCompression, dictionary), nil
+	}
+	return zstd.NewWriter(output), nil
+}
+
+func (b *extendedWriter) wrapZstd(context *CommunicationContext) (*zstdExtendedWriter, error) {
 	compressedBuffer := new(bytes.Buffer)
-	compressor := zstd.NewWriter(compressedBuffer)
+	compressor, err := newZstdWriter(compressedBuffer, context)
+	if err != nil {
+		return nil, err
+	}
 	counter := newCountWriter()
 	writeMux := io.MultiWriter(compressor, counter)
 	return &zstdExtendedWriter{
@@ -337,7 +352,7 @@ func (b *extendedWriter) wrapZstd() *zstdExtendedWriter {
 		compressedBuffer: compressedBuffer,
 		counter:          counter,
 		compressor:       compressor,
-	}
+	}, nil
 }
 
 func newWriteDeferredStrings(writer PacketWriter) writeDeferredStrings {
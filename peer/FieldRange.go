@@ -0,0 +1,94 @@
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// FieldRange records where in the packet payload a decoded field was read from.
+// The payload is PacketLayers.OfflinePayload for offline packets and
+// PacketLayers.SplitPacket.Data for other packets.
+type FieldRange struct {
+	// Name is the path of the field, such as "SubPackets[2].Instance"
+	Name string
+	// Start and End are bit offsets; End is exclusive
+	Start uint64
+	End   uint64
+}
+
+// Bytes returns the range of bytes that contain the field
+func (field FieldRange) Bytes() (int, int) {
+	return int(field.Start / 8), int((field.End + 7) / 8)
+}
+
+func (field FieldRange) String() string {
+	start, end := field.Bytes()
+	if field.Start%8 != 0 || field.End%8 != 0 {
+		return fmt.Sprintf("%s: bits %d-%d", field.Name, field.Start, field.End)
+	}
+	return fmt.Sprintf("%s: bytes %d-%d", field.Name, start, end)
+}
+
+// fieldRecorder tracks the position of the stream a packet is decoded from
+type fieldRecorder struct {
+	source *bytes.Reader
+	// base is the offset of source in the payload, in bytes
+	base int64
+	// prefix is prepended to the names of recorded fields
+	prefix string
+}
+
+// fieldStart returns the current bit offset of stream in the payload.
+// It returns -1 if fields aren't being recorded or stream doesn't read directly
+// from the payload, for example because the data is compressed or encrypted.
+func (layers *PacketLayers) fieldStart(stream *extendedReader) int64 {
+	recorder := layers.recorder
+	if recorder == nil || stream == nil || stream.r != recorder.source {
+		return -1
+	}
+	return (recorder.base + recorder.source.Size() - int64(recorder.source.Len())) * 8
+}
+
+// recordField records that a field was read from stream since start,
+// which was returned by fieldStart()
+func (layers *PacketLayers) recordField(name string, stream *extendedReader, start int64) {
+	end := layers.fieldStart(stream)
+	if start < 0 || end <= start {
+		return
+	}
+	layers.Fields = append(layers.Fields, FieldRange{
+		Name:  layers.recorder.prefix + name,
+		Start: uint64(start),
+		End:   uint64(end),
+	})
+}
+
+// FieldsAt returns the recorded fields that contain the given byte, innermost first
+func (layers *PacketLayers) FieldsAt(offset int) []FieldRange {
+	var result []FieldRange
+	for _, field := range layers.Fields {
+		start, end := field.Bytes()
+		if offset >= start && offset < end {
+			result = append(result, field)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].End-result[i].Start < result[j].End-result[j].Start
+	})
+	return result
+}
+
+// enterField prefixes the names of the fields recorded until the returned
+// function is called with name, so that nested layers can record their fields
+func (layers *PacketLayers) enterField(name string) func() {
+	recorder := layers.recorder
+	if recorder == nil {
+		return func() {}
+	}
+	prefix := recorder.prefix
+	recorder.prefix = prefix + name + "."
+	return func() {
+		recorder.prefix = prefix
+	}
+}
@@ -0,0 +1,95 @@
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/olebedev/emitter"
+)
+
+func TestRecordFields(t *testing.T) {
+	reader := NewPacketReader()
+	reader.SetContext(NewCommunicationContext())
+	reader.RecordFields = true
+	reader.Decoders().RegisterDataSubpacket(0x0D, testCodec)
+
+	var read []*PacketLayers
+	reader.LayerEmitter.On("full-reliable", func(e *emitter.Event) {
+		read = append(read, e.Args[0].(*PacketLayers))
+	}, emitter.Void)
+
+	reader.ReadPacket(orderedPing(0, 0, 0), &PacketLayers{})
+	reader.ReadPacket(orderedDatagram(1, 1, 1, []byte{0x83, 0x0D, 1, 0xAA, 0x0D, 0, 0x00}), &PacketLayers{})
+	if len(read) != 2 {
+		t.Fatalf("read %d packets", len(read))
+	}
+
+	expected := [][]FieldRange{{
+		{Name: "PacketType", Start: 0, End: 8},
+		{Name: "SendPingTime", Start: 8, End: 72},
+		{Name: "ID_CONNECTED_PING", Start: 8, End: 72},
+	}, {
+		{Name: "PacketType", Start: 0, End: 8},
+		{Name: "SubPackets[0]", Start: 8, End: 32},
+		{Name: "SubPackets[1]", Start: 32, End: 48},
+		{Name: "ID_DATA", Start: 8, End: 56},
+	}}
+	for i, layers := range read {
+		if fmt.Sprint(layers.Fields) != fmt.Sprint(expected[i]) {
+			t.Errorf("packet %d: recorded %v, expected %v", i, layers.Fields, expected[i])
+		}
+	}
+
+	fields := read[1].FieldsAt(3)
+	if len(fields) != 2 || fields[0].Name != "SubPackets[0]" || fields[1].Name != "ID_DATA" {
+		t.Errorf("fields at byte 3: %v", fields)
+	}
+	if fields := read[1].FieldsAt(7); len(fields) != 0 {
+		t.Errorf("fields past the end: %v", fields)
+	}
+}
+
+func TestRecordInnerFields(t *testing.T) {
+	reader := NewPacketReader()
+	reader.SetContext(NewCommunicationContext())
+	reader.RecordFields = true
+
+	var read []*PacketLayers
+	reader.LayerEmitter.On("offline", func(e *emitter.Event) {
+		read = append(read, e.Args[0].(*PacketLayers))
+	}, emitter.Void)
+	reader.LayerEmitter.On("full-reliable", func(e *emitter.Event) {
+		read = append(read, e.Args[0].(*PacketLayers))
+	}, emitter.Void)
+
+	handshake := append([]byte{0x7B}, OfflineMessageID...)
+	handshake = append(handshake, 5, 0, 0, 0)
+	reader.ReadPacket(handshake, &PacketLayers{})
+	reader.ReadPacket(orderedDatagram(0, 0, 0, []byte{0x83, 0x04, 0, 0, 0, 7, 0x00}), &PacketLayers{})
+	if len(read) != 2 {
+		t.Fatalf("read %d packets", len(read))
+	}
+
+	expected := [][]FieldRange{{
+		{Name: "PacketType", Start: 0, End: 8},
+		{Name: "OfflineMessageID", Start: 8, End: 136},
+		{Name: "ProtocolVersion", Start: 136, End: 144},
+		{Name: "MTUPadding", Start: 144, End: 168},
+		{Name: "ID_OPEN_CONNECTION_REQUEST_1", Start: 136, End: 168},
+	}, {
+		{Name: "PacketType", Start: 0, End: 8},
+		{Name: "SubPackets[0].MarkerID", Start: 16, End: 48},
+		{Name: "SubPackets[0]", Start: 8, End: 48},
+		{Name: "ID_DATA", Start: 8, End: 56},
+	}}
+	for i, layers := range read {
+		if fmt.Sprint(layers.Fields) != fmt.Sprint(expected[i]) {
+			t.Errorf("packet %d: recorded %v, expected %v", i, layers.Fields, expected[i])
+		}
+	}
+
+	fields := read[1].FieldsAt(4)
+	if len(fields) != 3 || fields[0].Name != "SubPackets[0].MarkerID" {
+		t.Errorf("fields at byte 4: %v", fields)
+	}
+}
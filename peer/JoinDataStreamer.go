@@ -59,6 +59,8 @@ type JoinDataStreamer struct {
 	counter          *countWriter
 	rawLayer         *Packet83_0B
 	packetWriter     PacketWriter
+	// err is set if the compressor couldn't be created
+	err error
 
 	deferredStringState writeDeferredStrings
 }
@@ -80,7 +82,10 @@ func (state *JoinDataStreamer) makeNewStream() *joinSerializeWriter {
 	state.compressedBuffer = bytes.NewBuffer(nil)
 	state.counter = newCountWriter()
 	state.rawLayer = &Packet83_0B{}
-	state.compressor = zstd.NewWriter(state.compressedBuffer)
+	state.compressor, state.err = newZstdWriter(state.compressedBuffer, state.packetWriter.Context())
+	if state.err != nil {
+		return nil
+	}
 
 	writeMux := io.MultiWriter(state.compressor, state.counter)
 	state.writer = &joinSerializeWriter{&extendedWriter{writeMux}}
@@ -93,6 +98,9 @@ func (state *JoinDataStreamer) makeNewStream() *joinSerializeWriter {
 // Flush forces JoinDataStreamer to emit the RawJoinDataBuffer being
 // serialized currently, unless empty
 func (state *JoinDataStreamer) Flush() error {
+	if state.err != nil {
+		return state.err
+	}
 	// If there's nothing to write, skip
 	if len(state.rawLayer.Instances) == 0 {
 		return nil
@@ -136,12 +144,18 @@ func (state *JoinDataStreamer) Close() error {
 
 // AddInstance add the instance to the current RawJoinDataBuffer
 func (state *JoinDataStreamer) AddInstance(instance *ReplicationInstance) error {
+	if state.err != nil {
+		return state.err
+	}
 	if state.compressedBuffer.Len() > MaxJoinDataBytes {
 		err := state.Flush()
 		if err != nil {
 			return err
 		}
 		state.makeNewStream()
+		if state.err != nil {
+			return state.err
+		}
 	}
 
 	state.rawLayer.Instances = append(state.rawLayer.Instances, instance)
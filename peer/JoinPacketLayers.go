@@ -147,11 +147,15 @@ type Packet13Layer struct {
 func (thisStream *extendedReader) DecodePacket05Layer(reader PacketReader, layers *PacketLayers) (RakNetPacket, error) {
 	var err error
 	layer := &Packet05Layer{}
+	start := layers.fieldStart(thisStream)
 	layer.ProtocolVersion, err = thisStream.readUint8() // !! RakNetLayer will have read the offline message !!
+	layers.recordField("ProtocolVersion", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	mtupad, err := ioutil.ReadAll(thisStream)
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("MTUPadding", thisStream, start)
 	layer.MTUPaddingLength = len(mtupad)
 
 	return layer, nil
@@ -186,16 +190,25 @@ func (thisStream *extendedReader) DecodePacket06Layer(reader PacketReader, layer
 	layer := &Packet06Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.GUID, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("GUID", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.UseSecurity, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("UseSecurity", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.MTU, err = thisStream.readUint16BE()
-	return layer, err
+	if err != nil {
+		return layer, err
+	}
+	layers.recordField("MTU", thisStream, start)
+	return layer, nil
 }
 
 // Serialize implements RakNetPacket.Serialize()
@@ -230,26 +243,36 @@ func (thisStream *extendedReader) DecodePacket07Layer(reader PacketReader, layer
 	layer := &Packet07Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.IPAddress, err = thisStream.readAddress()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("IPAddress", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.MTU, err = thisStream.readUint16BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("MTU", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.GUID, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("GUID", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.SupportedVersion, err = thisStream.readUint32BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("SupportedVersion", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.Capabilities, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Capabilities", thisStream, start)
 	return layer, err
 }
 
@@ -292,30 +315,42 @@ func (thisStream *extendedReader) DecodePacket08Layer(reader PacketReader, layer
 	layer := &Packet08Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.GUID, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("GUID", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.IPAddress, err = thisStream.readAddress()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("IPAddress", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.MTU, err = thisStream.readUint16BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("MTU", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.UseSecurity, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("UseSecurity", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.SupportedVersion, err = thisStream.readUint32BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("SupportedVersion", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.Capabilities, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Capabilities", thisStream, start)
 	return layer, err
 }
 
@@ -362,24 +397,32 @@ func (thisStream *extendedReader) DecodePacket09Layer(reader PacketReader, layer
 	layer := &Packet09Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.GUID, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("GUID", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.Timestamp, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Timestamp", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.UseSecurity, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("UseSecurity", thisStream, start)
 	// 2x 64 for timestamps, 8 for UseSecurity and 8 for PacketType
 
+	start = layers.fieldStart(thisStream)
 	layer.Password, err = ioutil.ReadAll(thisStream)
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Password", thisStream, start)
 	if IdentifyPassword(layer.Password) == StudioPassword {
 		layers.Root.Logger.Println("Detected Studio!")
 		reader.Context().IsStudio = true
@@ -422,26 +465,39 @@ func (thisStream *extendedReader) DecodePacket10Layer(reader PacketReader, layer
 	layer := &Packet10Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.IPAddress, err = thisStream.readAddress()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("IPAddress", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.SystemIndex, err = thisStream.readUint16BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("SystemIndex", thisStream, start)
 	for i := 0; i < 10; i++ {
+		start = layers.fieldStart(thisStream)
 		layer.Addresses[i], err = thisStream.readAddress()
 		if err != nil {
 			return layer, err
 		}
+		layers.recordField(fmt.Sprintf("Addresses[%d]", i), thisStream, start)
 	}
+	start = layers.fieldStart(thisStream)
 	layer.SendPingTime, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("SendPingTime", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.SendPongTime, err = thisStream.readUint64BE()
-	return layer, err
+	if err != nil {
+		return layer, err
+	}
+	layers.recordField("SendPongTime", thisStream, start)
+	return layer, nil
 }
 
 // Serialize implements RakNetPacket.Serialize()
@@ -490,22 +546,33 @@ func (thisStream *extendedReader) DecodePacket13Layer(reader PacketReader, layer
 	layer := &Packet13Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.IPAddress, err = thisStream.readAddress()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("IPAddress", thisStream, start)
 	for i := 0; i < 10; i++ {
+		start = layers.fieldStart(thisStream)
 		layer.Addresses[i], err = thisStream.readAddress()
 		if err != nil {
 			return layer, err
 		}
+		layers.recordField(fmt.Sprintf("Addresses[%d]", i), thisStream, start)
 	}
+	start = layers.fieldStart(thisStream)
 	layer.SendPingTime, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("SendPingTime", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.SendPongTime, err = thisStream.readUint64BE()
-	return layer, err
+	if err != nil {
+		return layer, err
+	}
+	layers.recordField("SendPongTime", thisStream, start)
+	return layer, nil
 }
 
 // Serialize implements RakNetPacket.Serialize()
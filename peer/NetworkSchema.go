@@ -199,10 +199,32 @@ type NetworkInstanceSchema struct {
 	Properties []*NetworkPropertySchema
 	Events     []*NetworkEventSchema
 	NetworkID  uint16
+
+	// Indices of the properties and events by name. See NetworkSchema.BuildIndex().
+	propertyIndices map[string]int
+	eventIndices    map[string]int
+}
+
+// buildIndex builds the indices of the properties and events of a class
+func (schema *NetworkInstanceSchema) buildIndex() {
+	schema.propertyIndices = make(map[string]int, len(schema.Properties))
+	for i := len(schema.Properties) - 1; i >= 0; i-- {
+		schema.propertyIndices[schema.Properties[i].Name] = i
+	}
+	schema.eventIndices = make(map[string]int, len(schema.Events))
+	for i := len(schema.Events) - 1; i >= 0; i-- {
+		schema.eventIndices[schema.Events[i].Name] = i
+	}
 }
 
 // LocalPropertyIndex finds the index of a certain property within one class
 func (schema *NetworkInstanceSchema) LocalPropertyIndex(name string) int {
+	if schema.propertyIndices != nil {
+		if idx, ok := schema.propertyIndices[name]; ok {
+			return idx
+		}
+		return -1
+	}
 	for i := 0; i < len(schema.Properties); i++ {
 		if schema.Properties[i].Name == name {
 			return i
@@ -222,6 +244,12 @@ func (schema *NetworkInstanceSchema) SchemaForProp(name string) *NetworkProperty
 
 // LocalEventIndex finds the index of a certain event within one class
 func (schema *NetworkInstanceSchema) LocalEventIndex(name string) int {
+	if schema.eventIndices != nil {
+		if idx, ok := schema.eventIndices[name]; ok {
+			return idx
+		}
+		return -1
+	}
 	for i := 0; i < len(schema.Events); i++ {
 		if schema.Events[i].Name == name {
 			return i
@@ -241,6 +269,9 @@ func (schema *NetworkInstanceSchema) SchemaForEvent(name string) *NetworkEventSc
 
 // SchemaForClass finds the schema for a certain class
 func (schema *NetworkSchema) SchemaForClass(instance string) *NetworkInstanceSchema {
+	if schema.classIndex != nil {
+		return schema.classIndex[instance]
+	}
 	for _, inst := range schema.Instances {
 		if inst.Name == instance {
 			return inst
@@ -251,6 +282,9 @@ func (schema *NetworkSchema) SchemaForClass(instance string) *NetworkInstanceSch
 
 // SchemaForEnum finds the schema for a certain enum
 func (schema *NetworkSchema) SchemaForEnum(enum string) *NetworkEnumSchema {
+	if schema.enumIndex != nil {
+		return schema.enumIndex[enum]
+	}
 	for _, enumVal := range schema.Enums {
 		if enum == enumVal.Name {
 			return enumVal
@@ -269,4 +303,28 @@ type NetworkSchema struct {
 
 	ContentPrefixes  []string
 	OptimizedStrings []string
+
+	// Indices of the classes and enums by name. See BuildIndex().
+	classIndex map[string]*NetworkInstanceSchema
+	enumIndex  map[string]*NetworkEnumSchema
+}
+
+// BuildIndex builds the indices that the SchemaFor* and Local*Index
+// lookups use. Schemas that are parsed or decoded are indexed
+// automatically, and lookups in schemas that haven't been indexed
+// scan the lists instead. BuildIndex must be called again if
+// the lists are modified.
+func (schema *NetworkSchema) BuildIndex() {
+	schema.classIndex = make(map[string]*NetworkInstanceSchema, len(schema.Instances))
+	// iterate backwards so that the first item with a given name wins,
+	// like in the scans
+	for i := len(schema.Instances) - 1; i >= 0; i-- {
+		instance := schema.Instances[i]
+		schema.classIndex[instance.Name] = instance
+		instance.buildIndex()
+	}
+	schema.enumIndex = make(map[string]*NetworkEnumSchema, len(schema.Enums))
+	for i := len(schema.Enums) - 1; i >= 0; i-- {
+		schema.enumIndex[schema.Enums[i].Name] = schema.Enums[i]
+	}
 }
@@ -0,0 +1,97 @@
+package peer
+
+import (
+	"fmt"
+	"testing"
+)
+
+// largeSchema returns a schema about the size of a real one, without indices
+func largeSchema() *NetworkSchema {
+	schema := &NetworkSchema{}
+	for i := 0; i < 1000; i++ {
+		schema.Enums = append(schema.Enums, &NetworkEnumSchema{Name: fmt.Sprintf("Enum%d", i), BitSize: 8, NetworkID: uint16(i)})
+	}
+	for i := 0; i < 1000; i++ {
+		class := &NetworkInstanceSchema{Name: fmt.Sprintf("Class%d", i), NetworkID: uint16(i)}
+		for j := 0; j < 40; j++ {
+			property := &NetworkPropertySchema{
+				Name:           fmt.Sprintf("Property%d", j),
+				Type:           PropertyTypeBool,
+				InstanceSchema: class,
+				NetworkID:      uint16(len(schema.Properties)),
+			}
+			class.Properties = append(class.Properties, property)
+			schema.Properties = append(schema.Properties, property)
+		}
+		for j := 0; j < 10; j++ {
+			event := &NetworkEventSchema{
+				Name:           fmt.Sprintf("Event%d", j),
+				InstanceSchema: class,
+				NetworkID:      uint16(len(schema.Events)),
+			}
+			class.Events = append(class.Events, event)
+			schema.Events = append(schema.Events, event)
+		}
+		schema.Instances = append(schema.Instances, class)
+	}
+	return schema
+}
+
+func TestSchemaIndex(t *testing.T) {
+	linear := largeSchema()
+	// the first item with a name wins
+	duplicate := &NetworkInstanceSchema{Name: "Class1", NetworkID: 1000}
+	linear.Instances = append(linear.Instances, duplicate)
+	indexed := largeSchema()
+	indexed.Instances = append(indexed.Instances, duplicate)
+	indexed.BuildIndex()
+
+	for _, name := range []string{"Class0", "Class1", "Class999", "Missing"} {
+		want, got := linear.SchemaForClass(name), indexed.SchemaForClass(name)
+		if (want == nil) != (got == nil) || (want != nil && want.NetworkID != got.NetworkID) {
+			t.Errorf("class %s differs", name)
+		}
+	}
+	for _, name := range []string{"Enum0", "Enum999", "Missing"} {
+		want, got := linear.SchemaForEnum(name), indexed.SchemaForEnum(name)
+		if (want == nil) != (got == nil) || (want != nil && want.NetworkID != got.NetworkID) {
+			t.Errorf("enum %s differs", name)
+		}
+	}
+	linearClass, indexedClass := linear.Instances[500], indexed.Instances[500]
+	for _, name := range []string{"Property0", "Property39", "Event9", "Missing"} {
+		if linearClass.LocalPropertyIndex(name) != indexedClass.LocalPropertyIndex(name) {
+			t.Errorf("index of property %s differs", name)
+		}
+		if linearClass.LocalEventIndex(name) != indexedClass.LocalEventIndex(name) {
+			t.Errorf("index of event %s differs", name)
+		}
+	}
+}
+
+func benchmarkSchemaLookups(b *testing.B, schema *NetworkSchema) {
+	names := make([]string, 100)
+	for i := range names {
+		names[i] = fmt.Sprintf("Class%d", i*10)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		class := schema.SchemaForClass(names[i%len(names)])
+		if class.SchemaForProp("Property30") == nil || class.SchemaForEvent("Event5") == nil {
+			b.Fatal("lookup failed")
+		}
+		if schema.SchemaForEnum("Enum700") == nil {
+			b.Fatal("lookup failed")
+		}
+	}
+}
+
+func BenchmarkSchemaLookupsLinear(b *testing.B) {
+	benchmarkSchemaLookups(b, largeSchema())
+}
+
+func BenchmarkSchemaLookupsIndexed(b *testing.B) {
+	schema := largeSchema()
+	schema.BuildIndex()
+	benchmarkSchemaLookups(b, schema)
+}
@@ -13,8 +13,10 @@ func (thisStream *extendedReader) DecodePacket15Layer(reader PacketReader, layer
 	layer := &Packet15Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	reason, err := thisStream.readUint32BE()
 	layer.Reason = int32(reason)
+	layers.recordField("Reason", thisStream, start)
 	// DisconnectReceivePacketError: most parser functions -- NOT NetworkStream reading
 	// DisconnectReceivePacketStreamError: when reading from network streams
 	// DisconnectSendPacketError: from ClusterJobStep, from DataOutStep, when creating player
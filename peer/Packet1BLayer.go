@@ -15,14 +15,18 @@ func (thisStream *extendedReader) DecodePacket1BLayer(reader PacketReader, layer
 	layer := &Packet1BLayer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.Timestamp, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Timestamp", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.Timestamp2, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Timestamp2", thisStream, start)
 
 	return layer, err
 }
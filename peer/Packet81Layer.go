@@ -39,47 +39,65 @@ func (thisStream *extendedReader) DecodePacket81Layer(reader PacketReader, layer
 
 	var err error
 
+	start := layers.fieldStart(thisStream)
 	layer.StreamJob, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("StreamJob", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.FilteringEnabled, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("FilteringEnabled", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.Bool1, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Bool1", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.Bool2, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Bool2", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.Bool3, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Bool3", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.CharacterAutoSpawn, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("CharacterAutoSpawn", thisStream, start)
 
+	start = layers.fieldStart(thisStream)
 	peerID, err := thisStream.readVarint64()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("PeerID", thisStream, start)
 	layer.PeerID = uint32(peerID)
 
 	reader.Context().ServerPeerID = layer.PeerID
 	if !reader.Context().IsStudio {
+		start = layers.fieldStart(thisStream)
 		layer.ScriptKey, err = thisStream.readUint32BE()
 		if err != nil {
 			return layer, err
 		}
+		layers.recordField("ScriptKey", thisStream, start)
+		start = layers.fieldStart(thisStream)
 		layer.CoreScriptKey, err = thisStream.readUint32BE()
 		if err != nil {
 			return layer, err
 		}
+		layers.recordField("CoreScriptKey", thisStream, start)
 
 		reader.Context().ScriptKey = layer.ScriptKey
 		reader.Context().CoreScriptKey = layer.CoreScriptKey
@@ -98,6 +116,7 @@ func (thisStream *extendedReader) DecodePacket81Layer(reader PacketReader, layer
 	layer.Items = make([]*Packet81LayerItem, arrayLen)
 	for i := 0; i < int(arrayLen); i++ {
 		thisItem := &Packet81LayerItem{}
+		start := layers.fieldStart(thisStream)
 		reference, err := thisStream.readObject(context)
 		if err != nil {
 			return layer, err
@@ -108,6 +127,9 @@ func (thisStream *extendedReader) DecodePacket81Layer(reader PacketReader, layer
 			return layer, err
 		}
 
+		if context.NetworkSchema == nil {
+			return layer, ErrNoSchema
+		}
 		if int(classID) > len(context.NetworkSchema.Instances) {
 			return layer, fmt.Errorf("class idx %d is higher than %d", classID, len(context.NetworkSchema.Instances))
 		}
@@ -130,6 +152,7 @@ func (thisStream *extendedReader) DecodePacket81Layer(reader PacketReader, layer
 		if err != nil {
 			return layer, err
 		}
+		layers.recordField(fmt.Sprintf("Items[%d]", i), thisStream, start)
 		layer.Items[i] = thisItem
 	}
 	return layer, nil
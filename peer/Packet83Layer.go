@@ -31,7 +31,7 @@ var Packet83Subpackets = map[uint8]string{
 	0x14: "ID_REPLIC_STREAM_DATA_INFO",
 }
 
-var packet83Decoders = map[uint8](func(*extendedReader, PacketReader, *PacketLayers) (Packet83Subpacket, error)){
+var packet83Decoders = map[uint8]subpacketDecoderFunc{
 	0x01: (*extendedReader).DecodePacket83_01,
 	0x02: (*extendedReader).DecodePacket83_02,
 	0x03: (*extendedReader).DecodePacket83_03,
@@ -70,6 +70,7 @@ type Packet83Layer struct {
 func (thisStream *extendedReader) DecodePacket83Layer(reader PacketReader, layers *PacketLayers) (RakNetPacket, error) {
 	layer := &Packet83Layer{}
 
+	start := layers.fieldStart(thisStream)
 	packetType, err := thisStream.readUint8()
 	if err != nil {
 		return layer, err
@@ -78,17 +79,22 @@ func (thisStream *extendedReader) DecodePacket83Layer(reader PacketReader, layer
 	var inner Packet83Subpacket
 	for packetType != 0 {
 		//println("parsing subpacket", packetType)
-		decoder, ok := packet83Decoders[packetType]
+		decoder, ok := reader.Decoders().subpackets[packetType]
 		if !ok {
 			return layer, errors.New("don't know how to parse replication subpacket: " + strconv.Itoa(int(packetType)))
 		}
+		name := fmt.Sprintf("SubPackets[%d]", len(layer.SubPackets))
+		leave := layers.enterField(name)
 		inner, err = decoder(thisStream, reader, layers)
+		leave()
 		if err != nil {
 			return layer, errors.New("parsing subpacket " + Packet83Subpackets[packetType] + ": " + err.Error())
 		}
+		layers.recordField(name, thisStream, start)
 
 		layer.SubPackets = append(layer.SubPackets, inner)
 
+		start = layers.fieldStart(thisStream)
 		packetType, err = thisStream.readUint8()
 		if err != nil {
 			return layer, err
@@ -15,11 +15,13 @@ func (thisStream *extendedReader) DecodePacket83_01(reader PacketReader, layers
 	inner := &Packet83_01{}
 
 	// NULL deletion is actually legal. Who would have known?
+	start := layers.fieldStart(thisStream)
 	reference, err := thisStream.readObject(reader.Context())
 	if err != nil {
 		return inner, err
 	}
-	inner.Instance, err = reader.Context().InstancesByReference.TryGetInstance(reference)
+	layers.recordField("Instance", thisStream, start)
+	inner.Instance, err = lookupInstance(reader, layers, reference)
 
 	return inner, err
 }
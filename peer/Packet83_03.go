@@ -23,42 +23,55 @@ func (thisStream *extendedReader) DecodePacket83_03(reader PacketReader, layers
 	var err error
 	layer := &Packet83_03{}
 
+	start := layers.fieldStart(thisStream)
 	reference, err := thisStream.readObject(reader.Context())
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Instance", thisStream, start)
 	if reference.IsNull {
 		return layer, errors.New("self is null in repl property")
 	}
-	layer.Instance, err = reader.Context().InstancesByReference.TryGetInstance(reference)
+	layer.Instance, err = lookupInstance(reader, layers, reference)
 	if err != nil {
 		return layer, err
 	}
 
+	start = layers.fieldStart(thisStream)
 	propertyIDx, err := thisStream.readUint16BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Schema", thisStream, start)
 
+	start = layers.fieldStart(thisStream)
 	layer.HasVersion, err = thisStream.readBoolByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("HasVersion", thisStream, start)
 	// If this packet was written by the client, read version
 	if layer.HasVersion && reader.IsClient() {
+		start = layers.fieldStart(thisStream)
 		layer.Version, err = thisStream.readSintUTF8()
 		if err != nil {
 			return layer, err
 		}
+		layers.recordField("Version", thisStream, start)
 	}
 
 	context := reader.Context()
+	if context.NetworkSchema == nil {
+		return layer, ErrNoSchema
+	}
 	if int(propertyIDx) == int(len(context.NetworkSchema.Properties)) { // explicit Parent property system
 		var reference datamodel.Reference
+		start = layers.fieldStart(thisStream)
 		reference, err = thisStream.readObject(reader.Context())
 		if err != nil {
 			return layer, err
 		}
+		layers.recordField("Value", thisStream, start)
 		// CreateInstance: allow forward references in ID_REPLIC_PROP
 		result := datamodel.ValueReference{Reference: reference}
 		refInstance, err := context.InstancesByReference.CreateInstance(reference)
@@ -79,10 +92,12 @@ func (thisStream *extendedReader) DecodePacket83_03(reader PacketReader, layers
 	layer.Schema = schema
 
 	deferred := newDeferredStrings(reader)
+	start = layers.fieldStart(thisStream)
 	layer.Value, err = schema.Decode(reader, thisStream, layers, deferred)
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Value", thisStream, start)
 
 	err = thisStream.resolveDeferredStrings(deferred)
 	if err != nil {
@@ -11,10 +11,12 @@ func (thisStream *extendedReader) DecodePacket83_04(reader PacketReader, layers
 	var err error
 	inner := &Packet83_04{}
 
+	start := layers.fieldStart(thisStream)
 	inner.MarkerID, err = thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("MarkerID", thisStream, start)
 
 	return inner, err
 }
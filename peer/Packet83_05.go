@@ -20,50 +20,68 @@ func (thisStream *extendedReader) DecodePacket83_05(reader PacketReader, layers
 	var err error
 	inner := &Packet83_05{}
 
+	start := layers.fieldStart(thisStream)
 	inner.PacketVersion, err = thisStream.readUint8()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("PacketVersion", thisStream, start)
 
 	if inner.PacketVersion <= 1 {
+		start = layers.fieldStart(thisStream)
 		inner.Timestamp, err = thisStream.readUint64BE()
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField("Timestamp", thisStream, start)
 	} else if inner.PacketVersion == 2 {
+		start = layers.fieldStart(thisStream)
 		inner.Int1, err = thisStream.readUint32BE()
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField("Int1", thisStream, start)
 		var timestamp uint32
+		start = layers.fieldStart(thisStream)
 		timestamp, err = thisStream.readUint32BE()
 		inner.Timestamp = uint64(timestamp)
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField("Timestamp", thisStream, start)
+		start = layers.fieldStart(thisStream)
 		inner.Fps1, err = thisStream.readFloat32BE()
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField("Fps1", thisStream, start)
+		start = layers.fieldStart(thisStream)
 		inner.Fps2, err = thisStream.readFloat32BE()
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField("Fps2", thisStream, start)
+		start = layers.fieldStart(thisStream)
 		inner.Fps3, err = thisStream.readFloat32BE()
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField("Fps3", thisStream, start)
 	} else {
 		return inner, errors.New("invalid packetversion")
 	}
+	start = layers.fieldStart(thisStream)
 	inner.SendStats, err = thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("SendStats", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	inner.ExtraStats, err = thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("ExtraStats", thisStream, start)
 	if inner.Timestamp&0x20 != 0 {
 		inner.ExtraStats ^= 0xFFFFFFFF
 	}
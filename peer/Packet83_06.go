@@ -14,23 +14,31 @@ func (thisStream *extendedReader) DecodePacket83_06(reader PacketReader, layers
 	var err error
 	inner := &Packet83_06{}
 
+	start := layers.fieldStart(thisStream)
 	inner.IsPingBack, err = thisStream.readBoolByte()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("IsPingBack", thisStream, start)
 
+	start = layers.fieldStart(thisStream)
 	inner.Timestamp, err = thisStream.readUint64BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("Timestamp", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	inner.SendStats, err = thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("SendStats", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	inner.ExtraStats, err = thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("ExtraStats", thisStream, start)
 	if inner.Timestamp&0x20 != 0 {
 		inner.ExtraStats ^= 0xFFFFFFFF
 	}
@@ -20,24 +20,31 @@ func (thisStream *extendedReader) DecodePacket83_07(reader PacketReader, layers
 	var err error
 	layer := &Packet83_07{}
 
+	start := layers.fieldStart(thisStream)
 	reference, err := thisStream.readObject(reader.Context())
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Instance", thisStream, start)
 	if reference.IsNull {
 		return layer, errors.New("self is nil in decode repl event")
 	}
-	layer.Instance, err = reader.Context().InstancesByReference.TryGetInstance(reference)
+	layer.Instance, err = lookupInstance(reader, layers, reference)
 	if err != nil {
 		return layer, err
 	}
 
+	start = layers.fieldStart(thisStream)
 	eventIDx, err := thisStream.readUint16BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Schema", thisStream, start)
 
 	context := reader.Context()
+	if context.NetworkSchema == nil {
+		return layer, ErrNoSchema
+	}
 	if int(eventIDx) > int(len(context.NetworkSchema.Events)) {
 		return layer, fmt.Errorf("event idx %d is higher than %d", eventIDx, len(context.NetworkSchema.Events))
 	}
@@ -46,10 +53,12 @@ func (thisStream *extendedReader) DecodePacket83_07(reader PacketReader, layers
 	schema := context.NetworkSchema.Events[eventIDx]
 	layer.Schema = schema
 	layers.Root.Logger.Println("Decoding event", schema.Name)
+	start = layers.fieldStart(thisStream)
 	layer.Event, err = schema.Decode(reader, thisStream, layers, deferred)
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Event", thisStream, start)
 
 	err = thisStream.resolveDeferredStrings(deferred)
 	if err != nil {
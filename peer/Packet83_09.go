@@ -51,6 +51,7 @@ func (thisStream *extendedReader) DecodePacket83_09(reader PacketReader, layers
 		return inner, err
 	}
 	var subpacket Packet83_09Subpacket
+	start := layers.fieldStart(thisStream)
 	switch subpacketType {
 	case 0: // ???
 		thisSubpacket := &Packet83_09_00{}
@@ -108,6 +109,7 @@ func (thisStream *extendedReader) DecodePacket83_09(reader PacketReader, layers
 		layers.Root.Logger.Println("don't know rocky subpacket", subpacketType)
 		return inner, errors.New("unimplemented subpacket type")
 	}
+	layers.recordField("Subpacket", thisStream, start)
 	inner.Subpacket = subpacket
 
 	return inner, err
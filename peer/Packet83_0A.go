@@ -19,24 +19,31 @@ func (thisStream *extendedReader) DecodePacket83_0A(reader PacketReader, layers
 	var err error
 	layer := &Packet83_0A{}
 
+	start := layers.fieldStart(thisStream)
 	reference, err := thisStream.readObject(reader.Context())
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Instance", thisStream, start)
 	if reference.IsNull {
 		return layer, errors.New("self is null in repl prop ack")
 	}
-	layer.Instance, err = reader.Context().InstancesByReference.TryGetInstance(reference)
+	layer.Instance, err = lookupInstance(reader, layers, reference)
 	if err != nil {
 		return layer, err
 	}
 
 	context := reader.Context()
+	start = layers.fieldStart(thisStream)
 	propertyIDx, err := thisStream.readUint16BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Schema", thisStream, start)
 
+	if context.NetworkSchema == nil {
+		return layer, ErrNoSchema
+	}
 	if int(propertyIDx) > int(len(context.NetworkSchema.Properties)) {
 		return layer, fmt.Errorf("prop idx %d is higher than %d", propertyIDx, len(context.NetworkSchema.Properties))
 	}
@@ -48,10 +55,12 @@ func (thisStream *extendedReader) DecodePacket83_0A(reader PacketReader, layers
 	}
 	layer.Versions = make([]uint32, countVersions)
 	for i := 0; i < int(countVersions); i++ {
+		start = layers.fieldStart(thisStream)
 		layer.Versions[i], err = thisStream.readUintUTF8()
 		if err != nil {
 			return layer, err
 		}
+		layers.recordField(fmt.Sprintf("Versions[%d]", i), thisStream, start)
 	}
 
 	return layer, err
@@ -14,6 +14,7 @@ type Packet83_0B struct {
 func (thisStream *extendedReader) DecodePacket83_0B(reader PacketReader, layers *PacketLayers) (Packet83Subpacket, error) {
 	layer := &Packet83_0B{}
 
+	start := layers.fieldStart(thisStream)
 	arrayLen, err := thisStream.readUint32BE()
 	if err != nil {
 		return layer, err
@@ -28,10 +29,12 @@ func (thisStream *extendedReader) DecodePacket83_0B(reader PacketReader, layers
 		return layer, nil
 	}
 
-	zstdStream, err := thisStream.RegionToZStdStream()
+	zstdStream, err := thisStream.RegionToZStdStream(reader.Context())
 	if err != nil {
 		return layer, err
 	}
+	// the instances can't be located in the compressed region
+	layers.recordField("Instances", thisStream, start)
 
 	deferred := newDeferredStrings(reader)
 	var i uint32
@@ -57,7 +60,10 @@ func (layer *Packet83_0B) Serialize(writer PacketWriter, stream *extendedWriter)
 	if err != nil {
 		return err
 	}
-	zstdStream := stream.wrapZstd()
+	zstdStream, err := stream.wrapZstd(writer.Context())
+	if err != nil {
+		return err
+	}
 	deferred := newWriteDeferredStrings(writer)
 
 	for i := 0; i < len(layer.Instances); i++ {
@@ -11,15 +11,19 @@ type Packet83_0C struct {
 func (thisStream *extendedReader) DecodePacket83_0C(reader PacketReader, layers *PacketLayers) (Packet83Subpacket, error) {
 	inner := &Packet83_0C{}
 
+	start := layers.fieldStart(thisStream)
 	quotaDiff, err := thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("QuotaDiff", thisStream, start)
 	inner.QuotaDiff = int32(quotaDiff)
+	start = layers.fieldStart(thisStream)
 	maxRegionRadius, err := thisStream.readUint16BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("MaxRegionRadius", thisStream, start)
 	inner.MaxRegionRadius = int16(maxRegionRadius)
 
 	return inner, nil
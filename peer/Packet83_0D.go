@@ -116,20 +116,26 @@ type Packet83_0D struct {
 func (thisStream *extendedReader) DecodePacket83_0D(reader PacketReader, layers *PacketLayers) (Packet83Subpacket, error) {
 	inner := &Packet83_0D{}
 	var err error
+	start := layers.fieldStart(thisStream)
 	inner.Bool1, err = thisStream.readBoolByte()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("Bool1", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	inner.Bool2, err = thisStream.readBoolByte()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("Bool2", thisStream, start)
 
 	if !inner.Bool1 && !inner.Bool2 {
+		start = layers.fieldStart(thisStream)
 		inner.Region, err = thisStream.readStreamInfo()
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField("Region", thisStream, start)
 	}
 
 	joinData, err := thisStream.DecodePacket83_0B(reader, layers)
@@ -36,7 +36,7 @@ func (thisStream *extendedReader) DecodePacket83_0E(reader PacketReader, layers
 	}
 
 	if useCompression {
-		thisStream, err = thisStream.RegionToZStdStream()
+		thisStream, err = thisStream.RegionToZStdStream(reader.Context())
 		if err != nil {
 			return inner, err
 		}
@@ -48,7 +48,7 @@ func (thisStream *extendedReader) DecodePacket83_0E(reader PacketReader, layers
 			return inner, err
 		}
 
-		inner.Instances[i], err = reader.Context().InstancesByReference.TryGetInstance(ref)
+		inner.Instances[i], err = lookupInstance(reader, layers, ref)
 		if err != nil {
 			return inner, err
 		}
@@ -74,7 +74,10 @@ func (layer *Packet83_0E) Serialize(writer PacketWriter, stream *extendedWriter)
 		return err
 	}
 
-	zstdStream := stream.wrapZstd()
+	zstdStream, err := stream.wrapZstd(writer.Context())
+	if err != nil {
+		return err
+	}
 	for _, inst := range layer.Instances {
 		err = zstdStream.writeObject(inst, writer.Context())
 		if err != nil {
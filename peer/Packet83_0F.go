@@ -16,11 +16,13 @@ func (thisStream *extendedReader) DecodePacket83_0F(reader PacketReader, layers
 	var err error
 	inner := &Packet83_0F{}
 
+	start := layers.fieldStart(thisStream)
 	reference, err := thisStream.readObject(reader.Context())
 	if err != nil {
 		return inner, err
 	}
-	inner.Instance, err = reader.Context().InstancesByReference.TryGetInstance(reference)
+	layers.recordField("Instance", thisStream, start)
+	inner.Instance, err = lookupInstance(reader, layers, reference)
 
 	return inner, err
 }
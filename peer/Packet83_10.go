@@ -11,10 +11,12 @@ func (thisStream *extendedReader) DecodePacket83_10(reader PacketReader, layers
 	var err error
 	inner := &Packet83_10{}
 
+	start := layers.fieldStart(thisStream)
 	inner.TagID, err = thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("TagID", thisStream, start)
 
 	return inner, err
 }
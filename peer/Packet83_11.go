@@ -82,12 +82,15 @@ func (thisStream *extendedReader) readMemoryStats() ([]MemoryStatsItem, error) {
 func (thisStream *extendedReader) DecodePacket83_11(reader PacketReader, layers *PacketLayers) (Packet83Subpacket, error) {
 	var err error
 	inner := &Packet83_11{}
+	start := layers.fieldStart(thisStream)
 	inner.Version, err = thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("Version", thisStream, start)
 
 	if inner.Version >= 5 {
+		start = layers.fieldStart(thisStream)
 		inner.MemoryStats.TotalServerMemory, err = thisStream.readFloat64BE()
 		if err != nil {
 			return inner, err
@@ -101,9 +104,11 @@ func (thisStream *extendedReader) DecodePacket83_11(reader PacketReader, layers
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField("MemoryStats", thisStream, start)
 	}
 
 	if inner.Version >= 3 {
+		start = layers.fieldStart(thisStream)
 		inner.DataStoreStats.Enabled, err = thisStream.readBoolByte()
 		if err != nil {
 			return inner, err
@@ -134,11 +139,13 @@ func (thisStream *extendedReader) DecodePacket83_11(reader PacketReader, layers
 				return inner, err
 			}
 		}
+		layers.recordField("DataStoreStats", thisStream, start)
 	}
 
 	for isEnd, err := thisStream.readBoolByte(); !isEnd && err == nil; isEnd, err = thisStream.readBoolByte() {
 		newJobItem := JobStatsItem{}
 		println("reading a job")
+		start := layers.fieldStart(thisStream)
 		name, err := thisStream.readUint32AndString()
 		if err != nil {
 			return inner, err
@@ -159,6 +166,7 @@ func (thisStream *extendedReader) DecodePacket83_11(reader PacketReader, layers
 			return inner, err
 		}
 
+		layers.recordField(fmt.Sprintf("JobStats[%d]", len(inner.JobStats)), thisStream, start)
 		inner.JobStats = append(inner.JobStats, newJobItem)
 	}
 	if err != nil {
@@ -168,6 +176,7 @@ func (thisStream *extendedReader) DecodePacket83_11(reader PacketReader, layers
 	for isEnd, err := thisStream.readBoolByte(); !isEnd && err == nil; isEnd, err = thisStream.readBoolByte() {
 		newScriptItem := ScriptStatsItem{}
 		println("reading a script")
+		start := layers.fieldStart(thisStream)
 		name, err := thisStream.readUint32AndString()
 		if err != nil {
 			return inner, err
@@ -183,32 +192,43 @@ func (thisStream *extendedReader) DecodePacket83_11(reader PacketReader, layers
 		if err != nil {
 			return inner, err
 		}
+		layers.recordField(fmt.Sprintf("ScriptStats[%d]", len(inner.ScriptStats)), thisStream, start)
 		inner.ScriptStats = append(inner.ScriptStats, newScriptItem)
 	}
 	if err != nil {
 		return inner, err
 	}
 
+	start = layers.fieldStart(thisStream)
 	inner.AvgPingMs, err = thisStream.readFloat32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("AvgPingMs", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	inner.AvgPhysicsSenderPktPS, err = thisStream.readFloat32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("AvgPhysicsSenderPktPS", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	inner.TotalDataKBPS, err = thisStream.readFloat32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("TotalDataKBPS", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	inner.TotalPhysicsKBPS, err = thisStream.readFloat32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("TotalPhysicsKBPS", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	inner.DataThroughputRatio, err = thisStream.readFloat32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("DataThroughputRatio", thisStream, start)
 
 	return inner, nil
 }
@@ -13,27 +13,40 @@ type Packet83_12 struct {
 }
 
 func (stream *extendedReader) DecodePacket83_12(reader PacketReader, layers *PacketLayers) (Packet83Subpacket, error) {
-	var err error
-	inner := &Packet83_12{}
 	numItems, err := stream.readUint8()
 	if err != nil {
-		return inner, err
+		return &Packet83_12{}, err
+	}
+	// Hashes of old protocol versions prefix the count with 0xFF.
+	// The prefix is only used to detect the format if the version is unknown.
+	hasSecurityTokens := numItems != 0xFF
+	if version := reader.Context().ProtocolVersion; version.Known() {
+		hasSecurityTokens = version.AtLeast(HashTokensVersion)
+		if !hasSecurityTokens && numItems != 0xFF {
+			return &Packet83_12{}, fmt.Errorf("invalid hash prefix %02X for protocol version %d", numItems, version)
+		}
 	}
+	return stream.decodeHashBody(layers, numItems, hasSecurityTokens)
+}
 
-	if numItems != 0xFF {
-		//println("noextranumitem")
-		inner.HasSecurityTokens = true
-	} else {
+// decodeHashBody decodes the rest of an ID_REPLIC_HASH whose first byte was numItems
+func (stream *extendedReader) decodeHashBody(layers *PacketLayers, numItems uint8, hasSecurityTokens bool) (*Packet83_12, error) {
+	var err error
+	inner := &Packet83_12{HasSecurityTokens: hasSecurityTokens}
+	if !inner.HasSecurityTokens {
 		numItems, err = stream.readUint8()
 		if err != nil {
 			return inner, err
 		}
 	}
 
+	start := layers.fieldStart(stream)
 	inner.Nonce, err = stream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("Nonce", stream, start)
+	start = layers.fieldStart(stream)
 	hashList := make([]uint32, numItems)
 	for i := 0; i < int(numItems); i++ {
 		hashList[i], err = stream.readUint32BE()
@@ -41,14 +54,17 @@ func (stream *extendedReader) DecodePacket83_12(reader PacketReader, layers *Pac
 			return inner, err
 		}
 	}
+	layers.recordField("HashList", stream, start)
 
 	if inner.HasSecurityTokens {
+		start = layers.fieldStart(stream)
 		for i := 0; i < 3; i++ {
 			inner.SecurityTokens[i], err = stream.readUint64BE()
 			if err != nil {
 				return inner, err
 			}
 		}
+		layers.recordField("SecurityTokens", stream, start)
 	}
 
 	inner.HashList = hashList
@@ -58,6 +74,9 @@ func (stream *extendedReader) DecodePacket83_12(reader PacketReader, layers *Pac
 
 // Serialize implements Packet83Subpacket.Serialize()
 func (layer *Packet83_12) Serialize(writer PacketWriter, stream *extendedWriter) error {
+	if version := writer.Context().ProtocolVersion; version.Known() && version.AtLeast(HashTokensVersion) != layer.HasSecurityTokens {
+		return fmt.Errorf("hash with security tokens %v can't be written for protocol version %d", layer.HasSecurityTokens, version)
+	}
 	if !layer.HasSecurityTokens {
 		err := stream.WriteByte(0xFF)
 		if err != nil {
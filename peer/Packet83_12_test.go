@@ -0,0 +1,128 @@
+package peer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func decodeHash(version ProtocolVersion, data []byte) (*Packet83_12, error) {
+	context := NewCommunicationContext()
+	context.ProtocolVersion = version
+	reader := NewPacketReader()
+	reader.SetContext(context)
+	layer, err := (&extendedReader{bytes.NewReader(data)}).DecodePacket83_12(reader, &PacketLayers{})
+	return layer.(*Packet83_12), err
+}
+
+func serializeHash(t *testing.T, version ProtocolVersion, layer *Packet83_12) []byte {
+	context := NewCommunicationContext()
+	context.ProtocolVersion = version
+	writer := NewPacketWriter()
+	writer.SetContext(context)
+	var buffer bytes.Buffer
+	if err := layer.Serialize(writer, &extendedWriter{&buffer}); err != nil {
+		t.Fatal("serializing hash:", err.Error())
+	}
+	return buffer.Bytes()
+}
+
+func TestHashVersions(t *testing.T) {
+	legacy := []byte{0xFF, 1, 0, 0, 0, 7, 0xAA, 0xBB, 0xCC, 0xDD}
+	tokens := []byte{1, 0, 0, 0, 7, 0xAA, 0xBB, 0xCC, 0xDD}
+	for i := 0; i < 3; i++ {
+		tokens = append(tokens, 0, 0, 0, 0, 0, 0, 0, byte(i+1))
+	}
+
+	cases := []struct {
+		name    string
+		version ProtocolVersion
+		data    []byte
+		tokens  bool
+	}{
+		{"legacy", HashTokensVersion - 1, legacy, false},
+		{"tokens", HashTokensVersion, tokens, true},
+		{"detected legacy", UnknownProtocolVersion, legacy, false},
+		{"detected tokens", UnknownProtocolVersion, tokens, true},
+	}
+	for _, c := range cases {
+		layer, err := decodeHash(c.version, c.data)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+			continue
+		}
+		if layer.HasSecurityTokens != c.tokens || layer.Nonce != 7 || len(layer.HashList) != 1 || layer.HashList[0] != 0xAABBCCDD {
+			t.Errorf("%s: decoded %+v", c.name, layer)
+			continue
+		}
+		if c.tokens && layer.SecurityTokens != [3]uint64{1, 2, 3} {
+			t.Errorf("%s: decoded tokens %v", c.name, layer.SecurityTokens)
+		}
+		if serialized := serializeHash(t, c.version, layer); !bytes.Equal(serialized, c.data) {
+			t.Errorf("%s: serialized % X, expected % X", c.name, serialized, c.data)
+		}
+	}
+
+	// a known version decides the format, whatever the data looks like
+	if _, err := decodeHash(HashTokensVersion-1, tokens); err == nil {
+		t.Error("decoded a hash without the prefix for a version without tokens")
+	}
+	if _, err := decodeHash(HashTokensVersion, legacy); err == nil {
+		t.Error("decoded a prefixed hash for a version with tokens")
+	}
+	detected, err := decodeHash(UnknownProtocolVersion, legacy)
+	if err != nil {
+		t.Fatal("decoding hash:", err.Error())
+	}
+	writer := NewPacketWriter()
+	writer.SetContext(NewCommunicationContext())
+	writer.Context().ProtocolVersion = HashTokensVersion
+	if err := detected.Serialize(writer, &extendedWriter{new(bytes.Buffer)}); err == nil {
+		t.Error("serialized a hash without tokens for a version with tokens")
+	}
+}
+
+func TestHashCountOfPrefix(t *testing.T) {
+	// a hash count of 0xFF can only be decoded when the version is known
+	data := []byte{0xFF, 0, 0, 0, 0}
+	for i := 0; i < 0xFF; i++ {
+		data = append(data, 0, 0, 0, byte(i))
+	}
+	data = append(data, make([]byte, 3*8)...)
+
+	layer, err := decodeHash(HashTokensVersion, data)
+	if err != nil {
+		t.Fatal("decoding hash:", err.Error())
+	}
+	if len(layer.HashList) != 0xFF || !layer.HasSecurityTokens {
+		t.Errorf("decoded %d hashes, tokens %v", len(layer.HashList), layer.HasSecurityTokens)
+	}
+	if serialized := serializeHash(t, HashTokensVersion, layer); !bytes.Equal(serialized, data) {
+		t.Error("serialized hash differs")
+	}
+}
+
+func TestProtocolSyncSetsVersion(t *testing.T) {
+	sync := &Packet90Layer{
+		SchemaVersion: 40,
+		JoinData:      "placeId=1818",
+		VersionID:     Packet90VersionID{0xFFF, 1, 2, 3, 4},
+	}
+	var buffer bytes.Buffer
+	if err := sync.Serialize(NewPacketWriter(), &extendedWriter{&buffer}); err != nil {
+		t.Fatal("serializing protocol sync:", err.Error())
+	}
+
+	reader := NewPacketReader()
+	reader.SetContext(NewCommunicationContext())
+	if reader.Context().ProtocolVersion.Known() {
+		t.Fatal("new context has a known protocol version")
+	}
+	layers := &PacketLayers{SplitPacket: &SplitPacketBuffer{RealLength: uint32(buffer.Len() + 1)}}
+	_, err := (&extendedReader{bytes.NewReader(buffer.Bytes())}).DecodePacket90Layer(reader, layers)
+	if err != nil {
+		t.Fatal("decoding protocol sync:", err.Error())
+	}
+	if version := reader.Context().ProtocolVersion; version != 40 || !version.AtLeast(HashTokensVersion) || version.AtLeast(41) {
+		t.Errorf("protocol version is %d", version)
+	}
+}
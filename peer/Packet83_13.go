@@ -16,20 +16,24 @@ func (thisStream *extendedReader) DecodePacket83_13(reader PacketReader, layers
 	var err error
 	inner := &Packet83_13{}
 
+	start := layers.fieldStart(thisStream)
 	ref1, err := thisStream.readObject(reader.Context())
 	if err != nil {
 		return inner, err
 	}
-	inner.Instance, err = reader.Context().InstancesByReference.TryGetInstance(ref1)
+	layers.recordField("Instance", thisStream, start)
+	inner.Instance, err = lookupInstance(reader, layers, ref1)
 	if err != nil {
 		return inner, err
 	}
 
+	start = layers.fieldStart(thisStream)
 	ref2, err := thisStream.readObject(reader.Context())
 	if err != nil {
 		return inner, err
 	}
-	inner.Parent, err = reader.Context().InstancesByReference.TryGetInstance(ref2)
+	layers.recordField("Parent", thisStream, start)
+	inner.Parent, err = lookupInstance(reader, layers, ref2)
 	if err != nil && err != datamodel.ErrNullInstance {
 		return inner, err
 	}
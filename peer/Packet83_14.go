@@ -14,14 +14,18 @@ func (thisStream *extendedReader) DecodePacket83_14(reader PacketReader, layers
 	inner := &Packet83_14{}
 	var err error
 
+	start := layers.fieldStart(thisStream)
 	inner.Region, err = thisStream.readStreamInfo()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("Region", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	int1, err := thisStream.readUint32BE()
 	if err != nil {
 		return inner, err
 	}
+	layers.recordField("Int1", thisStream, start)
 	inner.Int1 = int32(int1)
 	return inner, nil
 }
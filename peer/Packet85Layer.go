@@ -72,10 +72,83 @@ func (b *extendedReader) readPhysicsData(data *PhysicsData, motors bool, reader
 	return nil
 }
 
+func (b *extendedReader) decodePhysicsSubpacket(reader PacketReader, layers *PacketLayers, subpacket *Packet85LayerSubpacket) error {
+	start := layers.fieldStart(b)
+	myFlags, err := b.readUint8()
+	if err != nil {
+		return err
+	}
+	layers.recordField("NetworkHumanoidState", b, start)
+	subpacket.NetworkHumanoidState = myFlags & 0x1F
+
+	if reader.IsClient() {
+		start = layers.fieldStart(b)
+		err = b.readPhysicsData(&subpacket.Data, true, reader)
+		if err != nil {
+			return err
+		}
+		layers.recordField("Data", b, start)
+	} else {
+		start = layers.fieldStart(b)
+		subpacket.Data.Motors, err = b.readMotors()
+		if err != nil {
+			return err
+		}
+		layers.recordField("Data.Motors", b, start)
+		numEntries, err := b.readUint8()
+		if err != nil {
+			return err
+		}
+		layers.Root.Logger.Println("reading movement history,", numEntries, "entries")
+		subpacket.History = make([]*PhysicsData, numEntries)
+		for i := 0; i < int(numEntries); i++ {
+			start = layers.fieldStart(b)
+			subpacket.History[i] = new(PhysicsData)
+			subpacket.History[i].Interval, err = b.readFloat32BE()
+			if err != nil {
+				return err
+			}
+			b.readPhysicsData(subpacket.History[i], false, reader)
+			if err != nil {
+				return err
+			}
+			layers.recordField(fmt.Sprintf("History[%d]", i), b, start)
+		}
+	}
+
+	if (myFlags>>5)&1 == 0 { // has children
+		context := reader.Context()
+		var object datamodel.Reference
+		// peerID system shouldn't have caching problems anymore
+		// TODO: remove cache hack
+		start = layers.fieldStart(b)
+		for object, err = b.readObject(context); (err == nil || err == ErrCacheReadOOB) && !object.IsNull; object, err = b.readObject(context) {
+			layers.Root.Logger.Println("reading physics child for ref", object.String())
+			child := new(PhysicsData)
+			// ignore errors
+			child.Instance, _ = context.InstancesByReference.TryGetInstance(object)
+
+			err = b.readPhysicsData(child, true, reader)
+			if err != nil {
+				return err
+			}
+			layers.recordField(fmt.Sprintf("Children[%d]", len(subpacket.Children)), b, start)
+
+			subpacket.Children = append(subpacket.Children, child)
+			start = layers.fieldStart(b)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (b *extendedReader) DecodePacket85Layer(reader PacketReader, layers *PacketLayers) (RakNetPacket, error) {
 	context := reader.Context()
 	layer := &Packet85Layer{}
 	for {
+		start := layers.fieldStart(b)
 		reference, err := b.readObject(reader.Context())
 		if err != nil {
 			return layer, err
@@ -83,67 +156,20 @@ func (b *extendedReader) DecodePacket85Layer(reader PacketReader, layers *Packet
 		if reference.IsNull {
 			break
 		}
+		name := fmt.Sprintf("SubPackets[%d]", len(layer.SubPackets))
+		layers.recordField(name+".Instance", b, start)
 		layers.Root.Logger.Println("reading physics for ref", reference.String())
 		subpacket := &Packet85LayerSubpacket{}
 		// ignore errors
 		subpacket.Data.Instance, _ = context.InstancesByReference.TryGetInstance(reference)
 
-		myFlags, err := b.readUint8()
+		leave := layers.enterField(name)
+		err = b.decodePhysicsSubpacket(reader, layers, subpacket)
+		leave()
 		if err != nil {
 			return layer, err
 		}
-		subpacket.NetworkHumanoidState = myFlags & 0x1F
-
-		if reader.IsClient() {
-			err = b.readPhysicsData(&subpacket.Data, true, reader)
-			if err != nil {
-				return layer, err
-			}
-		} else {
-			subpacket.Data.Motors, err = b.readMotors()
-			if err != nil {
-				return layer, err
-			}
-			numEntries, err := b.readUint8()
-			if err != nil {
-				return layer, err
-			}
-			layers.Root.Logger.Println("reading movement history,", numEntries, "entries")
-			subpacket.History = make([]*PhysicsData, numEntries)
-			for i := 0; i < int(numEntries); i++ {
-				subpacket.History[i] = new(PhysicsData)
-				subpacket.History[i].Interval, err = b.readFloat32BE()
-				if err != nil {
-					return layer, err
-				}
-				b.readPhysicsData(subpacket.History[i], false, reader)
-				if err != nil {
-					return layer, err
-				}
-			}
-		}
-
-		if (myFlags>>5)&1 == 0 { // has children
-			var object datamodel.Reference
-			// peerID system shouldn't have caching problems anymore
-			// TODO: remove cache hack
-			for object, err = b.readObject(reader.Context()); (err == nil || err == ErrCacheReadOOB) && !object.IsNull; object, err = b.readObject(reader.Context()) {
-				layers.Root.Logger.Println("reading physics child for ref", object.String())
-				child := new(PhysicsData)
-				// ignore errors
-				child.Instance, _ = context.InstancesByReference.TryGetInstance(object)
-
-				err = b.readPhysicsData(child, true, reader)
-				if err != nil {
-					return layer, err
-				}
-
-				subpacket.Children = append(subpacket.Children, child)
-			}
-			if err != nil {
-				return layer, err
-			}
-		}
+		layers.recordField(name, b, start)
 
 		layer.SubPackets = append(layer.SubPackets, subpacket)
 	}
@@ -13,7 +13,6 @@ type Packet87Layer struct {
 }
 
 func (thisStream *extendedReader) DecodePacket87Layer(reader PacketReader, layers *PacketLayers) (RakNetPacket, error) {
-	context := reader.Context()
 	layer := &Packet87Layer{}
 	var ref datamodel.Reference
 
@@ -28,7 +27,7 @@ func (thisStream *extendedReader) DecodePacket87Layer(reader PacketReader, layer
 
 	// This reference will never be null
 	ref = datamodel.Reference{Scope: fmt.Sprintf("RBXPID%d", peerID), Id: id, PeerId: uint32(peerID)}
-	layer.Instance, err = context.InstancesByReference.TryGetInstance(ref)
+	layer.Instance, err = lookupInstance(reader, layers, ref)
 	if err != nil {
 		return layer, err
 	}
@@ -27,10 +27,13 @@ func (stream *extendedReader) DecodePacket8ALayer(reader PacketReader, layers *P
 	lenBytes := uint(layers.SplitPacket.RealLength) - 1 // -1 for packet id
 	key := reader.Context().GenerateSubmitTicketKey()
 	layers.Root.Logger.Println("using ticket key", string(key[:]))
+	start := layers.fieldStart(stream)
 	thisStream, err := stream.aesDecrypt(int(lenBytes), reader.Context().GenerateSubmitTicketKey())
 	if err != nil {
 		return layer, err
 	}
+	// the fields can't be told apart in the encrypted payload
+	layers.recordField("Encrypted", stream, start)
 
 	playerID, err := thisStream.readVarsint64()
 	if err != nil {
@@ -277,8 +277,6 @@ func deserializeChunks(stream chunkDeserializer) ([]Chunk, error) {
 func (thisStream *extendedReader) DecodePacket8DLayer(reader PacketReader, layers *PacketLayers) (RakNetPacket, error) {
 	layer := &Packet8DLayer{}
 
-	context := reader.Context()
-
 	reference, err := thisStream.readObject(reader.Context())
 	if err != nil {
 		return nil, err
@@ -286,13 +284,13 @@ func (thisStream *extendedReader) DecodePacket8DLayer(reader PacketReader, layer
 	if reference.IsNull {
 		return nil, errors.New("cluster instance is null")
 	}
-	layer.Instance, err = context.InstancesByReference.TryGetInstance(reference)
+	layer.Instance, err = lookupInstance(reader, layers, reference)
 	if err != nil {
 		return layer, err
 	}
 
 	layers.Root.Logger.Printf("Reading cluster for terrain: %s\n", layer.Instance.Name())
-	zstdStream, err := thisStream.RegionToZStdStream()
+	zstdStream, err := thisStream.RegionToZStdStream(reader.Context())
 	if err != nil {
 		return layer, err
 	}
@@ -498,7 +496,10 @@ func (layer *Packet8DLayer) Serialize(writer PacketWriter, stream *extendedWrite
 		return err
 	}
 
-	zstdStream := stream.wrapZstd()
+	zstdStream, err := stream.wrapZstd(writer.Context())
+	if err != nil {
+		return err
+	}
 
 	err = layer.serializeChunks(zstdStream)
 	if err != nil {
@@ -24,10 +24,13 @@ func (stream *extendedReader) DecodePacket90Layer(reader PacketReader, layers *P
 	layer := &Packet90Layer{}
 
 	lenBytes := uint(layers.SplitPacket.RealLength) - 1 // -1 for packet id
+	start := layers.fieldStart(stream)
 	thisStream, err := stream.aesDecrypt(int(lenBytes), packet90AESKey)
 	if err != nil {
 		return layer, err
 	}
+	// the fields can't be told apart in the encrypted payload
+	layers.recordField("Encrypted", stream, start)
 	layer.Int2, err = thisStream.ReadByte()
 	if err != nil {
 		return layer, err
@@ -36,6 +39,7 @@ func (stream *extendedReader) DecodePacket90Layer(reader PacketReader, layers *P
 	if err != nil {
 		return layer, err
 	}
+	reader.Context().ProtocolVersion = ProtocolVersion(layer.SchemaVersion)
 	layer.Int1, err = thisStream.ReadByte()
 	if err != nil {
 		return layer, err
@@ -11,7 +11,9 @@ func (thisStream *extendedReader) DecodePacket92Layer(reader PacketReader, layer
 	layer := &Packet92Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.PlaceID, err = thisStream.readVarsint64()
+	layers.recordField("PlaceID", thisStream, start)
 	return layer, err
 }
 
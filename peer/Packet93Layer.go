@@ -16,15 +16,15 @@ func (thisStream *extendedReader) DecodePacket93Layer(reader PacketReader, layer
 	layer := &Packet93Layer{}
 	layer.Params = make(map[string]bool)
 
+	start := layers.fieldStart(thisStream)
 	flags, err := thisStream.ReadByte()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("Flags", thisStream, start)
 	layer.ProtocolSchemaSync = flags&1 == 1
 	layer.APIDictionaryCompression = flags&2 == 2
-	if err != nil {
-		return layer, err
-	}
+	reader.Context().APIDictionaryCompression = layer.APIDictionaryCompression
 
 	numParams, err := thisStream.readUint16BE()
 	if err != nil {
@@ -33,6 +33,7 @@ func (thisStream *extendedReader) DecodePacket93Layer(reader PacketReader, layer
 
 	var i uint16
 	for i = 0; i < numParams; i++ {
+		start := layers.fieldStart(thisStream)
 		nameLen, err := thisStream.readUint16BE()
 		if err != nil {
 			return layer, err
@@ -51,6 +52,7 @@ func (thisStream *extendedReader) DecodePacket93Layer(reader PacketReader, layer
 			return layer, err
 		}
 		layer.Params[string(name)] = string(value) == "true"
+		layers.recordField(fmt.Sprintf("Params[%q]", name), thisStream, start)
 	}
 
 	return layer, nil
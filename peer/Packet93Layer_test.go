@@ -0,0 +1,88 @@
+package peer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+var testDictionary = []byte("ReplicatedStorage ReplicatedFirst StarterPlayerScripts StarterCharacterScripts")
+
+func compressRegion(t *testing.T, context *CommunicationContext, data []byte) []byte {
+	var buffer bytes.Buffer
+	zstdStream, err := (&extendedWriter{&buffer}).wrapZstd(context)
+	if err != nil {
+		t.Fatal("creating compressor:", err.Error())
+	}
+	if err = zstdStream.allBytes(data); err != nil {
+		t.Fatal("compressing:", err.Error())
+	}
+	if err = zstdStream.Close(); err != nil {
+		t.Fatal("closing compressor:", err.Error())
+	}
+	return buffer.Bytes()
+}
+
+func decompressRegion(context *CommunicationContext, region []byte) ([]byte, error) {
+	stream, err := (&extendedReader{bytes.NewReader(region)}).RegionToZStdStream(context)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(stream)
+}
+
+func TestDictionaryFormatEnablesCompression(t *testing.T) {
+	var buffer bytes.Buffer
+	format := &Packet93Layer{APIDictionaryCompression: true}
+	writer := NewPacketWriter()
+	writer.SetContext(NewCommunicationContext())
+	if err := format.Serialize(writer, &extendedWriter{&buffer}); err != nil {
+		t.Fatal("serializing dictionary format:", err.Error())
+	}
+	// writers decide what to compress; the verifier serializes with the reader's context
+	if writer.Context().APIDictionaryCompression {
+		t.Error("serializing enabled compression for the writer")
+	}
+
+	reader := NewPacketReader()
+	reader.SetContext(NewCommunicationContext())
+	_, err := (&extendedReader{bytes.NewReader(buffer.Bytes())}).DecodePacket93Layer(reader, &PacketLayers{})
+	if err != nil {
+		t.Fatal("decoding dictionary format:", err.Error())
+	}
+	if !reader.Context().APIDictionaryCompression {
+		t.Error("decoding didn't enable compression for the reader")
+	}
+}
+
+func TestDictionaryCompression(t *testing.T) {
+	data := []byte("ReplicatedStorage.RemoteEvent StarterPlayerScripts.LocalScript ReplicatedFirst")
+
+	plain := NewCommunicationContext()
+	enabled := NewCommunicationContext()
+	enabled.APIDictionaryCompression = true
+	if _, err := (&extendedWriter{new(bytes.Buffer)}).wrapZstd(enabled); err != ErrNoAPIDictionary {
+		t.Errorf("compressing without a dictionary returned %v", err)
+	}
+	if _, err := decompressRegion(enabled, compressRegion(t, plain, data)); err != ErrNoAPIDictionary {
+		t.Errorf("decompressing without a dictionary returned %v", err)
+	}
+	enabled.APIDictionary = testDictionary
+
+	for _, context := range []*CommunicationContext{plain, enabled} {
+		region := compressRegion(t, context, data)
+		decompressed, err := decompressRegion(context, region)
+		if err != nil {
+			t.Errorf("dictionary compression %v: %s", context.APIDictionaryCompression, err.Error())
+			continue
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("dictionary compression %v: decompressed %q", context.APIDictionaryCompression, decompressed)
+		}
+	}
+
+	// a region compressed with the dictionary can't be read as a plain frame
+	if decompressed, err := decompressRegion(plain, compressRegion(t, enabled, data)); err == nil && bytes.Equal(decompressed, data) {
+		t.Error("dictionary was not used")
+	}
+}
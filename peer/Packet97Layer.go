@@ -17,10 +17,13 @@ func (thisStream *extendedReader) DecodePacket97Layer(reader PacketReader, layer
 	}
 
 	var err error
-	stream, err := thisStream.RegionToZStdStream()
+	start := layers.fieldStart(thisStream)
+	stream, err := thisStream.RegionToZStdStream(reader.Context())
 	if err != nil {
 		return layer, err
 	}
+	// the schema can't be located in the compressed region
+	layers.recordField("Schema", thisStream, start)
 
 	enumArrayLen, err := stream.readUintUTF8()
 	if err != nil {
@@ -230,6 +233,7 @@ func (thisStream *extendedReader) DecodePacket97Layer(reader PacketReader, layer
 		layer.Schema.OptimizedStrings[i] = optimizedString
 	}
 
+	layer.Schema.BuildIndex()
 	reader.Context().NetworkSchema = layer.Schema
 
 	return layer, err
@@ -237,9 +241,10 @@ func (thisStream *extendedReader) DecodePacket97Layer(reader PacketReader, layer
 
 // Serialize implements RakNetPacket.Serialize()
 func (layer *Packet97Layer) Serialize(writer PacketWriter, stream *extendedWriter) error {
-	var err error
-
-	zstdStream := stream.wrapZstd()
+	zstdStream, err := stream.wrapZstd(writer.Context())
+	if err != nil {
+		return err
+	}
 	// 1. Close the stream if exiting with an error; report the write error instead of close error
 	// 2. If no error occurs, this function will return zstdStream.Close()
 	// in which case it will be run a second time because of the defer (nop)
@@ -10,8 +10,15 @@ type sequenceState struct {
 type orderingQueue struct {
 	index [32]uint32
 	queue [32]map[uint32]*PacketLayers // TODO: Use linked lists!
+	// started is used by degraded conversations, which
+	// don't know the first ordering index of a channel
+	started [32]bool
 }
 
+// maxOrderingGap is the number of packets that may wait for a missing
+// ordering index in a degraded conversation before the index is skipped
+const maxOrderingGap = 64
+
 func (q *orderingQueue) add(layers *PacketLayers) {
 	packet := layers.Reliability
 	q.queue[packet.OrderingChannel][packet.OrderingIndex] = layers
@@ -36,3 +43,49 @@ func (q *orderingQueue) next(channel uint8) *PacketLayers {
 
 	return nil
 }
+
+// isLate reports whether the ordering index of a packet has already been
+// passed. A channel starts at the first index that is seen on it.
+// Only used in degraded conversations.
+func (q *orderingQueue) isLate(layers *PacketLayers) bool {
+	packet := layers.Reliability
+	if !q.started[packet.OrderingChannel] {
+		q.started[packet.OrderingChannel] = true
+		q.index[packet.OrderingChannel] = packet.OrderingIndex
+		return false
+	}
+	return packet.OrderingIndex < q.index[packet.OrderingChannel]
+}
+
+// skipGap gives up waiting for the next ordering index of a channel if too
+// many packets are queued after it. Incomplete packets before the first
+// complete one are dropped. It returns the first complete packet and the
+// number of indices that were skipped.
+// Only used in degraded conversations.
+func (q *orderingQueue) skipGap(channel uint8) (*PacketLayers, uint32) {
+	queue := q.queue[channel]
+	if len(queue) <= maxOrderingGap {
+		return nil, 0
+	}
+	var first *PacketLayers
+	for _, layers := range queue {
+		if !layers.Reliability.SplitBuffer.IsFinal {
+			continue
+		}
+		if first == nil || layers.Reliability.OrderingIndex < first.Reliability.OrderingIndex {
+			first = layers
+		}
+	}
+	if first == nil {
+		return nil, 0
+	}
+	target := first.Reliability.OrderingIndex
+	for index := range queue {
+		if index < target {
+			delete(queue, index)
+		}
+	}
+	skipped := target - q.index[channel]
+	q.index[channel] = target
+	return first, skipped
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/Gskartwii/roblox-dissector/datamodel"
 	"github.com/robloxapi/rbxfile"
@@ -22,11 +23,13 @@ var packetDecoders = map[byte]decoderFunc{
 	0x7D: (*extendedReader).DecodePacket08Layer,
 	0x00: (*extendedReader).DecodePacket00Layer,
 	0x03: (*extendedReader).DecodePacket03Layer,
+	// ID_DETECT_LOST_CONNECTIONS is an empty keep-alive packet
+	0x04: (*extendedReader).DecodeRawPacket,
 	0x09: (*extendedReader).DecodePacket09Layer,
 	0x10: (*extendedReader).DecodePacket10Layer,
 	0x13: (*extendedReader).DecodePacket13Layer,
 	0x15: (*extendedReader).DecodePacket15Layer,
-	0x1B: (*extendedReader).DecodePacket1BLayer,
+	// ID_TIMESTAMP (0x1B) is decoded by readGeneric
 
 	0x81: (*extendedReader).DecodePacket81Layer,
 	0x83: (*extendedReader).DecodePacket83Layer,
@@ -36,10 +39,16 @@ var packetDecoders = map[byte]decoderFunc{
 	0x87: (*extendedReader).DecodePacket87Layer,
 	0x8A: (*extendedReader).DecodePacket8ALayer,
 	0x8D: (*extendedReader).DecodePacket8DLayer,
+	// The server sends ID_PROTOCOL_MISMATCH, ID_HASH_MISMATCH and
+	// ID_SECURITYKEY_MISMATCH to refuse a client during the join process.
+	// Their format isn't known; captured packets have had no payload.
+	0x8E: (*extendedReader).DecodeRawPacket,
 	0x8F: (*extendedReader).DecodePacket8FLayer,
 	0x90: (*extendedReader).DecodePacket90Layer,
 	0x92: (*extendedReader).DecodePacket92Layer,
 	0x93: (*extendedReader).DecodePacket93Layer,
+	0x94: (*extendedReader).DecodeRawPacket,
+	0x95: (*extendedReader).DecodeRawPacket,
 	0x96: (*extendedReader).DecodePacket96Layer,
 	0x97: (*extendedReader).DecodePacket97Layer,
 	0x98: (*extendedReader).DecodePacket98Layer,
@@ -61,6 +70,8 @@ type PacketReader interface {
 	ContextualHandler
 	SetIsClient(bool)
 	IsClient() bool
+	// Decoders returns the registry of decoders used by the reader
+	Decoders() *DecoderRegistry
 	ReadPacket(payload []byte, layers *PacketLayers)
 }
 
@@ -107,7 +118,15 @@ type DefaultPacketReader struct {
 	// These topics correspond to TypeString() return values
 	DataEmitter *emitter.Emitter
 
+	// RoundTrip checks that the packets read can be serialized back into
+	// the same bytes if it is set. It must be set before reading any packets.
+	RoundTrip *RoundTripVerifier
+	// RecordFields makes the reader record the byte ranges of the decoded
+	// fields in PacketLayers.Fields
+	RecordFields bool
+
 	isClient bool
+	decoders *DecoderRegistry
 
 	rmState      *reliableMessageState
 	sqState      *sequenceState
@@ -125,7 +144,13 @@ func (reader *DefaultPacketReader) SetIsClient(val bool) {
 	reader.isClient = val
 }
 
+// Decoders implements PacketReader.Decoders()
+func (reader *DefaultPacketReader) Decoders() *DecoderRegistry {
+	return reader.decoders
+}
+
 // NewPacketReader initializes a new DefaultPacketReader
+// that uses a copy of DefaultDecoders
 func NewPacketReader() *DefaultPacketReader {
 	var thisQ [32]map[uint32]*PacketLayers
 	for i := 0; i < 32; i++ {
@@ -137,6 +162,7 @@ func NewPacketReader() *DefaultPacketReader {
 		ErrorEmitter:  emitter.New(0),
 		PacketEmitter: emitter.New(0),
 		DataEmitter:   emitter.New(0),
+		decoders:      DefaultDecoders.Clone(),
 		contextualHandler: contextualHandler{
 			caches:        new(Caches),
 			sharedStrings: make(map[string]rbxfile.ValueSharedString),
@@ -171,49 +197,59 @@ func (reader *DefaultPacketReader) readOffline(stream *extendedReader, packetTyp
 	layers.Root.Logger = log.New(layers.Root.logBuffer, "", log.Lmicroseconds|log.Ltime)
 	layers.UniqueID = reader.context.uniqueID
 	reader.context.uniqueID++
-	decoder := packetDecoders[packetType]
-	if decoder != nil {
-		layers.Main, err = decoder(stream, reader, layers)
-		if err != nil {
-			layers.Error = fmt.Errorf("failed to decode offline packet %02X: %s", packetType, err.Error())
-		}
+	decoder := reader.decoders.packets[packetType]
+	if decoder == nil {
+		decoder = (*extendedReader).DecodeRawPacket
+	}
+	start := layers.fieldStart(stream)
+	layers.Main, err = decoder(stream, reader, layers)
+	if err != nil {
+		layers.Error = fmt.Errorf("failed to decode offline packet %02X: %s", packetType, err.Error())
 	} else {
-		layers.Error = fmt.Errorf("unknown offline packet %02X", packetType)
+		layers.recordField(layers.Main.TypeString(), stream, start)
 	}
 }
 
 func (reader *DefaultPacketReader) readGeneric(stream *extendedReader, layers *PacketLayers) {
 	var err error
-	if layers.PacketType == 0x1B { // ID_TIMESTAMP
-		tsLayer, err := packetDecoders[0x1B](stream, reader, layers)
+	// ID_TIMESTAMP prefixes the packet it timestamps. It is reserved in
+	// DecoderRegistry, so it is always decoded here and never from the registry.
+	if layers.PacketType == 0x1B {
+		start := layers.fieldStart(stream)
+		tsLayer, err := stream.DecodePacket1BLayer(reader, layers)
 		if err != nil {
 			layers.Reliability.SplitBuffer.Logger.Println("error:", err.Error())
 			layers.Error = fmt.Errorf("failed to decode timestamped packet: %s", err.Error())
 			return
 		}
+		layers.recordField("Timestamp", stream, start)
 		layers.Timestamp = tsLayer.(*Packet1BLayer)
+		start = layers.fieldStart(stream)
 		packetType, err := stream.ReadByte()
 		if err != nil {
 			layers.Reliability.SplitBuffer.Logger.Println("error:", err.Error())
 			layers.Error = fmt.Errorf("failed to decode timestamped packet: %s", err.Error())
 			return
 		}
+		layers.recordField("PacketType", stream, start)
 		layers.Reliability.SplitBuffer.PacketType = packetType
 		layers.Reliability.SplitBuffer.HasPacketType = true
 		layers.PacketType = packetType
 	}
-	decoder := packetDecoders[layers.PacketType]
+	decoder := reader.decoders.packets[layers.PacketType]
+	if decoder == nil {
+		// Unknown packets are kept as-is
+		decoder = (*extendedReader).DecodeRawPacket
+	}
 	// TODO: Should we really void partial deserializations?
-	if decoder != nil {
-		layers.Main, err = decoder(stream, reader, layers)
-
-		if err != nil {
-			layers.Main = nil
-			layers.Reliability.SplitBuffer.Logger.Println("error:", err.Error())
-			layers.Error = fmt.Errorf("failed to decode reliable packet %02X: %s", layers.PacketType, err.Error())
-		}
+	start := layers.fieldStart(stream)
+	layers.Main, err = decoder(stream, reader, layers)
+	if err == nil {
+		layers.recordField(layers.Main.TypeString(), stream, start)
 	} else {
-		layers.Error = fmt.Errorf("unknown packetType %d", layers.PacketType)
+		layers.Main = nil
+		layers.Reliability.SplitBuffer.Logger.Println("error:", err.Error())
+		layers.Error = fmt.Errorf("failed to decode reliable packet %02X: %s", layers.PacketType, err.Error())
 	}
 }
 
@@ -222,13 +258,23 @@ func (reader *DefaultPacketReader) readOrdered(layers *PacketLayers) {
 	subPacket := layers.Reliability
 	buffer := subPacket.SplitBuffer
 	if buffer.IsFinal {
+		if reader.RecordFields {
+			layers.recorder = &fieldRecorder{source: buffer.byteReader}
+			defer func() { layers.recorder = nil }()
+		}
 		var packetType uint8
+		start := layers.fieldStart(buffer.dataReader)
 		packetType, err = buffer.dataReader.ReadByte()
+		layers.recordField("PacketType", buffer.dataReader, start)
 		if err != nil {
 			subPacket.SplitBuffer.Logger.Println("error:", err.Error())
 			layers.Error = fmt.Errorf("failed to decode reliablePacket type %d: %s", packetType, err.Error())
 		} else {
 			layers.PacketType = packetType
+			var caches Caches
+			if reader.RoundTrip != nil {
+				caches = *reader.caches
+			}
 			reader.readGeneric(buffer.dataReader, layers)
 			byteReader := buffer.byteReader
 
@@ -236,6 +282,9 @@ func (reader *DefaultPacketReader) readOrdered(layers *PacketLayers) {
 			if byteReader.Len() != 0 && layers.Error == nil {
 				layers.Error = fmt.Errorf("parsed packet %02X but still have %d bytes remaining", layers.PacketType, byteReader.Len())
 			}
+			if reader.RoundTrip != nil && layers.Error == nil {
+				reader.RoundTrip.verify(reader, caches, layers, buffer.Data)
+			}
 		}
 
 		// fullreliablehandler, regardless of whether the parsing succeeded or not!
@@ -291,7 +340,19 @@ func (reader *DefaultPacketReader) readReliable(layers *PacketLayers) {
 		case ReliableOrdered:
 			if !hasHandled[thisRelPacket.ReliableMessageNumber] {
 				hasHandled[thisRelPacket.ReliableMessageNumber] = true
-				reader.ordQueue.add(reliablePacketLayers)
+				if reader.context.Degraded {
+					if reader.ordQueue.isLate(reliablePacketLayers) {
+						reliablePacketLayers.degrade("ordering index %d was received after it had been skipped", thisRelPacket.OrderingIndex)
+						reader.readOrdered(reliablePacketLayers)
+						break
+					}
+					reader.ordQueue.add(reliablePacketLayers)
+					if first, skipped := reader.ordQueue.skipGap(subPacket.OrderingChannel); first != nil {
+						first.degrade("skipped %d missing ordering indices on channel %d", skipped, subPacket.OrderingChannel)
+					}
+				} else {
+					reader.ordQueue.add(reliablePacketLayers)
+				}
 
 				reliablePacketLayers = reader.ordQueue.next(subPacket.OrderingChannel)
 				for reliablePacketLayers != nil {
@@ -311,16 +372,35 @@ func (reader *DefaultPacketReader) readReliable(layers *PacketLayers) {
 // ReadPacket reads a single packet and invokes all according handler functions
 func (reader *DefaultPacketReader) ReadPacket(payload []byte, layers *PacketLayers) {
 	var err error
+	// Packets that weren't read from a capture are timestamped on arrival
+	if layers.Root.Timestamp.IsZero() {
+		layers.Root.Timestamp = time.Now()
+	}
 	if IsOfflineMessage(payload) {
 		layers.OfflinePayload = payload
 
 		layers.PacketType = payload[0]
 		layers.OfflinePayload = payload
 		byteReader := bytes.NewReader(payload[1+0x10:])
+		if reader.RecordFields {
+			layers.recorder = &fieldRecorder{source: byteReader, base: 1 + 0x10}
+			layers.Fields = append(layers.Fields,
+				FieldRange{Name: "PacketType", Start: 0, End: 8},
+				FieldRange{Name: "OfflineMessageID", Start: 8, End: (1 + 0x10) * 8},
+			)
+		}
+		var caches Caches
+		if reader.RoundTrip != nil {
+			caches = *reader.caches
+		}
 		reader.readOffline(&extendedReader{byteReader}, layers.PacketType, layers)
 		if byteReader.Len() != 0 && layers.Error == nil {
 			layers.Error = fmt.Errorf("parsed packet %02X but still have %d bytes remaining", layers.PacketType, byteReader.Len())
 		}
+		if reader.RoundTrip != nil && layers.Error == nil {
+			reader.RoundTrip.verify(reader, caches, layers, payload)
+		}
+		layers.recorder = nil
 		reader.emitLayers("offline", layers)
 		return
 	}
@@ -348,7 +428,10 @@ func (reader *DefaultPacketReader) ReadPacket(payload []byte, layers *PacketLaye
 
 // HandlePacket01 is the default handler for ID_REPLIC_DELETE_INSTANCE packets
 func (reader *DefaultPacketReader) HandlePacket01(e *emitter.Event) {
-	packet := e.Args[0].(*Packet83_01)
+	packet, ok := e.Args[0].(*Packet83_01)
+	if !ok {
+		return
+	}
 	// client only REQUESTS that an instance should be deleted
 	if e.Args[1].(*PacketLayers).Root.FromClient {
 		return
@@ -376,7 +459,10 @@ func (reader *DefaultPacketReader) handleReplicationInstance(inst *ReplicationIn
 
 // HandlePacket02 is the default handler for ID_REPLIC_NEW_INSTANCE packets
 func (reader *DefaultPacketReader) HandlePacket02(e *emitter.Event) {
-	packet := e.Args[0].(*Packet83_02)
+	packet, ok := e.Args[0].(*Packet83_02)
+	if !ok {
+		return
+	}
 
 	err := reader.handleReplicationInstance(packet.ReplicationInstance)
 	if err != nil {
@@ -386,7 +472,10 @@ func (reader *DefaultPacketReader) HandlePacket02(e *emitter.Event) {
 
 // HandlePacket03 is the default handler for ID_REPLIC_PROP packets
 func (reader *DefaultPacketReader) HandlePacket03(e *emitter.Event) {
-	packet := e.Args[0].(*Packet83_03)
+	packet, ok := e.Args[0].(*Packet83_03)
+	if !ok {
+		return
+	}
 	if packet.Schema == nil {
 		// Parent handler
 		err := packet.Value.(datamodel.ValueReference).Instance.AddChild(packet.Instance)
@@ -400,13 +489,19 @@ func (reader *DefaultPacketReader) HandlePacket03(e *emitter.Event) {
 
 // HandlePacket07 is the default handler fo ID_REPLIC_EVENT packets
 func (reader *DefaultPacketReader) HandlePacket07(e *emitter.Event) {
-	packet := e.Args[0].(*Packet83_07)
+	packet, ok := e.Args[0].(*Packet83_07)
+	if !ok {
+		return
+	}
 	packet.Instance.FireEvent(packet.Schema.Name, packet.Event.Arguments...)
 }
 
 // HandlePacket0B is the default handler for ID_REPLIC_JOIN_DATA packets
 func (reader *DefaultPacketReader) HandlePacket0B(e *emitter.Event) {
-	packet := e.Args[0].(*Packet83_0B)
+	packet, ok := e.Args[0].(*Packet83_0B)
+	if !ok {
+		return
+	}
 	for _, inst := range packet.Instances {
 		err := reader.handleReplicationInstance(inst)
 		if err != nil {
@@ -418,13 +513,19 @@ func (reader *DefaultPacketReader) HandlePacket0B(e *emitter.Event) {
 
 // HandlePacket13 is the default handler for ID_REPLIC_ATOMIC packets
 func (reader *DefaultPacketReader) HandlePacket13(e *emitter.Event) {
-	packet := e.Args[0].(*Packet83_13)
+	packet, ok := e.Args[0].(*Packet83_13)
+	if !ok {
+		return
+	}
 	packet.Instance.SetParent(packet.Parent)
 }
 
 // HandlePacket81 is the default handler for ID_SET_GLOBALS packets
 func (reader *DefaultPacketReader) HandlePacket81(e *emitter.Event) {
-	packet := e.Args[0].(*Packet81Layer)
+	packet, ok := e.Args[0].(*Packet81Layer)
+	if !ok {
+		return
+	}
 	for _, item := range packet.Items {
 		reader.context.DataModel.AddService(item.Instance)
 	}
@@ -432,6 +533,7 @@ func (reader *DefaultPacketReader) HandlePacket81(e *emitter.Event) {
 
 // BindDataModelHandlers binds the default handlers so that the PacketReader
 // will update the DataModel based on what it reads
+// Packets decoded by a registered PacketCodec are ignored by these handlers.
 func (reader *DefaultPacketReader) BindDataModelHandlers() {
 	reader.PacketEmitter.On("ID_SET_GLOBALS", reader.HandlePacket81, emitter.Void)
 	reader.DataEmitter.On("ID_REPLIC_DELETE_INSTANCE", reader.HandlePacket01, emitter.Void)
@@ -458,7 +560,11 @@ func (reader *DefaultPacketReader) bindDataPacketHandler() {
 	// important: sync!
 	reader.PacketEmitter.On("ID_DATA", func(e *emitter.Event) {
 		layers := e.Args[1].(*PacketLayers)
-		for _, sub := range layers.Main.(*Packet83Layer).SubPackets {
+		data, ok := layers.Main.(*Packet83Layer)
+		if !ok {
+			return
+		}
+		for _, sub := range data.SubPackets {
 			subLayers := &PacketLayers{
 				Root:        layers.Root,
 				RakNet:      layers.RakNet,
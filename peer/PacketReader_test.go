@@ -0,0 +1,140 @@
+package peer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/olebedev/emitter"
+)
+
+// orderedPing returns a datagram containing a single RELIABLE_ORDERED ID_CONNECTED_PING
+func orderedPing(datagramNumber uint32, messageNumber uint32, orderingIndex uint32) []byte {
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint64(data[1:], uint64(orderingIndex))
+	return orderedDatagram(datagramNumber, messageNumber, orderingIndex, data)
+}
+
+// orderedDatagram returns a datagram containing data as a single RELIABLE_ORDERED packet
+func orderedDatagram(datagramNumber uint32, messageNumber uint32, orderingIndex uint32, data []byte) []byte {
+	payload := []byte{0x84}
+	payload = append(payload, byte(datagramNumber), byte(datagramNumber>>8), byte(datagramNumber>>16))
+	payload = append(payload, ReliableOrdered<<5)
+	payload = append(payload, byte(len(data)*8>>8), byte(len(data)*8))
+	payload = append(payload, byte(messageNumber), byte(messageNumber>>8), byte(messageNumber>>16))
+	payload = append(payload, byte(orderingIndex), byte(orderingIndex>>8), byte(orderingIndex>>16), 0)
+	return append(payload, data...)
+}
+
+func TestIsConnectedDatagram(t *testing.T) {
+	if !IsConnectedDatagram(orderedPing(5, 5, 5)) {
+		t.Error("ordered ping was not detected")
+	}
+	if IsConnectedDatagram([]byte{0x84, 0, 0, 0}) {
+		t.Error("empty datagram was detected")
+	}
+	if IsConnectedDatagram([]byte{0xC0, 0, 1, 1, 0, 0, 0}) {
+		t.Error("ACK was detected")
+	}
+	if IsConnectedDatagram(orderedPing(5, 5, 5)[:12]) {
+		t.Error("truncated datagram was detected")
+	}
+}
+
+func TestDegradedOrdering(t *testing.T) {
+	reader := NewPacketReader()
+	context := NewCommunicationContext()
+	context.Degraded = true
+	reader.SetContext(context)
+
+	var read []uint32
+	var degraded int
+	reader.LayerEmitter.On("full-reliable", func(e *emitter.Event) {
+		layers := e.Args[0].(*PacketLayers)
+		read = append(read, layers.Reliability.OrderingIndex)
+		if len(layers.Degradations) != 0 {
+			degraded++
+		}
+	}, emitter.Void)
+	reader.ErrorEmitter.On("*", func(e *emitter.Event) {
+		t.Errorf("decode error: %s", e.Args[0].(*PacketLayers).Error)
+	}, emitter.Void)
+
+	// the capture starts at ordering index 100, and 102 is never received
+	indices := []uint32{100, 99, 101}
+	for i := uint32(103); i <= 103+maxOrderingGap; i++ {
+		indices = append(indices, i)
+	}
+	for i, index := range indices {
+		reader.ReadPacket(orderedPing(uint32(i), uint32(i), index), &PacketLayers{})
+	}
+
+	expected := []uint32{100, 99, 101}
+	for i := uint32(103); i <= 103+maxOrderingGap; i++ {
+		expected = append(expected, i)
+	}
+	if len(read) != len(expected) {
+		t.Fatalf("read %d packets, expected %d: %v", len(read), len(expected), read)
+	}
+	for i := range expected {
+		if read[i] != expected[i] {
+			t.Fatalf("read ordering indices %v, expected %v", read, expected)
+		}
+	}
+	// the late packet and the packet after the gap are flagged
+	if degraded != 2 {
+		t.Errorf("%d packets were flagged, expected 2", degraded)
+	}
+}
+
+func TestSplitTimestamps(t *testing.T) {
+	writer := NewConnectedPeer(NewCommunicationContext(), false)
+	var datagrams [][]byte
+	writer.Output.On("udp", func(e *emitter.Event) {
+		datagrams = append(datagrams, e.Args[0].([]byte))
+	}, emitter.Void)
+	data := make([]byte, 4000)
+	data[0] = 0xFE
+	err := writer.ForwardRaw(&PacketLayers{
+		PacketType:  data[0],
+		Reliability: &ReliablePacket{Reliability: ReliableOrdered},
+		SplitPacket: &SplitPacketBuffer{Data: data},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datagrams) != 3 {
+		t.Fatalf("packet was split into %d datagrams", len(datagrams))
+	}
+
+	reader := NewPacketReader()
+	reader.SetContext(NewCommunicationContext())
+	var read *PacketLayers
+	reader.LayerEmitter.On("full-reliable", func(e *emitter.Event) {
+		read = e.Args[0].(*PacketLayers)
+	}, emitter.Void)
+	reader.ErrorEmitter.On("*", func(e *emitter.Event) {
+		t.Errorf("decode error: %s", e.Args[0].(*PacketLayers).Error)
+	}, emitter.Void)
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	// the timestamps of the splits needn't be in order
+	offsets := []time.Duration{10 * time.Millisecond, 0, 30 * time.Millisecond}
+	for i, datagram := range datagrams {
+		reader.ReadPacket(datagram, &PacketLayers{Root: RootLayer{Timestamp: start.Add(offsets[i])}})
+	}
+
+	if read == nil {
+		t.Fatal("split packet wasn't reassembled")
+	}
+	if !bytes.Equal(read.SplitPacket.Data, data) {
+		t.Error("reassembled data differs")
+	}
+	if !read.SplitPacket.FirstTimestamp.Equal(start) {
+		t.Errorf("first timestamp is %s", read.SplitPacket.FirstTimestamp)
+	}
+	if !read.SplitPacket.LastTimestamp.Equal(start.Add(30 * time.Millisecond)) {
+		t.Errorf("last timestamp is %s", read.SplitPacket.LastTimestamp)
+	}
+}
@@ -2,6 +2,8 @@ package peer
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"sort"
 
 	"github.com/olebedev/emitter"
@@ -38,7 +40,7 @@ type DefaultPacketWriter struct {
 	// Output sends the byte slice to be sent via UDP
 	// It uses the "output" topic
 	Output          *emitter.Emitter
-	orderingIndex   uint32
+	orderingIndex   [32]uint32
 	sequencingIndex uint32
 	splitPacketID   uint16
 	reliableNumber  uint32
@@ -104,8 +106,8 @@ func (writer *DefaultPacketWriter) WriteOffline(packet RakNetPacket) error {
 	}
 	writer.context.uniqueID++
 
-	writer.output(layers.OfflinePayload)
 	<-writer.LayerEmitter.Emit("offline", layers)
+	writer.output(layers.OfflinePayload)
 	return nil
 }
 
@@ -171,7 +173,6 @@ func (writer *DefaultPacketWriter) writeAsSplits(estHeaderLength int, data []byt
 	writer.context.uniqueID++
 	layers.SplitPacket = packet.SplitBuffer
 
-	var lastLayers *PacketLayers
 	for i := 0; i < requiredSplits; i++ {
 		thisPacket := packet.Copy()
 		newLayers := &PacketLayers{
@@ -205,19 +206,21 @@ func (writer *DefaultPacketWriter) writeAsSplits(estHeaderLength int, data []byt
 
 		<-writer.LayerEmitter.Emit("reliability", newLayers)
 		<-writer.LayerEmitter.Emit("reliable", newLayers)
+		// layers are emitted before the datagram carrying them is output
+		if newLayers.SplitPacket.IsFinal {
+			<-writer.LayerEmitter.Emit("full-reliable", newLayers)
+		}
 
 		err = writer.WriteRakNet(newLayers)
 		if err != nil {
 			return err
 		}
-		lastLayers = newLayers
 	}
-	<-writer.LayerEmitter.Emit("full-reliable", lastLayers)
 
 	return nil
 }
 
-func (writer *DefaultPacketWriter) writeReliablePacket(data []byte, layers *PacketLayers, reliability uint8) error {
+func (writer *DefaultPacketWriter) writeReliablePacket(data []byte, layers *PacketLayers, reliability uint8, channel uint8) error {
 	realLen := len(data)
 	estHeaderLength := 0x1C // UDP
 	estHeaderLength += 4    // RakNet
@@ -238,9 +241,9 @@ func (writer *DefaultPacketWriter) writeReliablePacket(data []byte, layers *Pack
 		estHeaderLength += 3
 	}
 	if reliability == 1 || reliability == 3 || reliability == 4 || reliability == 7 {
-		packet.OrderingChannel = 0
-		packet.OrderingIndex = writer.orderingIndex
-		writer.orderingIndex++
+		packet.OrderingChannel = channel
+		packet.OrderingIndex = writer.orderingIndex[channel]
+		writer.orderingIndex[channel]++
 		estHeaderLength += 7
 	}
 
@@ -304,7 +307,7 @@ func (writer *DefaultPacketWriter) writeTimestamped(layers *PacketLayers, reliab
 		return err
 	}
 
-	err = writer.writeReliablePacket(buffer.Bytes(), layers, reliability)
+	err = writer.writeReliablePacket(buffer.Bytes(), layers, reliability, 0)
 
 	return err
 }
@@ -323,7 +326,7 @@ func (writer *DefaultPacketWriter) writeGeneric(layers *PacketLayers, reliabilit
 		return err
 	}
 
-	err = writer.writeReliablePacket(buffer.Bytes(), layers, reliability)
+	err = writer.writeReliablePacket(buffer.Bytes(), layers, reliability, 0)
 
 	return err
 }
@@ -349,6 +352,44 @@ func (writer *DefaultPacketWriter) WriteTimestamped(timestamp *Packet1BLayer, ge
 	return writer.writeTimestamped(layers, Unreliable)
 }
 
+// ForwardRaw writes the reassembled data of a packet that was read by a PacketReader
+// verbatim, keeping its reliability and ordering channel. It is meant for packets
+// that couldn't be decoded or serialized; the decoding error is carried over to the
+// emitted layers.
+func (writer *DefaultPacketWriter) ForwardRaw(source *PacketLayers) error {
+	if source.SplitPacket == nil || len(source.SplitPacket.Data) == 0 {
+		return errors.New("no raw data to forward")
+	}
+	channel := source.Reliability.OrderingChannel
+	if channel >= 32 {
+		return fmt.Errorf("invalid ordering channel %d", channel)
+	}
+	layers := &PacketLayers{
+		Timestamp:  source.Timestamp,
+		PacketType: source.PacketType,
+		Error:      source.Error,
+	}
+	if layers.Error == nil {
+		layers.Error = fmt.Errorf("forwarded undecoded packet %02X", layers.PacketType)
+	}
+	return writer.writeReliablePacket(source.SplitPacket.Data, layers, source.Reliability.Reliability, channel)
+}
+
+// forwardsRaw reports whether a packet read by a PacketReader must be passed to
+// ForwardRaw, because it wasn't decoded or its layer has no serializer
+func forwardsRaw(layers *PacketLayers) bool {
+	if layers.Error != nil || layers.Main == nil {
+		return true
+	}
+	switch main := layers.Main.(type) {
+	case *RawPacket:
+		return true
+	case *CustomPacket:
+		return main.Codec.Serialize == nil
+	}
+	return false
+}
+
 // WriteACKs writes an ACK/NAK packet for the given datagram numbers
 func (writer *DefaultPacketWriter) WriteACKs(datagrams []int, isNAK bool) error {
 	var ackStructure []ACKRange
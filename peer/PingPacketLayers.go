@@ -14,7 +14,9 @@ func (thisStream *extendedReader) DecodePacket00Layer(reader PacketReader, layer
 	layer := &Packet00Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.SendPingTime, err = thisStream.readUint64BE()
+	layers.recordField("SendPingTime", thisStream, start)
 
 	return layer, err
 }
@@ -49,11 +51,15 @@ func (thisStream *extendedReader) DecodePacket03Layer(reader PacketReader, layer
 	layer := &Packet03Layer{}
 
 	var err error
+	start := layers.fieldStart(thisStream)
 	layer.SendPingTime, err = thisStream.readUint64BE()
 	if err != nil {
 		return layer, err
 	}
+	layers.recordField("SendPingTime", thisStream, start)
+	start = layers.fieldStart(thisStream)
 	layer.SendPongTime, err = thisStream.readUint64BE()
+	layers.recordField("SendPongTime", thisStream, start)
 
 	return layer, err
 }
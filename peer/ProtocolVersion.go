@@ -0,0 +1,35 @@
+package peer
+
+// ProtocolVersion identifies the packet formats used in a communication.
+// It is the SchemaVersion the client sends in ID_PROTOCOL_SYNC.
+//
+// ID_OPEN_CONNECTION_REQUEST_1 has a protocol version too, but it is the
+// version of RakNet, which is 5 for all Roblox protocol versions.
+// It therefore isn't used to choose packet formats.
+type ProtocolVersion uint32
+
+// UnknownProtocolVersion is used until ID_PROTOCOL_SYNC has been read.
+// Decoders then detect the format from the data where they can,
+// and serializers follow the decoded layer. With a known version,
+// the version alone decides the format.
+const UnknownProtocolVersion ProtocolVersion = 0
+
+// HashTokensVersion is the first protocol version whose ID_REPLIC_HASH
+// subpackets carry security tokens. Older versions prefix the hash count
+// with 0xFF and send no tokens.
+//
+// Version 36 is the version of the captures the token format was implemented
+// from; their ID_SUBMIT_TICKET reports it as Packet8ALayer.ProtocolVersion.
+// The prefixed format predates it, but no capture of the last version
+// without tokens is available, so an older boundary can't be ruled out.
+const HashTokensVersion ProtocolVersion = 36
+
+// Known reports whether the version has been read from ID_PROTOCOL_SYNC
+func (version ProtocolVersion) Known() bool {
+	return version != UnknownProtocolVersion
+}
+
+// AtLeast reports whether the version is known and not older than min
+func (version ProtocolVersion) AtLeast(min ProtocolVersion) bool {
+	return version.Known() && version >= min
+}
@@ -2,7 +2,9 @@ package peer
 
 import (
 	"context"
+	"errors"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/olebedev/emitter"
@@ -36,9 +38,134 @@ type ProxyWriter struct {
 	SecuritySettings SecurityHandler
 	RuntimeContext   context.Context
 
+	// Intercept, if set, is called for every decoded packet before it is forwarded.
+	// Packets for which it returns true are held until they are released or dropped.
+	// Packets going in the same direction are queued behind a held packet
+	// so that their order is preserved.
+	Intercept func(*PacketLayers) bool
+	// HoldEmitter emits "held" with a *HeldPacket whenever a packet is intercepted
+	HoldEmitter *emitter.Emitter
+
+	toServer *holdQueue
+	toClient *holdQueue
+
 	ackTicker *time.Ticker
 }
 
+// HeldPacket describes a packet that has been intercepted by a ProxyWriter.
+// Its Main layer may be modified before it is released.
+type HeldPacket struct {
+	Layers *PacketLayers
+	// FromClient is true if the packet is on its way to the server
+	FromClient bool
+
+	queue    *holdQueue
+	resolved bool
+	dropped  bool
+}
+
+// Release forwards the held packet along with any packets
+// that were queued behind it
+func (held *HeldPacket) Release() error {
+	return held.queue.resolve(held, false)
+}
+
+// Drop discards the held packet and forwards any packets
+// that were queued behind it
+func (held *HeldPacket) Drop() error {
+	return held.queue.resolve(held, true)
+}
+
+type holdQueue struct {
+	sync.Mutex
+	fromClient bool
+	write      func(*PacketLayers) error
+	packets    []*HeldPacket
+}
+
+func newHoldQueue(fromClient bool, dest *ProxyHalf) *holdQueue {
+	return &holdQueue{
+		fromClient: fromClient,
+		write: func(layers *PacketLayers) error {
+			if forwardsRaw(layers) {
+				return dest.ForwardRaw(layers)
+			}
+			if layers.PacketType == 0x85 {
+				return dest.WriteTimestamped(layers.Timestamp, layers.Main.(*Packet85Layer))
+			}
+			return dest.WritePacket(layers.Main)
+		},
+	}
+}
+
+// push writes the packet immediately if nothing is being held.
+// Otherwise it is queued, and if hold is set, a HeldPacket is returned.
+func (queue *holdQueue) push(layers *PacketLayers, hold bool) (*HeldPacket, error) {
+	queue.Lock()
+	defer queue.Unlock()
+	if !hold && len(queue.packets) == 0 {
+		return nil, queue.write(layers)
+	}
+	held := &HeldPacket{
+		Layers:     layers,
+		FromClient: queue.fromClient,
+		queue:      queue,
+		resolved:   !hold,
+	}
+	queue.packets = append(queue.packets, held)
+	if !hold {
+		return nil, nil
+	}
+	return held, nil
+}
+
+func (queue *holdQueue) resolve(held *HeldPacket, drop bool) error {
+	queue.Lock()
+	defer queue.Unlock()
+	if held.resolved {
+		return errors.New("packet has already been released or dropped")
+	}
+	held.resolved = true
+	held.dropped = drop
+
+	var firstErr error
+	for len(queue.packets) > 0 && queue.packets[0].resolved {
+		next := queue.packets[0]
+		queue.packets = queue.packets[1:]
+		if next.dropped {
+			continue
+		}
+		err := queue.write(next.Layers)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// dropAll drops every queued packet, as if Drop had been called on the held
+// ones, but without writing the packets queued behind them. It is called when
+// the proxy shuts down, as held packets would otherwise never be resolved.
+func (queue *holdQueue) dropAll() {
+	queue.Lock()
+	defer queue.Unlock()
+	for _, held := range queue.packets {
+		held.resolved = true
+		held.dropped = true
+	}
+	queue.packets = nil
+}
+
+func (writer *ProxyWriter) forward(queue *holdQueue, layers *PacketLayers) error {
+	// undecoded packets can't be inspected, but they still queue behind held packets
+	hold := writer.Intercept != nil && layers.Error == nil && layers.Main != nil && writer.Intercept(layers)
+	held, err := queue.push(layers, hold)
+	if held != nil {
+		<-writer.HoldEmitter.Emit("held", held)
+	}
+	return err
+}
+
 func (writer *ProxyWriter) startAcker() {
 	writer.ackTicker = time.NewTicker(16 * time.Millisecond)
 	go func() {
@@ -66,15 +193,19 @@ func NewProxyWriter(ctx context.Context) *ProxyWriter {
 	context := NewCommunicationContext()
 	writer := &ProxyWriter{
 		RuntimeContext: ctx,
+		HoldEmitter:    emitter.New(0),
 	}
 	clientHalf := NewProxyHalf(context, true)
 	serverHalf := NewProxyHalf(context, false)
+	writer.toServer = newHoldQueue(true, serverHalf)
+	writer.toClient = newHoldQueue(false, clientHalf)
 
 	// Set FromServer/Client appropriately
 	clientHalf.DefaultPacketWriter.LayerEmitter.On("*", func(e *emitter.Event) {
 		e.Args[0].(*PacketLayers).Root = RootLayer{
 			FromServer:  true,
 			Logger:      nil,
+			Timestamp:   time.Now(),
 			Source:      writer.ServerAddr,
 			Destination: writer.ClientAddr,
 		}
@@ -83,6 +214,7 @@ func NewProxyWriter(ctx context.Context) *ProxyWriter {
 		e.Args[0].(*PacketLayers).Root = RootLayer{
 			FromClient:  true,
 			Logger:      nil,
+			Timestamp:   time.Now(),
 			Source:      writer.ServerAddr,
 			Destination: writer.ClientAddr,
 		}
@@ -120,21 +252,7 @@ func NewProxyWriter(ctx context.Context) *ProxyWriter {
 			println("Disconnected by client!!")
 			return
 		}
-		if layers.Error != nil {
-			println("client error: ", layers.Error.Error())
-			return
-		}
-		if layers.Main == nil {
-			println("Dropping unknown packettype", packetType)
-			return
-		}
-		switch packetType {
-		case 0x85:
-			mainLayer := layers.Main.(*Packet85Layer)
-			err = serverHalf.WriteTimestamped(layers.Timestamp, mainLayer)
-		default:
-			err = serverHalf.WritePacket(layers.Main.(RakNetPacket))
-		}
+		err = writer.forward(writer.toServer, layers)
 		if err != nil {
 			println("client error:", err.Error())
 		}
@@ -144,21 +262,7 @@ func NewProxyWriter(ctx context.Context) *ProxyWriter {
 		var err error
 		layers := e.Args[0].(*PacketLayers)
 		packetType := layers.PacketType
-		if layers.Error != nil {
-			println("server error: ", layers.Error.Error())
-			return
-		}
-		if layers.Main == nil {
-			println("dropping nil packet??", packetType)
-			return
-		}
-		switch packetType {
-		case 0x85:
-			mainLayer := layers.Main.(*Packet85Layer)
-			err = clientHalf.WriteTimestamped(layers.Timestamp, mainLayer)
-		default:
-			err = clientHalf.WritePacket(layers.Main.(RakNetPacket))
-		}
+		err = writer.forward(writer.toClient, layers)
 		if err != nil {
 			println("server serialize error: ", err.Error())
 			return
@@ -168,6 +272,22 @@ func NewProxyWriter(ctx context.Context) *ProxyWriter {
 			println("Disconnected by server!!")
 		}
 	}, emitter.Void)
+	// Packets that fail to decode are forwarded verbatim so that
+	// decoder bugs don't break the session
+	clientHalf.DefaultPacketReader.ErrorEmitter.On("full-reliable", func(e *emitter.Event) {
+		layers := e.Args[0].(*PacketLayers)
+		err := writer.forward(writer.toServer, layers)
+		if err != nil {
+			println("client raw passthrough error:", err.Error())
+		}
+	}, emitter.Void)
+	serverHalf.DefaultPacketReader.ErrorEmitter.On("full-reliable", func(e *emitter.Event) {
+		layers := e.Args[0].(*PacketLayers)
+		err := writer.forward(writer.toClient, layers)
+		if err != nil {
+			println("server raw passthrough error:", err.Error())
+		}
+	}, emitter.Void)
 	clientHalf.DefaultPacketReader.ErrorEmitter.On("*", func(e *emitter.Event) {
 		println("client error on topic", e.OriginalTopic+":", e.Args[0].(*PacketLayers).Error.Error())
 	}, emitter.Void)
@@ -184,6 +304,11 @@ func NewProxyWriter(ctx context.Context) *ProxyWriter {
 	writer.ServerHalf = serverHalf
 
 	writer.startAcker()
+	go func() {
+		<-ctx.Done()
+		writer.toServer.dropAll()
+		writer.toClient.dropAll()
+	}()
 
 	return writer
 }
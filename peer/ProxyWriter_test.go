@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"testing"
+	"time"
 
 	"github.com/olebedev/emitter"
 )
@@ -49,3 +51,123 @@ func ExampleProxyWriter() {
 	})
 	// Output: Write 0500FFFF00FEFEFEFEFDFDFDFD123456780500000000000000000000 to server (30.40.50.60:50000)
 }
+
+func TestHoldQueueOrdering(t *testing.T) {
+	var written []byte
+	queue := &holdQueue{
+		write: func(layers *PacketLayers) error {
+			written = append(written, layers.PacketType)
+			return nil
+		},
+	}
+
+	queue.push(&PacketLayers{PacketType: 1}, false)
+	first, _ := queue.push(&PacketLayers{PacketType: 2}, true)
+	queue.push(&PacketLayers{PacketType: 3}, false)
+	second, _ := queue.push(&PacketLayers{PacketType: 4}, true)
+	queue.push(&PacketLayers{PacketType: 5}, false)
+
+	if !bytes.Equal(written, []byte{1}) {
+		t.Fatalf("packets behind a held packet were written: %v", written)
+	}
+	if err := second.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, []byte{1}) {
+		t.Fatalf("released packet overtook a held packet: %v", written)
+	}
+	if err := first.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, []byte{1, 3, 4, 5}) {
+		t.Errorf("unexpected write order: %v", written)
+	}
+	if first.Release() == nil {
+		t.Error("releasing a dropped packet should fail")
+	}
+}
+
+func TestProxyForwardsUndecodedPackets(t *testing.T) {
+	proxy := NewProxyWriter(context.TODO())
+	client := NewConnectedPeer(NewCommunicationContext(), false)
+	server := NewConnectedPeer(NewCommunicationContext(), true)
+
+	client.Output.On("udp", func(e *emitter.Event) {
+		proxy.ProxyClient(e.Args[0].([]byte), &PacketLayers{Root: RootLayer{FromClient: true}})
+	}, emitter.Void)
+	proxy.ServerHalf.Output.On("udp", func(e *emitter.Event) {
+		server.ReadPacket(e.Args[0].([]byte), &PacketLayers{Root: RootLayer{FromClient: true}})
+	}, emitter.Void)
+
+	var received *PacketLayers
+	receive := func(e *emitter.Event) {
+		received = e.Args[0].(*PacketLayers)
+	}
+	server.DefaultPacketReader.LayerEmitter.On("full-reliable", receive, emitter.Void)
+	server.DefaultPacketReader.ErrorEmitter.On("full-reliable", receive, emitter.Void)
+
+	for channel, data := range [][]byte{
+		// packets without a decoder are read as RawPacket
+		{0xFE, 0x01, 0x02, 0x03},
+		// a truncated ID_PLACEID_VERIFICATION can't be decoded
+		{0x92, 0x80},
+	} {
+		received = nil
+		err := client.ForwardRaw(&PacketLayers{
+			PacketType:  data[0],
+			Reliability: &ReliablePacket{Reliability: ReliableOrdered, OrderingChannel: uint8(channel + 3)},
+			SplitPacket: &SplitPacketBuffer{Data: data},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if received == nil {
+			t.Fatalf("packet %02X was not forwarded", data[0])
+		}
+		if !bytes.Equal(received.SplitPacket.Data, data) {
+			t.Errorf("forwarded data %X, expected %X", received.SplitPacket.Data, data)
+		}
+		if received.Reliability.Reliability != ReliableOrdered || int(received.Reliability.OrderingChannel) != channel+3 {
+			t.Errorf("reliability %d on channel %d was not preserved", received.Reliability.Reliability, received.Reliability.OrderingChannel)
+		}
+	}
+}
+
+func TestProxyDropsHeldPacketsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	proxy := NewProxyWriter(ctx)
+	proxy.Intercept = func(*PacketLayers) bool {
+		return true
+	}
+	var held *HeldPacket
+	proxy.HoldEmitter.On("held", func(e *emitter.Event) {
+		held = e.Args[0].(*HeldPacket)
+	}, emitter.Void)
+
+	err := proxy.forward(proxy.toServer, &PacketLayers{PacketType: 0x00, Main: &Packet00Layer{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held == nil {
+		t.Fatal("packet wasn't held")
+	}
+	cancel()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		proxy.toServer.Lock()
+		queued := len(proxy.toServer.packets)
+		proxy.toServer.Unlock()
+		if queued == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("held packet wasn't dropped on shutdown")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if held.Release() == nil {
+		t.Error("releasing a packet dropped on shutdown should fail")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"log"
 	"net"
 	"strings"
+	"time"
 )
 
 func bufferToStream(buffer []byte) *extendedReader {
@@ -33,6 +34,8 @@ type RootLayer struct {
 	Destination *net.UDPAddr
 	FromClient  bool
 	FromServer  bool
+	// Timestamp is the time when the datagram was captured or received
+	Timestamp time.Time
 }
 
 // GetLog returns the accumulated log string for a packet
@@ -60,6 +63,13 @@ type PacketLayers struct {
 	Main RakNetPacket
 	// Possible parsing error?
 	Error error
+	// Degradations lists the parts of the packet that could only be decoded
+	// partially because the conversation was picked up after it had started
+	Degradations []string
+	// Fields lists the parts of the payload each decoded field was read from.
+	// It is only filled in if the reader records fields.
+	Fields   []FieldRange
+	recorder *fieldRecorder
 
 	// First byte of the packet payload. Note that this might not be initialized for split packets.
 	PacketType byte
@@ -70,6 +80,15 @@ type PacketLayers struct {
 	UniqueID uint64
 }
 
+// degrade records that a part of the packet could only be decoded partially
+func (layers *PacketLayers) degrade(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	layers.Degradations = append(layers.Degradations, message)
+	if layers.Root.Logger != nil {
+		layers.Root.Logger.Println("degraded:", message)
+	}
+}
+
 // PacketNames contains the names of most packet types
 var PacketNames = map[byte]string{
 	0x00: "ID_CONNECTED_PING",
@@ -164,6 +183,39 @@ func IsOfflineMessage(data []byte) bool {
 	return bytes.Equal(data[1:1+len(OfflineMessageID)], OfflineMessageID)
 }
 
+// maxHeuristicSplits is the largest split count accepted by IsConnectedDatagram
+const maxHeuristicSplits = 0x10000
+
+// IsConnectedDatagram reports whether payload is a well-formed connected RakNet
+// datagram that carries at least one packet. It can be used to pick up
+// conversations whose offline handshake wasn't captured.
+func IsConnectedDatagram(payload []byte) bool {
+	if len(payload) < 4 || IsOfflineMessage(payload) {
+		return false
+	}
+	layers := &PacketLayers{}
+	rakNetLayer, err := bufferToStream(payload).DecodeRakNetLayer(nil, payload[0], layers)
+	if err != nil || rakNetLayer.Flags.IsACK || rakNetLayer.Flags.IsNAK {
+		return false
+	}
+	layers.RakNet = rakNetLayer
+	reliabilityLayer, err := rakNetLayer.payload.DecodeReliabilityLayer(nil, layers)
+	if err != nil || len(reliabilityLayer.Packets) == 0 {
+		return false
+	}
+	for _, packet := range reliabilityLayer.Packets {
+		if packet.Reliability > ReliableSequenced {
+			return false
+		}
+		if packet.HasSplitPacket && (packet.SplitPacketCount == 0 ||
+			packet.SplitPacketCount > maxHeuristicSplits ||
+			packet.SplitPacketIndex >= packet.SplitPacketCount) {
+			return false
+		}
+	}
+	return true
+}
+
 func (stream *extendedReader) DecodeRakNetLayer(reader PacketReader, packetType byte, layers *PacketLayers) (*RakNetLayer, error) {
 	layer := &RakNetLayer{}
 
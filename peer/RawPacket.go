@@ -0,0 +1,52 @@
+package peer
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// RawPacket represents a packet whose format is not known.
+// Its payload is kept as-is, so that it can be serialized without changes.
+type RawPacket struct {
+	PacketType byte
+	// Payload contains the bytes after the packet type
+	Payload []byte
+}
+
+// DecodeRawPacket reads the rest of the stream into a RawPacket.
+// It is used for packet types that have no decoder, and is registered
+// for named packet types whose format isn't known.
+func (thisStream *extendedReader) DecodeRawPacket(reader PacketReader, layers *PacketLayers) (RakNetPacket, error) {
+	layer := &RawPacket{PacketType: layers.PacketType}
+
+	var err error
+	start := layers.fieldStart(thisStream)
+	layer.Payload, err = ioutil.ReadAll(thisStream)
+	layers.recordField("Payload", thisStream, start)
+	return layer, err
+}
+
+// Serialize implements RakNetPacket.Serialize()
+func (layer *RawPacket) Serialize(writer PacketWriter, stream *extendedWriter) error {
+	return stream.allBytes(layer.Payload)
+}
+
+func (layer *RawPacket) String() string {
+	if len(layer.Payload) == 0 {
+		return layer.TypeString()
+	}
+	return fmt.Sprintf("%s: %d bytes", layer.TypeString(), len(layer.Payload))
+}
+
+// TypeString implements RakNetPacket.TypeString()
+func (layer *RawPacket) TypeString() string {
+	if name, ok := PacketNames[layer.PacketType]; ok {
+		return name
+	}
+	return fmt.Sprintf("Packet 0x%02X", layer.PacketType)
+}
+
+// Type implements RakNetPacket.Type()
+func (layer *RawPacket) Type() byte {
+	return layer.PacketType
+}
@@ -0,0 +1,55 @@
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/olebedev/emitter"
+)
+
+func TestRawPacket(t *testing.T) {
+	reader := NewPacketReader()
+	reader.SetContext(NewCommunicationContext())
+
+	var read []*PacketLayers
+	reader.LayerEmitter.On("full-reliable", func(e *emitter.Event) {
+		read = append(read, e.Args[0].(*PacketLayers))
+	}, emitter.Void)
+	reader.ErrorEmitter.On("*", func(e *emitter.Event) {
+		t.Errorf("decode error: %s", e.Args[0].(*PacketLayers).Error)
+	}, emitter.Void)
+
+	// ID_CHAT_TEAM has no decoder
+	data := []byte{0x88, 1, 2, 3, 0xFF}
+	reader.ReadPacket(orderedDatagram(0, 0, 0, data), &PacketLayers{})
+	// ID_PROTOCOL_MISMATCH is usually empty
+	reader.ReadPacket(orderedDatagram(1, 1, 1, []byte{0x8E}), &PacketLayers{})
+	reader.ReadPacket(orderedDatagram(2, 2, 2, []byte{0x94, 7, 8}), &PacketLayers{})
+	if len(read) != 3 {
+		t.Fatalf("read %d packets", len(read))
+	}
+
+	raw, ok := read[0].Main.(*RawPacket)
+	if !ok {
+		t.Fatalf("main layer is %T", read[0].Main)
+	}
+	if raw.Type() != 0x88 || raw.TypeString() != "ID_CHAT_TEAM" || !bytes.Equal(raw.Payload, data[1:]) {
+		t.Errorf("decoded %02X %s %v", raw.Type(), raw.TypeString(), raw.Payload)
+	}
+	var buffer bytes.Buffer
+	err := raw.Serialize(nil, &extendedWriter{&buffer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buffer.Bytes(), data[1:]) {
+		t.Errorf("serialized %v", buffer.Bytes())
+	}
+
+	if mismatch, ok := read[1].Main.(*RawPacket); !ok || len(mismatch.Payload) != 0 || mismatch.String() != "ID_PROTOCOL_MISMATCH" {
+		t.Errorf("main layer is %T %v", read[1].Main, read[1].Main)
+	}
+	// unexpected trailing bytes are kept
+	if mismatch, ok := read[2].Main.(*RawPacket); !ok || mismatch.TypeString() != "ID_HASH_MISMATCH" || !bytes.Equal(mismatch.Payload, []byte{7, 8}) {
+		t.Errorf("main layer is %T %v", read[2].Main, read[2].Main)
+	}
+}
@@ -45,11 +45,15 @@ func decodeReplicationInstance(reader PacketReader, thisStream instanceReader, l
 	}
 	var reference datamodel.Reference
 	context := reader.Context()
+	// join data is compressed, so only uncompressed instances have fields
+	stream, _ := thisStream.(*extendedReader)
 
+	start := layers.fieldStart(stream)
 	reference, err = thisStream.readObject(reader.Context())
 	if err != nil {
 		return nil, errors.New("while parsing self: " + err.Error())
 	}
+	layers.recordField("Instance", stream, start)
 	if reference.IsNull {
 		return nil, errors.New("self is nil in decodeReplicationInstance")
 	}
@@ -59,10 +63,15 @@ func decodeReplicationInstance(reader PacketReader, thisStream instanceReader, l
 	}
 	repInstance.Instance = thisInstance
 
+	start = layers.fieldStart(stream)
 	schemaIDx, err := thisStream.readUint16BE()
 	if err != nil {
 		return nil, err
 	}
+	layers.recordField("Schema", stream, start)
+	if context.NetworkSchema == nil {
+		return repInstance, ErrNoSchema
+	}
 	if int(schemaIDx) > len(context.NetworkSchema.Instances) {
 		return repInstance, fmt.Errorf("class idx %d is higher than %d", schemaIDx, len(context.NetworkSchema.Instances))
 	}
@@ -71,11 +80,14 @@ func decodeReplicationInstance(reader PacketReader, thisStream instanceReader, l
 	thisInstance.ClassName = schema.Name
 	layers.Root.Logger.Println("will parse", reference.String(), schema.Name, len(schema.Properties))
 
+	start = layers.fieldStart(stream)
 	repInstance.DeleteOnDisconnect, err = thisStream.readBoolByte()
 	if err != nil {
 		return repInstance, err
 	}
+	layers.recordField("DeleteOnDisconnect", stream, start)
 
+	start = layers.fieldStart(stream)
 	err = thisStream.ReadProperties(schema.Properties, repInstance.Properties, reader, deferred)
 	if err != nil {
 		return repInstance, err
@@ -87,11 +99,14 @@ func decodeReplicationInstance(reader PacketReader, thisStream instanceReader, l
 			return repInstance, err
 		}
 	}
+	layers.recordField("Properties", stream, start)
 
+	start = layers.fieldStart(stream)
 	reference, err = thisStream.readObject(reader.Context())
 	if err != nil {
 		return repInstance, errors.New("while parsing parent: " + err.Error())
 	}
+	layers.recordField("Parent", stream, start)
 	if len(reference.String()) > 0x50 {
 		layers.Root.Logger.Println("Parent: (invalid), ", len(reference.String()))
 	} else {
@@ -108,6 +123,12 @@ func decodeReplicationInstance(reader PacketReader, thisStream instanceReader, l
 			}
 			parent.ClassName = "DataModel"
 			repInstance.Parent = parent
+		} else if err == datamodel.ErrInstanceDoesntExist && context.Degraded {
+			layers.degrade("unknown parent %s", reference.String())
+			parent, err = context.InstancesByReference.CreateInstance(reference)
+			if err != nil {
+				return repInstance, err
+			}
 		} else {
 			return repInstance, err
 		}
@@ -0,0 +1,184 @@
+package peer
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// RoundTripMismatch describes a packet or ID_DATA subpacket whose
+// serialization differs from the bytes it was decoded from
+type RoundTripMismatch struct {
+	TypeString string
+	// UniqueID is the UniqueID of the PacketLayers the packet was decoded into
+	UniqueID uint64
+	// Offset is the offset of the first differing byte
+	Offset int
+	// Original contains the bytes the packet was decoded from.
+	// For ID_DATA subpackets, it contains the rest of the ID_DATA packet.
+	Original   []byte
+	Serialized []byte
+	// Err is set if the packet couldn't be serialized
+	Err error
+}
+
+// RoundTripStats counts the packets of one type checked by a RoundTripVerifier
+type RoundTripStats struct {
+	TypeString string
+	Checked    int
+	Mismatched int
+}
+
+// RoundTripVerifier re-serializes the packets read by a DefaultPacketReader and
+// compares the result with the bytes that were read. This can be used to validate
+// the serializers against real traffic.
+// The verifier serializes packets using a shadow writer that shares the reader's
+// context. Its caches are reset to the state the reader's caches were in before
+// each packet was read.
+// Note that packets containing compressed data may legitimately differ.
+type RoundTripVerifier struct {
+	// OnMismatch is called for every mismatch if it is set.
+	// It is called on the goroutine that reads the packets.
+	OnMismatch func(*RoundTripMismatch)
+
+	writer *DefaultPacketWriter
+	mutex  sync.Mutex
+	stats  map[string]*RoundTripStats
+}
+
+// NewRoundTripVerifier creates a RoundTripVerifier. Each reader needs its own verifier.
+func NewRoundTripVerifier() *RoundTripVerifier {
+	return &RoundTripVerifier{
+		writer: NewPacketWriter(),
+		stats:  make(map[string]*RoundTripStats),
+	}
+}
+
+// Stats returns the results for each packet and subpacket type,
+// sorted by TypeString
+func (verifier *RoundTripVerifier) Stats() []RoundTripStats {
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	result := make([]RoundTripStats, 0, len(verifier.stats))
+	for _, stats := range verifier.stats {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TypeString < result[j].TypeString
+	})
+	return result
+}
+
+func firstDifference(a []byte, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) < len(b) {
+		return len(a)
+	}
+	return len(b)
+}
+
+// report records the result of checking one packet or subpacket
+func (verifier *RoundTripVerifier) report(typeString string, mismatch *RoundTripMismatch) {
+	verifier.mutex.Lock()
+	stats, ok := verifier.stats[typeString]
+	if !ok {
+		stats = &RoundTripStats{TypeString: typeString}
+		verifier.stats[typeString] = stats
+	}
+	stats.Checked++
+	if mismatch != nil {
+		stats.Mismatched++
+	}
+	verifier.mutex.Unlock()
+
+	if mismatch != nil && verifier.OnMismatch != nil {
+		verifier.OnMismatch(mismatch)
+	}
+}
+
+// compare reports whether serialized equals original
+func (verifier *RoundTripVerifier) compare(typeString string, layers *PacketLayers, original []byte, serialized []byte, err error) bool {
+	if err == nil && bytes.Equal(original, serialized) {
+		verifier.report(typeString, nil)
+		return true
+	}
+	verifier.report(typeString, &RoundTripMismatch{
+		TypeString: typeString,
+		UniqueID:   layers.UniqueID,
+		Offset:     firstDifference(original, serialized),
+		Original:   original,
+		Serialized: serialized,
+		Err:        err,
+	})
+	return false
+}
+
+// serializeData writes the subpackets of an ID_DATA packet one by one,
+// so that the first differing subpacket can be reported
+func (verifier *RoundTripVerifier) serializeData(layer *Packet83Layer, layers *PacketLayers, stream *extendedWriter, buffer *bytes.Buffer, original []byte) error {
+	for _, subpacket := range layer.SubPackets {
+		start := buffer.Len()
+		err := stream.WriteByte(subpacket.Type())
+		if err == nil {
+			err = subpacket.Serialize(verifier.writer, stream)
+		}
+		serialized := buffer.Bytes()[start:]
+		var expected []byte
+		if start < len(original) {
+			expected = original[start:]
+		}
+		if len(expected) > len(serialized) {
+			expected = expected[:len(serialized)]
+		}
+		if !verifier.compare(subpacket.TypeString(), layers, expected, serialized, err) {
+			// the subpackets after this one can't be aligned with the original
+			return err
+		}
+	}
+	return stream.WriteByte(0)
+}
+
+// verify checks a packet that was decoded from original.
+// caches is the state of the reader's caches before the packet was decoded.
+func (verifier *RoundTripVerifier) verify(reader PacketReader, caches Caches, layers *PacketLayers, original []byte) {
+	if layers.Main == nil {
+		return
+	}
+	writer := verifier.writer
+	writer.SetContext(reader.Context())
+	writer.SetCaches(&caches)
+	writer.SetToClient(!reader.IsClient())
+
+	buffer := new(bytes.Buffer)
+	stream := &extendedWriter{buffer}
+	var err error
+	if layers.OfflinePayload != nil {
+		err = stream.WriteByte(layers.Main.Type())
+		if err == nil {
+			err = stream.allBytes(OfflineMessageID)
+		}
+	} else if layers.Timestamp != nil {
+		err = stream.WriteByte(layers.Timestamp.Type())
+		if err == nil {
+			err = layers.Timestamp.Serialize(writer, stream)
+		}
+		if err == nil {
+			err = stream.WriteByte(layers.Main.Type())
+		}
+	} else {
+		err = stream.WriteByte(layers.Main.Type())
+	}
+	if err == nil {
+		if data, ok := layers.Main.(*Packet83Layer); ok {
+			err = verifier.serializeData(data, layers, stream, buffer, original)
+		} else {
+			err = layers.Main.Serialize(writer, stream)
+		}
+	}
+
+	verifier.compare(layers.Main.TypeString(), layers, original, buffer.Bytes(), err)
+}
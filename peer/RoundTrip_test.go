@@ -0,0 +1,65 @@
+package peer
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+// lossyCodec reads one byte but always writes a zero
+var lossyCodec = &PacketCodec{
+	TypeString: "ID_LOSSY",
+	Decode: func(stream io.Reader, reader PacketReader, layers *PacketLayers) (fmt.Stringer, error) {
+		var value [1]byte
+		_, err := io.ReadFull(stream, value[:])
+		return testValue{}, err
+	},
+	Serialize: func(value fmt.Stringer, writer PacketWriter, stream io.Writer) error {
+		_, err := stream.Write([]byte{0})
+		return err
+	},
+}
+
+func TestRoundTripVerifier(t *testing.T) {
+	reader := NewPacketReader()
+	reader.SetContext(NewCommunicationContext())
+	reader.RoundTrip = NewRoundTripVerifier()
+	var mismatches []*RoundTripMismatch
+	reader.RoundTrip.OnMismatch = func(mismatch *RoundTripMismatch) {
+		mismatches = append(mismatches, mismatch)
+	}
+	reader.Decoders().RegisterDataSubpacket(0x0D, testCodec)
+	reader.Decoders().RegisterDataSubpacket(0x0E, lossyCodec)
+
+	reader.ReadPacket(orderedPing(0, 0, 0), &PacketLayers{})
+	// a varint with a redundant continuation byte
+	reader.ReadPacket(orderedDatagram(1, 1, 1, []byte{0x92, 0x80, 0x00}), &PacketLayers{})
+	reader.ReadPacket(orderedDatagram(2, 2, 2, []byte{0x83, 0x0D, 1, 0xAA, 0x0D, 0, 0x00}), &PacketLayers{})
+	// the second ID_TEST can't be checked after ID_LOSSY differs
+	reader.ReadPacket(orderedDatagram(3, 3, 3, []byte{0x83, 0x0D, 0, 0x0E, 7, 0x0D, 0, 0x00}), &PacketLayers{})
+
+	expected := []RoundTripStats{
+		{TypeString: "ID_CONNECTED_PING", Checked: 1},
+		{TypeString: "ID_DATA", Checked: 2, Mismatched: 1},
+		{TypeString: "ID_LOSSY", Checked: 1, Mismatched: 1},
+		{TypeString: "ID_PLACEID_VERIFICATION", Checked: 1, Mismatched: 1},
+		{TypeString: "ID_TEST", Checked: 3},
+	}
+	stats := reader.RoundTrip.Stats()
+	if fmt.Sprint(stats) != fmt.Sprint(expected) {
+		t.Errorf("stats %v, expected %v", stats, expected)
+	}
+
+	if len(mismatches) != 3 {
+		t.Fatalf("%d mismatches reported", len(mismatches))
+	}
+	if mismatches[0].TypeString != "ID_PLACEID_VERIFICATION" || mismatches[0].Offset != 1 {
+		t.Errorf("mismatch %s at %d", mismatches[0].TypeString, mismatches[0].Offset)
+	}
+	if mismatches[1].TypeString != "ID_LOSSY" || mismatches[1].Offset != 1 {
+		t.Errorf("mismatch %s at %d", mismatches[1].TypeString, mismatches[1].Offset)
+	}
+	if mismatches[2].TypeString != "ID_DATA" || mismatches[2].Offset != 4 {
+		t.Errorf("mismatch %s at %d", mismatches[2].TypeString, mismatches[2].Offset)
+	}
+}
@@ -0,0 +1,214 @@
+package peer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kinds of SchemaChanges
+const (
+	// SchemaItemAdded means that an item exists only in the new schema
+	SchemaItemAdded = "added"
+	// SchemaItemRemoved means that an item exists only in the old schema
+	SchemaItemRemoved = "removed"
+	// SchemaTypeChanged means that the type of a property changed
+	SchemaTypeChanged = "type"
+	// SchemaArgumentsChanged means that the argument types of an event changed
+	SchemaArgumentsChanged = "arguments"
+	// SchemaBitSizeChanged means that the bit size of an enum changed
+	SchemaBitSizeChanged = "bitSize"
+	// SchemaNetworkIDChanged means that an item was assigned a different network ID
+	SchemaNetworkIDChanged = "networkId"
+)
+
+// SchemaChange describes one difference between two network schemas
+type SchemaChange struct {
+	// Kind is one of the SchemaItemAdded etc. constants
+	Kind string `json:"kind"`
+	// Item is "enum", "class", "property" or "event"
+	Item string `json:"item"`
+	// Name is the name of the item. Properties and events are
+	// prefixed with the name of their class.
+	Name string `json:"name"`
+	// Old and New are the values that changed, if any
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+func (change SchemaChange) String() string {
+	switch change.Kind {
+	case SchemaItemAdded:
+		return fmt.Sprintf("+ %s %s", change.Item, change.Name)
+	case SchemaItemRemoved:
+		return fmt.Sprintf("- %s %s", change.Item, change.Name)
+	default:
+		return fmt.Sprintf("~ %s %s %s: %s -> %s", change.Item, change.Name, change.Kind, change.Old, change.New)
+	}
+}
+
+// SchemaDiff lists the differences between two network schemas
+type SchemaDiff struct {
+	Changes []SchemaChange `json:"changes"`
+}
+
+func (diff *SchemaDiff) add(kind string, item string, name string, before string, after string) {
+	diff.Changes = append(diff.Changes, SchemaChange{
+		Kind: kind,
+		Item: item,
+		Name: name,
+		Old:  before,
+		New:  after,
+	})
+}
+
+// networkID adds a SchemaNetworkIDChanged change if the IDs differ
+func (diff *SchemaDiff) networkID(item string, name string, before uint16, after uint16) {
+	if before != after {
+		diff.add(SchemaNetworkIDChanged, item, name, fmt.Sprint(before), fmt.Sprint(after))
+	}
+}
+
+// Without returns a copy of the diff without changes of the given kind
+func (diff *SchemaDiff) Without(kind string) *SchemaDiff {
+	result := &SchemaDiff{Changes: []SchemaChange{}}
+	for _, change := range diff.Changes {
+		if change.Kind != kind {
+			result.Changes = append(result.Changes, change)
+		}
+	}
+	return result
+}
+
+// WriteText writes the changes in a human-readable form, one per line
+func (diff *SchemaDiff) WriteText(file io.Writer) error {
+	for _, change := range diff.Changes {
+		_, err := fmt.Fprintln(file, change.String())
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(file, "%d changes\n", len(diff.Changes))
+	return err
+}
+
+// typeDescription describes a value type, including the name of the enum
+// that enum values refer to
+func typeDescription(schema *NetworkSchema, valueType uint8, enumID uint16) string {
+	name, ok := TypeNames[valueType]
+	if !ok {
+		name = fmt.Sprintf("type %d", valueType)
+	}
+	if valueType != PropertyTypeEnum {
+		return name
+	}
+	if int(enumID) < len(schema.Enums) {
+		return name + " " + schema.Enums[enumID].Name
+	}
+	return fmt.Sprintf("%s %d", name, enumID)
+}
+
+func argumentDescription(schema *NetworkSchema, event *NetworkEventSchema) string {
+	arguments := make([]string, len(event.Arguments))
+	for i, argument := range event.Arguments {
+		arguments[i] = typeDescription(schema, argument.Type, argument.EnumID)
+	}
+	return "(" + strings.Join(arguments, ", ") + ")"
+}
+
+// DiffSchemas compares two network schemas. Items are matched by name, so
+// that items that were assigned different network IDs aren't reported
+// as added or removed. Members of added or removed classes aren't listed
+// separately.
+func DiffSchemas(before *NetworkSchema, after *NetworkSchema) *SchemaDiff {
+	diff := &SchemaDiff{Changes: []SchemaChange{}}
+
+	oldEnums := make(map[string]*NetworkEnumSchema, len(before.Enums))
+	for _, enum := range before.Enums {
+		oldEnums[enum.Name] = enum
+	}
+	newEnums := make(map[string]*NetworkEnumSchema, len(after.Enums))
+	for _, enum := range after.Enums {
+		newEnums[enum.Name] = enum
+	}
+	for _, oldEnum := range before.Enums {
+		newEnum := newEnums[oldEnum.Name]
+		if newEnum == nil {
+			diff.add(SchemaItemRemoved, "enum", oldEnum.Name, "", "")
+			continue
+		}
+		if oldEnum.BitSize != newEnum.BitSize {
+			diff.add(SchemaBitSizeChanged, "enum", oldEnum.Name, fmt.Sprint(oldEnum.BitSize), fmt.Sprint(newEnum.BitSize))
+		}
+		diff.networkID("enum", oldEnum.Name, oldEnum.NetworkID, newEnum.NetworkID)
+	}
+	for _, newEnum := range after.Enums {
+		if oldEnums[newEnum.Name] == nil {
+			diff.add(SchemaItemAdded, "enum", newEnum.Name, "", "")
+		}
+	}
+
+	oldClasses := make(map[string]*NetworkInstanceSchema, len(before.Instances))
+	for _, class := range before.Instances {
+		oldClasses[class.Name] = class
+	}
+	newClasses := make(map[string]*NetworkInstanceSchema, len(after.Instances))
+	for _, class := range after.Instances {
+		newClasses[class.Name] = class
+	}
+	for _, oldClass := range before.Instances {
+		newClass := newClasses[oldClass.Name]
+		if newClass == nil {
+			diff.add(SchemaItemRemoved, "class", oldClass.Name, "", "")
+			continue
+		}
+		diff.networkID("class", oldClass.Name, oldClass.NetworkID, newClass.NetworkID)
+
+		for _, oldProperty := range oldClass.Properties {
+			name := oldClass.Name + "." + oldProperty.Name
+			newProperty := newClass.SchemaForProp(oldProperty.Name)
+			if newProperty == nil {
+				diff.add(SchemaItemRemoved, "property", name, "", "")
+				continue
+			}
+			oldType := typeDescription(before, oldProperty.Type, oldProperty.EnumID)
+			newType := typeDescription(after, newProperty.Type, newProperty.EnumID)
+			if oldType != newType {
+				diff.add(SchemaTypeChanged, "property", name, oldType, newType)
+			}
+			diff.networkID("property", name, oldProperty.NetworkID, newProperty.NetworkID)
+		}
+		for _, newProperty := range newClass.Properties {
+			if oldClass.SchemaForProp(newProperty.Name) == nil {
+				diff.add(SchemaItemAdded, "property", oldClass.Name+"."+newProperty.Name, "", "")
+			}
+		}
+
+		for _, oldEvent := range oldClass.Events {
+			name := oldClass.Name + "." + oldEvent.Name
+			newEvent := newClass.SchemaForEvent(oldEvent.Name)
+			if newEvent == nil {
+				diff.add(SchemaItemRemoved, "event", name, "", "")
+				continue
+			}
+			oldArguments := argumentDescription(before, oldEvent)
+			newArguments := argumentDescription(after, newEvent)
+			if oldArguments != newArguments {
+				diff.add(SchemaArgumentsChanged, "event", name, oldArguments, newArguments)
+			}
+			diff.networkID("event", name, oldEvent.NetworkID, newEvent.NetworkID)
+		}
+		for _, newEvent := range newClass.Events {
+			if oldClass.SchemaForEvent(newEvent.Name) == nil {
+				diff.add(SchemaItemAdded, "event", oldClass.Name+"."+newEvent.Name, "", "")
+			}
+		}
+	}
+	for _, newClass := range after.Instances {
+		if oldClasses[newClass.Name] == nil {
+			diff.add(SchemaItemAdded, "class", newClass.Name, "", "")
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,68 @@
+package peer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const updatedTestSchema = `{
+	"version": 1,
+	"enums": [{"name": "Quoted \"Enum\"", "bitSize": 2}, {"name": "Material", "bitSize": 8}],
+	"instances": [
+		{"name": "Tool", "properties": [], "events": []},
+		{
+			"name": "Part",
+			"unknown": 3,
+			"properties": [
+				{"name": "Anchored", "type": 10},
+				{"name": "Material", "type": 7, "enumId": 1},
+				{"name": "CanCollide", "type": 9}
+			],
+			"events": [{"name": "Touched", "arguments": [{"type": 28}]}]
+		}
+	],
+	"contentPrefixes": [],
+	"optimizedStrings": []
+}`
+
+func TestDiffSchemas(t *testing.T) {
+	updated, err := ParseSchemaJSON(strings.NewReader(updatedTestSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := DiffSchemas(testSchema(), updated)
+
+	expected := []SchemaChange{
+		{Kind: SchemaBitSizeChanged, Item: "enum", Name: "Material", Old: "7", New: "8"},
+		{Kind: SchemaNetworkIDChanged, Item: "enum", Name: "Material", Old: "0", New: "1"},
+		{Kind: SchemaNetworkIDChanged, Item: "enum", Name: "Quoted \"Enum\"", Old: "1", New: "0"},
+		{Kind: SchemaNetworkIDChanged, Item: "class", Name: "Part", Old: "0", New: "1"},
+		{Kind: SchemaTypeChanged, Item: "property", Name: "Part.Anchored", Old: "bool", New: "sint"},
+		{Kind: SchemaItemAdded, Item: "property", Name: "Part.CanCollide"},
+		{Kind: SchemaArgumentsChanged, Item: "event", Name: "Part.Touched", Old: "(Instance, Enum Quoted \"Enum\")", New: "(Instance)"},
+		{Kind: SchemaItemRemoved, Item: "class", Name: "Model (Legacy)"},
+		{Kind: SchemaItemAdded, Item: "class", Name: "Tool"},
+	}
+	if !reflect.DeepEqual(diff.Changes, expected) {
+		t.Errorf("diff is\n%v\nexpected\n%v", diff.Changes, expected)
+	}
+
+	if changes := diff.Without(SchemaNetworkIDChanged).Changes; len(changes) != len(expected)-3 {
+		t.Errorf("%d changes are left after removing network ID changes", len(changes))
+	}
+	if changes := DiffSchemas(updated, updated).Changes; len(changes) != 0 {
+		t.Errorf("identical schemas differ: %v", changes)
+	}
+
+	var text bytes.Buffer
+	err = diff.WriteText(&text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+	if lines[0] != "~ enum Material bitSize: 7 -> 8" || lines[5] != "+ property Part.CanCollide" || lines[len(lines)-1] != "9 changes" {
+		t.Errorf("text diff is\n%s", text.String())
+	}
+}
@@ -1,54 +1,100 @@
 package peer
 
 import "bufio"
+import "errors"
 import "fmt"
-import "regexp"
-import "strconv"
 import "io"
 
-func mustAtoi(x string) int {
-	result, err := strconv.Atoi(x)
+// maxSchemaItems is the maximum number of items in a schema list. Network IDs
+// are 16-bit, so no list can be longer.
+const maxSchemaItems = 0x10000
+
+// schemaParser reads the lines of a schema dump file
+type schemaParser struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (parser *schemaParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("schema line %d: %s", parser.line, fmt.Sprintf(format, args...))
+}
+
+// scan reads the next line and parses it according to format
+func (parser *schemaParser) scan(format string, args ...interface{}) error {
+	line, err := parser.reader.ReadString('\n')
+	parser.line++
+	if err == io.EOF && line == "" {
+		return parser.errorf("unexpected end of file")
+	} else if err != nil && err != io.EOF {
+		return err
+	}
+	_, err = fmt.Sscanf(line, format, args...)
+	if err != nil {
+		return parser.errorf("%s", err.Error())
+	}
+	return nil
+}
+
+// count reads a line containing the length of a list
+func (parser *schemaParser) count(what string) (int, error) {
+	var count int
+	err := parser.scan("%d", &count)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
-	return result
+	if count < 0 || count > maxSchemaItems {
+		return 0, parser.errorf("invalid number of %s: %d", what, count)
+	}
+	return count, nil
+}
+
+// strings reads a list of quoted strings preceded by its length
+func (parser *schemaParser) strings(what string) ([]string, error) {
+	count, err := parser.count(what)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, count)
+	for i := range result {
+		err = parser.scan("%q", &result[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
 }
 
-// ParseSchema parses a network schema based on a schema dump file
+// ParseSchema parses a network schema based on a schema dump file.
+// Malformed files result in an error.
 func ParseSchema(schemafile io.Reader) (*NetworkSchema, error) {
-	file := bufio.NewReader(schemafile)
+	parser := &schemaParser{reader: bufio.NewReader(schemafile)}
 	schema := &NetworkSchema{}
-	var totalEnums int
-	_, err := fmt.Fscanf(file, "%d\n", &totalEnums)
+	totalEnums, err := parser.count("enums")
 	if err != nil {
-		return schema, err
+		return nil, err
 	}
 
-	enumExp := regexp.MustCompile(`\s*"([a-zA-Z0-9 _]+)"\s*(\d+)\s*`)
 	schema.Enums = make([]*NetworkEnumSchema, totalEnums)
 	for i := 0; i < totalEnums; i++ {
-		line, err := file.ReadString('\n')
+		enum := &NetworkEnumSchema{NetworkID: uint16(i)}
+		err = parser.scan("%q %d", &enum.Name, &enum.BitSize)
 		if err != nil {
-			return schema, err
-		}
-		enum := enumExp.FindStringSubmatch(line)
-		schema.Enums[i] = &NetworkEnumSchema{
-			Name:      enum[1],
-			BitSize:   uint8(mustAtoi(enum[2])),
-			NetworkID: uint16(i),
+			return nil, err
 		}
+		schema.Enums[i] = enum
 	}
 
 	var totalInstances int
 	var totalProperties int
 	var totalEvents int
-
-	instanceExp := enumExp
-	eventExp := enumExp
-	propertyExp := regexp.MustCompile(`\s*"([a-zA-Z0-9 _\-\(\)/]+)"\s*(\d+)\s*(\d+)\s*`)
-	_, err = fmt.Fscanf(file, "%d %d %d\n", &totalInstances, &totalProperties, &totalEvents)
+	err = parser.scan("%d %d %d", &totalInstances, &totalProperties, &totalEvents)
 	if err != nil {
-		return schema, err
+		return nil, err
+	}
+	for _, total := range []int{totalInstances, totalProperties, totalEvents} {
+		if total < 0 || total > maxSchemaItems {
+			return nil, parser.errorf("invalid number of items: %d", total)
+		}
 	}
 	schema.Instances = make([]*NetworkInstanceSchema, totalInstances)
 	schema.Properties = make([]*NetworkPropertySchema, totalProperties)
@@ -56,78 +102,66 @@ func ParseSchema(schemafile io.Reader) (*NetworkSchema, error) {
 	propertyGlobalIndex := 0
 	eventGlobalIndex := 0
 	for i := 0; i < totalInstances; i++ {
-		line, err := file.ReadString('\n')
+		thisInstance := &NetworkInstanceSchema{NetworkID: uint16(i)}
+		err = parser.scan("%q %d", &thisInstance.Name, &thisInstance.Unknown)
 		if err != nil {
-			return schema, err
-		}
-		instance := instanceExp.FindStringSubmatch(line)
-		thisInstance := &NetworkInstanceSchema{
-			Name:      instance[1],
-			Unknown:   uint16(mustAtoi(instance[2])),
-			NetworkID: uint16(i),
+			return nil, err
 		}
 
-		var countProperties int
-		_, err = fmt.Fscanf(file, "%d\n", &countProperties)
+		countProperties, err := parser.count("properties")
 		if err != nil {
-			return schema, err
+			return nil, err
+		}
+		if propertyGlobalIndex+countProperties > totalProperties {
+			return nil, parser.errorf("more properties than the %d declared", totalProperties)
 		}
 		thisInstance.Properties = make([]*NetworkPropertySchema, countProperties)
 
 		for j := 0; j < countProperties; j++ {
-			line, err = file.ReadString('\n')
-			if err != nil {
-				return schema, err
-			}
-
-			property := propertyExp.FindStringSubmatch(line)
 			thisProperty := &NetworkPropertySchema{
-				Name:           property[1],
-				Type:           uint8(mustAtoi(property[2])),
-				EnumID:         uint16(mustAtoi(property[3])),
-				TypeString:     TypeNames[uint8(mustAtoi(property[2]))],
 				InstanceSchema: thisInstance,
 				NetworkID:      uint16(propertyGlobalIndex),
 			}
+			err = parser.scan("%q %d %d", &thisProperty.Name, &thisProperty.Type, &thisProperty.EnumID)
+			if err != nil {
+				return nil, err
+			}
+			thisProperty.TypeString = TypeNames[thisProperty.Type]
 			thisInstance.Properties[j] = thisProperty
 			schema.Properties[propertyGlobalIndex] = thisProperty
 
 			propertyGlobalIndex++
 		}
 
-		var countEvents int
-		_, err = fmt.Fscanf(file, "%d\n", &countEvents)
+		countEvents, err := parser.count("events")
 		if err != nil {
-			return schema, err
+			return nil, err
+		}
+		if eventGlobalIndex+countEvents > totalEvents {
+			return nil, parser.errorf("more events than the %d declared", totalEvents)
 		}
 		thisInstance.Events = make([]*NetworkEventSchema, countEvents)
 		for j := 0; j < countEvents; j++ {
-			line, err = file.ReadString('\n')
-			if err != nil {
-				return schema, err
-			}
-
-			event := eventExp.FindStringSubmatch(line)
 			thisEvent := &NetworkEventSchema{
-				Name:           event[1],
 				InstanceSchema: thisInstance,
 				NetworkID:      uint16(eventGlobalIndex),
 			}
-			countArguments := mustAtoi(event[2])
+			var countArguments int
+			err = parser.scan("%q %d", &thisEvent.Name, &countArguments)
+			if err != nil {
+				return nil, err
+			}
+			if countArguments < 0 || countArguments > maxSchemaItems {
+				return nil, parser.errorf("invalid number of arguments: %d", countArguments)
+			}
 			thisEvent.Arguments = make([]*NetworkArgumentSchema, countArguments)
 			for k := 0; k < countArguments; k++ {
-				var argType int
-				var argUnk int
-
-				_, err = fmt.Fscanf(file, "%d %d\n", &argType, &argUnk)
+				thisArgument := &NetworkArgumentSchema{}
+				err = parser.scan("%d %d", &thisArgument.Type, &thisArgument.EnumID)
 				if err != nil {
-					return schema, err
-				}
-				thisArgument := &NetworkArgumentSchema{
-					Type:       uint8(argType),
-					TypeString: TypeNames[uint8(argType)],
-					EnumID:     uint16(argUnk),
+					return nil, err
 				}
+				thisArgument.TypeString = TypeNames[thisArgument.Type]
 
 				thisEvent.Arguments[k] = thisArgument
 			}
@@ -140,39 +174,20 @@ func ParseSchema(schemafile io.Reader) (*NetworkSchema, error) {
 
 		schema.Instances[i] = thisInstance
 	}
-
-	var lenContentPrefixes int
-	_, err = fmt.Fscanf(file, "%d\n", &lenContentPrefixes)
-	if err != nil {
-		return schema, err
-	}
-	schema.ContentPrefixes = make([]string, lenContentPrefixes)
-	contentPrefixExp := regexp.MustCompile(`\s*"([^\"]+)"\s*`)
-	for i := 0; i < lenContentPrefixes; i++ {
-		line, err := file.ReadString('\n')
-		if err != nil {
-			return schema, err
-		}
-		contentPrefixMatch := contentPrefixExp.FindStringSubmatch(line)
-		schema.ContentPrefixes[i] = contentPrefixMatch[1]
+	if propertyGlobalIndex != totalProperties || eventGlobalIndex != totalEvents {
+		return nil, errors.New("schema has fewer properties or events than declared")
 	}
 
-	var lenOptimizedStrings int
-	_, err = fmt.Fscanf(file, "%d\n", &lenOptimizedStrings)
+	schema.ContentPrefixes, err = parser.strings("content prefixes")
 	if err != nil {
-		return schema, err
+		return nil, err
 	}
-	schema.OptimizedStrings = make([]string, lenOptimizedStrings)
-	optimizedStringExp := contentPrefixExp
-	for i := 0; i < lenOptimizedStrings; i++ {
-		line, err := file.ReadString('\n')
-		if err != nil {
-			return schema, err
-		}
-		optimizedStringMatch := optimizedStringExp.FindStringSubmatch(line)
-		schema.OptimizedStrings[i] = optimizedStringMatch[1]
+	schema.OptimizedStrings, err = parser.strings("optimized strings")
+	if err != nil {
+		return nil, err
 	}
 
+	schema.BuildIndex()
 	return schema, nil
 }
 
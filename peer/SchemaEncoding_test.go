@@ -0,0 +1,124 @@
+package peer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSchema returns a small schema that uses every part of the encodings
+func testSchema() *NetworkSchema {
+	schema := &NetworkSchema{
+		Enums: []*NetworkEnumSchema{
+			{Name: "Material", BitSize: 7, NetworkID: 0},
+			{Name: "Quoted \"Enum\"", BitSize: 2, NetworkID: 1},
+		},
+		ContentPrefixes:  []string{"rbxasset://", "rbxassetid://"},
+		OptimizedStrings: []string{"Workspace", "naïve \\ string"},
+	}
+	part := &NetworkInstanceSchema{Name: "Part", Unknown: 3, NetworkID: 0}
+	part.Properties = []*NetworkPropertySchema{
+		{Name: "Anchored", Type: PropertyTypeBool, TypeString: "bool", InstanceSchema: part, NetworkID: 0},
+		{Name: "Material", Type: PropertyTypeEnum, TypeString: "Enum", EnumID: 0, InstanceSchema: part, NetworkID: 1},
+	}
+	part.Events = []*NetworkEventSchema{{
+		Name: "Touched",
+		Arguments: []*NetworkArgumentSchema{
+			{Type: PropertyTypeInstance, TypeString: "Instance"},
+			{Type: PropertyTypeEnum, TypeString: "Enum", EnumID: 1},
+		},
+		InstanceSchema: part,
+		NetworkID:      0,
+	}}
+	model := &NetworkInstanceSchema{Name: "Model (Legacy)", NetworkID: 1}
+	model.Properties = []*NetworkPropertySchema{
+		{Name: "PrimaryPart", Type: PropertyTypeInstance, TypeString: "Instance", InstanceSchema: model, NetworkID: 2},
+	}
+	model.Events = []*NetworkEventSchema{
+		{Name: "Changed", Arguments: []*NetworkArgumentSchema{}, InstanceSchema: model, NetworkID: 1},
+	}
+	schema.Instances = []*NetworkInstanceSchema{part, model}
+	schema.Properties = append(append([]*NetworkPropertySchema{}, part.Properties...), model.Properties...)
+	schema.Events = append(append([]*NetworkEventSchema{}, part.Events...), model.Events...)
+	schema.BuildIndex()
+	return schema
+}
+
+func TestSchemaRoundTrip(t *testing.T) {
+	schema := testSchema()
+	encodings := []struct {
+		name  string
+		dump  func(*NetworkSchema, *bytes.Buffer) error
+		parse func(*bytes.Buffer) (*NetworkSchema, error)
+	}{
+		{"text", func(schema *NetworkSchema, buffer *bytes.Buffer) error {
+			return schema.Dump(buffer)
+		}, func(buffer *bytes.Buffer) (*NetworkSchema, error) {
+			return ParseSchema(buffer)
+		}},
+		{"json", func(schema *NetworkSchema, buffer *bytes.Buffer) error {
+			return schema.DumpJSON(buffer)
+		}, func(buffer *bytes.Buffer) (*NetworkSchema, error) {
+			return ParseSchemaJSON(buffer)
+		}},
+	}
+	for _, encoding := range encodings {
+		var buffer bytes.Buffer
+		err := encoding.dump(schema, &buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dumped := buffer.String()
+		parsed, err := encoding.parse(&buffer)
+		if err != nil {
+			t.Fatalf("%s: %s", encoding.name, err.Error())
+		}
+		if !reflect.DeepEqual(parsed, schema) {
+			t.Errorf("%s: parsed schema differs", encoding.name)
+		}
+
+		detected, err := ReadSchema(strings.NewReader("\n " + dumped))
+		if err != nil || !reflect.DeepEqual(detected, schema) {
+			t.Errorf("%s: ReadSchema didn't detect the encoding: %v", encoding.name, err)
+		}
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	var buffer bytes.Buffer
+	err := testSchema().Dump(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := buffer.String()
+
+	malformed := map[string]string{
+		"empty":               "",
+		"truncated":           valid[:len(valid)/2],
+		"unquoted enum":       "1\nMaterial 7\n",
+		"bad number":          "x\n",
+		"negative count":      "-1\n",
+		"huge count":          "100000000\n",
+		"bit size overflow":   "1\n\"Material\" 700\n",
+		"too many properties": "0\n1 0 0\n\"Part\" 0\n\t1\n\t\"Anchored\" 9 0\n\t0\n0\n0\n",
+		"too few events":      "0\n1 0 1\n\"Part\" 0\n\t0\n\t0\n0\n0\n",
+	}
+	for name, input := range malformed {
+		if _, err := ParseSchema(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+
+	malformedJSON := map[string]string{
+		"syntax":        "{",
+		"version":       `{"version": 2}`,
+		"unknown field": `{"version": 1, "classes": []}`,
+		"wrong type":    `{"version": 1, "enums": [{"name": "Material", "bitSize": "7"}]}`,
+	}
+	for name, input := range malformedJSON {
+		if _, err := ParseSchemaJSON(strings.NewReader(input)); err == nil {
+			t.Errorf("json %s: parsed without error", name)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package peer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SchemaJSONVersion is the version of the JSON schema encoding written by DumpJSON
+const SchemaJSONVersion = 1
+
+// The JSON encoding of a NetworkSchema is an object of the form
+//
+//	{
+//		"version": 1,
+//		"enums": [{"name": "Material", "bitSize": 7}, ...],
+//		"instances": [{
+//			"name": "Part",
+//			"unknown": 0,
+//			"properties": [{"name": "Anchored", "type": 9, "typeName": "bool", "enumId": 0}, ...],
+//			"events": [{"name": "Touched", "arguments": [{"type": 28, "typeName": "Instance", "enumId": 0}]}, ...]
+//		}, ...],
+//		"contentPrefixes": ["rbxasset://", ...],
+//		"optimizedStrings": ["Workspace", ...]
+//	}
+//
+// Network IDs are implied by the order of the lists: enums and instances are
+// numbered in order, and properties and events are numbered in the order they
+// appear across all instances. "typeName" is informational and ignored when
+// parsing.
+
+type jsonSchemaArgument struct {
+	Type     uint8  `json:"type"`
+	TypeName string `json:"typeName,omitempty"`
+	EnumID   uint16 `json:"enumId"`
+}
+
+type jsonSchemaEnum struct {
+	Name    string `json:"name"`
+	BitSize uint8  `json:"bitSize"`
+}
+
+type jsonSchemaEvent struct {
+	Name      string               `json:"name"`
+	Arguments []jsonSchemaArgument `json:"arguments"`
+}
+
+type jsonSchemaProperty struct {
+	Name     string `json:"name"`
+	Type     uint8  `json:"type"`
+	TypeName string `json:"typeName,omitempty"`
+	EnumID   uint16 `json:"enumId"`
+}
+
+type jsonSchemaInstance struct {
+	Name       string               `json:"name"`
+	Unknown    uint16               `json:"unknown"`
+	Properties []jsonSchemaProperty `json:"properties"`
+	Events     []jsonSchemaEvent    `json:"events"`
+}
+
+type jsonSchema struct {
+	Version          int                  `json:"version"`
+	Enums            []jsonSchemaEnum     `json:"enums"`
+	Instances        []jsonSchemaInstance `json:"instances"`
+	ContentPrefixes  []string             `json:"contentPrefixes"`
+	OptimizedStrings []string             `json:"optimizedStrings"`
+}
+
+// DumpJSON encodes a NetworkSchema to JSON that can be parsed by ParseSchemaJSON()
+func (schema *NetworkSchema) DumpJSON(file io.Writer) error {
+	result := jsonSchema{
+		Version:          SchemaJSONVersion,
+		Enums:            make([]jsonSchemaEnum, len(schema.Enums)),
+		Instances:        make([]jsonSchemaInstance, len(schema.Instances)),
+		ContentPrefixes:  schema.ContentPrefixes,
+		OptimizedStrings: schema.OptimizedStrings,
+	}
+	if result.ContentPrefixes == nil {
+		result.ContentPrefixes = []string{}
+	}
+	if result.OptimizedStrings == nil {
+		result.OptimizedStrings = []string{}
+	}
+	for i, enum := range schema.Enums {
+		result.Enums[i] = jsonSchemaEnum{Name: enum.Name, BitSize: enum.BitSize}
+	}
+	for i, instance := range schema.Instances {
+		thisInstance := jsonSchemaInstance{
+			Name:       instance.Name,
+			Unknown:    instance.Unknown,
+			Properties: make([]jsonSchemaProperty, len(instance.Properties)),
+			Events:     make([]jsonSchemaEvent, len(instance.Events)),
+		}
+		for j, property := range instance.Properties {
+			thisInstance.Properties[j] = jsonSchemaProperty{
+				Name:     property.Name,
+				Type:     property.Type,
+				TypeName: TypeNames[property.Type],
+				EnumID:   property.EnumID,
+			}
+		}
+		for j, event := range instance.Events {
+			thisEvent := jsonSchemaEvent{
+				Name:      event.Name,
+				Arguments: make([]jsonSchemaArgument, len(event.Arguments)),
+			}
+			for k, argument := range event.Arguments {
+				thisEvent.Arguments[k] = jsonSchemaArgument{
+					Type:     argument.Type,
+					TypeName: TypeNames[argument.Type],
+					EnumID:   argument.EnumID,
+				}
+			}
+			thisInstance.Events[j] = thisEvent
+		}
+		result.Instances[i] = thisInstance
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(result)
+}
+
+// ParseSchemaJSON parses a network schema encoded by DumpJSON()
+func ParseSchemaJSON(file io.Reader) (*NetworkSchema, error) {
+	var encoded jsonSchema
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&encoded)
+	if err != nil {
+		return nil, err
+	}
+	if encoded.Version != SchemaJSONVersion {
+		return nil, fmt.Errorf("unsupported schema version %d", encoded.Version)
+	}
+	if len(encoded.Enums) > maxSchemaItems || len(encoded.Instances) > maxSchemaItems {
+		return nil, fmt.Errorf("schema has too many enums or instances")
+	}
+
+	schema := &NetworkSchema{
+		Enums:            make([]*NetworkEnumSchema, len(encoded.Enums)),
+		Instances:        make([]*NetworkInstanceSchema, len(encoded.Instances)),
+		ContentPrefixes:  encoded.ContentPrefixes,
+		OptimizedStrings: encoded.OptimizedStrings,
+	}
+	if schema.ContentPrefixes == nil {
+		schema.ContentPrefixes = []string{}
+	}
+	if schema.OptimizedStrings == nil {
+		schema.OptimizedStrings = []string{}
+	}
+	for i, enum := range encoded.Enums {
+		schema.Enums[i] = &NetworkEnumSchema{
+			Name:      enum.Name,
+			BitSize:   enum.BitSize,
+			NetworkID: uint16(i),
+		}
+	}
+	for i, instance := range encoded.Instances {
+		thisInstance := &NetworkInstanceSchema{
+			Name:       instance.Name,
+			Unknown:    instance.Unknown,
+			Properties: make([]*NetworkPropertySchema, len(instance.Properties)),
+			Events:     make([]*NetworkEventSchema, len(instance.Events)),
+			NetworkID:  uint16(i),
+		}
+		if len(schema.Properties)+len(instance.Properties) > maxSchemaItems ||
+			len(schema.Events)+len(instance.Events) > maxSchemaItems {
+			return nil, fmt.Errorf("schema has too many properties or events")
+		}
+		for j, property := range instance.Properties {
+			thisProperty := &NetworkPropertySchema{
+				Name:           property.Name,
+				Type:           property.Type,
+				TypeString:     TypeNames[property.Type],
+				EnumID:         property.EnumID,
+				InstanceSchema: thisInstance,
+				NetworkID:      uint16(len(schema.Properties)),
+			}
+			thisInstance.Properties[j] = thisProperty
+			schema.Properties = append(schema.Properties, thisProperty)
+		}
+		for j, event := range instance.Events {
+			thisEvent := &NetworkEventSchema{
+				Name:           event.Name,
+				Arguments:      make([]*NetworkArgumentSchema, len(event.Arguments)),
+				InstanceSchema: thisInstance,
+				NetworkID:      uint16(len(schema.Events)),
+			}
+			for k, argument := range event.Arguments {
+				thisEvent.Arguments[k] = &NetworkArgumentSchema{
+					Type:       argument.Type,
+					TypeString: TypeNames[argument.Type],
+					EnumID:     argument.EnumID,
+				}
+			}
+			thisInstance.Events[j] = thisEvent
+			schema.Events = append(schema.Events, thisEvent)
+		}
+		schema.Instances[i] = thisInstance
+	}
+	if schema.Properties == nil {
+		schema.Properties = []*NetworkPropertySchema{}
+	}
+	if schema.Events == nil {
+		schema.Events = []*NetworkEventSchema{}
+	}
+
+	schema.BuildIndex()
+	return schema, nil
+}
+
+// ReadSchema parses a network schema in either the JSON encoding or the
+// format written by Dump(), depending on the contents of file
+func ReadSchema(file io.Reader) (*NetworkSchema, error) {
+	reader := bufio.NewReader(file)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.ContainsAny(first, " \t\r\n") {
+			if first[0] == '{' {
+				return ParseSchemaJSON(reader)
+			}
+			return ParseSchema(reader)
+		}
+		reader.Discard(1)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"time"
 
 	"github.com/Gskartwii/roblox-dissector/datamodel"
 	"github.com/olebedev/emitter"
@@ -43,6 +44,9 @@ type CustomServer struct {
 	Schema             *NetworkSchema
 	InstanceDictionary *datamodel.InstanceDictionary
 	RunningContext     context.Context
+	// Playback, if set, is played back to clients instead
+	// of replicating the DataModel. See NewPlaybackServer.
+	Playback *CapturedConversation
 
 	PlayerIndex int
 }
@@ -68,13 +72,14 @@ func (client *ServerClient) createWriter() {
 			fmt.Printf("Wrote %d bytes, err: %s\n", num, err.Error())
 		}
 
-		// Emit packet for PCAP capture (server-to-client)
+		// Emit packet for PCAP capture (server-to-client), after its layers have been emitted
 		<-client.Server.PacketEmitter.Emit("packet", client.Server.Address, client.Address, payload)
 	}, emitter.Void)
 	client.DefaultPacketWriter.LayerEmitter.On("*", func(e *emitter.Event) {
 		e.Args[0].(*PacketLayers).Root = RootLayer{
 			FromServer:  true,
 			Logger:      nil,
+			Timestamp:   time.Now(),
 			Source:      client.Server.Address,
 			Destination: client.Address,
 		}
@@ -82,7 +87,11 @@ func (client *ServerClient) createWriter() {
 }
 
 func (client *ServerClient) init() {
-	client.bindDefaultHandlers()
+	if client.Server.Playback != nil {
+		client.bindPlaybackHandlers()
+	} else {
+		client.bindDefaultHandlers()
+	}
 	// Write to server's connection
 	client.Connection = client.Server.Connection
 	client.createWriter()
@@ -99,6 +108,12 @@ func newServerClient(clientAddr *net.UDPAddr, server *CustomServer, context *Com
 		NetworkSchema:        context.NetworkSchema,
 		InstanceTopScope:     context.InstanceTopScope,
 		ServerPeerID:         1,
+		ProtocolVersion:      context.ProtocolVersion,
+		APIDictionary:        context.APIDictionary,
+	}
+	if server.Playback != nil {
+		// played back references must keep the captured peer ID
+		newContext.ServerPeerID = context.ServerPeerID
 	}
 
 	server.PlayerIndex++
@@ -159,10 +174,10 @@ func (myServer *CustomServer) Start() error {
 			<-myServer.ClientEmitter.Emit("client", thisClient)
 		}
 
-		// Emit packet for PCAP capture (client-to-server)
-		<-myServer.PacketEmitter.Emit("packet", client, myServer.Address, buf[:n])
-
 		thisClient.ReadPacket(buf[:n])
+
+		// Emit packet for PCAP capture (client-to-server), after it has been decoded
+		<-myServer.PacketEmitter.Emit("packet", client, myServer.Address, buf[:n])
 	}
 }
 
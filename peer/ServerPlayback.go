@@ -0,0 +1,153 @@
+package peer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/datamodel"
+	"github.com/olebedev/emitter"
+)
+
+// playbackSkippedPackets are server packets that are regenerated
+// by CustomServer instead of being played back
+var playbackSkippedPackets = map[byte]bool{
+	0x00: true, // ping
+	0x03: true, // pong
+	0x06: true,
+	0x08: true,
+	0x10: true,
+	0x93: true,
+}
+
+// NewPlaybackServer initializes a CustomServer that plays back the server half
+// of a captured conversation to every client that connects to it.
+// The handshake is regenerated; everything the server sent after the
+// client submitted its ticket is played back using the captured timing.
+func NewPlaybackServer(ctx context.Context, port uint16, capture *CapturedConversation) (*CustomServer, error) {
+	server := &CustomServer{
+		Clients:       make(map[string]*ServerClient),
+		ClientEmitter: emitter.New(0),
+		PacketEmitter: emitter.New(0),
+		Playback:      capture,
+	}
+
+	var err error
+	server.Address, err = net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return server, err
+	}
+
+	server.RunningContext = ctx
+	server.GUID = rand.Uint64()
+	server.Schema = capture.Context.NetworkSchema
+	server.Context = NewCommunicationContext()
+	server.Context.NetworkSchema = capture.Context.NetworkSchema
+	server.Context.InstanceTopScope = capture.Context.InstanceTopScope
+	server.Context.ServerPeerID = capture.Context.ServerPeerID
+	server.Context.APIDictionary = capture.Context.APIDictionary
+	server.Context.ProtocolVersion = capture.Context.ProtocolVersion
+	server.InstanceDictionary = datamodel.NewInstanceDictionary(capture.Context.ServerPeerID)
+
+	return server, nil
+}
+
+func (client *ServerClient) playbackProtocolSyncHandler(e *emitter.Event) {
+	capture := client.Server.Playback
+	index := capture.firstPacket(false, 0x93)
+	if index == -1 {
+		client.requestParamsHandler(e)
+		return
+	}
+	format := copyPacket(capture.Packets[index].Main).(*Packet93Layer)
+	// the packets played back after this one are compressed accordingly
+	client.Context.APIDictionaryCompression = format.APIDictionaryCompression
+	err := client.WritePacket(format)
+	if err != nil {
+		println("playback dictionary format error:", err.Error())
+	}
+}
+
+func (client *ServerClient) playbackTicketHandler(e *emitter.Event) {
+	go func() {
+		err := client.playBack()
+		if err != nil {
+			println("playback error:", err.Error())
+		}
+	}()
+}
+
+// writeCaptured writes a copy of a captured packet, because the
+// captured packets are shared by every client
+func (client *ServerClient) writeCaptured(layers *PacketLayers, timestampOffset uint64) error {
+	if forwardsRaw(layers) {
+		return client.ForwardRaw(layers)
+	}
+	main := copyPacket(layers.Main)
+	if layers.PacketType == 0x85 {
+		timestamp := *layers.Timestamp
+		timestamp.Timestamp += timestampOffset
+		return client.WriteTimestamped(&timestamp, main)
+	}
+	return client.WritePacket(main)
+}
+
+// playBack writes the captured server packets to the client,
+// preserving the time between them
+func (client *ServerClient) playBack() error {
+	capture := client.Server.Playback
+	start := capture.firstPacket(true, 0x8A) + 1
+	startTime := time.Now()
+	var captureStart time.Time
+	var timestampOffset uint64
+	var haveTimestampOffset bool
+
+	for i := start; i < len(capture.Packets); i++ {
+		layers := capture.Packets[i]
+		if layers.Root.FromClient || layers.OfflinePayload != nil || playbackSkippedPackets[layers.PacketType] {
+			continue
+		}
+
+		if captureTime := capture.timeOf(i); !captureTime.IsZero() {
+			if captureStart.IsZero() {
+				captureStart = captureTime
+			}
+			select {
+			case <-time.After(time.Until(startTime.Add(captureTime.Sub(captureStart)))):
+			case <-client.RunningContext.Done():
+				return nil
+			}
+		}
+		// the running context is cancelled when the client disconnects
+		select {
+		case <-client.RunningContext.Done():
+			return nil
+		default:
+		}
+
+		// physics timestamps are shifted so that they appear current
+		if layers.Timestamp != nil && !haveTimestampOffset {
+			timestampOffset = uint64(time.Now().UnixNano()/int64(time.Millisecond)) - layers.Timestamp.Timestamp
+			haveTimestampOffset = true
+		}
+		err := client.writeCaptured(layers, timestampOffset)
+		if err != nil {
+			return fmt.Errorf("failed to play back packet %d: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+func (client *ServerClient) bindPlaybackHandlers() {
+	client.DefaultPacketReader.LayerEmitter.On("reliability", client.defaultReliabilityLayerHandler, emitter.Void)
+	pEmitter := client.PacketEmitter
+	pEmitter.On("ID_OPEN_CONNECTION_REQUEST_1", client.offline5Handler, emitter.Void)
+	pEmitter.On("ID_OPEN_CONNECTION_REQUEST_2", client.offline7Handler, emitter.Void)
+	pEmitter.On("ID_CONNECTION_REQUEST", client.connectionRequestHandler, emitter.Void)
+	pEmitter.On("ID_PROTOCOL_SYNC", client.playbackProtocolSyncHandler, emitter.Void)
+	pEmitter.On("ID_SUBMIT_TICKET", client.playbackTicketHandler, emitter.Void)
+
+	client.PacketLogicHandler.bindDefaultHandlers()
+}
@@ -0,0 +1,66 @@
+package peer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/olebedev/emitter"
+)
+
+func TestPlaybackCompressesWithDictionary(t *testing.T) {
+	captured := NewCommunicationContext()
+	captured.APIDictionary = testDictionary
+	captured.ProtocolVersion = 40
+	capture := &CapturedConversation{
+		Context: captured,
+		Packets: []*PacketLayers{
+			{
+				PacketType:  0x93,
+				Reliability: &ReliablePacket{Reliability: ReliableOrdered},
+				Main:        &Packet93Layer{APIDictionaryCompression: true, Params: map[string]bool{}},
+			},
+			{
+				PacketType:  0x83,
+				Reliability: &ReliablePacket{Reliability: ReliableOrdered},
+				Main:        &Packet83Layer{SubPackets: []Packet83Subpacket{&Packet83_0E{}}},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewPlaybackServer(ctx, 0, capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newServerClient(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53640}, server, server.Context)
+	if client.Context.ProtocolVersion != 40 {
+		t.Errorf("client protocol version is %d", client.Context.ProtocolVersion)
+	}
+
+	// the receiving peer enables compression when it reads the dictionary format
+	receiverContext := NewCommunicationContext()
+	receiverContext.APIDictionary = testDictionary
+	receiver := NewConnectedPeer(receiverContext, false)
+	client.Output.On("udp", func(e *emitter.Event) {
+		receiver.ReadPacket(e.Args[0].([]byte), &PacketLayers{})
+	}, emitter.Void)
+	var received []*PacketLayers
+	receiver.DefaultPacketReader.LayerEmitter.On("full-reliable", func(e *emitter.Event) {
+		received = append(received, e.Args[0].(*PacketLayers))
+	}, emitter.Void)
+	receiver.DefaultPacketReader.ErrorEmitter.On("full-reliable", func(e *emitter.Event) {
+		t.Errorf("receiving %02X: %s", e.Args[0].(*PacketLayers).PacketType, e.Args[0].(*PacketLayers).Error)
+	}, emitter.Void)
+
+	client.playbackProtocolSyncHandler(&emitter.Event{})
+	if err = client.playBack(); err != nil {
+		t.Fatal(err)
+	}
+	if !client.Context.APIDictionaryCompression || !receiverContext.APIDictionaryCompression {
+		t.Error("compression wasn't enabled by the dictionary format")
+	}
+	if len(received) != 2 || received[1].PacketType != 0x83 {
+		t.Fatalf("received %d packets", len(received))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"log"
 	"strings"
+	"time"
 )
 
 // SplitPacketBuffer represents a structure that accumulates every
@@ -33,6 +34,9 @@ type SplitPacketBuffer struct {
 	// Total length received so far, in bytes
 	RealLength uint32
 	UniqueID   uint64
+	// Capture times of the earliest and latest splits received so far
+	FirstTimestamp time.Time
+	LastTimestamp  time.Time
 
 	logBuffer *strings.Builder // must be a pointer because it may be copied!
 	Logger    *log.Logger
@@ -55,10 +59,16 @@ func newSplitPacketBuffer(packet *ReliablePacket, context *CommunicationContext)
 	return list, list.UniqueID
 }
 
-func (list *SplitPacketBuffer) addPacket(packet *ReliablePacket, rakNetPacket *RakNetLayer, index uint32) {
+func (list *SplitPacketBuffer) addPacket(packet *ReliablePacket, rakNetPacket *RakNetLayer, index uint32, timestamp time.Time) {
 	// Packets may be duplicated. At least I think so. Thanks UDP
 	list.ReliablePackets[index] = packet
 	list.RakNetPackets = append(list.RakNetPackets, rakNetPacket)
+	if list.FirstTimestamp.IsZero() || timestamp.Before(list.FirstTimestamp) {
+		list.FirstTimestamp = timestamp
+	}
+	if timestamp.After(list.LastTimestamp) {
+		list.LastTimestamp = timestamp
+	}
 }
 
 func (list splitPacketList) delete(layers *PacketLayers) {
@@ -73,7 +83,7 @@ func (reader *DefaultPacketReader) addSplitPacket(layers *PacketLayers) *SplitPa
 	if !packet.HasSplitPacket {
 		buffer, id := newSplitPacketBuffer(packet, reader.context)
 		layers.UniqueID = id
-		buffer.addPacket(packet, layers.RakNet, 0)
+		buffer.addPacket(packet, layers.RakNet, 0, layers.Root.Timestamp)
 
 		return buffer
 	}
@@ -92,7 +102,7 @@ func (reader *DefaultPacketReader) addSplitPacket(layers *PacketLayers) *SplitPa
 		buffer = reader.splitPackets[splitPacketID]
 		id = buffer.UniqueID
 	}
-	buffer.addPacket(packet, layers.RakNet, splitPacketIndex)
+	buffer.addPacket(packet, layers.RakNet, splitPacketIndex, layers.Root.Timestamp)
 	packet.SplitBuffer = buffer
 	layers.UniqueID = id
 
@@ -0,0 +1,299 @@
+// Package project implements .sala project files, which store the raw traffic
+// of a capture session together with the state of its analysis, so that the
+// session can be reopened with identical decoding.
+package project
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/peer"
+)
+
+const (
+	formatName    = "sala-project"
+	formatVersion = 1
+)
+
+// Datagram is a raw UDP payload that belongs to a conversation
+type Datagram struct {
+	Time       time.Time `json:"time"`
+	FromClient bool      `json:"fromClient"`
+	Payload    []byte    `json:"payload"`
+}
+
+// Bookmark marks a packet of a conversation by its UniqueID
+type Bookmark struct {
+	PacketID uint64 `json:"packetId"`
+	Note     string `json:"note,omitempty"`
+}
+
+// Conversation is the saved state of a single conversation
+type Conversation struct {
+	Client string `json:"client"`
+	Server string `json:"server"`
+	// MidSession is set if the conversation was picked up after it had started
+	MidSession bool `json:"midSession,omitempty"`
+	// ProtocolVersion is the protocol version the conversation was decoded
+	// with, so that packets preceding ID_PROTOCOL_SYNC, or all packets of a
+	// mid-session conversation, are decoded the same way when it is reopened
+	ProtocolVersion peer.ProtocolVersion `json:"protocolVersion,omitempty"`
+	// Filter is the Lua filter script applied to the conversation
+	Filter    string     `json:"filter,omitempty"`
+	Bookmarks []Bookmark `json:"bookmarks,omitempty"`
+	// Datagrams are in the order they were captured in
+	Datagrams []Datagram `json:"datagrams"`
+}
+
+// Project is the contents of a .sala file
+type Project struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Name    string `json:"name,omitempty"`
+	Notes   string `json:"notes,omitempty"`
+	// Schema is an optional external network schema in the format
+	// read by peer.ParseSchema. It is used by conversations whose
+	// ID_NEW_SCHEMA wasn't captured.
+	Schema string `json:"schema,omitempty"`
+	// Dictionary is an optional external API dictionary. It is used by
+	// conversations whose server enables API dictionary compression.
+	Dictionary    []byte          `json:"dictionary,omitempty"`
+	Conversations []*Conversation `json:"conversations"`
+}
+
+// New creates an empty project
+func New(name string) *Project {
+	return &Project{
+		Format:  formatName,
+		Version: formatVersion,
+		Name:    name,
+	}
+}
+
+// Clone copies the project so that conversations can be added to the copy
+// and its analysis state can be changed without affecting the original.
+// The datagrams are shared.
+func (project *Project) Clone() *Project {
+	result := *project
+	result.Conversations = make([]*Conversation, len(project.Conversations))
+	for i, conv := range project.Conversations {
+		copied := *conv
+		copied.Bookmarks = append([]Bookmark(nil), conv.Bookmarks...)
+		copied.Datagrams = conv.Datagrams[:len(conv.Datagrams):len(conv.Datagrams)]
+		result.Conversations[i] = &copied
+	}
+	return &result
+}
+
+// Load reads a project from r
+func Load(r io.Reader) (*Project, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a sala project file: %s", err.Error())
+	}
+	defer gzipReader.Close()
+
+	project := &Project{}
+	err = json.NewDecoder(gzipReader).Decode(project)
+	if err != nil {
+		return nil, err
+	}
+	if project.Format != formatName {
+		return nil, errors.New("not a sala project file")
+	}
+	if project.Version > formatVersion {
+		return nil, fmt.Errorf("project file version %d is newer than supported (%d)", project.Version, formatVersion)
+	}
+	return project, nil
+}
+
+// LoadFile reads a project from a file
+func LoadFile(filename string) (*Project, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+// Save writes the project to w
+func (project *Project) Save(w io.Writer) error {
+	gzipWriter := gzip.NewWriter(w)
+	err := json.NewEncoder(gzipWriter).Encode(project)
+	if err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// SaveFile writes the project to a file. The file is replaced atomically
+// so that a failed save doesn't destroy an earlier version.
+func (project *Project) SaveFile(filename string) error {
+	temp, err := ioutil.TempFile(filepath.Dir(filename), ".sala-*")
+	if err != nil {
+		return err
+	}
+	err = project.Save(temp)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// NetworkSchema parses the external schema of the project.
+// It returns nil if the project doesn't have one.
+func (project *Project) NetworkSchema() (*peer.NetworkSchema, error) {
+	if project.Schema == "" {
+		return nil, nil
+	}
+	return peer.ReadSchema(strings.NewReader(project.Schema))
+}
+
+// SetNetworkSchema sets the external schema of the project
+func (project *Project) SetNetworkSchema(schema *peer.NetworkSchema) error {
+	if schema == nil {
+		project.Schema = ""
+		return nil
+	}
+	var buffer bytes.Buffer
+	err := schema.Dump(&buffer)
+	if err != nil {
+		return err
+	}
+	project.Schema = buffer.String()
+	return nil
+}
+
+// NewCaptureConversation creates a conversation with fresh readers for
+// replaying the saved datagrams. schema and dictionary may be nil.
+func (conv *Conversation) NewCaptureConversation(schema *peer.NetworkSchema, dictionary []byte) (*capture.Conversation, error) {
+	client, err := net.ResolveUDPAddr("udp", conv.Client)
+	if err != nil {
+		return nil, err
+	}
+	server, err := net.ResolveUDPAddr("udp", conv.Server)
+	if err != nil {
+		return nil, err
+	}
+	result := capture.NewConversation(client, server)
+	result.Context.Degraded = conv.MidSession
+	result.Context.NetworkSchema = schema
+	result.Context.APIDictionary = dictionary
+	result.Context.ProtocolVersion = conv.ProtocolVersion
+	return result, nil
+}
+
+// Replay decodes the saved datagrams using the readers of target. Because the
+// datagrams are decoded in the order they were captured in, the packets are
+// given the same UniqueIDs as in the original session.
+func (conv *Conversation) Replay(ctx context.Context, target *capture.Conversation) error {
+	for _, datagram := range conv.Datagrams {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		source, dest := target.Server, target.Client
+		reader := target.ServerReader
+		if datagram.FromClient {
+			source, dest = target.Client, target.Server
+			reader = target.ClientReader
+		}
+		layers := capture.NewLayers(source, dest, datagram.FromClient)
+		layers.Root.Timestamp = datagram.Time
+		reader.(peer.PacketReader).ReadPacket(datagram.Payload, layers)
+	}
+	return nil
+}
+
+// Recorder collects the datagrams of conversations while they are captured.
+// It is safe for concurrent use.
+type Recorder struct {
+	project       *Project
+	mutex         sync.Mutex
+	conversations map[*capture.Conversation]*Conversation
+}
+
+// NewRecorder creates a Recorder that adds conversations to project
+func NewRecorder(project *Project) *Recorder {
+	return &Recorder{
+		project:       project,
+		conversations: make(map[*capture.Conversation]*Conversation),
+	}
+}
+
+// Project returns the project the recorder adds conversations to
+func (recorder *Recorder) Project() *Project {
+	return recorder.project
+}
+
+// Conversation returns the saved state of conv, creating it if necessary
+func (recorder *Recorder) Conversation(conv *capture.Conversation) *Conversation {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return recorder.conversation(conv)
+}
+
+func (recorder *Recorder) conversation(conv *capture.Conversation) *Conversation {
+	saved, ok := recorder.conversations[conv]
+	if !ok {
+		saved = &Conversation{
+			Client:     conv.Client.String(),
+			Server:     conv.Server.String(),
+			MidSession: conv.IsMidSession(),
+		}
+		recorder.conversations[conv] = saved
+		recorder.project.Conversations = append(recorder.project.Conversations, saved)
+	}
+	return saved
+}
+
+// UpdateProtocolVersions copies the protocol versions of the conversations,
+// which are only known once they have been decoded, to their saved state
+func (recorder *Recorder) UpdateProtocolVersions() {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	for conv, saved := range recorder.conversations {
+		saved.ProtocolVersion = conv.Context.ProtocolVersion
+	}
+}
+
+// Record adds a datagram to the saved state of conv
+func (recorder *Recorder) Record(conv *capture.Conversation, source *net.UDPAddr, payload []byte, timestamp time.Time) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	saved := recorder.conversation(conv)
+	saved.Datagrams = append(saved.Datagrams, Datagram{
+		Time:       timestamp,
+		FromClient: capture.AddressEq(source, conv.Client),
+		Payload:    append([]byte(nil), payload...),
+	})
+}
+
+// Restore associates conv with a conversation of a reopened project so that
+// further analysis state is saved to it instead of a new conversation
+func (recorder *Recorder) Restore(conv *capture.Conversation, saved *Conversation) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.conversations[conv] = saved
+}
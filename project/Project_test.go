@@ -0,0 +1,136 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/capture/capturetest"
+	"github.com/Gskartwii/roblox-dissector/peer"
+)
+
+func decodedIDs(t *testing.T, conv *capture.Conversation, decode func()) []uint64 {
+	var ids []uint64
+	conv.Bind(func(e *capture.Event) {
+		if e.Topic != "full-reliable" {
+			return
+		}
+		if e.IsError {
+			t.Errorf("decode error: %s", e.Layers.Error)
+		}
+		ids = append(ids, e.Layers.UniqueID)
+	})
+	decode()
+	return ids
+}
+
+func TestProjectRoundTrip(t *testing.T) {
+	original := capturetest.NewMidSessionConversation()
+	original.Context.ProtocolVersion = peer.HashTokensVersion
+
+	saved := New("test")
+	saved.Notes = "look at packet 1"
+	saved.Dictionary = []byte("dictionary")
+	recorder := NewRecorder(saved)
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	originalIDs := decodedIDs(t, original, func() {
+		for i := byte(1); i <= 3; i++ {
+			source := capturetest.Server
+			if i == 2 {
+				source = capturetest.Client
+			}
+			payload := capturetest.ReliablePing(i)
+			timestamp := start.Add(time.Duration(i) * time.Millisecond)
+			recorder.Record(original, source, payload, timestamp)
+			capturetest.Read(original, payload, i == 2, timestamp)
+		}
+	})
+	recorder.Conversation(original).Filter = "return true"
+	recorder.Conversation(original).Bookmarks = []Bookmark{{PacketID: originalIDs[1], Note: "client ping"}}
+	recorder.UpdateProtocolVersions()
+
+	var buffer bytes.Buffer
+	err := saved.Save(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "test" || loaded.Notes != saved.Notes || !bytes.Equal(loaded.Dictionary, saved.Dictionary) || len(loaded.Conversations) != 1 {
+		t.Fatalf("loaded project differs: %+v", loaded)
+	}
+	conv := loaded.Conversations[0]
+	if conv.Filter != "return true" || len(conv.Bookmarks) != 1 || conv.Bookmarks[0].Note != "client ping" {
+		t.Errorf("analysis state differs: %+v", conv)
+	}
+	if !conv.MidSession || len(conv.Datagrams) != 3 || !conv.Datagrams[1].FromClient || conv.Datagrams[0].FromClient {
+		t.Fatalf("datagrams differ: %+v", conv)
+	}
+	if !conv.Datagrams[2].Time.Equal(start.Add(3 * time.Millisecond)) {
+		t.Errorf("timestamp is %s", conv.Datagrams[2].Time)
+	}
+
+	if conv.ProtocolVersion != peer.HashTokensVersion {
+		t.Errorf("protocol version is %d", conv.ProtocolVersion)
+	}
+
+	reopened, err := conv.NewCaptureConversation(nil, loaded.Dictionary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.IsMidSession() || !capture.AddressEq(reopened.Client, capturetest.Client) {
+		t.Errorf("reopened conversation differs")
+	}
+	if reopened.Context.ProtocolVersion != peer.HashTokensVersion || !bytes.Equal(reopened.Context.APIDictionary, saved.Dictionary) {
+		t.Errorf("decoding settings weren't restored")
+	}
+	replayedIDs := decodedIDs(t, reopened, func() {
+		err = conv.Replay(context.Background(), reopened)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayedIDs) != len(originalIDs) {
+		t.Fatalf("replay decoded %v, original decoded %v", replayedIDs, originalIDs)
+	}
+	for i := range originalIDs {
+		if replayedIDs[i] != originalIDs[i] {
+			t.Errorf("replay decoded %v, original decoded %v", replayedIDs, originalIDs)
+		}
+	}
+}
+
+func TestLoadRejectsOtherFiles(t *testing.T) {
+	_, err := Load(bytes.NewReader([]byte("not gzip")))
+	if err == nil {
+		t.Error("loaded a file that isn't gzip")
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	original := New("original")
+	original.Conversations = []*Conversation{{
+		Client:    "192.168.1.2:50000",
+		Server:    "128.116.1.2:53640",
+		Bookmarks: []Bookmark{{PacketID: 1}},
+		Datagrams: []Datagram{{Payload: []byte{0x84}}},
+	}}
+
+	clone := original.Clone()
+	clone.Schema = "schema"
+	clone.Conversations[0].Bookmarks[0].Note = "note"
+	clone.Conversations[0].Datagrams = append(clone.Conversations[0].Datagrams, Datagram{})
+	clone.Conversations = append(clone.Conversations, &Conversation{})
+
+	if original.Schema != "" || len(original.Conversations) != 1 {
+		t.Error("project was changed through its clone")
+	}
+	conv := original.Conversations[0]
+	if conv.Bookmarks[0].Note != "" || len(conv.Datagrams) != 1 {
+		t.Error("conversation was changed through its clone")
+	}
+}
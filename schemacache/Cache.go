@@ -0,0 +1,271 @@
+// Package schemacache keeps the network schemas seen in captures on disk, so
+// that captures whose ID_NEW_SCHEMA packet is missing can still be decoded.
+// Schemas are keyed by the schema version and version ID that clients send
+// in ID_PROTOCOL_SYNC.
+// The cache also holds the zstd dictionaries used by servers that enable
+// API dictionary compression. They are keyed by the schema version only.
+package schemacache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/peer"
+)
+
+// Key identifies the schema used by a client version
+type Key struct {
+	SchemaVersion uint32
+	VersionID     peer.Packet90VersionID
+}
+
+// KeyOf returns the key of the schema requested by an ID_PROTOCOL_SYNC packet
+func KeyOf(layer *peer.Packet90Layer) Key {
+	return Key{SchemaVersion: layer.SchemaVersion, VersionID: layer.VersionID}
+}
+
+func (key Key) String() string {
+	id := key.VersionID
+	return fmt.Sprintf("%d_%08x%08x%08x%08x%08x", key.SchemaVersion,
+		uint32(id[0]), uint32(id[1]), uint32(id[2]), uint32(id[3]), uint32(id[4]))
+}
+
+func (key Key) filename() string {
+	return key.String() + ".json"
+}
+
+// parseKey returns the key of a schema file name
+func parseKey(filename string) (Key, bool) {
+	var key Key
+	var id [5]uint32
+	_, err := fmt.Sscanf(filename, "%d_%8x%8x%8x%8x%8x.json", &key.SchemaVersion, &id[0], &id[1], &id[2], &id[3], &id[4])
+	if err != nil {
+		return key, false
+	}
+	for i, part := range id {
+		key.VersionID[i] = int32(part)
+	}
+	return key, key.filename() == filename
+}
+
+// Cache is a directory of network schemas in the JSON encoding
+type Cache struct {
+	Dir string
+}
+
+// New creates a cache that is kept in dir
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Default returns the cache in the user's cache directory
+func Default() (*Cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return New(filepath.Join(dir, "roblox-dissector", "schemas")), nil
+}
+
+// Store adds a schema to the cache, replacing the schema that was
+// stored for the same key
+func (cache *Cache) Store(key Key, schema *peer.NetworkSchema) error {
+	err := os.MkdirAll(cache.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(cache.Dir, ".schema-*")
+	if err != nil {
+		return err
+	}
+	err = schema.DumpJSON(temp)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), filepath.Join(cache.Dir, key.filename()))
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// Load reads the schema stored for key. If there is none, the error
+// satisfies os.IsNotExist.
+func (cache *Cache) Load(key Key) (*peer.NetworkSchema, error) {
+	return cache.load(filepath.Join(cache.Dir, key.filename()))
+}
+
+// LoadNearest reads the schema stored for key or, if there is none, the most
+// recently stored schema with the same schema version. It returns the key of
+// the schema that was read. Network IDs can change between client versions,
+// so a schema stored for another key may decode packets wrongly. If there is
+// no schema with the schema version, the error satisfies os.IsNotExist.
+func (cache *Cache) LoadNearest(key Key) (*peer.NetworkSchema, Key, error) {
+	schema, err := cache.Load(key)
+	if !os.IsNotExist(err) {
+		return schema, key, err
+	}
+	candidates, err := filepath.Glob(filepath.Join(cache.Dir, fmt.Sprintf("%d_*.json", key.SchemaVersion)))
+	if err != nil {
+		return nil, key, err
+	}
+	var nearest string
+	var nearestKey Key
+	var nearestTime int64
+	for _, candidate := range candidates {
+		candidateKey, ok := parseKey(filepath.Base(candidate))
+		if !ok || candidateKey.SchemaVersion != key.SchemaVersion {
+			continue
+		}
+		info, err := os.Stat(candidate)
+		if err != nil {
+			continue
+		}
+		if nearest == "" || info.ModTime().UnixNano() > nearestTime {
+			nearest, nearestKey, nearestTime = candidate, candidateKey, info.ModTime().UnixNano()
+		}
+	}
+	if nearest == "" {
+		return nil, key, &os.PathError{Op: "load", Path: filepath.Join(cache.Dir, key.filename()), Err: os.ErrNotExist}
+	}
+	schema, err = cache.load(nearest)
+	return schema, nearestKey, err
+}
+
+func (cache *Cache) load(location string) (*peer.NetworkSchema, error) {
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return peer.ParseSchemaJSON(file)
+}
+
+func dictionaryFilename(schemaVersion uint32) string {
+	return fmt.Sprintf("%d.dict", schemaVersion)
+}
+
+// StoreDictionary adds the API dictionary of a schema version to the cache
+func (cache *Cache) StoreDictionary(schemaVersion uint32, dictionary []byte) error {
+	err := os.MkdirAll(cache.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(cache.Dir, dictionaryFilename(schemaVersion)), dictionary, 0644)
+}
+
+// LoadDictionary reads the API dictionary of a schema version. If there is
+// none, the error satisfies os.IsNotExist.
+func (cache *Cache) LoadDictionary(schemaVersion uint32) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(cache.Dir, dictionaryFilename(schemaVersion)))
+}
+
+// watcher follows the decoded packets of a conversation for Watch
+type watcher struct {
+	cache   *Cache
+	conv    *capture.Conversation
+	onError func(error)
+	// onNearest is set if schemas of other client versions may be attached
+	onNearest func(requested, matched Key)
+	// key is nil until ID_PROTOCOL_SYNC has been decoded
+	key *Key
+}
+
+func (w *watcher) report(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// storeDictionary adds a dictionary that was supplied with the conversation
+// to the cache, unless the same dictionary is stored already
+func (w *watcher) storeDictionary(schemaVersion uint32, dictionary []byte) {
+	cached, err := w.cache.LoadDictionary(schemaVersion)
+	if err == nil && bytes.Equal(cached, dictionary) {
+		return
+	}
+	if err != nil && !os.IsNotExist(err) {
+		w.report(err)
+	}
+	err = w.cache.StoreDictionary(schemaVersion, dictionary)
+	if err != nil {
+		w.report(err)
+	}
+}
+
+func (w *watcher) handle(e *capture.Event) {
+	if e.IsError || e.Topic != "full-reliable" {
+		return
+	}
+	switch layer := e.Layers.Main.(type) {
+	case *peer.Packet90Layer:
+		key := KeyOf(layer)
+		w.key = &key
+		if w.conv.Context.APIDictionary != nil {
+			w.storeDictionary(key.SchemaVersion, w.conv.Context.APIDictionary)
+		} else {
+			dictionary, err := w.cache.LoadDictionary(key.SchemaVersion)
+			if err == nil {
+				w.conv.Context.APIDictionary = dictionary
+			} else if !os.IsNotExist(err) {
+				w.report(err)
+			}
+		}
+		if w.conv.Context.NetworkSchema != nil {
+			return
+		}
+		var schema *peer.NetworkSchema
+		var err error
+		matched := key
+		if w.onNearest != nil {
+			schema, matched, err = w.cache.LoadNearest(key)
+		} else {
+			schema, err = w.cache.Load(key)
+		}
+		if err != nil {
+			if !os.IsNotExist(err) {
+				w.report(err)
+			}
+			return
+		}
+		w.conv.Context.NetworkSchema = schema
+		if matched != key {
+			w.onNearest(key, matched)
+		}
+	case *peer.Packet97Layer:
+		if w.key == nil {
+			return
+		}
+		err := w.cache.Store(*w.key, layer.Schema)
+		if err != nil {
+			w.report(err)
+		}
+	}
+}
+
+// Watch makes the cache follow the packets decoded in conv. The schema of the
+// conversation is stored once ID_NEW_SCHEMA has been decoded. If the conversation
+// has no schema when ID_PROTOCOL_SYNC is decoded, the cached schema for the
+// client's version is attached to it. Likewise, the API dictionary of the
+// conversation is stored for the schema version, or the cached one is attached
+// if it has none. onError is called with errors reading or writing the cache
+// and may be nil.
+func (cache *Cache) Watch(conv *capture.Conversation, onError func(error)) {
+	w := &watcher{cache: cache, conv: conv, onError: onError}
+	conv.Bind(w.handle)
+}
+
+// WatchNearest is like Watch, but if no schema is cached for the client's
+// version, the schema found by LoadNearest is attached instead. onNearest is
+// then called with the client's key and the key of the attached schema, so
+// that the schema can be reported as approximate.
+func (cache *Cache) WatchNearest(conv *capture.Conversation, onNearest func(requested, matched Key), onError func(error)) {
+	w := &watcher{cache: cache, conv: conv, onError: onError, onNearest: onNearest}
+	conv.Bind(w.handle)
+}
@@ -0,0 +1,197 @@
+package schemacache
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/peer"
+)
+
+func testSchema(t *testing.T, className string) *peer.NetworkSchema {
+	schema, err := peer.ParseSchemaJSON(strings.NewReader(`{"version": 1, "enums": [], "instances": [{"name": "` + className + `", "properties": [], "events": []}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func newCache(t *testing.T) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "schemacache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(dir), func() { os.RemoveAll(dir) }
+}
+
+func TestCacheLoad(t *testing.T) {
+	cache, cleanup := newCache(t)
+	defer cleanup()
+
+	key := Key{SchemaVersion: 36, VersionID: peer.Packet90VersionID{1, -2, 3, 4, 5}}
+	if _, err := cache.Load(key); !os.IsNotExist(err) {
+		t.Fatalf("loading from an empty cache returned %v", err)
+	}
+	err := cache.Store(key, testSchema(t, "Part"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := cache.Load(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.SchemaForClass("Part") == nil {
+		t.Error("loaded the wrong schema")
+	}
+
+	// other clients with the same schema version don't get it
+	other := Key{SchemaVersion: 36}
+	if _, err = cache.Load(other); !os.IsNotExist(err) {
+		t.Errorf("loading another client version returned %v", err)
+	}
+	if _, err = cache.Load(Key{SchemaVersion: 37}); !os.IsNotExist(err) {
+		t.Errorf("loading another schema version returned %v", err)
+	}
+}
+
+func TestCacheLoadNearest(t *testing.T) {
+	cache, cleanup := newCache(t)
+	defer cleanup()
+
+	older := Key{SchemaVersion: 36, VersionID: peer.Packet90VersionID{1, -2, 3, 4, 5}}
+	newer := Key{SchemaVersion: 36, VersionID: peer.Packet90VersionID{6, 7, 8, 9, 10}}
+	if err := cache.Store(older, testSchema(t, "Part")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Store(newer, testSchema(t, "Model")); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(cache.Dir, older.filename()), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, matched, err := cache.LoadNearest(older)
+	if err != nil || matched != older || schema.SchemaForClass("Part") == nil {
+		t.Errorf("loading an exact key matched %v: %v", matched, err)
+	}
+	// other clients with the same schema version get the newest one
+	schema, matched, err = cache.LoadNearest(Key{SchemaVersion: 36})
+	if err != nil || matched != newer || schema.SchemaForClass("Model") == nil {
+		t.Errorf("loading the nearest schema matched %v: %v", matched, err)
+	}
+	if _, _, err = cache.LoadNearest(Key{SchemaVersion: 37}); !os.IsNotExist(err) {
+		t.Errorf("loading another schema version returned %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cache, cleanup := newCache(t)
+	defer cleanup()
+
+	sync := &peer.Packet90Layer{SchemaVersion: 36, VersionID: peer.Packet90VersionID{1, 2, 3, 4, 5}}
+	event := func(conv *capture.Conversation, layer peer.RakNetPacket) *capture.Event {
+		return &capture.Event{Conversation: conv, Topic: "full-reliable", Layers: &peer.PacketLayers{Main: layer}}
+	}
+	var errors []error
+	newWatcher := func() *watcher {
+		client := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+		server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+		return &watcher{cache: cache, conv: capture.NewConversation(client, server), onError: func(err error) {
+			errors = append(errors, err)
+		}}
+	}
+
+	// the first conversation has a schema, which is cached
+	first := newWatcher()
+	first.handle(event(first.conv, sync))
+	first.handle(event(first.conv, &peer.Packet97Layer{Schema: testSchema(t, "Part")}))
+
+	// the second one lacks ID_NEW_SCHEMA, so it gets the cached one
+	second := newWatcher()
+	second.handle(event(second.conv, sync))
+	if second.conv.Context.NetworkSchema == nil || second.conv.Context.NetworkSchema.SchemaForClass("Part") == nil {
+		t.Error("cached schema wasn't attached")
+	}
+
+	// a schema that has been attached already isn't replaced
+	external := testSchema(t, "Model")
+	third := newWatcher()
+	third.conv.Context.NetworkSchema = external
+	third.handle(event(third.conv, sync))
+	if third.conv.Context.NetworkSchema != external {
+		t.Error("external schema was replaced")
+	}
+
+	// other client versions only get it if approximate schemas are allowed
+	otherSync := &peer.Packet90Layer{SchemaVersion: 36, VersionID: peer.Packet90VersionID{5, 4, 3, 2, 1}}
+	fourth := newWatcher()
+	fourth.handle(event(fourth.conv, otherSync))
+	if fourth.conv.Context.NetworkSchema != nil {
+		t.Error("schema of another client version was attached")
+	}
+	var nearest []Key
+	fifth := newWatcher()
+	fifth.onNearest = func(requested, matched Key) {
+		nearest = append(nearest, requested, matched)
+	}
+	fifth.handle(event(fifth.conv, otherSync))
+	if fifth.conv.Context.NetworkSchema == nil || len(nearest) != 2 || nearest[0] != KeyOf(otherSync) || nearest[1] != KeyOf(sync) {
+		t.Errorf("nearest schema wasn't attached and reported: %v", nearest)
+	}
+	if len(errors) != 0 {
+		t.Errorf("cache errors: %v", errors)
+	}
+}
+
+func TestWatchDictionary(t *testing.T) {
+	cache, cleanup := newCache(t)
+	defer cleanup()
+
+	if _, err := cache.LoadDictionary(36); !os.IsNotExist(err) {
+		t.Fatalf("loading from an empty cache returned %v", err)
+	}
+	dictionary := []byte("ReplicatedStorage Workspace Players")
+	if err := cache.StoreDictionary(36, dictionary); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	w := &watcher{cache: cache, conv: capture.NewConversation(client, server), onError: func(err error) {
+		t.Error(err)
+	}}
+	sync := &peer.Packet90Layer{SchemaVersion: 36}
+	w.handle(&capture.Event{Conversation: w.conv, Topic: "full-reliable", Layers: &peer.PacketLayers{Main: sync}})
+	if string(w.conv.Context.APIDictionary) != string(dictionary) {
+		t.Errorf("attached dictionary %q", w.conv.Context.APIDictionary)
+	}
+}
+
+func TestWatchStoresDictionary(t *testing.T) {
+	cache, cleanup := newCache(t)
+	defer cleanup()
+
+	client := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1).To4(), Port: 50000}
+	server := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2).To4(), Port: 53640}
+	w := &watcher{cache: cache, conv: capture.NewConversation(client, server), onError: func(err error) {
+		t.Error(err)
+	}}
+	// a dictionary supplied with the conversation is cached for later captures
+	dictionary := []byte("ReplicatedStorage Workspace Players")
+	w.conv.Context.APIDictionary = dictionary
+	sync := &peer.Packet90Layer{SchemaVersion: 37}
+	w.handle(&capture.Event{Conversation: w.conv, Topic: "full-reliable", Layers: &peer.PacketLayers{Main: sync}})
+	cached, err := cache.LoadDictionary(37)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cached) != string(dictionary) {
+		t.Errorf("cached dictionary %q", cached)
+	}
+}
@@ -0,0 +1,502 @@
+// Package store implements a disk-backed packet store for captures that are
+// too large to keep in memory. The raw datagrams of a conversation and short
+// summaries of its decoded packets are written to temporary files, and only
+// a small index and a bounded cache of decoded packets are kept in memory.
+// Packets that have been evicted from the cache are decoded again from the
+// raw datagrams when they are needed.
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/peer"
+)
+
+// DefaultCacheSize is the number of decoded packets a Store keeps in memory
+const DefaultCacheSize = 1024
+
+// ErrClosed is returned when a closed Store is used
+var ErrClosed = errors.New("packet store is closed")
+
+// Summary flags
+const (
+	FlagFromClient = 1 << iota
+	FlagFromServer
+	FlagHasLength
+	FlagError
+	FlagDegraded
+	// FlagHasChildren is set for packets that are shown with subpackets
+	FlagHasChildren
+)
+
+// Summary is the part of a decoded packet that is needed to list it
+type Summary struct {
+	ID uint64
+	// Datagram is the index of the datagram that completed the packet
+	Datagram uint32
+	Time     time.Time
+	Flags    uint8
+	Length   uint32
+	// Text is the description of the packet, as returned by PacketLayers.String()
+	Text string
+}
+
+// Has reports whether all of flags are set
+func (summary *Summary) Has(flags uint8) bool {
+	return summary.Flags&flags == flags
+}
+
+// Summarize creates a summary of layers, which were completed by datagram
+func Summarize(layers *peer.PacketLayers, datagram uint32) *Summary {
+	summary := &Summary{
+		ID:       layers.UniqueID,
+		Datagram: datagram,
+		Time:     layers.Root.Timestamp,
+		Text:     layers.String(),
+	}
+	if layers.Root.FromClient {
+		summary.Flags |= FlagFromClient
+	} else if layers.Root.FromServer {
+		summary.Flags |= FlagFromServer
+	}
+	if layers.Error != nil {
+		summary.Flags |= FlagError
+	}
+	if len(layers.Degradations) != 0 {
+		summary.Flags |= FlagDegraded
+	}
+	if len(layers.OfflinePayload) > 0 {
+		summary.Flags |= FlagHasLength
+		summary.Length = uint32(len(layers.OfflinePayload))
+	} else if layers.SplitPacket != nil {
+		summary.Flags |= FlagHasLength
+		summary.Length = layers.SplitPacket.RealLength
+		summary.Time = layers.SplitPacket.FirstTimestamp
+	}
+	return summary
+}
+
+// encodeTime encodes timestamps as nanoseconds since the Unix epoch.
+// Zero timestamps are encoded as 0.
+func encodeTime(timestamp time.Time) uint64 {
+	if timestamp.IsZero() {
+		return 0
+	}
+	return uint64(timestamp.UnixNano())
+}
+
+func decodeTime(encoded uint64) time.Time {
+	if encoded == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(encoded))
+}
+
+// Store is a disk-backed store of the traffic of a single conversation.
+// It is safe for concurrent use.
+type Store struct {
+	// CacheSize is the maximum number of decoded packets kept in memory
+	CacheSize int
+
+	mutex  sync.Mutex
+	dir    string
+	closed bool
+
+	datagramFile   *os.File
+	datagramWriter *bufio.Writer
+	datagramCount  uint32
+
+	packetFile   *os.File
+	packetWriter *bufio.Writer
+	packetSize   int64
+	// offsets contains the offset of each packet summary in the order they were added
+	offsets []int64
+	// byID contains the indices of the packet summaries sorted by their IDs
+	byID []uint32
+	ids  []uint64
+
+	cache      map[uint64]*list.Element
+	cacheOrder *list.List
+
+	// redecodeMutex serializes re-decodes, which share redecoding
+	redecodeMutex sync.Mutex
+	redecoding    *redecodeCursor
+}
+
+// New creates a store in a new temporary directory inside dir.
+// If dir is empty, the default directory for temporary files is used.
+func New(dir string) (*Store, error) {
+	storeDir, err := ioutil.TempDir(dir, "sala-store")
+	if err != nil {
+		return nil, err
+	}
+	datagramFile, err := os.Create(filepath.Join(storeDir, "datagrams"))
+	if err != nil {
+		os.RemoveAll(storeDir)
+		return nil, err
+	}
+	packetFile, err := os.Create(filepath.Join(storeDir, "packets"))
+	if err != nil {
+		datagramFile.Close()
+		os.RemoveAll(storeDir)
+		return nil, err
+	}
+	return &Store{
+		CacheSize:      DefaultCacheSize,
+		dir:            storeDir,
+		datagramFile:   datagramFile,
+		datagramWriter: bufio.NewWriter(datagramFile),
+		packetFile:     packetFile,
+		packetWriter:   bufio.NewWriter(packetFile),
+		cache:          make(map[uint64]*list.Element),
+		cacheOrder:     list.New(),
+	}, nil
+}
+
+// Close removes the files of the store
+func (store *Store) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.closed {
+		return nil
+	}
+	store.closed = true
+	store.datagramFile.Close()
+	store.packetFile.Close()
+	store.cache = nil
+	store.cacheOrder = nil
+	return os.RemoveAll(store.dir)
+}
+
+// AddDatagram appends a raw datagram to the store and returns its index
+func (store *Store) AddDatagram(timestamp time.Time, fromClient bool, payload []byte) (uint32, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.closed {
+		return 0, ErrClosed
+	}
+
+	var header [13]byte
+	binary.LittleEndian.PutUint64(header[0:], encodeTime(timestamp))
+	if fromClient {
+		header[8] = 1
+	}
+	binary.LittleEndian.PutUint32(header[9:], uint32(len(payload)))
+	_, err := store.datagramWriter.Write(header[:])
+	if err != nil {
+		return 0, err
+	}
+	_, err = store.datagramWriter.Write(payload)
+	if err != nil {
+		return 0, err
+	}
+	store.datagramCount++
+	return store.datagramCount - 1, nil
+}
+
+// DatagramCount returns the number of datagrams in the store
+func (store *Store) DatagramCount() uint32 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.datagramCount
+}
+
+// AddPacket appends the summary of a decoded packet to the store
+func (store *Store) AddPacket(summary *Summary) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.closed {
+		return ErrClosed
+	}
+
+	var header [29]byte
+	binary.LittleEndian.PutUint64(header[0:], summary.ID)
+	binary.LittleEndian.PutUint32(header[8:], summary.Datagram)
+	binary.LittleEndian.PutUint64(header[12:], encodeTime(summary.Time))
+	header[20] = summary.Flags
+	binary.LittleEndian.PutUint32(header[21:], summary.Length)
+	binary.LittleEndian.PutUint32(header[25:], uint32(len(summary.Text)))
+	_, err := store.packetWriter.Write(header[:])
+	if err != nil {
+		return err
+	}
+	_, err = store.packetWriter.WriteString(summary.Text)
+	if err != nil {
+		return err
+	}
+
+	index := uint32(len(store.offsets))
+	store.offsets = append(store.offsets, store.packetSize)
+	store.ids = append(store.ids, summary.ID)
+	store.packetSize += int64(len(header) + len(summary.Text))
+
+	// IDs are almost always added in order, so search for the position from the end
+	position := len(store.byID)
+	for position > 0 && store.ids[store.byID[position-1]] > summary.ID {
+		position--
+	}
+	store.byID = append(store.byID, 0)
+	copy(store.byID[position+1:], store.byID[position:])
+	store.byID[position] = index
+	return nil
+}
+
+// Len returns the number of packets in the store
+func (store *Store) Len() int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return len(store.offsets)
+}
+
+// Index returns the index of the packet with the given ID
+func (store *Store) Index(id uint64) (int, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	position := sort.Search(len(store.byID), func(i int) bool {
+		return store.ids[store.byID[i]] >= id
+	})
+	if position == len(store.byID) || store.ids[store.byID[position]] != id {
+		return 0, false
+	}
+	return int(store.byID[position]), true
+}
+
+// Packets reads the summaries of count packets starting at index start
+func (store *Store) Packets(start int, count int) ([]*Summary, error) {
+	store.mutex.Lock()
+	if store.closed {
+		store.mutex.Unlock()
+		return nil, ErrClosed
+	}
+	if start < 0 || start > len(store.offsets) {
+		store.mutex.Unlock()
+		return nil, fmt.Errorf("packet index %d out of range", start)
+	}
+	if start+count > len(store.offsets) {
+		count = len(store.offsets) - start
+	}
+	err := store.packetWriter.Flush()
+	if err != nil || count == 0 {
+		store.mutex.Unlock()
+		return nil, err
+	}
+	offset := store.offsets[start]
+	end := store.packetSize
+	if start+count < len(store.offsets) {
+		end = store.offsets[start+count]
+	}
+	file := store.packetFile
+	store.mutex.Unlock()
+
+	// os.File.ReadAt may be called concurrently with writes to the file
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, end-offset))
+	summaries := make([]*Summary, 0, count)
+	for i := 0; i < count; i++ {
+		var header [29]byte
+		_, err = io.ReadFull(reader, header[:])
+		if err != nil {
+			return nil, err
+		}
+		text := make([]byte, binary.LittleEndian.Uint32(header[25:]))
+		_, err = io.ReadFull(reader, text)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &Summary{
+			ID:       binary.LittleEndian.Uint64(header[0:]),
+			Datagram: binary.LittleEndian.Uint32(header[8:]),
+			Time:     decodeTime(binary.LittleEndian.Uint64(header[12:])),
+			Flags:    header[20],
+			Length:   binary.LittleEndian.Uint32(header[21:]),
+			Text:     string(text),
+		})
+	}
+	return summaries, nil
+}
+
+// Packet reads the summary of the packet with the given ID
+func (store *Store) Packet(id uint64) (*Summary, error) {
+	index, ok := store.Index(id)
+	if !ok {
+		return nil, fmt.Errorf("packet %d is not in the store", id)
+	}
+	summaries, err := store.Packets(index, 1)
+	if err != nil {
+		return nil, err
+	}
+	return summaries[0], nil
+}
+
+// Remember adds decoded layers to the cache, evicting the least
+// recently used packet if the cache is full
+func (store *Store) Remember(layers *peer.PacketLayers) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.closed {
+		return
+	}
+	if element, ok := store.cache[layers.UniqueID]; ok {
+		element.Value = layers
+		store.cacheOrder.MoveToFront(element)
+		return
+	}
+	store.cache[layers.UniqueID] = store.cacheOrder.PushFront(layers)
+	for store.cacheOrder.Len() > store.CacheSize && store.cacheOrder.Len() > 1 {
+		oldest := store.cacheOrder.Back()
+		store.cacheOrder.Remove(oldest)
+		delete(store.cache, oldest.Value.(*peer.PacketLayers).UniqueID)
+	}
+}
+
+// Cached returns the decoded layers of a packet if they are in the cache
+func (store *Store) Cached(id uint64) (*peer.PacketLayers, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.closed {
+		return nil, false
+	}
+	element, ok := store.cache[id]
+	if !ok {
+		return nil, false
+	}
+	store.cacheOrder.MoveToFront(element)
+	return element.Value.(*peer.PacketLayers), true
+}
+
+// redecodeCursor is the state of the last re-decode. Later packets are
+// decoded by resuming it, so that moving forward through a capture doesn't
+// replay it from the first datagram every time.
+type redecodeCursor struct {
+	conv     *capture.Conversation
+	settings redecodeSettings
+	// next is the index of the next datagram to be read, at offset in the datagram file
+	next   uint32
+	offset int64
+	wanted uint64
+	found  *peer.PacketLayers
+}
+
+// redecodeSettings are the settings of a conversation that decide
+// whether its packets are decoded the same way
+type redecodeSettings struct {
+	degraded   bool
+	schema     *peer.NetworkSchema
+	dictionary []byte
+	version    peer.ProtocolVersion
+}
+
+func settingsOf(context *peer.CommunicationContext) redecodeSettings {
+	return redecodeSettings{
+		degraded:   context.Degraded,
+		schema:     context.NetworkSchema,
+		dictionary: context.APIDictionary,
+		version:    context.ProtocolVersion,
+	}
+}
+
+func (settings redecodeSettings) equal(other redecodeSettings) bool {
+	return settings.degraded == other.degraded &&
+		settings.schema == other.schema &&
+		bytes.Equal(settings.dictionary, other.dictionary) &&
+		settings.version == other.version
+}
+
+// Redecode decodes the packet with the given ID again by replaying the stored
+// datagrams into a conversation created by newConversation, which must have the
+// same endpoints and settings as the captured one. Because the datagrams are
+// decoded in the order they were captured in, the packets are given the same IDs.
+// All re-decoded packets are added to the cache.
+//
+// The conversation of the last call is resumed if the packet was completed by a
+// later datagram and the settings of newConversation haven't changed. Decoders can't be rewound, so packets that precede it and have
+// been evicted from the cache are decoded by replaying from the first datagram.
+func (store *Store) Redecode(ctx context.Context, newConversation func() *capture.Conversation, id uint64) (*peer.PacketLayers, error) {
+	summary, err := store.Packet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	err = store.datagramWriter.Flush()
+	file := store.datagramFile
+	store.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	store.redecodeMutex.Lock()
+	defer store.redecodeMutex.Unlock()
+	fresh := newConversation()
+	cursor := store.redecoding
+	if cursor == nil || cursor.next > summary.Datagram || !cursor.settings.equal(settingsOf(fresh.Context)) {
+		cursor = &redecodeCursor{conv: fresh, settings: settingsOf(fresh.Context)}
+		cursor.conv.Bind(func(e *capture.Event) {
+			if e.Topic == "reliable" || e.Topic == "reliability" {
+				return
+			}
+			store.Remember(e.Layers)
+			if e.Layers.UniqueID == cursor.wanted {
+				cursor.found = e.Layers
+			}
+		})
+		store.redecoding = cursor
+	}
+	cursor.wanted = id
+	cursor.found = nil
+
+	conv := cursor.conv
+	reader := bufio.NewReader(io.NewSectionReader(file, cursor.offset, 1<<62))
+	for cursor.next <= summary.Datagram && cursor.found == nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		var header [13]byte
+		_, err = io.ReadFull(reader, header[:])
+		if err != nil {
+			store.redecoding = nil
+			return nil, err
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(header[9:]))
+		_, err = io.ReadFull(reader, payload)
+		if err != nil {
+			store.redecoding = nil
+			return nil, err
+		}
+		cursor.next++
+		cursor.offset += int64(len(header) + len(payload))
+
+		fromClient := header[8] == 1
+		source, dest := conv.Server, conv.Client
+		packetReader := conv.ServerReader
+		if fromClient {
+			source, dest = conv.Client, conv.Server
+			packetReader = conv.ClientReader
+		}
+		layers := capture.NewLayers(source, dest, fromClient)
+		layers.Root.Timestamp = decodeTime(binary.LittleEndian.Uint64(header[0:]))
+		packetReader.(peer.PacketReader).ReadPacket(payload, layers)
+	}
+	if cursor.found == nil {
+		return nil, fmt.Errorf("packet %d wasn't decoded again", id)
+	}
+	// packets completed by the same datagram may have evicted it
+	store.Remember(cursor.found)
+	return cursor.found, nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/capture/capturetest"
+)
+
+func TestStoreRedecodesEvictedPackets(t *testing.T) {
+	store, err := New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.CacheSize = 2
+
+	conv := capturetest.NewMidSessionConversation()
+	var ids []uint64
+	conv.Bind(func(e *capture.Event) {
+		if e.Topic != "full-reliable" {
+			return
+		}
+		if e.IsError {
+			t.Errorf("decode error: %s", e.Layers.Error)
+		}
+		err := store.AddPacket(Summarize(e.Layers, store.DatagramCount()-1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Remember(e.Layers)
+		ids = append(ids, e.Layers.UniqueID)
+	})
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := byte(1); i <= 5; i++ {
+		fromClient := i%2 == 0
+		payload := capturetest.ReliablePing(i)
+		timestamp := start.Add(time.Duration(i) * time.Millisecond)
+		_, err = store.AddDatagram(timestamp, fromClient, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		capturetest.Read(conv, payload, fromClient, timestamp)
+	}
+
+	if store.Len() != 5 || len(ids) != 5 {
+		t.Fatalf("store has %d packets, %d were decoded", store.Len(), len(ids))
+	}
+	summaries, err := store.Packets(1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 4 {
+		t.Fatalf("read %d summaries, expected 4", len(summaries))
+	}
+	if summaries[0].ID != ids[1] || !summaries[0].Has(FlagFromClient) || summaries[1].Has(FlagFromClient) {
+		t.Errorf("summary differs: %+v", summaries[0])
+	}
+	if !summaries[0].Time.Equal(start.Add(2*time.Millisecond)) || summaries[0].Length != 9 {
+		t.Errorf("summary differs: %+v", summaries[0])
+	}
+	if index, ok := store.Index(ids[3]); !ok || index != 3 {
+		t.Errorf("index of packet %d is %d", ids[3], index)
+	}
+
+	if _, ok := store.Cached(ids[0]); ok {
+		t.Error("evicted packet is still cached")
+	}
+	if _, ok := store.Cached(ids[4]); !ok {
+		t.Error("recent packet isn't cached")
+	}
+	layers, err := store.Redecode(context.Background(), capturetest.NewMidSessionConversation, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layers.UniqueID != ids[1] || !layers.Root.FromClient || layers.String() != summaries[0].Text {
+		t.Errorf("redecoded %s, expected %s", layers.String(), summaries[0].Text)
+	}
+	if _, ok := store.Cached(ids[1]); !ok {
+		t.Error("redecoded packet wasn't cached")
+	}
+
+	// later packets resume the last re-decode, earlier ones replay from the start
+	cursor := store.redecoding
+	cases := []struct {
+		index   int
+		resumed bool
+	}{{2, true}, {3, true}, {0, false}}
+	for _, c := range cases {
+		layers, err = store.Redecode(context.Background(), capturetest.NewMidSessionConversation, ids[c.index])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if layers.UniqueID != ids[c.index] || (store.redecoding == cursor) != c.resumed {
+			t.Errorf("redecoding packet %d resumed the last re-decode: %v", c.index, !c.resumed)
+		}
+		cursor = store.redecoding
+	}
+
+	// so do packets decoded with different settings
+	_, err = store.Redecode(context.Background(), func() *capture.Conversation {
+		conv := capturetest.NewMidSessionConversation()
+		conv.Context.ProtocolVersion = 40
+		return conv
+	}, ids[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.redecoding == cursor {
+		t.Error("redecoding with a new protocol version resumed the last re-decode")
+	}
+}
+
+func TestStoreIndexOutOfOrder(t *testing.T) {
+	store, err := New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, id := range []uint64{1, 3, 2, 4} {
+		err = store.AddPacket(&Summary{ID: id, Text: "packet"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for index, id := range []uint64{1, 3, 2, 4} {
+		if found, ok := store.Index(id); !ok || found != index {
+			t.Errorf("index of packet %d is %d, expected %d", id, found, index)
+		}
+	}
+	if _, ok := store.Index(5); ok {
+		t.Error("found a packet that isn't in the store")
+	}
+
+	store.Close()
+	if err = store.AddPacket(&Summary{ID: 5}); err != ErrClosed {
+		t.Errorf("adding to a closed store returned %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/olebedev/emitter"
+)
+
+// readCapture decodes the first conversation in a pcap or pcapng file
+func readCapture(filename string) (*peer.CapturedConversation, error) {
+	file, err := capture.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var captured *peer.CapturedConversation
+	var first *capture.Conversation
+	session := capture.NewSession(func(e *capture.Event) {
+		if e.Conversation != first {
+			return
+		}
+		if e.Topic != "full-reliable" && (e.Topic != "offline" || e.IsError) {
+			return
+		}
+		captured.Packets = append(captured.Packets, e.Layers)
+	})
+	session.NewConversation = func(conv *capture.Conversation) {
+		if first == nil {
+			first = conv
+			captured = &peer.CapturedConversation{Context: conv.Context}
+		}
+	}
+
+	ctx := context.Background()
+	err = capture.CapturePackets(ctx, session, file.Packets(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, errors.New("no conversation found in capture")
+	}
+
+	return captured, nil
+}
+
+func main() {
+	serverAddrName := flag.String("server", "127.0.0.1:53640", "Address of the server to replay the capture against")
+	window := flag.Duration("window", 200*time.Millisecond, "How long to collect server responses after each replayed packet")
+	joinTimeout := flag.Duration("jointimeout", 10*time.Second, "How long to wait for the server to accept the join")
+	serve := flag.Bool("serve", false, "If set, will play back the server half of the capture to connecting clients instead")
+	port := flag.Uint("port", 53640, "Port to listen on when playing back the server half")
+	flag.Parse()
+	inFileName := flag.Arg(0)
+
+	if inFileName == "" {
+		flag.Usage()
+		return
+	}
+
+	capture, err := readCapture(inFileName)
+	if err != nil {
+		panic(err)
+	}
+
+	if *serve {
+		server, err := peer.NewPlaybackServer(context.Background(), uint16(*port), capture)
+		if err != nil {
+			panic(err)
+		}
+		server.ClientEmitter.On("client", func(e *emitter.Event) {
+			fmt.Printf("Playing back to %s\n", e.Args[0].(*peer.ServerClient).Address)
+		}, emitter.Void)
+		fmt.Printf("Serving %d packets on port %d\n", len(capture.Packets), *port)
+		err = server.Start()
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	serverAddr, err := net.ResolveUDPAddr("udp", *serverAddrName)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Replaying %d packets to %s\n", len(capture.Packets), serverAddr)
+
+	replay := peer.NewClientReplay(context.Background(), capture, serverAddr)
+	replay.ResponseWindow = *window
+	replay.JoinTimeout = *joinTimeout
+
+	divergences := 0
+	replay.DivergenceEmitter.On("divergence", func(e *emitter.Event) {
+		divergences++
+		fmt.Println(e.Args[0].(*peer.ReplayDivergence).String())
+	}, emitter.Void)
+
+	err = replay.Replay()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Replay finished with %d divergences\n", divergences)
+}
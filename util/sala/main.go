@@ -0,0 +1,549 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Gskartwii/roblox-dissector/capture"
+	"github.com/Gskartwii/roblox-dissector/export"
+	"github.com/Gskartwii/roblox-dissector/filter"
+	"github.com/Gskartwii/roblox-dissector/peer"
+	"github.com/Gskartwii/roblox-dissector/schemacache"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+	"github.com/yuin/gopher-lua"
+)
+
+const usage = `usage: sala <command> [flags] [arguments]
+
+Commands:
+  read        decode packets from a pcap or pcapng file
+  live        decode packets from a network interface
+  schemadiff  compare the network schemas of two schema files or captures
+
+Run "sala <command> -h" for the flags of a command.
+`
+
+type options struct {
+	JSON       bool
+	FilterFile string
+	DumpDir    string
+	MidSession bool
+	// Workers is the number of goroutines decoding conversations in parallel
+	Workers int
+	// SchemaFile is used by conversations whose ID_NEW_SCHEMA wasn't captured
+	SchemaFile     string
+	SchemaCacheDir string
+	NoSchemaCache  bool
+	// Verify enables round-trip verification of the decoded packets
+	Verify bool
+	// ProtocolVersion is used by conversations whose ID_PROTOCOL_SYNC wasn't captured
+	ProtocolVersion uint
+	// DictionaryFile is used by conversations whose API dictionary isn't cached
+	DictionaryFile string
+}
+
+func (opts *options) bind(flags *flag.FlagSet) {
+	flags.BoolVar(&opts.JSON, "json", false, "If set, will print packets as newline-delimited JSON")
+	flags.StringVar(&opts.FilterFile, "filter", "", "Path to a Lua filter script")
+	flags.StringVar(&opts.DumpDir, "dump", "", "If set, will dump the DataModel of each conversation into this directory")
+	flags.BoolVar(&opts.MidSession, "midsession", false, "If set, will also decode conversations that started before the capture. Other UDP traffic may be mistaken for them.")
+	flags.StringVar(&opts.SchemaFile, "schema", "", "Path to a schema file or capture whose schema is used by conversations whose ID_NEW_SCHEMA wasn't captured")
+	flags.StringVar(&opts.SchemaCacheDir, "schemacache", "", "Directory of the schema cache (default: in the user's cache directory)")
+	flags.BoolVar(&opts.NoSchemaCache, "noschemacache", false, "If set, won't read schemas from or write them to the schema cache")
+	flags.BoolVar(&opts.Verify, "verify", false, "If set, will check that every decoded packet serializes back into the same bytes and print a summary per packet type")
+	flags.StringVar(&opts.DictionaryFile, "dictionary", "", "Path to the zstd dictionary used if the server enables API dictionary compression, which is added to the schema cache (default: from the schema cache)")
+	flags.UintVar(&opts.ProtocolVersion, "protocol", 0, "Protocol version used by conversations whose ID_PROTOCOL_SYNC wasn't captured (default: detect the packet formats)")
+}
+
+type dissector struct {
+	opts     options
+	output   io.Writer
+	exporter *export.Exporter
+	session  *capture.Session
+	// mutex serializes the output and the filter, which are
+	// used by every conversation when decoding in parallel
+	mutex sync.Mutex
+	// indices are the 1-based numbers of conversations in the order they were detected
+	indices map[*capture.Conversation]int
+	// verifiers are the round-trip verifiers of every reader if Verify is set
+	verifiers []*peer.RoundTripVerifier
+
+	filter      *lua.FunctionProto
+	filterState *lua.LState
+}
+
+func newDissector(opts options, output io.Writer) (*dissector, error) {
+	dis := &dissector{
+		opts:     opts,
+		output:   output,
+		exporter: export.NewExporter(output),
+		indices:  make(map[*capture.Conversation]int),
+	}
+	var schema *peer.NetworkSchema
+	if opts.SchemaFile != "" {
+		var err error
+		schema, err = loadSchema(opts.SchemaFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var dictionary []byte
+	if opts.DictionaryFile != "" {
+		var err error
+		dictionary, err = ioutil.ReadFile(opts.DictionaryFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var cache *schemacache.Cache
+	if opts.SchemaCacheDir != "" {
+		cache = schemacache.New(opts.SchemaCacheDir)
+	} else if !opts.NoSchemaCache {
+		var err error
+		cache, err = schemacache.Default()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "schemas won't be cached: %s\n", err.Error())
+		}
+	}
+	if opts.NoSchemaCache {
+		cache = nil
+	}
+
+	dis.session = capture.NewSession(dis.handle)
+	dis.session.MidSession = opts.MidSession
+	dis.session.NewConversation = func(conv *capture.Conversation) {
+		dis.mutex.Lock()
+		index := len(dis.indices) + 1
+		dis.indices[conv] = index
+		dis.mutex.Unlock()
+		if opts.Verify {
+			dis.verify(index, conv)
+		}
+		if conv.Context.NetworkSchema == nil {
+			conv.Context.NetworkSchema = schema
+		}
+		if conv.Context.APIDictionary == nil {
+			conv.Context.APIDictionary = dictionary
+		}
+		if !conv.Context.ProtocolVersion.Known() {
+			conv.Context.ProtocolVersion = peer.ProtocolVersion(opts.ProtocolVersion)
+		}
+		if cache != nil {
+			cache.WatchNearest(conv, func(requested, matched schemacache.Key) {
+				fmt.Fprintf(os.Stderr, "conversation %d: no schema is cached for client version %s, using the approximate schema of %s\n", index, requested, matched)
+			}, func(err error) {
+				fmt.Fprintf(os.Stderr, "schema cache error: %s\n", err.Error())
+			})
+		}
+	}
+	if opts.FilterFile != "" {
+		script, err := ioutil.ReadFile(opts.FilterFile)
+		if err != nil {
+			return nil, err
+		}
+		dis.filter, err = filter.CompileFilter(string(script))
+		if err != nil {
+			return nil, err
+		}
+		dis.filterState = filter.NewLuaFilterState(func(text string) {
+			fmt.Fprint(os.Stderr, text)
+		})
+	}
+	return dis, nil
+}
+
+func (dis *dissector) accepts(layers *peer.PacketLayers) (bool, error) {
+	if dis.filter == nil {
+		return true, nil
+	}
+	// when filtering, drop error packets by default
+	if layers.Main == nil || layers.Error != nil {
+		return false, nil
+	}
+	return filter.FilterAcceptsPacket(dis.filterState, dis.filter, layers.Main)
+}
+
+// packetRecord is the summary of a packet printed in text mode
+type packetRecord struct {
+	Conversation int
+	ID           uint64
+	Time         time.Time
+	Direction    string
+	Source       string
+	Destination  string
+	PacketType   uint8
+	TypeName     string
+	Length       int
+	Packet       string
+	Subpackets   []string
+	Error        string
+	Degradations []string
+}
+
+func newPacketRecord(index int, layers *peer.PacketLayers) *packetRecord {
+	record := &packetRecord{
+		Conversation: index,
+		ID:           layers.UniqueID,
+		Time:         layers.Root.Timestamp,
+		Direction:    "S->C",
+		Source:       layers.Root.Source.String(),
+		Destination:  layers.Root.Destination.String(),
+		PacketType:   layers.PacketType,
+		TypeName:     peer.PacketNames[layers.PacketType],
+		Packet:       layers.String(),
+	}
+	if layers.Root.FromClient {
+		record.Direction = "C->S"
+	}
+	if layers.OfflinePayload != nil {
+		record.Length = len(layers.OfflinePayload)
+	} else if layers.SplitPacket != nil {
+		record.Length = int(layers.SplitPacket.RealLength)
+	}
+	if data, ok := layers.Main.(*peer.Packet83Layer); ok {
+		for _, sub := range data.SubPackets {
+			record.Subpackets = append(record.Subpackets, sub.String())
+		}
+	}
+	if layers.Error != nil {
+		record.Error = layers.Error.Error()
+	}
+	record.Degradations = layers.Degradations
+	return record
+}
+
+func (dis *dissector) printText(record *packetRecord) {
+	fmt.Fprintf(dis.output, "%s %d#%d %s %s (%d bytes)\n", record.Time.Format("15:04:05.000000"), record.Conversation, record.ID, record.Direction, record.Packet, record.Length)
+	for _, sub := range record.Subpackets {
+		fmt.Fprintf(dis.output, "\t%s\n", sub)
+	}
+	for _, degradation := range record.Degradations {
+		fmt.Fprintf(dis.output, "\tdegraded: %s\n", degradation)
+	}
+	if record.Error != "" {
+		fmt.Fprintf(dis.output, "\terror: %s\n", record.Error)
+	}
+}
+
+func (dis *dissector) handle(e *capture.Event) {
+	if e.Topic != "full-reliable" && (e.Topic != "offline" || e.IsError) {
+		return
+	}
+	layers := e.Layers
+	dis.mutex.Lock()
+	defer dis.mutex.Unlock()
+	acc, err := dis.accepts(layers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "filter error on packet %d: %s\n", layers.UniqueID, err.Error())
+		return
+	}
+	if !acc {
+		return
+	}
+
+	index := dis.indices[e.Conversation]
+	if dis.opts.JSON {
+		record := export.NewPacketRecord(layers)
+		record.Conversation = index
+		err = dis.exporter.WriteRecord(record)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode packet %d: %s\n", layers.UniqueID, err.Error())
+		}
+	} else {
+		dis.printText(newPacketRecord(index, layers))
+	}
+}
+
+// writeTo makes the dissector write the raw packets of every conversation to writer
+func (dis *dissector) writeTo(writer *capture.RollingWriter) {
+	dis.session.RawPacket = func(packet gopacket.Packet, conv *capture.Conversation) {
+		err := writer.WritePacket(conv, packet.Metadata().CaptureInfo, packet.Data(), "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write packet: %s\n", err.Error())
+		}
+	}
+	handle := dis.session.Handler
+	dis.session.Handler = func(e *capture.Event) {
+		handle(e)
+		// the conversation has ended, so its file can be closed
+		if e.Topic == "full-reliable" && e.Layers.PacketType == 0x15 {
+			err := writer.CloseConversation(e.Conversation)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to close capture file: %s\n", err.Error())
+			}
+		}
+	}
+}
+
+func (dis *dissector) run(ctx context.Context, packets <-chan gopacket.Packet) error {
+	return capture.CapturePacketsParallel(ctx, dis.session, packets, dis.opts.Workers)
+}
+
+// verify attaches round-trip verifiers to the readers of a conversation
+func (dis *dissector) verify(index int, conv *capture.Conversation) {
+	for _, provider := range []capture.PacketProvider{conv.ClientReader, conv.ServerReader} {
+		reader, ok := provider.(*peer.DefaultPacketReader)
+		if !ok {
+			continue
+		}
+		verifier := peer.NewRoundTripVerifier()
+		verifier.OnMismatch = func(mismatch *peer.RoundTripMismatch) {
+			if mismatch.Err != nil {
+				fmt.Fprintf(os.Stderr, "%d#%d %s failed to serialize: %s\n", index, mismatch.UniqueID, mismatch.TypeString, mismatch.Err.Error())
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%d#%d %s differs at byte %d (%d bytes serialized, %d read)\n", index, mismatch.UniqueID, mismatch.TypeString, mismatch.Offset, len(mismatch.Serialized), len(mismatch.Original))
+		}
+		reader.RoundTrip = verifier
+		dis.mutex.Lock()
+		dis.verifiers = append(dis.verifiers, verifier)
+		dis.mutex.Unlock()
+	}
+}
+
+// printVerification prints the round-trip results of every packet type
+func (dis *dissector) printVerification() {
+	if !dis.opts.Verify {
+		return
+	}
+	total := make(map[string]*peer.RoundTripStats)
+	var names []string
+	for _, verifier := range dis.verifiers {
+		for _, stats := range verifier.Stats() {
+			sum, ok := total[stats.TypeString]
+			if !ok {
+				sum = &peer.RoundTripStats{TypeString: stats.TypeString}
+				total[stats.TypeString] = sum
+				names = append(names, stats.TypeString)
+			}
+			sum.Checked += stats.Checked
+			sum.Mismatched += stats.Mismatched
+		}
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "round-trip verification:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%-32s %d checked, %d mismatched\n", name, total[name].Checked, total[name].Mismatched)
+	}
+}
+
+func (dis *dissector) dump() error {
+	if dis.opts.DumpDir == "" {
+		return nil
+	}
+	for _, conv := range dis.session.Conversations {
+		index := dis.indices[conv]
+		location := filepath.Join(dis.opts.DumpDir, strconv.Itoa(index))
+		err := os.MkdirAll(location, 0755)
+		if err != nil {
+			return err
+		}
+		err = conv.Context.DumpDataModel(location)
+		if err != nil {
+			return fmt.Errorf("failed to dump conversation %d: %s", index, err.Error())
+		}
+	}
+	return nil
+}
+
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+	return ctx
+}
+
+func readCommand(args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("read", flag.ExitOnError)
+	opts.bind(flags)
+	flags.IntVar(&opts.Workers, "workers", 1, "Number of goroutines decoding conversations in parallel. Packets of different conversations may be printed out of order.")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("read requires exactly one pcap or pcapng file")
+	}
+
+	file, err := capture.OpenFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dis, err := newDissector(opts, os.Stdout)
+	if err != nil {
+		return err
+	}
+	ctx := interruptContext()
+	err = dis.run(ctx, file.Packets(ctx))
+	if err != nil {
+		return err
+	}
+	dis.printVerification()
+	return dis.dump()
+}
+
+func liveCommand(args []string) error {
+	var opts options
+	flags := flag.NewFlagSet("live", flag.ExitOnError)
+	opts.bind(flags)
+	iface := flags.String("i", "", "Name of the interface to capture from")
+	promisc := flags.Bool("promisc", false, "If set, will put the interface in promiscuous mode")
+	var rolling capture.RollingOptions
+	flags.StringVar(&rolling.Dir, "w", "", "If set, will write the captured RakNet packets to rolling capture files in this directory")
+	flags.StringVar(&rolling.Prefix, "prefix", "sala", "Prefix of the names of the capture files")
+	flags.BoolVar(&rolling.Ng, "pcapng", false, "If set, will write pcapng files instead of pcap files")
+	flags.BoolVar(&rolling.PerConversation, "perconversation", false, "If set, will write each conversation to its own files")
+	rotateSize := flags.Int64("rotatesize", 0, "Start a new capture file once a file has grown to this many megabytes")
+	flags.DurationVar(&rolling.MaxDuration, "rotatetime", 0, "Start a new capture file once a file spans this long")
+	flags.IntVar(&rolling.MaxFiles, "maxfiles", 0, "Remove the oldest capture files once there are more than this many")
+	maxTotalSize := flags.Int64("maxtotalsize", 0, "Remove the oldest capture files once they take more than this many megabytes")
+	flags.DurationVar(&rolling.Retention, "retention", 0, "Remove capture files that are older than this")
+	flags.Parse(args)
+	if *iface == "" {
+		return errors.New("live requires an interface")
+	}
+	rolling.MaxSize = *rotateSize << 20
+	rolling.MaxTotalSize = *maxTotalSize << 20
+
+	handle, err := pcap.OpenLive(*iface, 2000, *promisc, pcap.BlockForever)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	err = handle.SetBPFFilter("udp")
+	if err != nil {
+		return err
+	}
+
+	dis, err := newDissector(opts, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if rolling.Dir != "" {
+		writer, err := capture.NewRollingWriter(rolling, handle.LinkType(), uint32(handle.SnapLen()))
+		if err != nil {
+			return err
+		}
+		defer writer.Close()
+		dis.writeTo(writer)
+	}
+	err = dis.run(interruptContext(), gopacket.NewPacketSource(handle, handle.LinkType()).Packets())
+	if err != nil {
+		return err
+	}
+	dis.printVerification()
+	return dis.dump()
+}
+
+// loadSchema reads a network schema from a schema file or from the
+// first ID_NEW_SCHEMA packet in a pcap or pcapng file
+func loadSchema(filename string) (*peer.NetworkSchema, error) {
+	extension := strings.ToLower(filepath.Ext(filename))
+	if extension != ".pcap" && extension != ".pcapng" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return peer.ReadSchema(file)
+	}
+
+	file, err := capture.OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var schema *peer.NetworkSchema
+	session := capture.NewSession(func(e *capture.Event) {
+		if layer, ok := e.Layers.Main.(*peer.Packet97Layer); ok && schema == nil {
+			schema = layer.Schema
+			cancel()
+		}
+	})
+	err = capture.CapturePackets(ctx, session, file.Packets(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return nil, fmt.Errorf("%s doesn't contain a schema", filename)
+	}
+	return schema, nil
+}
+
+func schemaDiffCommand(args []string) error {
+	flags := flag.NewFlagSet("schemadiff", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "If set, will print the differences as JSON")
+	ignoreIDs := flags.Bool("noids", false, "If set, won't report items that were only assigned a different network ID")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: sala schemadiff [flags] <old> <new>")
+		fmt.Fprintln(flags.Output(), "Schemas are read from schema files or from pcap or pcapng captures.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return errors.New("schemadiff requires exactly two schema files or captures")
+	}
+
+	oldSchema, err := loadSchema(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	newSchema, err := loadSchema(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	diff := peer.DiffSchemas(oldSchema, newSchema)
+	if *ignoreIDs {
+		diff = diff.Without(peer.SchemaNetworkIDChanged)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(diff)
+	}
+	return diff.WriteText(os.Stdout)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "read":
+		err = readCommand(os.Args[2:])
+	case "live":
+		err = liveCommand(os.Args[2:])
+	case "schemadiff":
+		err = schemaDiffCommand(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "sala:", err.Error())
+		os.Exit(1)
+	}
+}